@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -12,17 +13,25 @@ import (
 
 	"omniapi/internal/adapters"
 	"omniapi/internal/api/handlers"
+	"omniapi/internal/auth"
+	"omniapi/internal/broker"
 	"omniapi/internal/config"
+	"omniapi/internal/connectors"
 	"omniapi/internal/database"
+	"omniapi/internal/domain"
+	"omniapi/internal/history"
+	"omniapi/internal/models"
 	"omniapi/internal/polling"
 	"omniapi/internal/queue/requester"
 	"omniapi/internal/queue/status"
+	"omniapi/internal/quota"
 	"omniapi/internal/router"
 	"omniapi/internal/services"
 	"omniapi/internal/websocket"
 
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func main() {
@@ -64,6 +73,13 @@ func main() {
 	// Inicializar servicios de MongoDB
 	handlers.InitServices()
 
+	// Inicializar autenticación (tokens firmados + sesiones en MongoDB)
+	if err := auth.Init(cfg.App.Auth); err != nil {
+		log.Fatalf("❌ Error initializing auth: %v", err)
+	}
+	fmt.Printf("✅ Auth initialized (issuer=%s, token_expiry=%s, refresh_expiry=%s)\n",
+		cfg.App.Auth.Issuer, cfg.App.Auth.TokenExpiry, cfg.App.Auth.RefreshExpiry)
+
 	// Verificar si existe un usuario administrador
 	fmt.Println("\n🔐 Checking admin user...")
 	adminExists, err := services.CheckAdminExists()
@@ -85,6 +101,11 @@ func main() {
 	fmt.Println("\n📡 Initializing Router...")
 	r := router.NewRouter()
 
+	// Secuencias por stream: continuar la numeración tras un reinicio
+	if err := r.SetSequenceStore(services.NewSequenceService()); err != nil {
+		log.Printf("⚠️  Warning: could not load stream sequences: %v", err)
+	}
+
 	// Iniciar router
 	if err := r.Start(ctx); err != nil {
 		log.Fatalf("❌ Error starting router: %v", err)
@@ -99,6 +120,10 @@ func main() {
 	requesters := make(map[string]requester.Requester) // Key: provider:tenantId:siteId
 	streamTracker := status.NewStreamTracker()
 
+	// Coordinador de failover cloud/ProcessAPI según políticas multi-conector
+	failover := router.NewFailoverCoordinator(r, streamTracker)
+	failoverConnectors := make(map[string][]router.ConnectorConfig) // Key: tenantId
+
 	for _, connCfg := range cfg.Connections {
 		// Solo procesar conexiones activas
 		if connCfg.Status != "active" {
@@ -116,13 +141,52 @@ func main() {
 		var strategy requester.Strategy
 		switch connCfg.TypeID {
 		case "scaleaq-cloud":
-			// Obtener credenciales de config
-			apiKey, _ := connCfg.Config["api_key"].(string)
 			endpoint, _ := connCfg.Config["endpoint"].(string)
-			strategy = requester.NewScaleAQCloudStrategy(endpoint, apiKey)
+
+			// Credenciales: username + secreto (via TokenManager) o api_key estática
+			var tokens requester.TokenSource
+			if username, _ := connCfg.Config["username"].(string); username != "" {
+				password, _ := connCfg.Config["__resolved_secret"].(string)
+				serviceID, err := primitive.ObjectIDFromHex(connCfg.ID)
+				if err != nil {
+					serviceID = primitive.NewObjectID()
+				}
+				tokens = services.NewServiceTokenSource(&models.ExternalService{
+					ID:          serviceID,
+					Code:        connCfg.ID,
+					Name:        connCfg.DisplayName,
+					ServiceType: "scaleaq",
+					BaseURL:     endpoint,
+					Credentials: &models.ServiceCredentials{
+						Username: username,
+						Password: password,
+					},
+				})
+			} else {
+				apiKey, _ := connCfg.Config["api_key"].(string)
+				if apiKey == "" {
+					apiKey, _ = connCfg.Config["__resolved_secret"].(string)
+				}
+				tokens = requester.StaticToken(apiKey)
+			}
+
+			scaleAQ := requester.NewScaleAQCloudStrategy(endpoint, tokens)
+			if scaleAQSiteID, _ := connCfg.Config["scaleaq_site_id"].(string); scaleAQSiteID != "" {
+				scaleAQ.SetSiteAlias(siteID, scaleAQSiteID)
+			}
+			strategy = scaleAQ
 		case "process-api":
 			endpoint, _ := connCfg.Config["endpoint"].(string)
-			strategy = requester.NewProcessAPIStrategy(endpoint)
+			processAPI := requester.NewProcessAPIStrategy(endpoint)
+			if apiKey, _ := connCfg.Config["api_key"].(string); apiKey != "" {
+				processAPI.SetAPIKey(apiKey)
+			} else if secret, _ := connCfg.Config["__resolved_secret"].(string); secret != "" {
+				processAPI.SetAPIKey(secret)
+			}
+			pageSize, _ := connCfg.Config["page_size"].(int)
+			maxPages, _ := connCfg.Config["max_pages"].(int)
+			processAPI.SetPagination(pageSize, maxPages)
+			strategy = processAPI
 		default:
 			// Usar NoOp para tipos no implementados o de prueba
 			strategy = requester.NewNoOpStrategy()
@@ -152,9 +216,16 @@ func main() {
 		// Crear requester
 		req := requester.NewSequentialRequester(reqConfig, strategy)
 
-		// Registrar callback para resultados → Router
+		// Fuente y prioridad del conector (cloud primero, ProcessAPI como fallback local)
+		source, priority := requester.SourceCloud, 100
+		if connCfg.TypeID == "process-api" {
+			source, priority = requester.SourceProcessAPI, 50
+		}
+
+		// Registrar callback para resultados → Failover → Router
+		connectorID := connCfg.ID
 		req.OnResult(func(result requester.Result) {
-			r.OnRequesterResult(result)
+			failover.HandleResult(connectorID, result)
 		})
 
 		// Iniciar requester
@@ -172,11 +243,20 @@ func main() {
 				SiteID:   siteID,
 				CageID:   nil, // Puede ser más específico según el conector
 				Metric:   metric,
-				Source:   string(requester.SourceCloud),
+				Source:   string(source),
 			}
 			streamTracker.RegisterStream(streamKey)
 		}
 
+		failover.Register(connectorID, siteID, source, req)
+		failoverConnectors[connCfg.TenantID] = append(failoverConnectors[connCfg.TenantID], router.ConnectorConfig{
+			ID:       connectorID,
+			Type:     connCfg.TypeID,
+			Priority: priority,
+			Weight:   1,
+			Enabled:  true,
+		})
+
 		// Guardar referencia
 		key := fmt.Sprintf("%s:%s:%s", connCfg.TypeID, connCfg.TenantID, siteID)
 		requesters[key] = req
@@ -192,6 +272,28 @@ func main() {
 
 	fmt.Printf("✅ %d Requesters initialized\n", len(requesters))
 
+	// Políticas multi-conector por tenant y kind
+	failoverPolicy := router.MultiConnectorPolicy(cfg.App.Requester.FailoverPolicy)
+	if failoverPolicy == "" {
+		failoverPolicy = router.PolicyFallback
+	}
+	for tenantID, connectors := range failoverConnectors {
+		tenantOID, err := primitive.ObjectIDFromHex(tenantID)
+		if err != nil {
+			log.Printf("⚠️  Tenant %s has no valid id, failover policy skipped", tenantID)
+			continue
+		}
+		for _, kind := range []domain.StreamKind{domain.StreamKindFeeding, domain.StreamKindBiometric, domain.StreamKindClimate} {
+			r.SetMultiConnectorPolicy(&router.MultiConnectorConfig{
+				TenantID:   tenantOID,
+				Kind:       kind,
+				Policy:     failoverPolicy,
+				Connectors: append([]router.ConnectorConfig(nil), connectors...),
+			})
+		}
+	}
+	fmt.Printf("✅ Failover policy '%s' configured for %d tenants\n", failoverPolicy, len(failoverConnectors))
+
 	// ═══════════════════════════════════════════════════════════
 	// FASE 3: Crear StatusPusher
 	// ═══════════════════════════════════════════════════════════
@@ -208,6 +310,10 @@ func main() {
 
 	// Registrar callback para heartbeats → Router
 	statusPusher.OnEmit(func(st status.Status) {
+		// Reportar la fuente que el failover tiene activa para el tenant y kind
+		if source, ok := failover.ActiveSource(st.TenantID, st.Metric); ok {
+			st.Source = source
+		}
 		r.OnStatusHeartbeat(st)
 	})
 
@@ -222,20 +328,206 @@ func main() {
 	// ═══════════════════════════════════════════════════════════
 	fmt.Println("\n🔌 Initializing WebSocket Hub...")
 	wsHub := websocket.NewHub(r)
+
+	// Autenticación de conexiones: tenant, capabilities y scopes por usuario
+	authService, err := auth.GetService()
+	if err != nil {
+		log.Fatalf("❌ Error getting auth service: %v", err)
+	}
+	wsTenants := make([]domain.Tenant, 0, len(cfg.Tenants))
+	for i := range cfg.Tenants {
+		tenant, err := cfg.Tenants[i].ToDomainTenant()
+		if err != nil || cfg.Tenants[i].ID != tenant.ID.Hex() {
+			log.Printf("⚠️  Tenant %s skipped for WebSocket access (invalid id)", cfg.Tenants[i].Name)
+			continue
+		}
+		wsTenants = append(wsTenants, *tenant)
+	}
+	accessResolver := auth.NewAccessResolver(authService, services.NewUserService().GetByID, wsTenants)
+	accessResolver.SetTenantLookup(auth.TenantLookup(quota.MongoTenantLoader()))
+	auth.SetAccessResolver(accessResolver)
+	wsHub.SetAccessResolver(accessResolver)
+
 	go wsHub.Run()
-	fmt.Println("✅ WebSocket Hub started")
+	fmt.Printf("✅ WebSocket Hub started (tenants with scopes: %d)\n", len(wsTenants))
+
+	// ═══════════════════════════════════════════════════════════
+	// FASE 4.3: Quotas por tenant (medición y límites)
+	// ═══════════════════════════════════════════════════════════
+	fmt.Println("\n📏 Initializing Quota Meter...")
+	quotaMeter := quota.GetMeter()
+	quotaMeter.SetLimits(cfg.App.Quotas.ToDomainQuotas(), wsTenants)
+	quotaMeter.SetTenantLoader(quota.MongoTenantLoader())
+	quotaMeter.SetCounter(quota.ResourceConnections, quota.CollectionCounter("external_services"))
+	quotaMeter.SetCounter(quota.ResourcePollingConfigs, quota.CollectionCounter("polling_configs"))
+	quotaMeter.Start(ctx, quota.NewMongoUsageStore())
+	wsHub.SetQuotaMeter(quotaMeter)
+	fmt.Printf("✅ Quota Meter started (default quotas: %d)\n", len(cfg.App.Quotas.Default))
+
+	// ═══════════════════════════════════════════════════════════
+	// FASE 4.4: Histórico de datos (colección time-series)
+	// ═══════════════════════════════════════════════════════════
+	fmt.Println("\n📚 Initializing History Store...")
+	historyStore := history.GetStore()
+	if err := historyStore.Start(ctx, cfg.App.Policies.DataRetention.Events); err != nil {
+		log.Printf("⚠️  Warning: could not start history store: %v", err)
+	}
+
+	// Cada evento DATA enrutado (incluye registros de recetas) → histórico y quota diaria
+	r.OnEventRouted(func(event *connectors.CanonicalEvent) {
+		historyStore.RecordEvent(event)
+		quotaMeter.Record(event.Envelope.Stream.TenantID.Hex(), quota.ResourceEventsPerDay)
+	})
+
+	// REPLAY de clientes WebSocket ← histórico
+	r.SetReplaySource(func(ctx context.Context, q router.ReplayQuery, fn func(*connectors.CanonicalEvent) error) (int, error) {
+		query := history.Query{From: q.From, To: q.To, AfterSeq: q.AfterSeq, UpToSeq: q.UpToSeq}
+		if len(q.Filters) > 0 && q.Filters[0].TenantID != nil {
+			query.TenantID = q.Filters[0].TenantID.Hex()
+		}
+		// Con un solo stream se filtra en MongoDB; con varios el router aplica los filtros
+		if q.Stream != nil {
+			query.Kind = string(q.Stream.Kind)
+			query.SiteID = q.Stream.SiteID
+			if q.Stream.CageID != nil {
+				query.CageID = *q.Stream.CageID
+			}
+		} else if len(q.Filters) == 1 {
+			filter := q.Filters[0]
+			if filter.Kind != nil {
+				query.Kind = string(*filter.Kind)
+			}
+			if filter.SiteID != nil {
+				query.SiteID = *filter.SiteID
+			}
+			if filter.CageID != nil {
+				query.CageID = *filter.CageID
+			}
+		}
+		return historyStore.Replay(ctx, query, fn)
+	})
 
 	// ═══════════════════════════════════════════════════════════
 	// FASE 4.5: Iniciar Polling Engine
 	// ═══════════════════════════════════════════════════════════
 	fmt.Println("\n🔄 Initializing Polling Engine...")
 	pollingEngine := polling.GetEngine()
+
+	// Resultados exitosos de polling → histórico
+	pollingEngine.OnResult(func(result polling.PollingResult) {
+		if !result.Success {
+			return
+		}
+		historyStore.RecordPoll(history.PollResult{
+			InstanceID: result.InstanceID,
+			EndpointID: result.EndpointID,
+			Label:      result.Label,
+			Provider:   result.Provider,
+			TenantID:   result.TenantID,
+			SiteID:     result.SiteID,
+			Data:       result.Data,
+			LatencyMS:  result.LatencyMS,
+			PolledAt:   result.PolledAt,
+			Partial:    result.Truncated,
+		})
+	})
+
+	// Registros normalizados por recetas → Router
+	pollingEngine.OnRecipeOutput(r.OnRecipeOutput)
+
 	if err := pollingEngine.Start(ctx); err != nil {
 		log.Printf("⚠️  Warning: could not start polling engine: %v", err)
 	} else {
 		fmt.Println("✅ Polling Engine started")
 	}
 
+	// ═══════════════════════════════════════════════════════════
+	// FASE 4.6: Rollups (ventanas agregadas publicadas a brokers)
+	// ═══════════════════════════════════════════════════════════
+	if len(cfg.App.Rollups) > 0 {
+		fmt.Println("\n🧮 Initializing Rollup outputs...")
+		brokerManager := pollingEngine.GetBrokerManager()
+		started := 0
+		for _, rc := range cfg.App.Rollups {
+			rollupConfig := rc
+			spec, err := router.ParseAggregateSpec(rollupConfig.Window, rollupConfig.Slide, rollupConfig.Fields, rollupConfig.Functions, rollupConfig.GroupBy)
+			if err != nil {
+				log.Printf("⚠️  Warning: invalid rollup %s: %v", rollupConfig.Name, err)
+				continue
+			}
+
+			filter := router.SubscriptionFilter{Where: rollupConfig.Where}
+			if rollupConfig.TenantID != "" {
+				tenantID, err := primitive.ObjectIDFromHex(rollupConfig.TenantID)
+				if err != nil {
+					log.Printf("⚠️  Warning: invalid tenant_id in rollup %s: %v", rollupConfig.Name, err)
+					continue
+				}
+				filter.TenantID = &tenantID
+			}
+			if rollupConfig.Kind != "" {
+				kind := domain.StreamKind(rollupConfig.Kind)
+				filter.Kind = &kind
+			}
+			if rollupConfig.FarmID != "" {
+				filter.FarmID = &rollupConfig.FarmID
+			}
+			if rollupConfig.SiteID != "" {
+				filter.SiteID = &rollupConfig.SiteID
+			}
+			if rollupConfig.Metric != "" {
+				filter.Metrics = []string{rollupConfig.Metric}
+			}
+
+			topicPattern := rollupConfig.Topic
+			if topicPattern == "" {
+				topicPattern = "omniapi/rollups/{tenant_id}/{kind}/{site}/{window}"
+			}
+
+			err = r.AddRollup(rollupConfig.Name, filter, *spec, func(event *connectors.CanonicalEvent) {
+				stream := event.Envelope.Stream
+				vars := map[string]string{
+					"name":      rollupConfig.Name,
+					"tenant_id": stream.TenantID.Hex(),
+					"kind":      string(stream.Kind),
+					"farm":      "all",
+					"site":      "all",
+					"cage":      "all",
+					"metric":    event.Kind,
+					"window":    spec.Window.String(),
+				}
+				if stream.FarmID != "" {
+					vars["farm"] = stream.FarmID
+				}
+				if stream.SiteID != "" {
+					vars["site"] = stream.SiteID
+				}
+				if stream.CageID != nil {
+					vars["cage"] = *stream.CageID
+				}
+
+				var payload map[string]interface{}
+				if err := json.Unmarshal(event.Payload, &payload); err != nil {
+					return
+				}
+				payload["tenant_id"] = stream.TenantID.Hex()
+				payload["kind"] = string(stream.Kind)
+				payload["farm_id"] = stream.FarmID
+				payload["site_id"] = stream.SiteID
+				payload["cage_id"] = stream.CageID
+				payload["ts"] = event.Envelope.Timestamp.UnixMilli()
+
+				brokerManager.PublishAsync(rollupConfig.BrokerID, broker.BuildTopic(topicPattern, vars), payload)
+			})
+			if err != nil {
+				log.Printf("⚠️  Warning: could not start rollup %s: %v", rollupConfig.Name, err)
+				continue
+			}
+			started++
+		}
+		fmt.Printf("✅ Rollup outputs started (%d/%d)\n", started, len(cfg.App.Rollups))
+	}
+
 	// ═══════════════════════════════════════════════════════════
 	// FASE 5: Iniciar actualización periódica de métricas
 	// ═══════════════════════════════════════════════════════════
@@ -280,6 +572,9 @@ func main() {
 		// Cancelar contexto para detener todos los componentes
 		cancel()
 
+		// Escribir los puntos pendientes del histórico
+		history.GetStore().Wait(5 * time.Second)
+
 		// Esperar un poco para que se completen las operaciones
 		time.Sleep(1 * time.Second)
 
@@ -299,69 +594,73 @@ func main() {
 
 	// Configurar rutas de autenticación
 	http.HandleFunc("/api/auth/login", handlers.CORSMiddleware(handlers.LoginHandler))
-	http.HandleFunc("/api/auth/register", handlers.CORSMiddleware(handlers.RegisterHandler))
+	http.HandleFunc("/api/auth/register", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.RegisterHandler)))
 	http.HandleFunc("/api/auth/setup/check", handlers.CORSMiddleware(handlers.CheckSetupHandler))
 	http.HandleFunc("/api/auth/setup", handlers.CORSMiddleware(handlers.SetupHandler))
+	http.HandleFunc("/api/auth/refresh", handlers.CORSMiddleware(handlers.RefreshHandler))
+	http.HandleFunc("/api/auth/logout", handlers.CORSMiddleware(handlers.RequireAuth(handlers.LogoutHandler)))
+	http.HandleFunc("/api/auth/me", handlers.CORSMiddleware(handlers.RequireAuth(handlers.MeHandler)))
 
 	// Configurar rutas de servicios externos
-	http.HandleFunc("/api/services", handlers.CORSMiddleware(handlers.GetServicesHandler))
-	http.HandleFunc("/api/services/get", handlers.CORSMiddleware(handlers.GetServiceHandler))
-	http.HandleFunc("/api/services/create", handlers.CORSMiddleware(handlers.CreateServiceHandler))
-	http.HandleFunc("/api/services/update", handlers.CORSMiddleware(handlers.UpdateServiceHandler))
-	http.HandleFunc("/api/services/delete", handlers.CORSMiddleware(handlers.DeleteServiceHandler))
-	http.HandleFunc("/api/services/test", handlers.CORSMiddleware(handlers.TestServiceConnectionHandler))
+	http.HandleFunc("/api/services", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetServicesHandler)))
+	http.HandleFunc("/api/services/get", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetServiceHandler)))
+	http.HandleFunc("/api/services/create", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.CreateServiceHandler)))
+	http.HandleFunc("/api/services/update", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.UpdateServiceHandler)))
+	http.HandleFunc("/api/services/delete", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.DeleteServiceHandler)))
+	http.HandleFunc("/api/services/test", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.TestServiceConnectionHandler)))
 
 	// Configurar rutas de tenants (empresas salmoneras)
-	http.HandleFunc("/api/tenants", handlers.CORSMiddleware(handlers.GetTenantsHandler))
-	http.HandleFunc("/api/tenants/get", handlers.CORSMiddleware(handlers.GetTenantHandler))
-	http.HandleFunc("/api/tenants/create", handlers.CORSMiddleware(handlers.CreateTenantHandler))
-	http.HandleFunc("/api/tenants/update", handlers.CORSMiddleware(handlers.UpdateTenantHandler))
-	http.HandleFunc("/api/tenants/delete", handlers.CORSMiddleware(handlers.DeleteTenantHandler))
+	http.HandleFunc("/api/tenants", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetTenantsHandler)))
+	http.HandleFunc("/api/tenants/get", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetTenantHandler)))
+	http.HandleFunc("/api/tenants/create", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.CreateTenantHandler)))
+	http.HandleFunc("/api/tenants/update", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.UpdateTenantHandler)))
+	http.HandleFunc("/api/tenants/delete", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.DeleteTenantHandler)))
 
 	// Configurar rutas de sites (centros de cultivo)
-	http.HandleFunc("/api/sites", handlers.CORSMiddleware(handlers.GetSitesHandler))
-	http.HandleFunc("/api/sites/get", handlers.CORSMiddleware(handlers.GetSiteHandler))
-	http.HandleFunc("/api/sites/create", handlers.CORSMiddleware(handlers.CreateSiteHandler))
-	http.HandleFunc("/api/sites/update", handlers.CORSMiddleware(handlers.UpdateSiteHandler))
-	http.HandleFunc("/api/sites/delete", handlers.CORSMiddleware(handlers.DeleteSiteHandler))
+	http.HandleFunc("/api/sites", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetSitesHandler)))
+	http.HandleFunc("/api/sites/get", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetSiteHandler)))
+	http.HandleFunc("/api/sites/create", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.CreateSiteHandler)))
+	http.HandleFunc("/api/sites/update", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.UpdateSiteHandler)))
+	http.HandleFunc("/api/sites/delete", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.DeleteSiteHandler)))
 
 	// Configurar rutas de external services (servicios externos)
-	http.HandleFunc("/api/external-services", handlers.CORSMiddleware(handlers.GetExternalServicesHandler))
-	http.HandleFunc("/api/external-services/get", handlers.CORSMiddleware(handlers.GetExternalServiceHandler))
-	http.HandleFunc("/api/external-services/create", handlers.CORSMiddleware(handlers.CreateExternalServiceHandler))
-	http.HandleFunc("/api/external-services/update", handlers.CORSMiddleware(handlers.UpdateExternalServiceHandler))
-	http.HandleFunc("/api/external-services/delete", handlers.CORSMiddleware(handlers.DeleteExternalServiceHandler))
-	http.HandleFunc("/api/external-services/test", handlers.CORSMiddleware(handlers.TestExternalServiceConnectionHandler))
+	http.HandleFunc("/api/external-services", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetExternalServicesHandler)))
+	http.HandleFunc("/api/external-services/get", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetExternalServiceHandler)))
+	http.HandleFunc("/api/external-services/create", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.CreateExternalServiceHandler)))
+	http.HandleFunc("/api/external-services/update", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.UpdateExternalServiceHandler)))
+	http.HandleFunc("/api/external-services/delete", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.DeleteExternalServiceHandler)))
+	http.HandleFunc("/api/external-services/test", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.TestExternalServiceConnectionHandler)))
 
 	// Configurar rutas de MongoDB API
-	http.HandleFunc("/api/users", handlers.GetUsersHandler)
-	http.HandleFunc("/api/users/create", handlers.CreateUserHandler)
-	http.HandleFunc("/api/users/get", handlers.GetUserHandler)
-	http.HandleFunc("/api/users/update", handlers.UpdateUserHandler)
-	http.HandleFunc("/api/users/delete", handlers.DeleteUserHandler)
-	http.HandleFunc("/api/messages", handlers.GetMessagesHandler)
-	http.HandleFunc("/api/messages/create", handlers.CreateMessageHandler)
-	http.HandleFunc("/api/database/stats", handlers.GetDatabaseStatsHandler)
+	http.HandleFunc("/api/users", handlers.RequireRole(auth.RoleAdmin, handlers.GetUsersHandler))
+	http.HandleFunc("/api/users/create", handlers.RequireRole(auth.RoleAdmin, handlers.CreateUserHandler))
+	http.HandleFunc("/api/users/get", handlers.RequireRole(auth.RoleAdmin, handlers.GetUserHandler))
+	http.HandleFunc("/api/users/update", handlers.RequireRole(auth.RoleAdmin, handlers.UpdateUserHandler))
+	http.HandleFunc("/api/users/delete", handlers.RequireRole(auth.RoleAdmin, handlers.DeleteUserHandler))
+	http.HandleFunc("/api/messages", handlers.RequireRole(auth.RoleViewer, handlers.GetMessagesHandler))
+	http.HandleFunc("/api/messages/create", handlers.RequireRole(auth.RoleOperator, handlers.CreateMessageHandler))
+	http.HandleFunc("/api/database/stats", handlers.RequireRole(auth.RoleAdmin, handlers.GetDatabaseStatsHandler))
 
 	// Configurar rutas de Schema Validation
-	http.HandleFunc("/api/schemas", handlers.ListSchemasHandler)
-	http.HandleFunc("/api/schemas/get", handlers.GetSchemaHandler)
-	http.HandleFunc("/api/schemas/validate", handlers.ValidateSchemaHandler)
+	http.HandleFunc("/api/schemas", handlers.RequireRole(auth.RoleViewer, handlers.ListSchemasHandler))
+	http.HandleFunc("/api/schemas/get", handlers.RequireRole(auth.RoleViewer, handlers.GetSchemaHandler))
+	http.HandleFunc("/api/schemas/validate", handlers.RequireRole(auth.RoleViewer, handlers.ValidateSchemaHandler))
 
 	// Configurar rutas del builder/discovery
-	http.HandleFunc("/api/discovery/runs", handlers.CORSMiddleware(handlers.DiscoveryRunsHandler))
-	http.HandleFunc("/api/discovery/run", handlers.CORSMiddleware(handlers.RunDiscoveryHandler))
+	http.HandleFunc("/api/discovery/runs", handlers.CORSMiddleware(handlers.RequireRoles(auth.RoleViewer, auth.RoleOperator, handlers.DiscoveryRunsHandler)))
+	http.HandleFunc("/api/discovery/run", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.RunDiscoveryHandler)))
 
 	// Configurar rutas de Polling Engine
-	http.HandleFunc("/api/polling/start", handlers.CORSMiddleware(handlers.StartPollingHandler))
-	http.HandleFunc("/api/polling/stop", handlers.CORSMiddleware(handlers.StopPollingHandler))
-	http.HandleFunc("/api/polling/status", handlers.CORSMiddleware(handlers.GetPollingStatusHandler))
-	http.HandleFunc("/api/polling/configs", handlers.CORSMiddleware(handlers.ListPollingConfigsHandler))
-	http.HandleFunc("/api/polling/config", handlers.CORSMiddleware(handlers.GetPollingConfigHandler))
-	http.HandleFunc("/api/polling/last-result/", handlers.CORSMiddleware(handlers.GetLastResultHandler))
+	http.HandleFunc("/api/polling/start", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.StartPollingHandler)))
+	http.HandleFunc("/api/polling/stop", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.StopPollingHandler)))
+	http.HandleFunc("/api/polling/status", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetPollingStatusHandler)))
+	http.HandleFunc("/api/polling/cluster", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetPollingClusterHandler)))
+	http.HandleFunc("/api/polling/configs", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.ListPollingConfigsHandler)))
+	http.HandleFunc("/api/polling/config", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetPollingConfigHandler)))
+	http.HandleFunc("/api/polling/last-result/", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetLastResultHandler)))
 
 	// Configurar rutas de Recipes (Data Converter)
-	http.HandleFunc("/api/recipes", handlers.CORSMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/recipes", handlers.CORSMiddleware(handlers.RequireRoles(auth.RoleViewer, auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
 			handlers.ListRecipesHandler(w, r)
@@ -372,8 +671,9 @@ func main() {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	}))
-	http.HandleFunc("/api/recipes/", handlers.CORSMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	})))
+	http.HandleFunc("/api/recipes/dry-run", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.DryRunRecipeHandler)))
+	http.HandleFunc("/api/recipes/", handlers.CORSMiddleware(handlers.RequireRoles(auth.RoleViewer, auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
 			handlers.GetRecipeHandler(w, r)
@@ -386,15 +686,21 @@ func main() {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
+
+	// Configurar rutas de Histórico
+	http.HandleFunc("/api/history", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetHistoryHandler)))
+	http.HandleFunc("/api/history/downsample", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetHistoryDownsampleHandler)))
+	http.HandleFunc("/api/quotas/usage", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetQuotaUsageHandler)))
+	http.HandleFunc("/api/history/stats", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetHistoryStatsHandler)))
 
 	// Configurar rutas de Broker/MQTT
-	http.HandleFunc("/api/brokers", handlers.CORSMiddleware(handlers.ListBrokersHandler))
-	http.HandleFunc("/api/brokers/add", handlers.CORSMiddleware(handlers.AddBrokerHandler))
-	http.HandleFunc("/api/brokers/test", handlers.CORSMiddleware(handlers.TestBrokerConnectionHandler))
-	http.HandleFunc("/api/brokers/templates", handlers.CORSMiddleware(handlers.GetTopicTemplatesHandler))
+	http.HandleFunc("/api/brokers", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.ListBrokersHandler)))
+	http.HandleFunc("/api/brokers/add", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, handlers.AddBrokerHandler)))
+	http.HandleFunc("/api/brokers/test", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, handlers.TestBrokerConnectionHandler)))
+	http.HandleFunc("/api/brokers/templates", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, handlers.GetTopicTemplatesHandler)))
 	// Para rutas con ID dinámico usamos un handler que rutea según método
-	http.HandleFunc("/api/brokers/", handlers.CORSMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/brokers/", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "PUT", "PATCH":
 			handlers.UpdateBrokerHandler(w, r)
@@ -405,15 +711,23 @@ func main() {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	}))
+	})))
+
+	// Configurar rutas de Requester (failover cloud/ProcessAPI)
+	http.HandleFunc("/api/requester/dispatch", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		handlers.DispatchRequestHandler(failover, w, r)
+	})))
+	http.HandleFunc("/api/requester/failover", handlers.CORSMiddleware(handlers.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetFailoverStatusHandler(failover, w, r)
+	})))
 
 	// Configurar rutas WebSocket
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		websocket.WSHandler(wsHub, w, r)
 	})
-	http.HandleFunc("/ws/stats", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/ws/stats", handlers.RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
 		websocket.WSStatsHandler(wsHub, w, r)
-	})
+	}))
 	http.HandleFunc("/ws/test", websocket.WSTestHandler)
 
 	// Página de integración WebSocket
@@ -458,6 +772,15 @@ func main() {
 	fmt.Printf("⏹️  Stop Polling: POST http://localhost:%s/api/polling/stop\n", cfg.Port)
 	fmt.Printf("📊 Polling Status: http://localhost:%s/api/polling/status\n", cfg.Port)
 	fmt.Printf("📋 List Configs: http://localhost:%s/api/polling/configs\n", cfg.Port)
+	fmt.Printf("🔀 Polling Cluster: http://localhost:%s/api/polling/cluster\n", cfg.Port)
+	fmt.Println("───────────── Requester Endpoints ─────────────────")
+	fmt.Printf("📤 Dispatch: POST http://localhost:%s/api/requester/dispatch\n", cfg.Port)
+	fmt.Printf("🔀 Failover: http://localhost:%s/api/requester/failover\n", cfg.Port)
+	fmt.Println("───────────── History Endpoints ───────────────────")
+	fmt.Printf("📚 History: http://localhost:%s/api/history\n", cfg.Port)
+	fmt.Printf("📉 Downsample: http://localhost:%s/api/history/downsample?field=<field>&interval=5m\n", cfg.Port)
+	fmt.Println("───────────── Quota Endpoints ─────────────────────")
+	fmt.Printf("📏 Quota Usage: http://localhost:%s/api/quotas/usage\n", cfg.Port)
 	fmt.Println("═══════════════════════════════════════════════════")
 
 	// Iniciar servidor
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"omniapi/internal/config"
+	"omniapi/internal/crypto"
+	"omniapi/internal/database"
+	"omniapi/internal/services"
+
+	"github.com/joho/godotenv"
+)
+
+// rotate-secrets re-encripta los secretos guardados en MongoDB con la clave activa del keyring.
+// Por defecto es un dry-run: solo reporta. Con -apply escribe los cambios.
+//
+//	ENCRYPTION_KEY=<clave antigua> ENCRYPTION_KEYS=2026-10:<clave nueva> ENCRYPTION_ACTIVE_KEY_ID=2026-10 \
+//	    go run ./cmd/tools/rotate-secrets -apply
+func main() {
+	apply := flag.Bool("apply", false, "escribir los secretos re-encriptados (por defecto solo reporta)")
+	flag.Parse()
+
+	if *apply {
+		fmt.Println("🔐 Re-encriptando secretos...")
+	} else {
+		fmt.Println("🔐 Re-encriptación de secretos (dry-run, usar -apply para escribir)...")
+	}
+
+	// Cargar .env
+	if err := godotenv.Load(); err != nil {
+		log.Printf("⚠️  No se encontró archivo .env")
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("❌ Error cargando configuración: %v", err)
+	}
+
+	keyring, err := crypto.NewKeyringFromEnv()
+	if err != nil {
+		log.Fatalf("❌ Error inicializando keyring: %v", err)
+	}
+	crypto.InitKeyring(keyring)
+
+	// Conectar a MongoDB
+	timeout, _ := time.ParseDuration(cfg.MongoDB.Timeout)
+	mongoConfig := database.MongoConfig{
+		URI:      cfg.MongoDB.URI,
+		Database: cfg.MongoDB.Database,
+		Timeout:  timeout,
+	}
+
+	if err := database.Connect(mongoConfig); err != nil {
+		log.Fatalf("❌ Error conectando a MongoDB: %v", err)
+	}
+	defer database.Disconnect()
+
+	report, err := services.NewSecretRotationService(keyring).Run(!*apply)
+	if err != nil {
+		log.Fatalf("❌ Error re-encriptando secretos: %v", err)
+	}
+
+	fmt.Printf("\n🔑 Clave activa: %s\n", report.ActiveKeyID)
+	for _, c := range report.Collections {
+		fmt.Printf("\n📦 %s\n", c.Collection)
+		fmt.Printf("   Documentos: %d, secretos: %d\n", c.DocumentsScanned, c.Secrets)
+
+		keys := make([]string, 0, len(c.ByKey))
+		for key := range c.ByKey {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("   - %s: %d\n", key, c.ByKey[key])
+		}
+
+		if report.DryRun {
+			fmt.Printf("   Pendientes de migrar: %d\n", c.Pending)
+		} else {
+			fmt.Printf("   Migrados: %d/%d (%d documentos)\n", c.Migrated, c.Pending, c.DocumentsUpdated)
+		}
+		for _, failure := range c.Failures {
+			fmt.Printf("   ❌ %s.%s: %s\n", failure.DocumentID, failure.Field, failure.Error)
+		}
+	}
+
+	fmt.Printf("\n⏱️  Duración: %s\n", report.Duration)
+	if failed := report.Failed(); failed > 0 {
+		fmt.Printf("⚠️  %d secretos no se pudieron migrar\n", failed)
+		database.Disconnect()
+		os.Exit(1)
+	}
+	fmt.Println("✅ Listo")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"omniapi/internal/crypto"
+
+	"github.com/joho/godotenv"
+)
+
+// seal-secret cifra un valor con la clave activa para el archivo de secretos del proveedor "encfile".
+// El valor se lee de stdin para que no quede en el historial de la shell:
+//
+//	echo -n "s3cr3t" | go run ./cmd/tools/seal-secret -name innovex_client_secret >> configs/secrets.enc.yaml
+func main() {
+	name := flag.String("name", "", "nombre del secreto (key en secrets.enc.yaml)")
+	flag.Parse()
+
+	if *name == "" {
+		log.Fatalf("❌ -name es obligatorio")
+	}
+
+	// Cargar .env
+	if err := godotenv.Load(); err != nil {
+		log.Printf("⚠️  No se encontró archivo .env")
+	}
+
+	cryptoService, err := crypto.GetService()
+	if err != nil {
+		log.Fatalf("❌ Error inicializando servicio de encriptación: %v", err)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	value, err := reader.ReadString('\n')
+	if err != nil && value == "" {
+		log.Fatalf("❌ No se recibió ningún valor por stdin")
+	}
+	value = strings.TrimRight(value, "\r\n")
+
+	encrypted, err := cryptoService.Encrypt(value)
+	if err != nil {
+		log.Fatalf("❌ Error cifrando secreto: %v", err)
+	}
+
+	fmt.Printf("%s: %q\n", *name, encrypted)
+}
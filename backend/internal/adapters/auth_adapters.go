@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"omniapi/internal/config"
 	"omniapi/internal/crypto"
 	"omniapi/internal/models"
 )
@@ -30,6 +31,22 @@ type AuthAdapter interface {
 	GetServiceType() string
 }
 
+// RefreshableAuthAdapter adaptador que puede renovar el token con un refresh token (OAuth2)
+type RefreshableAuthAdapter interface {
+	AuthAdapter
+	Refresh(service *models.ExternalService, refreshToken string) (*TokenResponse, error)
+}
+
+// RequestAuthorizer adaptador que define cómo se aplica el token a cada request (header propio, firma HMAC)
+type RequestAuthorizer interface {
+	Authorize(req *http.Request, service *models.ExternalService, token string) error
+}
+
+// ConnectionTester adaptador con una verificación propia para /api/external-services/test
+type ConnectionTester interface {
+	TestConnection(service *models.ExternalService) (*TokenResponse, error)
+}
+
 // ============================================================
 // ScaleAQ Auth Adapter (Bearer Token)
 // ============================================================
@@ -64,6 +81,10 @@ func (a *ScaleAQAuthAdapter) Authenticate(service *models.ExternalService) (*Tok
 		}
 	}
 
+	if decryptedPassword, err = resolveCredentialRef(service.Credentials.PasswordRef, decryptedPassword); err != nil {
+		return nil, fmt.Errorf("error resolviendo password: %w", err)
+	}
+
 	if isBcryptHash(decryptedPassword) {
 		return nil, fmt.Errorf("el password de ScaleAQ fue almacenado con un formato anterior no reversible; vuelve a guardar el servicio con la clave actual")
 	}
@@ -165,15 +186,16 @@ func (a *InnovexAuthAdapter) GetServiceType() string {
 	return "innovex"
 }
 
-func (a *InnovexAuthAdapter) Authenticate(service *models.ExternalService) (*TokenResponse, error) {
+// credentials retorna password y client secret en claro (descifrados o resueltos desde su referencia)
+func (a *InnovexAuthAdapter) credentials(service *models.ExternalService) (string, string, error) {
 	if service.Credentials == nil {
-		return nil, fmt.Errorf("credenciales no configuradas")
+		return "", "", fmt.Errorf("credenciales no configuradas")
 	}
 
 	// Desencriptar credenciales para uso en API externa
 	cryptoService, err := crypto.GetService()
 	if err != nil {
-		return nil, fmt.Errorf("error inicializando crypto service: %w", err)
+		return "", "", fmt.Errorf("error inicializando crypto service: %w", err)
 	}
 
 	// Desencriptar campos sensibles
@@ -207,29 +229,66 @@ func (a *InnovexAuthAdapter) Authenticate(service *models.ExternalService) (*Tok
 		}
 	}
 
+	if decryptedPassword, err = resolveCredentialRef(service.Credentials.PasswordRef, decryptedPassword); err != nil {
+		return "", "", fmt.Errorf("error resolviendo password: %w", err)
+	}
+	if decryptedClientSecret, err = resolveCredentialRef(service.Credentials.ClientSecretRef, decryptedClientSecret); err != nil {
+		return "", "", fmt.Errorf("error resolviendo client secret: %w", err)
+	}
+
 	if isBcryptHash(decryptedPassword) {
-		return nil, fmt.Errorf("el password de Innovex fue almacenado con un formato anterior no reversible; vuelve a guardar el servicio con la clave actual")
+		return "", "", fmt.Errorf("el password de Innovex fue almacenado con un formato anterior no reversible; vuelve a guardar el servicio con la clave actual")
 	}
 
 	if isBcryptHash(decryptedClientSecret) {
-		return nil, fmt.Errorf("el client secret de Innovex fue almacenado con un formato anterior no reversible; vuelve a guardar el servicio con la clave actual")
+		return "", "", fmt.Errorf("el client secret de Innovex fue almacenado con un formato anterior no reversible; vuelve a guardar el servicio con la clave actual")
 	}
 
-	// Endpoint de autenticación Innovex - evitar duplicar path si ya está en base_url
-	authURL := service.BaseURL
-	if !strings.Contains(service.BaseURL, "/api_register/token") {
-		authURL = fmt.Sprintf("%s/api_register/token/", strings.TrimSuffix(service.BaseURL, "/"))
-	}
+	return decryptedPassword, decryptedClientSecret, nil
+}
 
-	fmt.Printf("🔗 Innovex Auth URL: %s\n", authURL)
+func (a *InnovexAuthAdapter) Authenticate(service *models.ExternalService) (*TokenResponse, error) {
+	password, clientSecret, err := a.credentials(service)
+	if err != nil {
+		return nil, err
+	}
 
 	// Preparar form data (application/x-www-form-urlencoded)
 	formData := url.Values{}
 	formData.Set("grant_type", "password")
 	formData.Set("client_id", service.Credentials.ClientID)
-	formData.Set("client_secret", decryptedClientSecret)
+	formData.Set("client_secret", clientSecret)
 	formData.Set("username", service.Credentials.Username)
-	formData.Set("password", decryptedPassword)
+	formData.Set("password", password)
+
+	return a.requestToken(service, formData)
+}
+
+// Refresh intercambia el refresh token por un nuevo access token (grant_type=refresh_token)
+func (a *InnovexAuthAdapter) Refresh(service *models.ExternalService, refreshToken string) (*TokenResponse, error) {
+	_, clientSecret, err := a.credentials(service)
+	if err != nil {
+		return nil, err
+	}
+
+	formData := url.Values{}
+	formData.Set("grant_type", "refresh_token")
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("client_id", service.Credentials.ClientID)
+	formData.Set("client_secret", clientSecret)
+
+	return a.requestToken(service, formData)
+}
+
+// requestToken envía el formulario al endpoint de tokens de Innovex
+func (a *InnovexAuthAdapter) requestToken(service *models.ExternalService, formData url.Values) (*TokenResponse, error) {
+	// Endpoint de autenticación Innovex - evitar duplicar path si ya está en base_url
+	authURL := service.BaseURL
+	if !strings.Contains(service.BaseURL, "/api_register/token") {
+		authURL = fmt.Sprintf("%s/api_register/token/", strings.TrimSuffix(service.BaseURL, "/"))
+	}
+
+	fmt.Printf("🔗 Innovex Auth URL: %s\n", authURL)
 
 	// Crear request
 	req, err := http.NewRequest("POST", authURL, strings.NewReader(formData.Encode()))
@@ -305,13 +364,31 @@ func (a *APIKeyAuthAdapter) GetServiceType() string {
 }
 
 func (a *APIKeyAuthAdapter) Authenticate(service *models.ExternalService) (*TokenResponse, error) {
-	if service.Credentials == nil || service.Credentials.APIKey == "" {
+	if service.Credentials == nil || (service.Credentials.APIKey == "" && service.Credentials.APIKeyRef == "") {
 		return nil, fmt.Errorf("API Key no configurada")
 	}
 
+	apiKey := service.Credentials.APIKey
+	if apiKey != "" {
+		cryptoService, err := crypto.GetService()
+		if err != nil {
+			return nil, fmt.Errorf("error inicializando crypto service: %w", err)
+		}
+		if cryptoService.IsEncrypted(apiKey) {
+			if apiKey, err = cryptoService.Decrypt(apiKey); err != nil {
+				return nil, fmt.Errorf("error desencriptando API Key: %w", err)
+			}
+		}
+	}
+
+	apiKey, err := resolveCredentialRef(service.Credentials.APIKeyRef, apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("error resolviendo API Key: %w", err)
+	}
+
 	// Para API Key, el "token" es la key misma (no caduca)
 	tokenResp := &TokenResponse{
-		AccessToken: service.Credentials.APIKey,
+		AccessToken: apiKey,
 		TokenType:   "ApiKey",
 		ExpiresIn:   0,                                          // No expira
 		ExpiresAt:   time.Now().Add(100 * 365 * 24 * time.Hour), // 100 años
@@ -332,11 +409,32 @@ func GetAuthAdapter(serviceType string) (AuthAdapter, error) {
 		return NewInnovexAuthAdapter(), nil
 	case "apikey":
 		return NewAPIKeyAuthAdapter(), nil
+	case "custom":
+		return NewConfigurableAuthAdapter(), nil
 	default:
 		return nil, fmt.Errorf("tipo de servicio no soportado: %s", serviceType)
 	}
 }
 
+// AuthorizeRequest aplica el token a una request hacia el servicio (por defecto "Authorization: Bearer <token>")
+func AuthorizeRequest(req *http.Request, service *models.ExternalService, token string) error {
+	if adapter, err := GetAuthAdapter(service.ServiceType); err == nil {
+		if authorizer, ok := adapter.(RequestAuthorizer); ok {
+			return authorizer.Authorize(req, service, token)
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// resolveCredentialRef resuelve la referencia a un secret provider; sin referencia retorna el valor almacenado
+func resolveCredentialRef(ref, stored string) (string, error) {
+	if ref == "" {
+		return stored, nil
+	}
+	return config.GetSecretRegistry().ResolveServiceRef(ref)
+}
+
 func isBcryptHash(value string) bool {
 	return strings.HasPrefix(value, "$2a$") || strings.HasPrefix(value, "$2b$") || strings.HasPrefix(value, "$2y$")
 }
@@ -0,0 +1,593 @@
+package adapters
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"omniapi/internal/crypto"
+	"omniapi/internal/jsonpath"
+	"omniapi/internal/models"
+)
+
+// ============================================================
+// Configurable Auth Adapter (declarativo vía ExternalService.Config["auth"])
+// ============================================================
+
+// Flujos de autenticación soportados por el adaptador configurable
+const (
+	AuthFlowClientCredentials = "oauth2_client_credentials"
+	AuthFlowPassword          = "oauth2_password"
+	AuthFlowBasic             = "basic"
+	AuthFlowHMAC              = "hmac"
+	AuthFlowLogin             = "login"
+)
+
+// ConfigurableAuthConfig configuración declarativa de autenticación (service.Config["auth"]).
+//
+// Los valores de login.body, hmac.string_to_sign y header_format aceptan placeholders:
+// {username}, {password}, {client_id}, {client_secret}, {api_key}, {token}, y en HMAC además
+// {method}, {path}, {query}, {timestamp}, {nonce} y {body_sha256}.
+type ConfigurableAuthConfig struct {
+	Flow string `json:"flow"`
+
+	// OAuth2 y login: endpoint de tokens (relativo a base_url o absoluto)
+	TokenURL   string `json:"token_url,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	Audience   string `json:"audience,omitempty"`
+	ClientAuth string `json:"client_auth,omitempty"` // body (default) | basic
+
+	// Login personalizado
+	Login *LoginFlowConfig `json:"login,omitempty"`
+
+	// HMAC
+	HMAC *HMACConfig `json:"hmac,omitempty"`
+
+	// Cómo se envía el token en cada request (default: "Authorization: Bearer {token}")
+	Header       string `json:"header,omitempty"`
+	HeaderFormat string `json:"header_format,omitempty"`
+
+	// Path relativo a base_url que /api/external-services/test consulta con la autenticación aplicada
+	TestPath string `json:"test_path,omitempty"`
+}
+
+// LoginFlowConfig endpoint de login propio del proveedor
+type LoginFlowConfig struct {
+	Method            string            `json:"method,omitempty"`      // default POST
+	BodyFormat        string            `json:"body_format,omitempty"` // json (default) | form
+	Body              map[string]string `json:"body,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	TokenPath         string            `json:"token_path"`                   // ruta en el JSON ("data.accessToken")
+	ExpiresInPath     string            `json:"expires_in_path,omitempty"`    // segundos hasta la expiración
+	RefreshTokenPath  string            `json:"refresh_token_path,omitempty"` // opcional
+	DefaultExpiresInS int               `json:"default_expires_in,omitempty"` // default 3600
+}
+
+// HMACConfig firma de cada request con client_secret (o api_key)
+type HMACConfig struct {
+	Algorithm       string `json:"algorithm,omitempty"` // sha256 (default) | sha1 | sha512
+	Encoding        string `json:"encoding,omitempty"`  // hex (default) | base64
+	SignatureHeader string `json:"signature_header,omitempty"`
+	SignatureFormat string `json:"signature_format,omitempty"` // default "{signature}"
+	KeyIDHeader     string `json:"key_id_header,omitempty"`    // header con client_id (opcional)
+	TimestampHeader string `json:"timestamp_header,omitempty"` // header con el timestamp unix (opcional)
+	NonceHeader     string `json:"nonce_header,omitempty"`     // header con un nonce (opcional)
+	StringToSign    string `json:"string_to_sign,omitempty"`   // default "{method}\n{path}\n{timestamp}\n{body_sha256}"
+}
+
+// nonExpiringTokenTTL vigencia de los "tokens" de flujos sin sesión (basic, hmac)
+const nonExpiringTokenTTL = 100 * 365 * 24 * time.Hour
+
+// ConfigurableAuthAdapter adaptador para proveedores nuevos configurado sin cambios de código
+type ConfigurableAuthAdapter struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewConfigurableAuthAdapter() *ConfigurableAuthAdapter {
+	return &ConfigurableAuthAdapter{
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (a *ConfigurableAuthAdapter) GetServiceType() string {
+	return "custom"
+}
+
+// ParseAuthConfig lee y valida service.Config["auth"]
+func ParseAuthConfig(config map[string]interface{}) (*ConfigurableAuthConfig, error) {
+	raw, ok := config["auth"]
+	if !ok || raw == nil {
+		return nil, fmt.Errorf("config.auth es requerido para servicios custom")
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("config.auth inválido: %w", err)
+	}
+
+	var cfg ConfigurableAuthConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("config.auth inválido: %w", err)
+	}
+	cfg.Flow = strings.ToLower(strings.TrimSpace(cfg.Flow))
+
+	switch cfg.Flow {
+	case AuthFlowClientCredentials, AuthFlowPassword:
+		if cfg.TokenURL == "" {
+			return nil, fmt.Errorf("config.auth.token_url es requerido para %s", cfg.Flow)
+		}
+		if cfg.ClientAuth != "" && cfg.ClientAuth != "body" && cfg.ClientAuth != "basic" {
+			return nil, fmt.Errorf("config.auth.client_auth debe ser 'body' o 'basic'")
+		}
+	case AuthFlowBasic:
+	case AuthFlowHMAC:
+		if cfg.HMAC == nil || cfg.HMAC.SignatureHeader == "" {
+			return nil, fmt.Errorf("config.auth.hmac.signature_header es requerido")
+		}
+		if _, err := hmacHash(cfg.HMAC.Algorithm); err != nil {
+			return nil, err
+		}
+		if cfg.HMAC.Encoding != "" && cfg.HMAC.Encoding != "hex" && cfg.HMAC.Encoding != "base64" {
+			return nil, fmt.Errorf("config.auth.hmac.encoding debe ser 'hex' o 'base64'")
+		}
+	case AuthFlowLogin:
+		if cfg.TokenURL == "" {
+			return nil, fmt.Errorf("config.auth.token_url es requerido para login")
+		}
+		if cfg.Login == nil || cfg.Login.TokenPath == "" {
+			return nil, fmt.Errorf("config.auth.login.token_path es requerido")
+		}
+		if cfg.Login.BodyFormat != "" && cfg.Login.BodyFormat != "json" && cfg.Login.BodyFormat != "form" {
+			return nil, fmt.Errorf("config.auth.login.body_format debe ser 'json' o 'form'")
+		}
+	case "":
+		return nil, fmt.Errorf("config.auth.flow es requerido")
+	default:
+		return nil, fmt.Errorf("flujo de autenticación no soportado: %s", cfg.Flow)
+	}
+
+	if cfg.HeaderFormat != "" && cfg.Flow != AuthFlowHMAC && !strings.Contains(cfg.HeaderFormat, "{token}") {
+		return nil, fmt.Errorf("config.auth.header_format debe incluir {token}")
+	}
+
+	return &cfg, nil
+}
+
+// Authenticate obtiene el token según el flujo configurado
+func (a *ConfigurableAuthAdapter) Authenticate(service *models.ExternalService) (*TokenResponse, error) {
+	cfg, err := ParseAuthConfig(service.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := resolveCredentials(service)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Flow {
+	case AuthFlowClientCredentials, AuthFlowPassword:
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		if cfg.Flow == AuthFlowPassword {
+			form.Set("grant_type", "password")
+			form.Set("username", creds["username"])
+			form.Set("password", creds["password"])
+		}
+		if cfg.Scope != "" {
+			form.Set("scope", cfg.Scope)
+		}
+		if cfg.Audience != "" {
+			form.Set("audience", cfg.Audience)
+		}
+		return a.oauth2Token(service, cfg, creds, form)
+
+	case AuthFlowBasic:
+		if creds["username"] == "" {
+			return nil, fmt.Errorf("credentials.username es requerido para basic")
+		}
+		return &TokenResponse{
+			AccessToken: base64.StdEncoding.EncodeToString([]byte(creds["username"] + ":" + creds["password"])),
+			TokenType:   "Basic",
+			ExpiresAt:   a.now().Add(nonExpiringTokenTTL),
+		}, nil
+
+	case AuthFlowHMAC:
+		if hmacSecret(creds) == "" {
+			return nil, fmt.Errorf("credentials.client_secret o api_key es requerido para hmac")
+		}
+		// Sin sesión: cada request se firma en AuthorizeRequest
+		return &TokenResponse{
+			AccessToken: creds["client_id"],
+			TokenType:   "HMAC",
+			ExpiresAt:   a.now().Add(nonExpiringTokenTTL),
+		}, nil
+
+	default:
+		return a.login(service, cfg, creds)
+	}
+}
+
+// Refresh renueva con refresh token (solo flujos OAuth2)
+func (a *ConfigurableAuthAdapter) Refresh(service *models.ExternalService, refreshToken string) (*TokenResponse, error) {
+	cfg, err := ParseAuthConfig(service.Config)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Flow != AuthFlowClientCredentials && cfg.Flow != AuthFlowPassword {
+		return nil, fmt.Errorf("el flujo %s no soporta refresh token", cfg.Flow)
+	}
+
+	creds, err := resolveCredentials(service)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return a.oauth2Token(service, cfg, creds, form)
+}
+
+// Authorize aplica el token (o la firma HMAC) a una request hacia el proveedor
+func (a *ConfigurableAuthAdapter) Authorize(req *http.Request, service *models.ExternalService, token string) error {
+	cfg, err := ParseAuthConfig(service.Config)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Flow == AuthFlowHMAC {
+		creds, err := resolveCredentials(service)
+		if err != nil {
+			return err
+		}
+		return a.signHMAC(req, cfg.HMAC, creds)
+	}
+
+	header := cfg.Header
+	if header == "" {
+		header = "Authorization"
+	}
+	format := cfg.HeaderFormat
+	if format == "" {
+		format = "Bearer {token}"
+		if cfg.Flow == AuthFlowBasic {
+			format = "Basic {token}"
+		}
+	}
+	req.Header.Set(header, strings.ReplaceAll(format, "{token}", token))
+	return nil
+}
+
+// TestConnection autentica y, si hay test_path, verifica que el proveedor acepte la autenticación
+func (a *ConfigurableAuthAdapter) TestConnection(service *models.ExternalService) (*TokenResponse, error) {
+	tokenResp, err := a.Authenticate(service)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _ := ParseAuthConfig(service.Config)
+	if cfg.TestPath == "" {
+		return tokenResp, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, resolveURL(service.BaseURL, cfg.TestPath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("test_path inválido: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if err := a.Authorize(req, service, tokenResp.AccessToken); err != nil {
+		return nil, err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error consultando test_path: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("test_path respondió HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return tokenResp, nil
+}
+
+// oauth2Token ejecuta una llamada al endpoint de tokens OAuth2 (respuesta estándar RFC 6749)
+func (a *ConfigurableAuthAdapter) oauth2Token(service *models.ExternalService, cfg *ConfigurableAuthConfig, creds map[string]string, form url.Values) (*TokenResponse, error) {
+	if cfg.ClientAuth != "basic" {
+		form.Set("client_id", creds["client_id"])
+		if creds["client_secret"] != "" {
+			form.Set("client_secret", creds["client_secret"])
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, resolveURL(service.BaseURL, cfg.TokenURL), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientAuth == "basic" {
+		req.SetBasicAuth(creds["client_id"], creds["client_secret"])
+	}
+
+	data, err := a.doTokenRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.tokenFromJSON(data, "access_token", "expires_in", "refresh_token", 3600)
+}
+
+// login ejecuta el endpoint de login propio del proveedor
+func (a *ConfigurableAuthAdapter) login(service *models.ExternalService, cfg *ConfigurableAuthConfig, creds map[string]string) (*TokenResponse, error) {
+	login := cfg.Login
+	method := strings.ToUpper(login.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body io.Reader
+	contentType := ""
+	if len(login.Body) > 0 {
+		values := make(map[string]string, len(login.Body))
+		for key, value := range login.Body {
+			values[key] = expandPlaceholders(value, creds)
+		}
+
+		if login.BodyFormat == "form" {
+			form := url.Values{}
+			for key, value := range values {
+				form.Set(key, value)
+			}
+			body = strings.NewReader(form.Encode())
+			contentType = "application/x-www-form-urlencoded"
+		} else {
+			payload, _ := json.Marshal(values)
+			body = bytes.NewReader(payload)
+			contentType = "application/json"
+		}
+	}
+
+	req, err := http.NewRequest(method, resolveURL(service.BaseURL, cfg.TokenURL), body)
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range login.Headers {
+		req.Header.Set(key, expandPlaceholders(value, creds))
+	}
+
+	data, err := a.doTokenRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultTTL := login.DefaultExpiresInS
+	if defaultTTL <= 0 {
+		defaultTTL = 3600
+	}
+	return a.tokenFromJSON(data, login.TokenPath, login.ExpiresInPath, login.RefreshTokenPath, defaultTTL)
+}
+
+func (a *ConfigurableAuthAdapter) doTokenRequest(req *http.Request) (interface{}, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error en request de autenticación: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo respuesta: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("autenticación fallida (HTTP %d): %s", resp.StatusCode, truncate(string(body), 300))
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("error parseando respuesta: %w", err)
+	}
+	return data, nil
+}
+
+// tokenFromJSON extrae token, expiración y refresh token de la respuesta
+func (a *ConfigurableAuthAdapter) tokenFromJSON(data interface{}, tokenPath, expiresPath, refreshPath string, defaultTTL int) (*TokenResponse, error) {
+	token, ok := jsonpath.Lookup(data, tokenPath).(string)
+	if !ok || token == "" {
+		return nil, fmt.Errorf("la respuesta no contiene un token en '%s'", tokenPath)
+	}
+
+	expiresIn := defaultTTL
+	if expiresPath != "" {
+		switch v := jsonpath.Lookup(data, expiresPath).(type) {
+		case float64:
+			expiresIn = int(v)
+		case string:
+			if parsed, err := strconv.Atoi(v); err == nil {
+				expiresIn = parsed
+			}
+		}
+	}
+	// Una expiración nula o negativa forzaría un login en cada llamada
+	if expiresIn <= 0 {
+		expiresIn = defaultTTL
+	}
+
+	tokenResp := &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		ExpiresAt:   a.now().Add(time.Duration(expiresIn) * time.Second),
+	}
+	if tokenType, ok := jsonpath.Lookup(data, "token_type").(string); ok && tokenType != "" {
+		tokenResp.TokenType = tokenType
+	}
+	if refreshPath != "" {
+		tokenResp.RefreshToken, _ = jsonpath.Lookup(data, refreshPath).(string)
+	}
+	return tokenResp, nil
+}
+
+// signHMAC firma la request con el secreto del servicio
+func (a *ConfigurableAuthAdapter) signHMAC(req *http.Request, cfg *HMACConfig, creds map[string]string) error {
+	var body []byte
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("error leyendo body para firmar: %w", err)
+		}
+		body, _ = io.ReadAll(reader)
+		reader.Close()
+	} else if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	bodyHash := sha256.Sum256(body)
+	values := map[string]string{
+		"method":      req.Method,
+		"path":        req.URL.EscapedPath(),
+		"query":       req.URL.RawQuery,
+		"timestamp":   strconv.FormatInt(a.now().Unix(), 10),
+		"nonce":       strconv.FormatInt(a.now().UnixNano(), 36),
+		"body_sha256": hex.EncodeToString(bodyHash[:]),
+	}
+	for key, value := range creds {
+		values[key] = value
+	}
+
+	stringToSign := cfg.StringToSign
+	if stringToSign == "" {
+		stringToSign = "{method}\n{path}\n{timestamp}\n{body_sha256}"
+	}
+
+	newHash, _ := hmacHash(cfg.Algorithm)
+	mac := hmac.New(newHash, []byte(hmacSecret(creds)))
+	mac.Write([]byte(expandPlaceholders(stringToSign, values)))
+
+	signature := hex.EncodeToString(mac.Sum(nil))
+	if cfg.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	format := cfg.SignatureFormat
+	if format == "" {
+		format = "{signature}"
+	}
+	values["signature"] = signature
+	req.Header.Set(cfg.SignatureHeader, expandPlaceholders(format, values))
+
+	if cfg.KeyIDHeader != "" {
+		req.Header.Set(cfg.KeyIDHeader, creds["client_id"])
+	}
+	if cfg.TimestampHeader != "" {
+		req.Header.Set(cfg.TimestampHeader, values["timestamp"])
+	}
+	if cfg.NonceHeader != "" {
+		req.Header.Set(cfg.NonceHeader, values["nonce"])
+	}
+	return nil
+}
+
+// resolveCredentials retorna las credenciales del servicio en claro (descifradas o desde su referencia)
+func resolveCredentials(service *models.ExternalService) (map[string]string, error) {
+	creds := map[string]string{}
+	if service.Credentials == nil {
+		return creds, nil
+	}
+
+	cryptoService, err := crypto.GetService()
+	if err != nil {
+		return nil, fmt.Errorf("error inicializando crypto service: %w", err)
+	}
+
+	secrets := []struct {
+		name, value, ref string
+	}{
+		{"password", service.Credentials.Password, service.Credentials.PasswordRef},
+		{"client_secret", service.Credentials.ClientSecret, service.Credentials.ClientSecretRef},
+		{"api_key", service.Credentials.APIKey, service.Credentials.APIKeyRef},
+	}
+	for _, secret := range secrets {
+		value := secret.value
+		if cryptoService.IsEncrypted(value) {
+			if value, err = cryptoService.Decrypt(value); err != nil {
+				return nil, fmt.Errorf("error desencriptando %s: %w", secret.name, err)
+			}
+		}
+		if value, err = resolveCredentialRef(secret.ref, value); err != nil {
+			return nil, fmt.Errorf("error resolviendo %s: %w", secret.name, err)
+		}
+		creds[secret.name] = value
+	}
+
+	creds["username"] = service.Credentials.Username
+	creds["client_id"] = service.Credentials.ClientID
+	return creds, nil
+}
+
+func hmacSecret(creds map[string]string) string {
+	if creds["client_secret"] != "" {
+		return creds["client_secret"]
+	}
+	return creds["api_key"]
+}
+
+func hmacHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("algoritmo HMAC no soportado: %s", algorithm)
+	}
+}
+
+// expandPlaceholders reemplaza {clave} por su valor
+func expandPlaceholders(template string, values map[string]string) string {
+	for key, value := range values {
+		template = strings.ReplaceAll(template, "{"+key+"}", value)
+	}
+	return template
+}
+
+// resolveURL combina base_url con un path relativo (o retorna la URL absoluta)
+func resolveURL(baseURL, path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
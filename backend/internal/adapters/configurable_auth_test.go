@@ -0,0 +1,228 @@
+package adapters
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"omniapi/internal/crypto"
+	"omniapi/internal/models"
+)
+
+func newCustomService(baseURL string, auth map[string]interface{}, creds *models.ServiceCredentials) *models.ExternalService {
+	if err := crypto.InitService("12345678901234567890123456789012"); err != nil {
+		panic(err)
+	}
+	return &models.ExternalService{
+		ServiceType: "custom",
+		BaseURL:     baseURL,
+		Credentials: creds,
+		Config:      map[string]interface{}{"auth": auth},
+	}
+}
+
+func TestParseAuthConfig_Validation(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{},
+		{"flow": "kerberos"},
+		{"flow": "oauth2_client_credentials"},
+		{"flow": "login", "token_url": "/login"},
+		{"flow": "hmac"},
+		{"flow": "hmac", "hmac": map[string]interface{}{"signature_header": "X-Sig", "algorithm": "md5"}},
+		{"flow": "oauth2_password", "token_url": "/token", "header_format": "Bearer"},
+	}
+	for _, auth := range invalid {
+		if _, err := ParseAuthConfig(map[string]interface{}{"auth": auth}); err == nil {
+			t.Errorf("expected validation error for %v", auth)
+		}
+	}
+
+	if _, err := ParseAuthConfig(map[string]interface{}{}); err == nil {
+		t.Error("expected error when config.auth is missing")
+	}
+
+	cfg, err := ParseAuthConfig(map[string]interface{}{"auth": map[string]interface{}{
+		"flow":      "LOGIN",
+		"token_url": "/api/login",
+		"login":     map[string]interface{}{"token_path": "data.token"},
+	}})
+	if err != nil || cfg.Flow != AuthFlowLogin || cfg.Login.TokenPath != "data.token" {
+		t.Fatalf("expected valid login config, got %+v: %v", cfg, err)
+	}
+}
+
+func TestConfigurableAuth_OAuth2ClientCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		r.ParseForm()
+		switch {
+		case !ok || user != "client" || pass != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Form.Get("grant_type") == "client_credentials" && r.Form.Get("scope") == "read":
+			w.Write([]byte(`{"access_token":"tok-1","token_type":"Bearer","expires_in":120,"refresh_token":"ref-1"}`))
+		case r.Form.Get("grant_type") == "refresh_token" && r.Form.Get("refresh_token") == "ref-1":
+			w.Write([]byte(`{"access_token":"tok-2","expires_in":120}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	service := newCustomService(server.URL, map[string]interface{}{
+		"flow":          "oauth2_client_credentials",
+		"token_url":     "/oauth/token",
+		"scope":         "read",
+		"client_auth":   "basic",
+		"header":        "X-Access-Token",
+		"header_format": "{token}",
+	}, &models.ServiceCredentials{ClientID: "client", ClientSecret: "secret"})
+
+	adapter := NewConfigurableAuthAdapter()
+	tokenResp, err := adapter.Authenticate(service)
+	if err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	if tokenResp.AccessToken != "tok-1" || tokenResp.RefreshToken != "ref-1" || tokenResp.ExpiresIn != 120 {
+		t.Fatalf("unexpected token response: %+v", tokenResp)
+	}
+
+	refreshed, err := adapter.Refresh(service, tokenResp.RefreshToken)
+	if err != nil || refreshed.AccessToken != "tok-2" {
+		t.Fatalf("expected refreshed token, got %+v: %v", refreshed, err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/data", nil)
+	if err := AuthorizeRequest(req, service, "tok-2"); err != nil {
+		t.Fatalf("authorize failed: %v", err)
+	}
+	if req.Header.Get("X-Access-Token") != "tok-2" || req.Header.Get("Authorization") != "" {
+		t.Errorf("expected token in custom header, got %v", req.Header)
+	}
+}
+
+func TestConfigurableAuth_LoginFlow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/session":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["user"] != "operator" || body["pass"] != "p4ss" || r.Header.Get("X-Tenant") != "operator" {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"bad credentials"}`))
+				return
+			}
+			w.Write([]byte(`{"data":{"session":{"jwt":"jwt-123","ttl":"900"}}}`))
+		case "/api/ping":
+			if r.Header.Get("Authorization") != "JWT jwt-123" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer server.Close()
+
+	auth := map[string]interface{}{
+		"flow":          "login",
+		"token_url":     "/api/session",
+		"header_format": "JWT {token}",
+		"test_path":     "/api/ping",
+		"login": map[string]interface{}{
+			"body":            map[string]interface{}{"user": "{username}", "pass": "{password}"},
+			"headers":         map[string]interface{}{"X-Tenant": "{username}"},
+			"token_path":      "data.session.jwt",
+			"expires_in_path": "data.session.ttl",
+		},
+	}
+	service := newCustomService(server.URL, auth, &models.ServiceCredentials{Username: "operator", Password: "p4ss"})
+
+	adapter := NewConfigurableAuthAdapter()
+	tokenResp, err := adapter.TestConnection(service)
+	if err != nil {
+		t.Fatalf("test connection failed: %v", err)
+	}
+	if tokenResp.AccessToken != "jwt-123" || tokenResp.ExpiresIn != 900 {
+		t.Fatalf("unexpected token response: %+v", tokenResp)
+	}
+
+	service.Credentials.Password = "wrong"
+	if _, err := adapter.TestConnection(service); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected authentication error, got %v", err)
+	}
+
+	service.Credentials.Password = "p4ss"
+	auth["header_format"] = "Bearer {token}"
+	if _, err := adapter.TestConnection(service); err == nil || !strings.Contains(err.Error(), "test_path") {
+		t.Errorf("expected test_path rejection with wrong header format, got %v", err)
+	}
+}
+
+func TestConfigurableAuth_NonPositiveExpiresInUsesDefault(t *testing.T) {
+	adapter := NewConfigurableAuthAdapter()
+	for _, expires := range []interface{}{0.0, -30.0, "soon", "0"} {
+		data := map[string]interface{}{"token": "tok", "ttl": expires}
+		tokenResp, err := adapter.tokenFromJSON(data, "token", "ttl", "", 600)
+		if err != nil {
+			t.Fatalf("tokenFromJSON failed: %v", err)
+		}
+		if tokenResp.ExpiresIn != 600 {
+			t.Errorf("expires_in %v: expected default TTL 600, got %d", expires, tokenResp.ExpiresIn)
+		}
+	}
+}
+
+func TestConfigurableAuth_BasicAndHMAC(t *testing.T) {
+	basic := newCustomService("http://provider.local", map[string]interface{}{"flow": "basic"},
+		&models.ServiceCredentials{Username: "user", Password: "pass"})
+
+	adapter := NewConfigurableAuthAdapter()
+	tokenResp, err := adapter.Authenticate(basic)
+	if err != nil {
+		t.Fatalf("basic authenticate failed: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "http://provider.local/data", nil)
+	AuthorizeRequest(req, basic, tokenResp.AccessToken)
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("expected basic auth header, got %q", req.Header.Get("Authorization"))
+	}
+
+	hmacService := newCustomService("http://provider.local", map[string]interface{}{
+		"flow": "hmac",
+		"hmac": map[string]interface{}{
+			"signature_header": "X-Signature",
+			"signature_format": "v1={signature}",
+			"key_id_header":    "X-Key-Id",
+			"timestamp_header": "X-Timestamp",
+		},
+	}, &models.ServiceCredentials{ClientID: "key-1", ClientSecret: "hmac-secret"})
+
+	adapter.now = func() time.Time { return time.Unix(1700000000, 0) }
+	tokenResp, err = adapter.Authenticate(hmacService)
+	if err != nil {
+		t.Fatalf("hmac authenticate failed: %v", err)
+	}
+
+	body := `{"site":"A1"}`
+	req, _ = http.NewRequest(http.MethodPost, "http://provider.local/v1/readings?limit=5", strings.NewReader(body))
+	if err := adapter.Authorize(req, hmacService, tokenResp.AccessToken); err != nil {
+		t.Fatalf("hmac authorize failed: %v", err)
+	}
+
+	bodyHash := sha256.Sum256([]byte(body))
+	mac := hmac.New(sha256.New, []byte("hmac-secret"))
+	mac.Write([]byte("POST\n/v1/readings\n1700000000\n" + hex.EncodeToString(bodyHash[:])))
+	expected := "v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	if req.Header.Get("X-Signature") != expected {
+		t.Errorf("expected signature %q, got %q", expected, req.Header.Get("X-Signature"))
+	}
+	if req.Header.Get("X-Key-Id") != "key-1" || req.Header.Get("X-Timestamp") != "1700000000" {
+		t.Errorf("unexpected hmac headers: %v", req.Header)
+	}
+}
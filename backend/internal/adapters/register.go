@@ -5,6 +5,7 @@ import (
 	"omniapi/internal/connectors"
 	"omniapi/internal/connectors/adapters/mqttfeed"
 	"omniapi/internal/connectors/adapters/restclimate"
+	"omniapi/internal/polling/drivers"
 )
 
 // RegisterAllAdapters registra todos los adaptadores disponibles
@@ -24,5 +25,13 @@ func RegisterAllAdapters() error {
 		return err
 	}
 
+	// Drivers del polling engine por proveedor (los demás usan el driver HTTP genérico)
+	if err := drivers.Register(drivers.NewScaleAQDriver()); err != nil {
+		return err
+	}
+	if err := drivers.Register(drivers.NewInnovexDriver()); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -2,12 +2,11 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"time"
 
+	"omniapi/internal/auth"
 	"omniapi/internal/database"
 	"omniapi/internal/models"
 	"omniapi/internal/services"
@@ -28,8 +27,11 @@ type LoginResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
 	Data    struct {
-		Token string      `json:"token"`
-		User  models.User `json:"user"`
+		Token        string      `json:"token"`
+		RefreshToken string      `json:"refresh_token,omitempty"`
+		ExpiresIn    int64       `json:"expires_in,omitempty"`
+		ExpiresAt    time.Time   `json:"expires_at,omitempty"`
+		User         models.User `json:"user"`
 	} `json:"data"`
 	Timestamp int64 `json:"timestamp"`
 }
@@ -86,33 +88,34 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generar token
-	token, err := generateToken()
-	if err != nil {
+	// Las cuentas deshabilitadas no pueden iniciar sesión
+	if user.Status != "" && user.Status != "active" {
 		response := LoginResponse{
 			Success:   false,
-			Message:   "Error generando token",
+			Message:   "Usuario deshabilitado",
 			Timestamp: time.Now().Unix(),
 		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusForbidden)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	// Crear sesión
-	session := models.Session{
-		UserID:    user.ID,
-		Token:     token,
-		IPAddress: r.RemoteAddr,
-		UserAgent: r.UserAgent(),
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		IsActive:  true,
+	// Crear sesión y emitir tokens firmados
+	authService, err := auth.GetService()
+	if err != nil {
+		response := LoginResponse{
+			Success:   false,
+			Message:   "Autenticación no disponible",
+			Timestamp: time.Now().Unix(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(response)
+		return
 	}
 
-	sessionsCollection := database.GetCollection("sessions")
-	_, err = sessionsCollection.InsertOne(ctx, session)
+	tokens, err := authService.Login(&user, r.RemoteAddr, r.UserAgent())
 	if err != nil {
 		response := LoginResponse{
 			Success:   false,
@@ -136,7 +139,11 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		Message:   "Login exitoso",
 		Timestamp: time.Now().Unix(),
 	}
-	response.Data.Token = token
+	user.Role = auth.NormalizeRole(user.Role)
+	response.Data.Token = tokens.AccessToken
+	response.Data.RefreshToken = tokens.RefreshToken
+	response.Data.ExpiresIn = tokens.ExpiresIn
+	response.Data.ExpiresAt = tokens.ExpiresAt
 	response.Data.User = user
 
 	w.Header().Set("Content-Type", "application/json")
@@ -183,7 +190,18 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	user.UpdatedAt = time.Now()
 	user.Status = "active"
 	if user.Role == "" {
-		user.Role = "user"
+		user.Role = auth.RoleViewer
+	}
+	if !auth.IsValidRole(user.Role) {
+		response := models.APIResponse{
+			Success:   false,
+			Message:   "Rol inválido (admin, operator, viewer)",
+			Timestamp: time.Now().Unix(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
 	}
 
 	// Insertar en MongoDB
@@ -218,15 +236,6 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// generateToken genera un token aleatorio
-func generateToken() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(b), nil
-}
-
 // SetupRequest estructura para el setup inicial
 type SetupRequest struct {
 	Username string `json:"username"`
@@ -342,3 +351,100 @@ func SetupHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
+
+// RefreshRequest estructura para renovar tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshHandler emite un nuevo par de tokens a partir de un refresh token vigente.
+// El refresh token se rota: cada uno sólo puede usarse una vez.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, "refresh_token es obligatorio", http.StatusBadRequest)
+		return
+	}
+
+	authService, err := auth.GetService()
+	if err != nil {
+		respondWithError(w, "Autenticación no disponible", http.StatusServiceUnavailable)
+		return
+	}
+
+	claims, err := authService.ParseRefresh(req.RefreshToken)
+	if err != nil {
+		respondWithError(w, "Refresh token inválido: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := userService.GetByID(claims.Subject)
+	if err != nil || (user.Status != "" && user.Status != "active") {
+		authService.Logout(claims.SessionID)
+		respondWithError(w, "Usuario no disponible", http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := authService.Refresh(claims, user)
+	if err != nil {
+		respondWithError(w, "No se pudo renovar la sesión: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	respondWithSuccess(w, "Token renovado", tokens)
+}
+
+// LogoutHandler revoca la sesión del token actual
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "No autenticado", http.StatusUnauthorized)
+		return
+	}
+
+	authService, err := auth.GetService()
+	if err != nil {
+		respondWithError(w, "Autenticación no disponible", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := authService.Logout(claims.SessionID); err != nil {
+		respondWithError(w, "Error cerrando sesión: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	respondWithSuccess(w, "Sesión cerrada", nil)
+}
+
+// MeHandler retorna la identidad del token actual
+func MeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		respondWithError(w, "No autenticado", http.StatusUnauthorized)
+		return
+	}
+
+	respondWithSuccess(w, "Usuario autenticado", map[string]interface{}{
+		"user_id":    claims.Subject,
+		"username":   claims.Username,
+		"role":       claims.Role,
+		"tenant_id":  claims.TenantID,
+		"session_id": claims.SessionID,
+		"expires_at": claims.ExpiresAtTime(),
+	})
+}
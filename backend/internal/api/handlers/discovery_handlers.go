@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"omniapi/internal/adapters"
 	"omniapi/internal/database"
 	"omniapi/internal/models"
 	"omniapi/internal/services"
@@ -130,12 +131,12 @@ func runInnovexDiscovery(service *models.ExternalService, site *models.Site, mon
 	}
 
 	// Obtener token
-	token, err := services.GetTokenManager().GetToken(service)
+	auth, err := newDiscoveryAuth(service)
 	if err != nil {
-		return response, fmt.Errorf("error obteniendo token: %v", err)
+		return response, err
 	}
 
-	response.HeadersUsed["Authorization"] = "Bearer " + token[:20] + "..." // Truncar por seguridad
+	response.HeadersUsed["Authorization"] = "Bearer " + auth.token[:20] + "..." // Truncar por seguridad
 	response.HeadersUsed["Content-Type"] = "application/json"
 
 	// Si no hay monitorID, usar el del config o el site code
@@ -161,7 +162,7 @@ func runInnovexDiscovery(service *models.ExternalService, site *models.Site, mon
 	allMonitorsResult := callEndpoint(
 		baseURL+"/api_dataweb/all_monitors/?active=all",
 		"GET",
-		token,
+		auth,
 		"All Monitors",
 		"/api_dataweb/all_monitors/?active=all",
 		"Devuelve todos los monitores asociados al cliente, incluyendo lat/lon y monitor_key.",
@@ -173,7 +174,7 @@ func runInnovexDiscovery(service *models.ExternalService, site *models.Site, mon
 	monitorDetailResult := callEndpoint(
 		baseURL+monitorDetailPath,
 		"GET",
-		token,
+		auth,
 		"Monitor Detail",
 		monitorDetailPath,
 		"Lista loggers y sensores del monitor, incluyendo jaulas, módulos y profundidad.",
@@ -195,7 +196,7 @@ func runInnovexDiscovery(service *models.ExternalService, site *models.Site, mon
 	lastDataResult := callEndpoint(
 		baseURL+lastDataPath,
 		"GET",
-		token,
+		auth,
 		"Monitor Sensor Last Data (oxygen)",
 		lastDataPath,
 		"Retorna la última medición de oxígeno por sensor con temperatura, saturación y salinidad.",
@@ -207,7 +208,7 @@ func runInnovexDiscovery(service *models.ExternalService, site *models.Site, mon
 	lastDataFlowResult := callEndpoint(
 		baseURL+lastDataFlowPath,
 		"GET",
-		token,
+		auth,
 		"Monitor Sensor Last Data (flow)",
 		lastDataFlowPath,
 		"Retorna la última medición de flujo por sensor.",
@@ -277,12 +278,12 @@ func runScaleAQDiscovery(service *models.ExternalService, site *models.Site) (Di
 	}
 
 	// Obtener token
-	token, err := services.GetTokenManager().GetToken(service)
+	auth, err := newDiscoveryAuth(service)
 	if err != nil {
-		return response, fmt.Errorf("error obteniendo token: %v", err)
+		return response, err
 	}
 
-	response.HeadersUsed["Authorization"] = "Bearer " + token[:20] + "..."
+	response.HeadersUsed["Authorization"] = "Bearer " + auth.token[:20] + "..."
 	response.HeadersUsed["Scale-Version"] = "2025-01-01"
 	response.HeadersUsed["Accept"] = "application/json"
 
@@ -304,7 +305,7 @@ func runScaleAQDiscovery(service *models.ExternalService, site *models.Site) (Di
 	companyResult := callScaleAQEndpoint(
 		baseURL+"/meta/company?include=all",
 		"GET",
-		token,
+		auth,
 		"Company Info",
 		"/meta/company?include=all",
 		"Ficha de compañía completa con lista de sitios.",
@@ -316,7 +317,7 @@ func runScaleAQDiscovery(service *models.ExternalService, site *models.Site) (Di
 	siteResult := callScaleAQEndpoint(
 		baseURL+sitePath,
 		"GET",
-		token,
+		auth,
 		"Site Info",
 		sitePath,
 		"Información detallada del centro seleccionado.",
@@ -400,8 +401,52 @@ func runScaleAQDiscovery(service *models.ExternalService, site *models.Site) (Di
 	return response, nil
 }
 
+// discoveryAuth token de un servicio durante un discovery
+type discoveryAuth struct {
+	service *models.ExternalService
+	token   string
+}
+
+func newDiscoveryAuth(service *models.ExternalService) (*discoveryAuth, error) {
+	token, err := services.GetTokenManager().GetToken(service)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo token: %v", err)
+	}
+	return &discoveryAuth{service: service, token: token}, nil
+}
+
+// do ejecuta la request; ante 401/403 descarta el token rechazado y reintenta una vez con uno renovado
+func (a *discoveryAuth) do(build func(token string) (*http.Request, error)) (*http.Response, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	tokenManager := services.GetTokenManager()
+
+	for attempt := 0; ; attempt++ {
+		req, err := build(a.token)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && attempt == 0 {
+			resp.Body.Close()
+			tokenManager.RejectToken(a.service.ID, a.token)
+			token, err := tokenManager.GetToken(a.service)
+			if err != nil {
+				return nil, fmt.Errorf("error renovando token: %v", err)
+			}
+			a.token = token
+			continue
+		}
+		return resp, nil
+	}
+}
+
 // callEndpoint hace una llamada HTTP y retorna el resultado formateado
-func callEndpoint(url, method, token, label, path, description string) DiscoveryEndpointResult {
+func callEndpoint(url, method string, auth *discoveryAuth, label, path, description string) DiscoveryEndpointResult {
 	result := DiscoveryEndpointResult{
 		Label:       label,
 		Method:      method,
@@ -414,19 +459,18 @@ func callEndpoint(url, method, token, label, path, description string) Discovery
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
-	if err != nil {
-		result.Availability = "error"
-		result.Error = err.Error()
-		return result
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
 	start := time.Now()
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := auth.do(func(token string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := adapters.AuthorizeRequest(req, auth.service, token); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		result.Availability = "error"
 		result.Error = err.Error()
@@ -460,7 +504,7 @@ func callEndpoint(url, method, token, label, path, description string) Discovery
 }
 
 // callScaleAQEndpoint hace una llamada HTTP con headers de ScaleAQ
-func callScaleAQEndpoint(url, method, token, label, path, description string) DiscoveryEndpointResult {
+func callScaleAQEndpoint(url, method string, auth *discoveryAuth, label, path, description string) DiscoveryEndpointResult {
 	result := DiscoveryEndpointResult{
 		Label:       label,
 		Method:      method,
@@ -473,20 +517,19 @@ func callScaleAQEndpoint(url, method, token, label, path, description string) Di
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
-	if err != nil {
-		result.Availability = "error"
-		result.Error = err.Error()
-		return result
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Scale-Version", "2025-01-01")
-	req.Header.Set("Accept", "application/json")
-
 	start := time.Now()
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := auth.do(func(token string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := adapters.AuthorizeRequest(req, auth.service, token); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Scale-Version", "2025-01-01")
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		result.Availability = "error"
 		result.Error = err.Error()
@@ -8,9 +8,12 @@ import (
 	"strings"
 	"time"
 
+	"omniapi/internal/adapters"
+	"omniapi/internal/config"
 	"omniapi/internal/crypto"
 	"omniapi/internal/database"
 	"omniapi/internal/models"
+	"omniapi/internal/quota"
 	"omniapi/internal/services"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -213,6 +216,19 @@ func CreateExternalServiceHandler(w http.ResponseWriter, r *http.Request) {
 	// Normalizar service_type
 	service.ServiceType = strings.ToLower(service.ServiceType)
 
+	// Servicios custom: la autenticación se declara en config.auth
+	if service.ServiceType == "custom" {
+		if _, err := adapters.ParseAuthConfig(service.Config); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
 	// Normalizar code
 	if service.Code == "" {
 		service.Code = strings.ToLower(strings.ReplaceAll(service.Name, " ", "-"))
@@ -268,6 +284,24 @@ func CreateExternalServiceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Quota de conexiones externas del tenant
+	if !service.TenantID.IsZero() {
+		if err := quota.GetMeter().Admit(service.TenantID.Hex(), quota.ResourceConnections); err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+	}
+
+	if err := validateCredentialRefs(service.Credentials); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
 	// Encriptar credenciales sensibles con AES (solo si están en texto plano)
 	if service.Credentials != nil {
 		cryptoService, err := crypto.GetService()
@@ -366,6 +400,55 @@ func UpdateExternalServiceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateCredentialRefs(updates.Credentials); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// La config se reemplaza completa: validar la autenticación de la config resultante
+	// (un servicio custom no puede quedar sin config.auth)
+	if updates.Config != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var current models.ExternalService
+		err := database.GetCollection("external_services").FindOne(ctx, bson.M{"_id": objID}).Decode(&current)
+		cancel()
+		if err == mongo.ErrNoDocuments {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   "Servicio no encontrado",
+			})
+			return
+		} else if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"error":   fmt.Sprintf("Error obteniendo servicio: %v", err),
+			})
+			return
+		}
+
+		_, hasAuth := updates.Config["auth"]
+		if strings.ToLower(current.ServiceType) == "custom" || hasAuth {
+			if _, err := adapters.ParseAuthConfig(updates.Config); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"error":   err.Error(),
+				})
+				return
+			}
+		}
+	}
+
 	// Encriptar credenciales si se proporcionan nuevas
 	if updates.Credentials != nil {
 		cryptoService, err := crypto.GetService()
@@ -663,6 +746,36 @@ func encryptServiceCredentials(credentials *models.ServiceCredentials, cryptoSer
 	return changed, nil
 }
 
+// validateCredentialRefs verifica que las referencias a secret providers tengan formato y proveedor válidos
+func validateCredentialRefs(credentials *models.ServiceCredentials) error {
+	if credentials == nil {
+		return nil
+	}
+
+	registry := config.GetSecretRegistry()
+	refs := map[string]string{
+		"password_ref":      credentials.PasswordRef,
+		"client_secret_ref": credentials.ClientSecretRef,
+		"api_key_ref":       credentials.APIKeyRef,
+	}
+	for field, uri := range refs {
+		if uri == "" {
+			continue
+		}
+		ref, err := config.ParseSecretRef(uri)
+		if err != nil {
+			return fmt.Errorf("%s: %v", field, err)
+		}
+		if !registry.Supports(ref.Provider) {
+			return fmt.Errorf("%s: proveedor de secretos no soportado '%s' (disponibles: %s)", field, ref.Provider, strings.Join(registry.Providers(), ", "))
+		}
+		if err := config.ValidateServiceSecretRef(ref); err != nil {
+			return fmt.Errorf("%s: %v", field, err)
+		}
+	}
+	return nil
+}
+
 func ensureServiceCredentialsEncrypted(collection *mongo.Collection, service *models.ExternalService) error {
 	if service.Credentials == nil {
 		return nil
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"omniapi/internal/auth"
+	"omniapi/internal/history"
+	"omniapi/internal/models"
+)
+
+// defaultHistoryRange rango consultado cuando no se indica "from"
+const defaultHistoryRange = 24 * time.Hour
+
+// GetHistoryHandler retorna puntos históricos paginados.
+// Un usuario de tenant solo ve el suyo; un admin global sin tenant_id ve todos.
+// GET /api/history?tenant_id=&site_id=&cage_id=&kind=&instance_id=&from=&to=&page=&per_page=&order=
+func GetHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, status, err := parseHistoryQuery(r)
+	if err != nil {
+		writeHistoryError(w, status, err)
+		return
+	}
+
+	points, total, err := history.GetStore().Find(query)
+	if err != nil {
+		writeHistoryError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	totalPages := int((total + int64(query.PerPage) - 1) / int64(query.PerPage))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    points,
+		"from":    query.From,
+		"to":      query.To,
+		"pagination": models.PaginationInfo{
+			Page:       query.Page,
+			PerPage:    query.PerPage,
+			Total:      total,
+			TotalPages: totalPages,
+			HasNext:    query.Page < totalPages,
+			HasPrev:    query.Page > 1,
+		},
+	})
+}
+
+// GetHistoryDownsampleHandler retorna buckets min/max/avg de un campo numérico
+// GET /api/history/downsample?field=temperature&interval=5m&kind=climate&from=&to=
+func GetHistoryDownsampleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, status, err := parseHistoryQuery(r)
+	if err != nil {
+		writeHistoryError(w, status, err)
+		return
+	}
+
+	field := r.URL.Query().Get("field")
+	interval, err := time.ParseDuration(r.URL.Query().Get("interval"))
+	if err != nil {
+		writeHistoryError(w, http.StatusBadRequest, fmt.Errorf("invalid interval (ej: 30s, 5m, 1h): %v", err))
+		return
+	}
+
+	buckets, err := history.GetStore().Downsample(query, field, interval)
+	if err != nil {
+		writeHistoryError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"field":    field,
+		"interval": interval.String(),
+		"from":     query.From,
+		"to":       query.To,
+		"count":    len(buckets),
+		"data":     buckets,
+	})
+}
+
+// GetHistoryStatsHandler retorna las estadísticas del writer del histórico.
+// Son globales (todos los tenants): solo para usuarios sin tenant.
+func GetHistoryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		writeAuthError(w, http.StatusUnauthorized, auth.ErrMissingToken.Error())
+		return
+	}
+	if claims.TenantID != "" {
+		writeAuthError(w, http.StatusForbidden, auth.ErrTenantForbidden.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    history.GetStore().GetStats(),
+	})
+}
+
+// parseHistoryQuery construye la consulta desde los query params y la acota al tenant
+// del usuario. Retorna el status HTTP del error.
+func parseHistoryQuery(r *http.Request) (history.Query, int, error) {
+	params := r.URL.Query()
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		return history.Query{}, http.StatusUnauthorized, auth.ErrMissingToken
+	}
+
+	query := history.Query{
+		TenantID:   params.Get("tenant_id"),
+		SiteID:     params.Get("site_id"),
+		CageID:     params.Get("cage_id"),
+		Kind:       params.Get("kind"),
+		InstanceID: params.Get("instance_id"),
+		EndpointID: params.Get("endpoint_id"),
+		Source:     params.Get("source"),
+		Metric:     params.Get("metric"),
+		Descending: params.Get("order") == "desc",
+	}
+
+	if claims.TenantID != "" {
+		if query.TenantID != "" && query.TenantID != claims.TenantID {
+			return query, http.StatusForbidden, auth.ErrTenantForbidden
+		}
+		query.TenantID = claims.TenantID
+	}
+
+	query.To = time.Now().UTC()
+	if raw := params.Get("to"); raw != "" {
+		to, err := parseHistoryTime(raw)
+		if err != nil {
+			return query, http.StatusBadRequest, fmt.Errorf("invalid to: %v", err)
+		}
+		query.To = to
+	}
+
+	query.From = query.To.Add(-defaultHistoryRange)
+	if raw := params.Get("from"); raw != "" {
+		from, err := parseHistoryTime(raw)
+		if err != nil {
+			return query, http.StatusBadRequest, fmt.Errorf("invalid from: %v", err)
+		}
+		query.From = from
+	}
+
+	query.Page, _ = strconv.Atoi(params.Get("page"))
+	query.PerPage, _ = strconv.Atoi(params.Get("per_page"))
+
+	return query, http.StatusBadRequest, query.Validate()
+}
+
+// parseHistoryTime acepta RFC3339 o timestamp Unix en milisegundos
+func parseHistoryTime(raw string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func writeHistoryError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
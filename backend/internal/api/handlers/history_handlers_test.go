@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"omniapi/internal/auth"
+	"omniapi/internal/history"
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseHistoryQueryScopesTenantUsers(t *testing.T) {
+	svc := setupAuthService(t)
+
+	tenantID := primitive.NewObjectID().Hex()
+	tokens, err := svc.Login(&models.User{ID: primitive.NewObjectID(), Username: "tenant-viewer", Role: auth.RoleViewer, TenantID: tenantID}, "", "")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	admin := loginAs(t, svc, auth.RoleAdmin)
+
+	var query history.Query
+	handler := RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		var status int
+		var err error
+		if query, status, err = parseHistoryQuery(r); err != nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		name   string
+		token  string
+		params string
+		status int
+		tenant string
+	}{
+		{"tenant user without tenant_id", tokens.AccessToken, "", http.StatusOK, tenantID},
+		{"tenant user with own tenant_id", tokens.AccessToken, "?tenant_id=" + tenantID, http.StatusOK, tenantID},
+		{"tenant user with foreign tenant_id", tokens.AccessToken, "?tenant_id=" + primitive.NewObjectID().Hex(), http.StatusForbidden, ""},
+		{"global admin sees all tenants", admin, "", http.StatusOK, ""},
+	}
+
+	for _, c := range cases {
+		query = history.Query{}
+		req := httptest.NewRequest("GET", "/api/history"+c.params, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, rec.Code)
+			continue
+		}
+		if c.status == http.StatusOK && query.TenantID != c.tenant {
+			t.Errorf("%s: expected tenant %q, got %q", c.name, c.tenant, query.TenantID)
+		}
+	}
+
+	// Las estadísticas del writer son globales: no para usuarios de tenant
+	req := httptest.NewRequest("GET", "/api/history/stats", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec := httptest.NewRecorder()
+	RequireRole(auth.RoleViewer, GetHistoryStatsHandler)(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for tenant user on history stats, got %d", rec.Code)
+	}
+}
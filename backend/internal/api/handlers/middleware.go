@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
+
+	"omniapi/internal/auth"
+	"omniapi/internal/quota"
 )
 
 // CORSMiddleware agrega headers CORS a todas las respuestas
@@ -22,3 +28,92 @@ func CORSMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// RequireAuth exige un access token válido (cualquier rol)
+func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return RequireRoles(auth.RoleViewer, auth.RoleViewer, next)
+}
+
+// RequireRole exige un access token válido con al menos el rol indicado
+func RequireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return RequireRoles(role, role, next)
+}
+
+// RequireRoles exige readRole para GET/HEAD y writeRole para el resto de métodos.
+// Los claims autenticados quedan disponibles vía auth.ClaimsFromContext.
+func RequireRoles(readRole, writeRole string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// El preflight no lleva credenciales
+		if r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+
+		svc, err := auth.GetService()
+		if err != nil {
+			writeAuthError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		token, err := auth.TokenFromRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="omniapi"`)
+			writeAuthError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		claims, err := svc.Authenticate(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="omniapi", error="invalid_token"`)
+			writeAuthError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		required := writeRole
+		if r.Method == "GET" || r.Method == "HEAD" {
+			required = readRole
+		}
+
+		if !auth.HasRole(claims.Role, required) {
+			writeAuthError(w, http.StatusForbidden, auth.ErrInsufficientRole.Error()+": requires "+required)
+			return
+		}
+
+		if err := quota.GetMeter().Allow(claims.TenantID, quota.ResourceAPICalls); err != nil {
+			writeQuotaError(w, err)
+			return
+		}
+
+		next(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+	}
+}
+
+// writeAuthError responde errores de autenticación/autorización en formato JSON
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   false,
+		"error":     message,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// writeQuotaError responde 429 con el código QUOTA_EXCEEDED y el detalle de la quota superada
+func writeQuotaError(w http.ResponseWriter, err error) {
+	response := map[string]interface{}{
+		"success":   false,
+		"code":      quota.ErrorCode,
+		"error":     err.Error(),
+		"timestamp": time.Now().Unix(),
+	}
+
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		response["quota"] = exceeded
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(response)
+}
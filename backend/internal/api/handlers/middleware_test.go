@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"omniapi/internal/auth"
+	"omniapi/internal/config"
+	"omniapi/internal/domain"
+	"omniapi/internal/models"
+	"omniapi/internal/quota"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func setupAuthService(t *testing.T) *auth.Service {
+	t.Helper()
+	svc, err := auth.NewService(config.AuthConfig{
+		JWTSecret:   config.SecretRef{Key: "middleware-test-secret-0123456789"},
+		TokenExpiry: time.Hour,
+		Issuer:      "omniapi",
+	}, auth.NewMemorySessionStore())
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	auth.SetService(svc)
+	t.Cleanup(func() { auth.SetService(nil) })
+	return svc
+}
+
+func loginAs(t *testing.T, svc *auth.Service, role string) string {
+	t.Helper()
+	tokens, err := svc.Login(&models.User{ID: primitive.NewObjectID(), Username: role, Role: role}, "", "")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	return tokens.AccessToken
+}
+
+func TestRequireRolesEnforcesAuthentication(t *testing.T) {
+	svc := setupAuthService(t)
+
+	var gotClaims *auth.Claims
+	handler := RequireRoles(auth.RoleViewer, auth.RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		gotClaims, _ = auth.ClaimsFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	viewer := loginAs(t, svc, auth.RoleViewer)
+	operator := loginAs(t, svc, auth.RoleOperator)
+
+	cases := []struct {
+		name   string
+		method string
+		token  string
+		status int
+	}{
+		{"missing token", "GET", "", http.StatusUnauthorized},
+		{"garbage token", "GET", "not-a-token", http.StatusUnauthorized},
+		{"viewer can read", "GET", viewer, http.StatusOK},
+		{"viewer cannot write", "POST", viewer, http.StatusForbidden},
+		{"preflight passes", "OPTIONS", "", http.StatusOK},
+		{"operator can write", "POST", operator, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/api/recipes", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != c.status {
+			t.Errorf("%s: expected %d, got %d (%s)", c.name, c.status, rec.Code, rec.Body.String())
+		}
+	}
+
+	if gotClaims == nil || gotClaims.Role != auth.RoleOperator {
+		t.Fatalf("expected operator claims in context, got %+v", gotClaims)
+	}
+}
+
+func TestRequireRoleRejectsRevokedSession(t *testing.T) {
+	svc := setupAuthService(t)
+	token := loginAs(t, svc, auth.RoleAdmin)
+
+	claims, err := svc.Authenticate(token)
+	if err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	if err := svc.Logout(claims.SessionID); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+
+	handler := RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/api/tenants", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for revoked session, got %d", rec.Code)
+	}
+}
+
+func TestRequireRoleEnforcesAPICallQuota(t *testing.T) {
+	svc := setupAuthService(t)
+
+	tenantID := primitive.NewObjectID()
+	meter := quota.GetMeter()
+	meter.SetLimits(nil, []domain.Tenant{{ID: tenantID, Quotas: []domain.Quota{{Resource: quota.ResourceAPICalls, Limit: 2}}}})
+	t.Cleanup(func() { meter.SetLimits(nil, nil) })
+
+	tokens, err := svc.Login(&models.User{ID: primitive.NewObjectID(), Username: "tenant-viewer", Role: auth.RoleViewer, TenantID: tenantID.Hex()}, "", "")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	handler := RequireRole(auth.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	statuses := make([]int, 0, 3)
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/sites", nil)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		last = httptest.NewRecorder()
+		handler(last, req)
+		statuses = append(statuses, last.Code)
+	}
+
+	if statuses[0] != http.StatusOK || statuses[1] != http.StatusOK || statuses[2] != http.StatusTooManyRequests {
+		t.Fatalf("expected 200, 200, 429, got %v", statuses)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(last.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if body["code"] != quota.ErrorCode || body["quota"] == nil {
+		t.Errorf("expected QUOTA_EXCEEDED with quota detail, got %v", body)
+	}
+
+	// Un admin global (sin tenant) no consume quota
+	admin := loginAs(t, svc, auth.RoleAdmin)
+	req := httptest.NewRequest("GET", "/api/sites", nil)
+	req.Header.Set("Authorization", "Bearer "+admin)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected global admin to bypass tenant quota, got %d", rec.Code)
+	}
+}
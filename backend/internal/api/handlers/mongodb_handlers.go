@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"omniapi/internal/auth"
+	"omniapi/internal/domain"
 	"omniapi/internal/models"
 	"omniapi/internal/services"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Servicios globales
@@ -43,6 +47,16 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Role != "" && !auth.IsValidRole(user.Role) {
+		respondWithError(w, "Rol inválido (admin, operator, viewer)", http.StatusBadRequest)
+		return
+	}
+
+	if user.TenantID != "" && !primitive.IsValidObjectID(user.TenantID) {
+		respondWithError(w, "tenant_id inválido", http.StatusBadRequest)
+		return
+	}
+
 	if err := userService.Create(&user); err != nil {
 		respondWithError(w, err.Error(), http.StatusConflict)
 		return
@@ -146,11 +160,41 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 	delete(updates, "created_at")
 	delete(updates, "updated_at")
 
+	if role, ok := updates["role"].(string); ok && !auth.IsValidRole(role) {
+		respondWithError(w, "Rol inválido (admin, operator, viewer)", http.StatusBadRequest)
+		return
+	}
+
+	if tenantID, ok := updates["tenant_id"].(string); ok && tenantID != "" && !primitive.IsValidObjectID(tenantID) {
+		respondWithError(w, "tenant_id inválido", http.StatusBadRequest)
+		return
+	}
+
+	// Los scopes del usuario siempre pertenecen a su tenant: se decodifican tipados
+	if rawScopes, ok := updates["scopes"]; ok {
+		scopes, err := decodeUserScopes(rawScopes)
+		if err != nil {
+			respondWithError(w, "scopes inválidos: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		updates["scopes"] = scopes
+	}
+
 	if err := userService.Update(userID, updates); err != nil {
 		respondWithError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Cambios de rol, estado o contraseña invalidan las sesiones existentes
+	_, roleChanged := updates["role"]
+	_, statusChanged := updates["status"]
+	_, passwordChanged := updates["password"]
+	_, tenantChanged := updates["tenant_id"]
+	_, scopesChanged := updates["scopes"]
+	if roleChanged || statusChanged || passwordChanged || tenantChanged || scopesChanged {
+		revokeUserSessions(userID)
+	}
+
 	respondWithSuccess(w, "Usuario actualizado exitosamente", nil)
 }
 
@@ -172,6 +216,8 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	revokeUserSessions(userID)
+
 	respondWithSuccess(w, "Usuario eliminado exitosamente", nil)
 }
 
@@ -282,6 +328,58 @@ func GetDatabaseStatsHandler(w http.ResponseWriter, r *http.Request) {
 
 // Funciones auxiliares para respuestas JSON
 
+// decodeUserScopes valida los scopes de un usuario recibidos como JSON genérico
+func decodeUserScopes(raw interface{}) ([]domain.Scope, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// tenant_id se ignora: se asigna desde el usuario al resolver el acceso
+	var input []struct {
+		Resource    string              `json:"resource"`
+		Permissions []domain.Capability `json:"permissions"`
+		FarmIDs     []string            `json:"farm_ids"`
+		SiteIDs     []string            `json:"site_ids"`
+		CageIDs     []string            `json:"cage_ids"`
+	}
+	if err := json.Unmarshal(data, &input); err != nil {
+		return nil, err
+	}
+
+	scopes := make([]domain.Scope, 0, len(input))
+	for _, in := range input {
+		if in.Resource == "" {
+			return nil, fmt.Errorf("resource is required")
+		}
+		for _, capability := range in.Permissions {
+			if !capability.IsValid() {
+				return nil, fmt.Errorf("invalid capability: %s", capability)
+			}
+		}
+		scopes = append(scopes, domain.Scope{
+			Resource:    in.Resource,
+			Permissions: in.Permissions,
+			FarmIDs:     in.FarmIDs,
+			SiteIDs:     in.SiteIDs,
+			CageIDs:     in.CageIDs,
+		})
+	}
+
+	return scopes, nil
+}
+
+// revokeUserSessions revoca las sesiones de un usuario sin interrumpir la respuesta
+func revokeUserSessions(userID string) {
+	authService, err := auth.GetService()
+	if err != nil {
+		return
+	}
+	if err := authService.RevokeUser(userID); err != nil {
+		fmt.Printf("⚠️  Error revocando sesiones del usuario %s: %v\n", userID, err)
+	}
+}
+
 func respondWithError(w http.ResponseWriter, message string, statusCode int) {
 	response := models.APIResponse{
 		Success:   false,
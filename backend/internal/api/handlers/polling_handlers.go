@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"omniapi/internal/domain"
 	"omniapi/internal/polling"
 )
 
@@ -32,6 +34,10 @@ func StartPollingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	config, err := polling.GetEngine().StartPolling(req)
+	if errors.Is(err, domain.ErrQuotaExceeded) {
+		writeQuotaError(w, err)
+		return
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -116,6 +122,37 @@ func GetPollingStatusHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetPollingClusterHandler retorna las réplicas del API y qué configuraciones ejecuta cada una
+func GetPollingClusterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := polling.GetEngine().GetClusterStatus()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"data":      status,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
 // ListPollingConfigsHandler lista todas las configuraciones activas
 func ListPollingConfigsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "OPTIONS" {
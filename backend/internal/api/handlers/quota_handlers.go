@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"omniapi/internal/auth"
+	"omniapi/internal/quota"
+)
+
+// GetQuotaUsageHandler retorna el uso de quotas por tenant.
+// Un usuario de tenant solo ve el suyo; un admin global sin tenant_id ve todos.
+// GET /api/quotas/usage?tenant_id=
+func GetQuotaUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		writeAuthError(w, http.StatusUnauthorized, auth.ErrMissingToken.Error())
+		return
+	}
+
+	meter := quota.GetMeter()
+	tenantID := r.URL.Query().Get("tenant_id")
+
+	if claims.TenantID != "" {
+		if tenantID != "" && tenantID != claims.TenantID {
+			writeAuthError(w, http.StatusForbidden, auth.ErrTenantForbidden.Error())
+			return
+		}
+		tenantID = claims.TenantID
+	}
+
+	var data interface{}
+	if tenantID != "" {
+		data = meter.Usage(tenantID)
+	} else {
+		usage := make([]quota.Usage, 0)
+		for _, id := range meter.Tenants() {
+			usage = append(usage, meter.Usage(id))
+		}
+		data = usage
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"data":      data,
+		"timestamp": time.Now().Unix(),
+	})
+}
@@ -295,3 +295,91 @@ func DeleteRecipeHandler(w http.ResponseWriter, r *http.Request) {
 		"timestamp": time.Now().Unix(),
 	})
 }
+
+// DryRunRecipeRequest request para probar una receta sin emitir registros
+type DryRunRecipeRequest struct {
+	RecipeID   string          `json:"recipe_id,omitempty"`   // Receta guardada
+	Recipe     *recipes.Recipe `json:"recipe,omitempty"`      // O receta inline (aún no guardada)
+	InstanceID string          `json:"instance_id,omitempty"` // Por defecto el instance_id de la receta
+}
+
+// DryRunRecipeHandler ejecuta una receta contra el último resultado de una instancia
+// y retorna los registros generados sin publicarlos
+func DryRunRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeError := func(status int, msg string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   msg,
+		})
+	}
+
+	var req DryRunRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	recipe := req.Recipe
+	if recipe == nil {
+		if req.RecipeID == "" {
+			writeError(http.StatusBadRequest, "recipe_id or recipe is required")
+			return
+		}
+		stored, err := recipes.GetStore().Get(req.RecipeID)
+		if err != nil {
+			writeError(http.StatusNotFound, err.Error())
+			return
+		}
+		recipe = stored
+	}
+
+	instanceID := req.InstanceID
+	if instanceID == "" {
+		instanceID = recipe.InstanceID
+	}
+	if instanceID == "" {
+		writeError(http.StatusBadRequest, "instance_id is required")
+		return
+	}
+
+	result, err := polling.GetEngine().GetLastResult(instanceID)
+	if err != nil {
+		writeError(http.StatusNotFound, err.Error())
+		return
+	}
+
+	output, err := recipes.Run(recipe, result.Data, time.Now())
+	if err != nil {
+		writeError(http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	output.InstanceID = instanceID
+	output.EndpointID = result.EndpointID
+	output.TenantID = result.TenantID
+	output.SiteID = result.SiteID
+	if output.Provider == "" {
+		output.Provider = result.Provider
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"output":    output,
+		"count":     len(output.Records),
+		"polled_at": result.PolledAt,
+		"timestamp": time.Now().Unix(),
+	})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"omniapi/internal/queue/requester"
+	"omniapi/internal/router"
+)
+
+// defaultDispatchRange rango solicitado cuando no se indica "from"
+const defaultDispatchRange = time.Hour
+
+// DispatchRequest body de POST /api/requester/dispatch
+type DispatchRequest struct {
+	TenantID string  `json:"tenant_id"`
+	SiteID   string  `json:"site_id"`
+	CageID   *string `json:"cage_id,omitempty"`
+	Metric   string  `json:"metric"`
+	From     string  `json:"from,omitempty"` // RFC3339 o Unix ms (default: to - 1h)
+	To       string  `json:"to,omitempty"`   // RFC3339 o Unix ms (default: ahora)
+	Priority string  `json:"priority,omitempty"`
+}
+
+// DispatchRequestHandler encola una solicitud en el conector que indica la política de failover
+// POST /api/requester/dispatch
+func DispatchRequestHandler(coordinator *router.FailoverCoordinator, w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body DispatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeRequesterError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON: %v", err))
+		return
+	}
+
+	req, err := body.toRequest()
+	if err != nil {
+		writeRequesterError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	requestID, err := coordinator.Dispatch(req)
+	if err != nil {
+		writeRequesterError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	source, _ := coordinator.ActiveSource(req.TenantID, req.Metric)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"request_id": requestID,
+		"source":     source,
+		"time_range": req.TimeRange,
+	})
+}
+
+// GetFailoverStatusHandler retorna fuentes activas, conectores y políticas del failover
+// GET /api/requester/failover
+func GetFailoverStatusHandler(coordinator *router.FailoverCoordinator, w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"data":    coordinator.GetStats(),
+	})
+}
+
+// toRequest valida el body y construye la solicitud del requester
+func (d DispatchRequest) toRequest() (requester.Request, error) {
+	if d.TenantID == "" || d.SiteID == "" || d.Metric == "" {
+		return requester.Request{}, fmt.Errorf("tenant_id, site_id and metric are required")
+	}
+
+	to := time.Now().UTC()
+	if d.To != "" {
+		parsed, err := parseHistoryTime(d.To)
+		if err != nil {
+			return requester.Request{}, fmt.Errorf("invalid to: %v", err)
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultDispatchRange)
+	if d.From != "" {
+		parsed, err := parseHistoryTime(d.From)
+		if err != nil {
+			return requester.Request{}, fmt.Errorf("invalid from: %v", err)
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		return requester.Request{}, fmt.Errorf("from must be before to")
+	}
+
+	priority := requester.Priority(d.Priority)
+	switch priority {
+	case requester.PriorityHigh, requester.PriorityNormal, requester.PriorityLow:
+	case "":
+		priority = requester.PriorityNormal
+	default:
+		return requester.Request{}, fmt.Errorf("invalid priority: %s", d.Priority)
+	}
+
+	return requester.Request{
+		TenantID:  d.TenantID,
+		SiteID:    d.SiteID,
+		CageID:    d.CageID,
+		Metric:    d.Metric,
+		TimeRange: requester.TimeRange{From: from, To: to},
+		Priority:  priority,
+	}, nil
+}
+
+func writeRequesterError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
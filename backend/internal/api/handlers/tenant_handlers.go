@@ -7,8 +7,10 @@ import (
 	"strings"
 	"time"
 
+	"omniapi/internal/auth"
 	"omniapi/internal/database"
 	"omniapi/internal/models"
+	"omniapi/internal/quota"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -384,6 +386,8 @@ func UpdateTenantHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	invalidateTenant(objectID.Hex())
+
 	// Obtener tenant actualizado
 	var tenant models.Tenant
 	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&tenant)
@@ -474,6 +478,8 @@ func DeleteTenantHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	invalidateTenant(objectID.Hex())
+
 	response := models.APIResponse{
 		Success:   true,
 		Message:   "Tenant eliminado exitosamente",
@@ -484,3 +490,11 @@ func DeleteTenantHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// invalidateTenant hace que las quotas y el acceso WebSocket del tenant se recarguen en el próximo uso
+func invalidateTenant(tenantID string) {
+	quota.GetMeter().Invalidate(tenantID)
+	if resolver, err := auth.GetAccessResolver(); err == nil {
+		resolver.InvalidateTenant(tenantID)
+	}
+}
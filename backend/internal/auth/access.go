@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"omniapi/internal/domain"
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Access permisos efectivos de un usuario autenticado dentro de un tenant
+type Access struct {
+	UserID       string
+	Username     string
+	Role         string
+	TenantID     primitive.ObjectID
+	Capabilities []domain.Capability
+	Scopes       []domain.Scope
+}
+
+// UserLookup obtiene un usuario por ID (ej: services.UserService.GetByID)
+type UserLookup func(userID string) (*models.User, error)
+
+// TenantLookup obtiene un tenant del store (nil si no existe; ej: quota.MongoTenantLoader)
+type TenantLookup func(tenantID string) (*domain.Tenant, error)
+
+// tenantTTL cada cuánto se vuelve a leer un tenant del store
+const tenantTTL = time.Minute
+
+// cachedTenant tenant leído del store (nil = no existe)
+type cachedTenant struct {
+	tenant   *domain.Tenant
+	loadedAt time.Time
+}
+
+// AccessResolver traduce un access token al tenant, capabilities y scopes del usuario
+type AccessResolver struct {
+	service *Service
+	users   UserLookup
+	lookup  TenantLookup
+
+	tenants map[primitive.ObjectID]domain.Tenant // Catálogo de configuración
+	cache   map[primitive.ObjectID]cachedTenant  // Tenants del store
+	mu      sync.RWMutex
+}
+
+var (
+	globalResolver   *AccessResolver
+	globalResolverMu sync.RWMutex
+)
+
+// NewAccessResolver crea un resolver con los tenants configurados
+func NewAccessResolver(service *Service, users UserLookup, tenants []domain.Tenant) *AccessResolver {
+	ar := &AccessResolver{
+		service: service,
+		users:   users,
+		cache:   make(map[primitive.ObjectID]cachedTenant),
+	}
+	ar.SetTenants(tenants)
+	return ar
+}
+
+// SetAccessResolver registra el resolver global (para invalidar tenants desde la API)
+func SetAccessResolver(ar *AccessResolver) {
+	globalResolverMu.Lock()
+	defer globalResolverMu.Unlock()
+	globalResolver = ar
+}
+
+// GetAccessResolver retorna el resolver global
+func GetAccessResolver() (*AccessResolver, error) {
+	globalResolverMu.RLock()
+	defer globalResolverMu.RUnlock()
+	if globalResolver == nil {
+		return nil, ErrNotInitialized
+	}
+	return globalResolver, nil
+}
+
+// SetTenants reemplaza el catálogo de tenants (ej: al recargar configuración)
+func (ar *AccessResolver) SetTenants(tenants []domain.Tenant) {
+	byID := make(map[primitive.ObjectID]domain.Tenant, len(tenants))
+	for _, tenant := range tenants {
+		byID[tenant.ID] = tenant
+	}
+
+	ar.mu.Lock()
+	ar.tenants = byID
+	ar.mu.Unlock()
+}
+
+// SetTenantLookup lee los tenants del store (estado y scopes actuales) y los recarga cada
+// tenantTTL. Un tenant que el store no tiene usa el catálogo de SetTenants.
+func (ar *AccessResolver) SetTenantLookup(lookup TenantLookup) {
+	ar.mu.Lock()
+	ar.lookup = lookup
+	ar.cache = make(map[primitive.ObjectID]cachedTenant)
+	ar.mu.Unlock()
+}
+
+// InvalidateTenant fuerza a releer el tenant en la próxima conexión (ej: al actualizarlo)
+func (ar *AccessResolver) InvalidateTenant(tenantID string) {
+	oid, err := primitive.ObjectIDFromHex(tenantID)
+	if err != nil {
+		return
+	}
+	ar.mu.Lock()
+	delete(ar.cache, oid)
+	ar.mu.Unlock()
+}
+
+// tenant retorna el tenant vigente. Sin store, o si el store no lo tiene, se usa el
+// catálogo; si tampoco está ahí el tenant es desconocido (ErrTenantUnknown).
+func (ar *AccessResolver) tenant(tenantID primitive.ObjectID) (*domain.Tenant, error) {
+	ar.mu.RLock()
+	lookup := ar.lookup
+	cached, isCached := ar.cache[tenantID]
+	configured, isConfigured := ar.tenants[tenantID]
+	ar.mu.RUnlock()
+
+	stored := cached.tenant
+	if lookup != nil && (!isCached || time.Since(cached.loadedAt) >= tenantTTL) {
+		tenant, err := lookup(tenantID.Hex())
+		if err != nil {
+			// Sin store se conserva la última lectura; sin lectura previa se rechaza
+			if !isCached {
+				return nil, fmt.Errorf("%w: %v", ErrTenantUnknown, err)
+			}
+		} else {
+			stored = tenant
+			ar.mu.Lock()
+			ar.cache[tenantID] = cachedTenant{tenant: tenant, loadedAt: time.Now()}
+			ar.mu.Unlock()
+		}
+	}
+
+	switch {
+	case stored != nil:
+		return stored, nil
+	case isConfigured:
+		return &configured, nil
+	default:
+		return nil, ErrTenantUnknown
+	}
+}
+
+// Resolve valida el token y calcula el acceso del usuario.
+// requestedTenant solo se usa para admins globales (sin tenant asignado); para el resto
+// debe estar vacío o coincidir con el tenant del usuario.
+func (ar *AccessResolver) Resolve(token, requestedTenant string) (*Access, error) {
+	claims, err := ar.service.Authenticate(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := ar.users(claims.Subject)
+	if err != nil || user == nil || (user.Status != "" && user.Status != "active") {
+		return nil, ErrUserUnavailable
+	}
+
+	role := NormalizeRole(user.Role)
+	tenantID, err := resolveTenantID(user, role, requestedTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, err := ar.tenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Status != "" && tenant.Status != domain.TenantStatusActive {
+		return nil, ErrTenantInactive
+	}
+
+	scopes := effectiveScopes(tenantID, tenant.Scopes, user.Scopes)
+
+	return &Access{
+		UserID:       claims.Subject,
+		Username:     user.Username,
+		Role:         role,
+		TenantID:     tenantID,
+		Capabilities: capabilitiesOf(scopes),
+		Scopes:       scopes,
+	}, nil
+}
+
+// resolveTenantID determina el tenant de la conexión
+func resolveTenantID(user *models.User, role, requestedTenant string) (primitive.ObjectID, error) {
+	if user.TenantID == "" {
+		// Solo un admin global puede elegir tenant
+		if role != RoleAdmin {
+			return primitive.NilObjectID, ErrTenantForbidden
+		}
+		if requestedTenant == "" {
+			return primitive.NilObjectID, ErrTenantRequired
+		}
+		tenantID, err := primitive.ObjectIDFromHex(requestedTenant)
+		if err != nil {
+			return primitive.NilObjectID, ErrTenantRequired
+		}
+		return tenantID, nil
+	}
+
+	if requestedTenant != "" && requestedTenant != user.TenantID {
+		return primitive.NilObjectID, ErrTenantForbidden
+	}
+
+	tenantID, err := primitive.ObjectIDFromHex(user.TenantID)
+	if err != nil {
+		return primitive.NilObjectID, ErrTenantForbidden
+	}
+	return tenantID, nil
+}
+
+// effectiveScopes combina los scopes del tenant con los del usuario. Un tenant existente
+// sin scopes tiene acceso a todos sus recursos.
+// Los scopes del usuario solo pueden restringir: cada scope del usuario se intersecta
+// con cada scope del tenant (permisos y granjas/sitios/jaulas), así nunca ve más de lo
+// que el tenant otorga.
+func effectiveScopes(tenantID primitive.ObjectID, tenantScopes, userScopes []domain.Scope) []domain.Scope {
+	if len(tenantScopes) == 0 {
+		tenantScopes = []domain.Scope{{
+			TenantID:    tenantID,
+			Resource:    "*",
+			Permissions: domain.AllCapabilities(),
+		}}
+	}
+
+	if len(userScopes) == 0 {
+		return tenantScopes
+	}
+
+	var scopes []domain.Scope
+	for _, userScope := range userScopes {
+		userScope.TenantID = tenantID
+		for _, tenantScope := range tenantScopes {
+			if scope, ok := intersectScope(tenantScope, userScope); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	return scopes
+}
+
+// intersectScope retorna el scope que permite a la vez tenantScope y userScope.
+// ok es false si no comparten ninguna granja, sitio o jaula.
+func intersectScope(tenantScope, userScope domain.Scope) (domain.Scope, bool) {
+	scope := domain.Scope{
+		TenantID: userScope.TenantID,
+		Resource: userScope.Resource,
+	}
+	if userScope.Resource == "*" {
+		scope.Resource = tenantScope.Resource
+	}
+
+	for _, capability := range userScope.Permissions {
+		if domain.ContainsCapability(tenantScope.Permissions, capability) {
+			scope.Permissions = append(scope.Permissions, capability)
+		}
+	}
+
+	// Un scope global no restringe por IDs aunque tenga listas
+	if tenantScope.Resource == "*" {
+		tenantScope.FarmIDs, tenantScope.SiteIDs, tenantScope.CageIDs = nil, nil, nil
+	}
+	if userScope.Resource == "*" {
+		userScope.FarmIDs, userScope.SiteIDs, userScope.CageIDs = nil, nil, nil
+	}
+
+	var ok bool
+	if scope.FarmIDs, ok = intersectIDs(tenantScope.FarmIDs, userScope.FarmIDs); !ok {
+		return scope, false
+	}
+	if scope.SiteIDs, ok = intersectIDs(tenantScope.SiteIDs, userScope.SiteIDs); !ok {
+		return scope, false
+	}
+	if scope.CageIDs, ok = intersectIDs(tenantScope.CageIDs, userScope.CageIDs); !ok {
+		return scope, false
+	}
+
+	return scope, true
+}
+
+// intersectIDs intersecta dos listas de IDs donde una lista vacía significa "todos".
+// ok es false si ambas restringen y no tienen IDs en común.
+func intersectIDs(tenantIDs, userIDs []string) ([]string, bool) {
+	if len(tenantIDs) == 0 {
+		return userIDs, true
+	}
+	if len(userIDs) == 0 {
+		return tenantIDs, true
+	}
+
+	var ids []string
+	for _, id := range userIDs {
+		for _, allowed := range tenantIDs {
+			if id == allowed {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids, len(ids) > 0
+}
+
+// capabilitiesOf retorna la unión de permisos de los scopes
+func capabilitiesOf(scopes []domain.Scope) []domain.Capability {
+	var capabilities []domain.Capability
+	for _, scope := range scopes {
+		for _, capability := range scope.Permissions {
+			if !domain.ContainsCapability(capabilities, capability) {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+	return capabilities
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"omniapi/internal/config"
+	"omniapi/internal/domain"
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testSecret = "test-secret-0123456789abcdef"
+
+func newTestService(t *testing.T) (*Service, *MemorySessionStore) {
+	t.Helper()
+	store := NewMemorySessionStore()
+	svc, err := NewService(config.AuthConfig{
+		JWTSecret:     config.SecretRef{Key: testSecret},
+		TokenExpiry:   time.Hour,
+		RefreshExpiry: 24 * time.Hour,
+		Issuer:        "omniapi-test",
+	}, store)
+	if err != nil {
+		t.Fatalf("failed to create service: %v", err)
+	}
+	return svc, store
+}
+
+func testUser(role string) *models.User {
+	return &models.User{ID: primitive.NewObjectID(), Username: "jdoe", Role: role, Status: "active"}
+}
+
+func TestSignerRejectsTamperedTokens(t *testing.T) {
+	signer, err := NewSigner(testSecret, "omniapi")
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+
+	token, err := signer.Sign(Claims{Subject: "u1", Type: TokenTypeAccess, Role: RoleViewer, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("sign failed: %v", err)
+	}
+
+	if _, err := signer.Verify(token, TokenTypeAccess); err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+
+	// Cambiar el payload (ej: escalar rol) invalida la firma
+	parts := strings.Split(token, ".")
+	forged, _ := signer.Sign(Claims{Subject: "u1", Type: TokenTypeAccess, Role: RoleAdmin, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	tampered := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+	if _, err := signer.Verify(tampered, TokenTypeAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+
+	other, _ := NewSigner("another-secret-0123456789", "omniapi")
+	if _, err := other.Verify(token, TokenTypeAccess); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken with different secret, got %v", err)
+	}
+
+	if _, err := signer.Verify(token, TokenTypeRefresh); !errors.Is(err, ErrWrongTokenType) {
+		t.Fatalf("expected ErrWrongTokenType, got %v", err)
+	}
+}
+
+func TestSignerRejectsExpiredTokens(t *testing.T) {
+	signer, _ := NewSigner(testSecret, "omniapi")
+	token, _ := signer.Sign(Claims{Subject: "u1", Type: TokenTypeAccess, ExpiresAt: time.Now().Add(-time.Second).Unix()})
+
+	if _, err := signer.Verify(token, TokenTypeAccess); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestNewSignerRejectsWeakSecret(t *testing.T) {
+	if _, err := NewSigner("short", "omniapi"); !errors.Is(err, ErrWeakSecret) {
+		t.Fatalf("expected ErrWeakSecret, got %v", err)
+	}
+}
+
+func TestRoleHierarchy(t *testing.T) {
+	cases := []struct {
+		role, required string
+		allowed        bool
+	}{
+		{RoleAdmin, RoleOperator, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleViewer, RoleOperator, false},
+		{RoleOperator, RoleAdmin, false},
+		{"moderator", RoleOperator, true},
+		{"user", RoleViewer, true},
+		{"user", RoleOperator, false},
+		{"", RoleViewer, true},
+	}
+
+	for _, c := range cases {
+		if got := HasRole(c.role, c.required); got != c.allowed {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", c.role, c.required, got, c.allowed)
+		}
+	}
+}
+
+func TestLoginAuthenticateAndLogout(t *testing.T) {
+	svc, _ := newTestService(t)
+	user := testUser("moderator")
+
+	tokens, err := svc.Login(user, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if tokens.ExpiresIn != 3600 {
+		t.Errorf("unexpected expires_in: %d", tokens.ExpiresIn)
+	}
+
+	claims, err := svc.Authenticate(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("authenticate failed: %v", err)
+	}
+	if claims.Subject != user.ID.Hex() || claims.Role != RoleOperator {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	// El refresh token no sirve como access token
+	if _, err := svc.Authenticate(tokens.RefreshToken); !errors.Is(err, ErrWrongTokenType) {
+		t.Fatalf("expected ErrWrongTokenType, got %v", err)
+	}
+
+	if err := svc.Logout(claims.SessionID); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if _, err := svc.Authenticate(tokens.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected ErrSessionRevoked after logout, got %v", err)
+	}
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	svc, _ := newTestService(t)
+	user := testUser(RoleViewer)
+
+	first, err := svc.Login(user, "", "")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	claims, err := svc.ParseRefresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("parse refresh failed: %v", err)
+	}
+
+	second, err := svc.Refresh(claims, user)
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if _, err := svc.Authenticate(second.AccessToken); err != nil {
+		t.Fatalf("new access token should be valid: %v", err)
+	}
+
+	// Reusar el refresh token original revoca la sesión
+	if _, err := svc.Refresh(claims, user); !errors.Is(err, ErrRefreshReused) {
+		t.Fatalf("expected ErrRefreshReused, got %v", err)
+	}
+	if _, err := svc.Authenticate(second.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("expected session revoked after reuse, got %v", err)
+	}
+}
+
+func TestAccessResolverScopesUsersToTheirTenant(t *testing.T) {
+	svc, _ := newTestService(t)
+
+	tenantID := primitive.NewObjectID()
+	tenant := domain.Tenant{
+		ID:     tenantID,
+		Status: domain.TenantStatusActive,
+		Scopes: []domain.Scope{{
+			TenantID:    tenantID,
+			Resource:    "site:A",
+			Permissions: []domain.Capability{domain.CapabilityFeedingRead, domain.CapabilityClimateRead},
+			SiteIDs:     []string{"site-A"},
+		}},
+	}
+
+	member := testUser(RoleViewer)
+	member.TenantID = tenantID.Hex()
+	member.Scopes = []domain.Scope{{
+		Resource:    "cage:1",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead, domain.CapabilityOpsRead},
+		CageIDs:     []string{"cage-1"},
+	}}
+	admin := testUser(RoleAdmin)
+
+	users := map[string]*models.User{member.ID.Hex(): member, admin.ID.Hex(): admin}
+	resolver := NewAccessResolver(svc, func(id string) (*models.User, error) {
+		if u, ok := users[id]; ok {
+			return u, nil
+		}
+		return nil, errors.New("not found")
+	}, []domain.Tenant{tenant})
+
+	memberTokens, _ := svc.Login(member, "", "")
+	access, err := resolver.Resolve(memberTokens.AccessToken, "")
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if access.TenantID != tenantID {
+		t.Fatalf("expected tenant %s, got %s", tenantID.Hex(), access.TenantID.Hex())
+	}
+	// ops.read no lo otorga el tenant: el scope del usuario no puede ampliarlo
+	if len(access.Capabilities) != 1 || access.Capabilities[0] != domain.CapabilityFeedingRead {
+		t.Fatalf("unexpected capabilities: %v", access.Capabilities)
+	}
+	if len(access.Scopes) != 1 || access.Scopes[0].TenantID != tenantID {
+		t.Fatalf("unexpected scopes: %+v", access.Scopes)
+	}
+
+	if _, err := resolver.Resolve(memberTokens.AccessToken, primitive.NewObjectID().Hex()); !errors.Is(err, ErrTenantForbidden) {
+		t.Fatalf("expected ErrTenantForbidden for foreign tenant, got %v", err)
+	}
+
+	adminTokens, _ := svc.Login(admin, "", "")
+	if _, err := resolver.Resolve(adminTokens.AccessToken, ""); !errors.Is(err, ErrTenantRequired) {
+		t.Fatalf("expected ErrTenantRequired for global admin, got %v", err)
+	}
+	access, err = resolver.Resolve(adminTokens.AccessToken, tenantID.Hex())
+	if err != nil || len(access.Capabilities) != 2 {
+		t.Fatalf("expected admin to get tenant capabilities, got %+v (%v)", access, err)
+	}
+
+	if _, err := resolver.Resolve("garbage", ""); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestEffectiveScopesIntersectsTenantIDs(t *testing.T) {
+	tenantID := primitive.NewObjectID()
+	tenantScopes := []domain.Scope{{
+		TenantID:    tenantID,
+		Resource:    "site:A",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+		SiteIDs:     []string{"site-A"},
+	}}
+
+	// El usuario pide más sitios de los que otorga el tenant: solo queda site-A
+	scopes := effectiveScopes(tenantID, tenantScopes, []domain.Scope{{
+		Resource:    "sites",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+		SiteIDs:     []string{"site-A", "site-B"},
+	}})
+	if len(scopes) != 1 || len(scopes[0].SiteIDs) != 1 || scopes[0].SiteIDs[0] != "site-A" {
+		t.Fatalf("expected scope narrowed to site-A, got %+v", scopes)
+	}
+	siteB := domain.StreamKey{TenantID: tenantID, SiteID: "site-B"}
+	if domain.CanAccessAny(scopes, capabilitiesOf(scopes), domain.CapabilityFeedingRead, siteB) {
+		t.Error("user scope should not grant access to site-B")
+	}
+
+	// Un scope global del usuario hereda las restricciones del tenant
+	scopes = effectiveScopes(tenantID, tenantScopes, []domain.Scope{{
+		Resource:    "*",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+	}})
+	if len(scopes) != 1 || scopes[0].Resource != "site:A" || len(scopes[0].SiteIDs) != 1 {
+		t.Fatalf("expected global user scope limited to the tenant scope, got %+v", scopes)
+	}
+
+	// Sin sitios en común no queda ningún scope
+	scopes = effectiveScopes(tenantID, tenantScopes, []domain.Scope{{
+		Resource:    "site:B",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+		SiteIDs:     []string{"site-B"},
+	}})
+	if len(scopes) != 0 {
+		t.Fatalf("expected no scopes, got %+v", scopes)
+	}
+}
+
+func TestAccessResolverLoadsTenantsFromStore(t *testing.T) {
+	svc, _ := newTestService(t)
+
+	tenantID := primitive.NewObjectID()
+	member := testUser(RoleViewer)
+	member.TenantID = tenantID.Hex()
+	resolver := NewAccessResolver(svc, func(id string) (*models.User, error) {
+		return member, nil
+	}, nil)
+	tokens, _ := svc.Login(member, "", "")
+
+	// Sin catálogo ni store el tenant es desconocido: no recibe un scope global
+	if _, err := resolver.Resolve(tokens.AccessToken, ""); !errors.Is(err, ErrTenantUnknown) {
+		t.Fatalf("expected ErrTenantUnknown, got %v", err)
+	}
+
+	stored := domain.Tenant{ID: tenantID, Status: domain.TenantStatusSuspended}
+	loads := 0
+	resolver.SetTenantLookup(func(id string) (*domain.Tenant, error) {
+		loads++
+		if id != tenantID.Hex() {
+			return nil, nil
+		}
+		tenant := stored
+		return &tenant, nil
+	})
+
+	if _, err := resolver.Resolve(tokens.AccessToken, ""); !errors.Is(err, ErrTenantInactive) {
+		t.Fatalf("expected ErrTenantInactive for suspended tenant, got %v", err)
+	}
+
+	// El cambio de estado se ve tras invalidar el tenant
+	stored.Status = domain.TenantStatusActive
+	if _, err := resolver.Resolve(tokens.AccessToken, ""); !errors.Is(err, ErrTenantInactive) {
+		t.Fatalf("expected cached tenant until invalidated, got %v", err)
+	}
+	resolver.InvalidateTenant(tenantID.Hex())
+	access, err := resolver.Resolve(tokens.AccessToken, "")
+	if err != nil {
+		t.Fatalf("resolve failed after invalidation: %v", err)
+	}
+	if access.TenantID != tenantID || loads != 2 {
+		t.Fatalf("unexpected access %+v after %d loads", access, loads)
+	}
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "errors"
+
+// Errores de autenticación
+var (
+	ErrNotInitialized   = errors.New("auth service not initialized")
+	ErrWeakSecret       = errors.New("jwt secret must be at least 16 characters")
+	ErrMissingToken     = errors.New("missing bearer token")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrWrongTokenType   = errors.New("wrong token type")
+	ErrSessionRevoked   = errors.New("session revoked or expired")
+	ErrRefreshReused    = errors.New("refresh token already used")
+	ErrInsufficientRole = errors.New("insufficient role")
+)
+
+// Errores de autorización por tenant
+var (
+	ErrUserUnavailable = errors.New("user not found or inactive")
+	ErrTenantRequired  = errors.New("tenant is required")
+	ErrTenantForbidden = errors.New("tenant not allowed for this user")
+	ErrTenantInactive  = errors.New("tenant is not active")
+	ErrTenantUnknown   = errors.New("tenant not found")
+)
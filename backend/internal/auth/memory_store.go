@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySessionStore SessionStore en memoria (tests y entornos sin MongoDB)
+type MemorySessionStore struct {
+	sessions map[string]*models.Session
+	mu       sync.Mutex
+}
+
+// NewMemorySessionStore crea un store de sesiones en memoria
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*models.Session)}
+}
+
+// Create guarda una nueva sesión
+func (m *MemorySessionStore) Create(session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	stored := *session
+	m.sessions[session.ID.Hex()] = &stored
+	return nil
+}
+
+// Get retorna una sesión por ID
+func (m *MemorySessionStore) Get(sessionID string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionRevoked
+	}
+	stored := *session
+	return &stored, nil
+}
+
+// Rotate reemplaza el refresh token vigente solo si coincide con oldTokenID
+func (m *MemorySessionStore) Rotate(sessionID, oldTokenID, newTokenID string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[sessionID]
+	if !ok || !session.IsActive || session.Token != oldTokenID {
+		return false, nil
+	}
+	session.Token = newTokenID
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// Revoke desactiva una sesión
+func (m *MemorySessionStore) Revoke(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.sessions[sessionID]; ok {
+		now := time.Now()
+		session.IsActive = false
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+// RevokeAllForUser desactiva todas las sesiones de un usuario
+func (m *MemorySessionStore) RevokeAllForUser(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, session := range m.sessions {
+		if session.UserID.Hex() == userID {
+			now := time.Now()
+			session.IsActive = false
+			session.RevokedAt = &now
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package auth
+
+// Roles de usuario soportados, de mayor a menor privilegio
+const (
+	RoleAdmin    = "admin"    // Gestión completa: tenants, sites, servicios, brokers, usuarios
+	RoleOperator = "operator" // Operación: polling, recetas, pruebas de conexión
+	RoleViewer   = "viewer"   // Solo lectura
+)
+
+// roleLevels nivel de privilegio por rol
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// NormalizeRole mapea roles legacy a los roles actuales.
+// "moderator" pasa a operator y "user" (o vacío) a viewer.
+func NormalizeRole(role string) string {
+	switch role {
+	case RoleAdmin, RoleOperator, RoleViewer:
+		return role
+	case "moderator":
+		return RoleOperator
+	default:
+		return RoleViewer
+	}
+}
+
+// IsValidRole verifica si el rol es uno de los roles actuales
+func IsValidRole(role string) bool {
+	_, ok := roleLevels[role]
+	return ok
+}
+
+// HasRole verifica si un rol cumple con el rol mínimo requerido
+func HasRole(role, required string) bool {
+	return roleLevels[NormalizeRole(role)] >= roleLevels[NormalizeRole(required)]
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"omniapi/internal/config"
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sessionCacheTTL tiempo durante el cual una sesión validada no se vuelve a consultar.
+// Una revocación en otro nodo se propaga como máximo en este intervalo.
+const sessionCacheTTL = 30 * time.Second
+
+// TokenPair tokens emitidos en login/refresh
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"` // Segundos de validez del access token
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Service emite, valida y revoca tokens de sesión
+type Service struct {
+	signer     *Signer
+	tokenTTL   time.Duration
+	refreshTTL time.Duration
+	sessions   SessionStore
+
+	validated map[string]time.Time // Key: sessionID → última validación contra el store
+	mu        sync.RWMutex
+}
+
+var (
+	globalService *Service
+	globalMu      sync.RWMutex
+)
+
+// NewService crea un servicio de autenticación a partir de AuthConfig
+func NewService(cfg config.AuthConfig, sessions SessionStore) (*Service, error) {
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = "omniapi"
+	}
+
+	signer, err := NewSigner(cfg.JWTSecret.Key, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenTTL := cfg.TokenExpiry
+	if tokenTTL <= 0 {
+		tokenTTL = 24 * time.Hour
+	}
+	refreshTTL := cfg.RefreshExpiry
+	if refreshTTL <= 0 {
+		refreshTTL = 7 * 24 * time.Hour
+	}
+
+	return &Service{
+		signer:     signer,
+		tokenTTL:   tokenTTL,
+		refreshTTL: refreshTTL,
+		sessions:   sessions,
+		validated:  make(map[string]time.Time),
+	}, nil
+}
+
+// Init inicializa el servicio global con sesiones en MongoDB
+func Init(cfg config.AuthConfig) error {
+	svc, err := NewService(cfg, NewMongoSessionStore())
+	if err != nil {
+		return err
+	}
+	SetService(svc)
+	return nil
+}
+
+// SetService reemplaza el servicio global (útil en tests)
+func SetService(svc *Service) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	globalService = svc
+}
+
+// GetService retorna el servicio global
+func GetService() (*Service, error) {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	if globalService == nil {
+		return nil, ErrNotInitialized
+	}
+	return globalService, nil
+}
+
+// Login crea una sesión para el usuario y emite el par de tokens
+func (s *Service) Login(user *models.User, ipAddress, userAgent string) (*TokenPair, error) {
+	refreshID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Token:     refreshID,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+		IsActive:  true,
+	}
+
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+
+	return s.issue(user, session.ID.Hex(), refreshID, now)
+}
+
+// ParseRefresh valida un refresh token (firma, tipo y expiración)
+func (s *Service) ParseRefresh(token string) (*Claims, error) {
+	return s.signer.Verify(token, TokenTypeRefresh)
+}
+
+// Refresh rota el refresh token de la sesión y emite un nuevo par.
+// Si el refresh token ya fue usado se revoca la sesión completa.
+func (s *Service) Refresh(claims *Claims, user *models.User) (*TokenPair, error) {
+	if claims.Subject != user.ID.Hex() {
+		return nil, ErrInvalidToken
+	}
+
+	newRefreshID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rotated, err := s.sessions.Rotate(claims.SessionID, claims.ID, newRefreshID, now.Add(s.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Reuso de un refresh token ya rotado: posible robo, invalidar la sesión
+		s.Logout(claims.SessionID)
+		return nil, ErrRefreshReused
+	}
+
+	return s.issue(user, claims.SessionID, newRefreshID, now)
+}
+
+// Authenticate valida un access token y que su sesión siga activa
+func (s *Service) Authenticate(token string) (*Claims, error) {
+	claims, err := s.signer.Verify(token, TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkSession(claims.SessionID); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Logout revoca una sesión
+func (s *Service) Logout(sessionID string) error {
+	s.mu.Lock()
+	delete(s.validated, sessionID)
+	s.mu.Unlock()
+
+	return s.sessions.Revoke(sessionID)
+}
+
+// RevokeUser revoca todas las sesiones de un usuario (cambio de rol, baja, etc.)
+func (s *Service) RevokeUser(userID string) error {
+	s.mu.Lock()
+	s.validated = make(map[string]time.Time)
+	s.mu.Unlock()
+
+	return s.sessions.RevokeAllForUser(userID)
+}
+
+// checkSession verifica contra el store (con cache) que la sesión esté activa
+func (s *Service) checkSession(sessionID string) error {
+	s.mu.RLock()
+	checkedAt, ok := s.validated[sessionID]
+	s.mu.RUnlock()
+
+	if ok && time.Since(checkedAt) < sessionCacheTTL {
+		return nil
+	}
+
+	session, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return err
+	}
+
+	if !session.IsActive || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+
+	s.mu.Lock()
+	s.validated[sessionID] = time.Now()
+	s.mu.Unlock()
+
+	return nil
+}
+
+// issue firma el par access/refresh para una sesión
+func (s *Service) issue(user *models.User, sessionID, refreshID string, now time.Time) (*TokenPair, error) {
+	accessID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
+	accessExp := now.Add(s.tokenTTL)
+	refreshExp := now.Add(s.refreshTTL)
+	role := NormalizeRole(user.Role)
+
+	access, err := s.signer.Sign(Claims{
+		Subject:   user.ID.Hex(),
+		ID:        accessID,
+		SessionID: sessionID,
+		Type:      TokenTypeAccess,
+		Username:  user.Username,
+		Role:      role,
+		TenantID:  user.TenantID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: accessExp.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error signing access token: %w", err)
+	}
+
+	refresh, err := s.signer.Sign(Claims{
+		Subject:   user.ID.Hex(),
+		ID:        refreshID,
+		SessionID: sessionID,
+		Type:      TokenTypeRefresh,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: refreshExp.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error signing refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.tokenTTL.Seconds()),
+		ExpiresAt:        accessExp,
+		RefreshExpiresAt: refreshExp,
+	}, nil
+}
+
+type contextKey struct{}
+
+// WithClaims agrega los claims autenticados al contexto
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, claims)
+}
+
+// ClaimsFromContext retorna los claims autenticados del request
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(contextKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// TokenFromRequest extrae el token del header "Authorization: Bearer <token>"
+func TokenFromRequest(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingToken
+	}
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrMissingToken
+	}
+
+	return strings.TrimSpace(token), nil
+}
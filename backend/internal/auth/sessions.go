@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"omniapi/internal/database"
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionStore persistencia de sesiones de usuario
+type SessionStore interface {
+	// Create guarda una nueva sesión
+	Create(session *models.Session) error
+
+	// Get retorna una sesión por ID
+	Get(sessionID string) (*models.Session, error)
+
+	// Rotate reemplaza el refresh token vigente solo si coincide con oldTokenID
+	Rotate(sessionID, oldTokenID, newTokenID string, expiresAt time.Time) (bool, error)
+
+	// Revoke desactiva una sesión
+	Revoke(sessionID string) error
+
+	// RevokeAllForUser desactiva todas las sesiones de un usuario
+	RevokeAllForUser(userID string) error
+}
+
+// MongoSessionStore implementa SessionStore sobre la colección "sessions"
+type MongoSessionStore struct {
+	collection string
+}
+
+// NewMongoSessionStore crea el store y asegura el índice TTL de expiración
+func NewMongoSessionStore() *MongoSessionStore {
+	store := &MongoSessionStore{collection: "sessions"}
+
+	if database.Database != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		indexes := []mongo.IndexModel{
+			{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetExpireAfterSeconds(0),
+			},
+			{
+				Keys: bson.D{{Key: "user_id", Value: 1}},
+			},
+		}
+		if _, err := database.GetCollection(store.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			fmt.Printf("⚠️  Warning: could not create session indexes: %v\n", err)
+		}
+	}
+
+	return store
+}
+
+// Create guarda una nueva sesión
+func (s *MongoSessionStore) Create(session *models.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+
+	_, err := database.GetCollection(s.collection).InsertOne(ctx, session)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+// Get retorna una sesión por ID
+func (s *MongoSessionStore) Get(sessionID string) (*models.Session, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session models.Session
+	err = database.GetCollection(s.collection).FindOne(ctx, bson.M{"_id": objectID}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSessionRevoked
+		}
+		return nil, fmt.Errorf("error getting session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// Rotate reemplaza el refresh token vigente de forma atómica
+func (s *MongoSessionStore) Rotate(sessionID, oldTokenID, newTokenID string, expiresAt time.Time) (bool, error) {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false, ErrSessionRevoked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := database.GetCollection(s.collection).UpdateOne(ctx,
+		bson.M{"_id": objectID, "token": oldTokenID, "is_active": true},
+		bson.M{"$set": bson.M{"token": newTokenID, "expires_at": expiresAt}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error rotating session: %w", err)
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+// Revoke desactiva una sesión
+func (s *MongoSessionStore) Revoke(sessionID string) error {
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err = database.GetCollection(s.collection).UpdateOne(ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"is_active": false, "revoked_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllForUser desactiva todas las sesiones activas de un usuario
+func (s *MongoSessionStore) RevokeAllForUser(userID string) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user id: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	_, err = database.GetCollection(s.collection).UpdateMany(ctx,
+		bson.M{"user_id": objectID, "is_active": true},
+		bson.M{"$set": bson.M{"is_active": false, "revoked_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return nil
+}
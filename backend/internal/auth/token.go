@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Tipos de token emitidos
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// Claims contenido firmado de un token (formato compatible con JWT HS256)
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"` // ID del usuario
+	ID        string `json:"jti"` // ID único del token
+	SessionID string `json:"sid"` // Sesión a la que pertenece (para revocación)
+	Type      string `json:"typ"` // access | refresh
+	Username  string `json:"usr,omitempty"`
+	Role      string `json:"role,omitempty"`
+	TenantID  string `json:"tid,omitempty"` // Tenant del usuario (para quotas)
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// ExpiresAtTime retorna la expiración como time.Time
+func (c *Claims) ExpiresAtTime() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// jwtHeader header fijo HS256
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Signer firma y verifica tokens con HMAC-SHA256
+type Signer struct {
+	secret []byte
+	issuer string
+}
+
+// NewSigner crea un firmador de tokens
+func NewSigner(secret, issuer string) (*Signer, error) {
+	if len(secret) < 16 {
+		return nil, ErrWeakSecret
+	}
+	return &Signer{secret: []byte(secret), issuer: issuer}, nil
+}
+
+// Sign firma los claims y retorna el token compacto header.payload.signature
+func (s *Signer) Sign(claims Claims) (string, error) {
+	if claims.Issuer == "" {
+		claims.Issuer = s.issuer
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + s.signature(unsigned), nil
+}
+
+// Verify valida firma, emisor, tipo y expiración del token
+func (s *Signer) Verify(token, expectedType string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return nil, ErrInvalidToken
+	}
+
+	expected := s.signature(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Issuer != s.issuer {
+		return nil, ErrInvalidToken
+	}
+	if expectedType != "" && claims.Type != expectedType {
+		return nil, ErrWrongTokenType
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	return &claims, nil
+}
+
+func (s *Signer) signature(unsigned string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newTokenID genera un identificador aleatorio para jti
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
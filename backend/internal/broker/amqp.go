@@ -0,0 +1,325 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPConfig opciones de un broker AMQP 0-9-1 (BrokerConfig.Type = "amqp").
+// broker_url: amqp://host:5672/vhost o amqps:// para TLS (certificados en BrokerConfig.TLS).
+// Los mensajes se publican con publisher confirms; con qos > 0 además son persistentes.
+type AMQPConfig struct {
+	Exchange     string `bson:"exchange,omitempty" json:"exchange,omitempty"`           // Exchange destino (default: amq.topic)
+	ExchangeType string `bson:"exchange_type,omitempty" json:"exchange_type,omitempty"` // topic (default), direct, fanout, headers
+	Declare      bool   `bson:"declare,omitempty" json:"declare,omitempty"`             // Declarar el exchange (durable) al conectar
+	Mandatory    bool   `bson:"mandatory,omitempty" json:"mandatory,omitempty"`         // Fallar si ninguna cola recibe el mensaje
+}
+
+// Validate verifica las opciones de AMQP
+func (c *AMQPConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.ExchangeType {
+	case "", "topic", "direct", "fanout", "headers":
+	default:
+		return fmt.Errorf("unsupported amqp exchange_type: %s", c.ExchangeType)
+	}
+	if c.Declare && c.Exchange == "" {
+		return fmt.Errorf("amqp.exchange is required to declare it")
+	}
+	return nil
+}
+
+func (c *AMQPConfig) exchange() string {
+	if c == nil || c.Exchange == "" {
+		return "amq.topic"
+	}
+	return c.Exchange
+}
+
+func (c *AMQPConfig) exchangeType() string {
+	if c == nil || c.ExchangeType == "" {
+		return "topic"
+	}
+	return c.ExchangeType
+}
+
+// amqpRoutingKey adapta un topic generado con BuildTopic a la convención de routing keys ("." como separador)
+func amqpRoutingKey(topic string) string {
+	key := strings.Trim(strings.ReplaceAll(topic, "/", "."), ".")
+	if len(key) > 255 {
+		key = key[:255]
+	}
+	return key
+}
+
+// ═══════════════════════════════════════════════════════════
+// AMQPSink
+// ═══════════════════════════════════════════════════════════
+
+// AMQPSink publicador AMQP 0-9-1 (rabbitmq/amqp091-go) con publisher confirms. Las
+// publicaciones concurrentes comparten el canal y cada una espera su propia confirmación.
+type AMQPSink struct {
+	sinkState
+	config *BrokerConfig
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	returns chan amqp.Return // Basic.Return de los mensajes mandatory (se leen en takeReturn)
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	returnsMu sync.Mutex
+	returned  map[string]string // message_id → motivo de la devolución
+}
+
+// NewAMQPSink crea un sink AMQP
+func NewAMQPSink(config *BrokerConfig) *AMQPSink {
+	return &AMQPSink{config: config}
+}
+
+// Connect abre la conexión, el canal y activa los publisher confirms
+func (a *AMQPSink) Connect(ctx context.Context) error {
+	a.mu.Lock()
+	a.ctx, a.cancel = context.WithCancel(ctx)
+	a.mu.Unlock()
+
+	if err := a.dial(ctx); err != nil {
+		return err
+	}
+
+	a.setConnected()
+	fmt.Printf("✅ AMQP sink connected to %s\n", redactURL(a.config.BrokerURL))
+	return nil
+}
+
+func (a *AMQPSink) dial(ctx context.Context) error {
+	conn, err := dialAMQP(ctx, a.config)
+	if err != nil {
+		return err
+	}
+
+	channel, err := openAMQPChannel(conn, a.config.AMQP)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	var returns chan amqp.Return
+	if a.config.AMQP != nil && a.config.AMQP.Mandatory {
+		returns = channel.NotifyReturn(make(chan amqp.Return, 64))
+	}
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	channelClosed := channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	a.mu.Lock()
+	if ctx.Err() != nil {
+		a.mu.Unlock()
+		conn.Close()
+		return ctx.Err()
+	}
+	if a.conn != nil {
+		a.conn.Close()
+	}
+	a.conn, a.channel, a.returns = conn, channel, returns
+	a.mu.Unlock()
+
+	a.returnsMu.Lock()
+	a.returned = make(map[string]string)
+	a.returnsMu.Unlock()
+
+	// Caída de la conexión o del canal (Connection.Close, Channel.Close, heartbeat, red)
+	go func() {
+		var closeErr *amqp.Error
+		select {
+		case closeErr = <-connClosed:
+		case closeErr = <-channelClosed:
+		}
+
+		a.mu.Lock()
+		current := a.conn == conn
+		a.mu.Unlock()
+		if !current || ctx.Err() != nil {
+			return
+		}
+
+		err := fmt.Errorf("connection closed")
+		if closeErr != nil {
+			err = closeErr
+		}
+		conn.Close()
+		a.connectionLost(ctx, "AMQP sink "+redactURL(a.config.BrokerURL), err, a.dial)
+	}()
+	return nil
+}
+
+// Disconnect cierra la conexión
+func (a *AMQPSink) Disconnect() {
+	a.mu.Lock()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	if a.conn != nil {
+		a.conn.Close()
+		a.conn, a.channel, a.returns = nil, nil, nil
+	}
+	a.mu.Unlock()
+
+	a.setDisconnected()
+}
+
+// Publish publica en el exchange con routing key derivada del topic y espera el ack del broker
+func (a *AMQPSink) Publish(topic string, payload interface{}) PublishResult {
+	result := PublishResult{Topic: amqpRoutingKey(topic), Timestamp: time.Now()}
+
+	a.mu.Lock()
+	channel, returns, ctx := a.channel, a.returns, a.ctx
+	a.mu.Unlock()
+
+	if !a.IsConnected() || channel == nil {
+		return a.fail(result, fmt.Errorf("not connected to broker"))
+	}
+
+	body, err := serializePayload(payload)
+	if err != nil {
+		return a.fail(result, err)
+	}
+
+	message := amqp.Publishing{ContentType: "application/json", DeliveryMode: amqp.Transient, Body: body}
+	if a.config.QoS > 0 {
+		message.DeliveryMode = amqp.Persistent
+	}
+	mandatory := returns != nil
+	if mandatory {
+		message.MessageId = uuid.NewString()
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, sinkPublishTimeout)
+	defer cancel()
+
+	confirm, err := channel.PublishWithDeferredConfirmWithContext(publishCtx, a.config.AMQP.exchange(), result.Topic, mandatory, false, message)
+	if err != nil {
+		return a.fail(result, err)
+	}
+	acked, err := confirm.WaitContext(publishCtx)
+	if err != nil {
+		return a.fail(result, fmt.Errorf("timeout waiting for broker confirmation: %w", err))
+	}
+	if !acked {
+		return a.fail(result, fmt.Errorf("message rejected by broker (nack)"))
+	}
+
+	if mandatory {
+		if reason, ok := a.takeReturn(returns, message.MessageId); ok {
+			return a.fail(result, fmt.Errorf("message returned by broker: %s", reason))
+		}
+	}
+
+	a.recordSuccess()
+	result.Success = true
+	return result
+}
+
+// takeReturn retorna la devolución del mensaje si la hubo. amqp091 entrega el Basic.Return en
+// el canal returns antes de procesar el ack, así que al recibir el ack ya está disponible; las
+// devoluciones de otros mensajes quedan guardadas para sus publicaciones.
+func (a *AMQPSink) takeReturn(returns chan amqp.Return, messageID string) (string, bool) {
+	a.returnsMu.Lock()
+	defer a.returnsMu.Unlock()
+
+	for drained := false; !drained; {
+		select {
+		case ret, ok := <-returns:
+			if !ok {
+				drained = true
+				break
+			}
+			a.returned[ret.MessageId] = fmt.Sprintf("%d %s", ret.ReplyCode, ret.ReplyText)
+		default:
+			drained = true
+		}
+	}
+
+	reason, ok := a.returned[messageID]
+	delete(a.returned, messageID)
+	return reason, ok
+}
+
+// dialAMQP abre la conexión. Las credenciales de la config tienen prioridad sobre las de la
+// URL (sin ninguna se usa guest); amqps:// usa los certificados de BrokerConfig.TLS.
+func dialAMQP(ctx context.Context, config *BrokerConfig) (*amqp.Connection, error) {
+	u, err := url.Parse(config.BrokerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amqp url: %w", err)
+	}
+
+	clientName := config.ClientID
+	if clientName == "" {
+		clientName = "omniapi"
+	}
+	properties := amqp.NewConnectionProperties()
+	properties.SetClientConnectionName(clientName)
+
+	amqpConfig := amqp.Config{
+		Properties: properties,
+		Dial: func(network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// Plazo para los handshakes TLS y AMQP; amqp091 lo quita al abrir la conexión
+			conn.SetDeadline(time.Now().Add(15 * time.Second))
+			return conn, nil
+		},
+	}
+	if config.Username != "" {
+		amqpConfig.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: config.Username, Password: config.Password}}
+	}
+	if u.Scheme == "amqps" {
+		if amqpConfig.TLSClientConfig, err = config.TLS.build(u.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := amqp.DialConfig(config.BrokerURL, amqpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to amqp: %w", err)
+	}
+	return conn, nil
+}
+
+// openAMQPChannel abre el canal de publicación, declara el exchange si corresponde y activa los confirms
+func openAMQPChannel(conn *amqp.Connection, config *AMQPConfig) (*amqp.Channel, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && config.Declare {
+		if err := channel.ExchangeDeclare(config.exchange(), config.exchangeType(), true, false, false, false, nil); err != nil {
+			return nil, fmt.Errorf("error declaring amqp exchange %s: %w", config.exchange(), err)
+		}
+	}
+	if err := channel.Confirm(false); err != nil {
+		return nil, fmt.Errorf("error enabling publisher confirms: %w", err)
+	}
+	return channel, nil
+}
+
+// redactURL oculta el password de una URL para los logs
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,330 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// KafkaConfig opciones de un broker Kafka (BrokerConfig.Type = "kafka").
+// broker_url: kafka://host1:9092,host2:9092 o kafka+ssl:// para TLS (certificados en BrokerConfig.TLS).
+// Con username/password se autentica con SASL (PLAIN por defecto o SCRAM).
+type KafkaConfig struct {
+	Topic         string `bson:"topic,omitempty" json:"topic,omitempty"`                   // Topic fijo; el topic generado se usa como key. Vacío = topic generado con "/" → "."
+	Acks          string `bson:"acks,omitempty" json:"acks,omitempty"`                     // all (default), leader, none
+	TimeoutMS     int    `bson:"timeout_ms,omitempty" json:"timeout_ms,omitempty"`         // Espera del broker por las réplicas (default: 5000)
+	SASLMechanism string `bson:"sasl_mechanism,omitempty" json:"sasl_mechanism,omitempty"` // plain (default), scram-sha-256, scram-sha-512
+	BatchSize     int    `bson:"batch_size,omitempty" json:"batch_size,omitempty"`         // Mensajes por lote y partición (default: 100)
+	LingerMS      int    `bson:"linger_ms,omitempty" json:"linger_ms,omitempty"`           // Espera máxima para completar un lote (default: 10)
+}
+
+// Validate verifica las opciones de Kafka
+func (c *KafkaConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if _, err := c.requiredAcks(); err != nil {
+		return err
+	}
+	switch strings.ToLower(c.SASLMechanism) {
+	case "", "plain", "scram-sha-256", "scram-sha-512":
+	default:
+		return fmt.Errorf("unsupported kafka sasl_mechanism: %s", c.SASLMechanism)
+	}
+	if c.Topic != "" && kafkaTopicName(c.Topic) != c.Topic {
+		return fmt.Errorf("invalid kafka topic: %s", c.Topic)
+	}
+	if c.BatchSize < 0 || c.LingerMS < 0 {
+		return fmt.Errorf("kafka batch_size and linger_ms must not be negative")
+	}
+	return nil
+}
+
+func (c *KafkaConfig) requiredAcks() (kafka.RequiredAcks, error) {
+	if c == nil {
+		return kafka.RequireAll, nil
+	}
+	switch strings.ToLower(c.Acks) {
+	case "", "all", "-1":
+		return kafka.RequireAll, nil
+	case "leader", "1":
+		return kafka.RequireOne, nil
+	case "none", "0":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka acks: %s", c.Acks)
+	}
+}
+
+// saslMechanism mecanismo SASL para las credenciales del broker (nil sin username)
+func (c *KafkaConfig) saslMechanism(username, password string) (sasl.Mechanism, error) {
+	if username == "" {
+		return nil, nil
+	}
+	mechanism := ""
+	if c != nil {
+		mechanism = strings.ToLower(c.SASLMechanism)
+	}
+	switch mechanism {
+	case "", "plain":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	default:
+		return nil, fmt.Errorf("unsupported kafka sasl_mechanism: %s", c.SASLMechanism)
+	}
+}
+
+func (c *KafkaConfig) timeout() time.Duration {
+	if c == nil || c.TimeoutMS <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.TimeoutMS) * time.Millisecond
+}
+
+func (c *KafkaConfig) batchSize() int {
+	if c == nil || c.BatchSize <= 0 {
+		return 100
+	}
+	return c.BatchSize
+}
+
+func (c *KafkaConfig) linger() time.Duration {
+	if c == nil || c.LingerMS <= 0 {
+		return 10 * time.Millisecond
+	}
+	return time.Duration(c.LingerMS) * time.Millisecond
+}
+
+// kafkaTopicName adapta un topic generado con BuildTopic a los caracteres válidos de Kafka
+func kafkaTopicName(topic string) string {
+	name := strings.Trim(strings.ReplaceAll(topic, "/", "."), ".")
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if len(name) > 249 {
+		name = name[:249]
+	}
+	return name
+}
+
+// parseKafkaURL retorna los brokers de arranque y si se usa TLS
+func parseKafkaURL(brokerURL string) ([]string, bool, error) {
+	scheme, hosts, ok := strings.Cut(brokerURL, "://")
+	if !ok {
+		return nil, false, fmt.Errorf("kafka broker_url must be kafka://host:port[,host:port]")
+	}
+
+	useTLS := false
+	switch strings.ToLower(scheme) {
+	case "kafka", "tcp":
+	case "kafka+ssl", "kafka+tls", "ssl", "tls":
+		useTLS = true
+	default:
+		return nil, false, fmt.Errorf("unsupported kafka scheme: %s", scheme)
+	}
+
+	var addrs []string
+	for _, host := range strings.Split(strings.TrimSuffix(hosts, "/"), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "9092")
+		}
+		addrs = append(addrs, host)
+	}
+	if len(addrs) == 0 {
+		return nil, false, fmt.Errorf("kafka broker_url has no hosts")
+	}
+	return addrs, useTLS, nil
+}
+
+// ═══════════════════════════════════════════════════════════
+// KafkaSink
+// ═══════════════════════════════════════════════════════════
+
+// KafkaSink productor Kafka (segmentio/kafka-go). Las publicaciones concurrentes se agrupan en
+// lotes por partición; cada Publish espera los acks del lote que contiene su mensaje.
+type KafkaSink struct {
+	sinkState
+	config *BrokerConfig
+
+	mu        sync.Mutex
+	writer    *kafka.Writer
+	client    *kafka.Client // Consulta de metadata: verifica la conexión al conectar y reconectar
+	transport *kafka.Transport
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// NewKafkaSink crea un sink Kafka
+func NewKafkaSink(config *BrokerConfig) *KafkaSink {
+	return &KafkaSink{config: config}
+}
+
+// Connect prepara el productor y verifica que el cluster responda
+func (k *KafkaSink) Connect(ctx context.Context) error {
+	bootstrap, useTLS, err := parseKafkaURL(k.config.BrokerURL)
+	if err != nil {
+		return err
+	}
+	acks, err := k.config.Kafka.requiredAcks()
+	if err != nil {
+		return err
+	}
+	mechanism, err := k.config.Kafka.saslMechanism(k.config.Username, k.config.Password)
+	if err != nil {
+		return err
+	}
+
+	clientID := k.config.ClientID
+	if clientID == "" {
+		clientID = "omniapi"
+	}
+	transport := &kafka.Transport{
+		ClientID:    clientID,
+		DialTimeout: 10 * time.Second,
+		SASL:        mechanism,
+	}
+	if useTLS {
+		// El ServerName lo completa kafka-go con el host de cada broker
+		if transport.TLS, err = k.config.TLS.build(""); err != nil {
+			return err
+		}
+	}
+
+	addr := kafka.TCP(bootstrap...)
+	writer := &kafka.Writer{
+		Addr:                   addr,
+		Balancer:               &kafka.Hash{}, // Hash de la key; round robin sin key
+		RequiredAcks:           acks,
+		BatchSize:              k.config.Kafka.batchSize(),
+		BatchTimeout:           k.config.Kafka.linger(),
+		WriteTimeout:           k.config.Kafka.timeout(),
+		AllowAutoTopicCreation: true,
+		Transport:              transport,
+	}
+
+	k.mu.Lock()
+	k.writer = writer
+	k.client = &kafka.Client{Addr: addr, Transport: transport, Timeout: 10 * time.Second}
+	k.transport = transport
+	k.ctx, k.cancel = context.WithCancel(ctx)
+	k.mu.Unlock()
+
+	if err := k.dial(ctx); err != nil {
+		k.Disconnect()
+		return err
+	}
+
+	k.setConnected()
+	fmt.Printf("✅ Kafka sink connected to %s\n", k.config.BrokerURL)
+	return nil
+}
+
+// dial verifica que algún broker de arranque responda la metadata del cluster
+func (k *KafkaSink) dial(ctx context.Context) error {
+	k.mu.Lock()
+	client := k.client
+	k.mu.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("not connected to broker")
+	}
+	if _, err := client.Metadata(ctx, &kafka.MetadataRequest{}); err != nil {
+		return fmt.Errorf("error connecting to kafka: %w", err)
+	}
+	return nil
+}
+
+// Disconnect envía los lotes pendientes y cierra las conexiones
+func (k *KafkaSink) Disconnect() {
+	k.mu.Lock()
+	if k.cancel != nil {
+		k.cancel()
+	}
+	writer, transport := k.writer, k.transport
+	k.writer, k.client, k.transport = nil, nil, nil
+	k.mu.Unlock()
+
+	if writer != nil {
+		writer.Close()
+	}
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+	k.setDisconnected()
+}
+
+// Publish agrega el mensaje al lote de su partición y espera los acks configurados
+func (k *KafkaSink) Publish(topic string, payload interface{}) PublishResult {
+	result := PublishResult{Topic: topic, Timestamp: time.Now()}
+
+	k.mu.Lock()
+	writer, ctx := k.writer, k.ctx
+	k.mu.Unlock()
+
+	if !k.IsConnected() || writer == nil {
+		return k.fail(result, fmt.Errorf("not connected to broker"))
+	}
+
+	value, err := serializePayload(payload)
+	if err != nil {
+		return k.fail(result, err)
+	}
+
+	name, key := kafkaTopicName(topic), []byte(nil)
+	if k.config.Kafka != nil && k.config.Kafka.Topic != "" {
+		name, key = k.config.Kafka.Topic, []byte(topic)
+	}
+	result.Topic = name
+
+	// Espera del broker más margen para completar el lote y reintentar
+	publishCtx, cancel := context.WithTimeout(ctx, k.config.Kafka.timeout()+sinkPublishTimeout)
+	defer cancel()
+
+	err = writer.WriteMessages(publishCtx, kafka.Message{Topic: name, Key: key, Value: value})
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) && len(writeErrs) == 1 {
+		err = writeErrs[0]
+	}
+	if err != nil {
+		// Sin respuesta del cluster: se reintenta la conexión y el outbox retiene los mensajes
+		if isNetworkError(err) || errors.Is(err, context.DeadlineExceeded) {
+			k.connectionLost(ctx, "Kafka sink "+k.config.BrokerURL, err, k.dial)
+		}
+		return k.fail(result, err)
+	}
+
+	k.recordSuccess()
+	result.Success = true
+	return result
+}
+
+// isNetworkError indica si el error proviene de la conexión (requiere reconectar)
+func isNetworkError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
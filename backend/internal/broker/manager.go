@@ -3,36 +3,55 @@ package broker
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
+	"omniapi/internal/crypto"
 	"omniapi/internal/database"
+	"omniapi/internal/metrics"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Manager gestiona múltiples publishers MQTT
+// Manager gestiona múltiples brokers de salida (MQTT, Kafka, AMQP)
 type Manager struct {
-	publishers map[string]*Publisher // Key: broker_id
+	publishers map[string]Sink // Key: broker_id
 	configs    map[string]*BrokerConfig
 	mu         sync.RWMutex
 	ctx        context.Context
 	cancelFunc context.CancelFunc
+
+	// Store-and-forward: outbox persistente y bucle de conexión por broker
+	outboxes    map[string]*Outbox // Key: broker_id
+	outboxStore OutboxStore
+	running     map[string]context.CancelFunc // Key: broker_id
 }
 
+const (
+	// Espera entre intentos de conexión inicial a un broker (crece hasta el máximo)
+	connectRetryInitial = 5 * time.Second
+	connectRetryMax     = time.Minute
+)
+
 // NewManager crea un nuevo manager de brokers
 func NewManager() *Manager {
 	return &Manager{
-		publishers: make(map[string]*Publisher),
+		publishers: make(map[string]Sink),
 		configs:    make(map[string]*BrokerConfig),
+		outboxes:   make(map[string]*Outbox),
+		running:    make(map[string]context.CancelFunc),
 	}
 }
 
 // Start inicia el manager y carga brokers desde MongoDB
 func (m *Manager) Start(ctx context.Context) error {
 	m.ctx, m.cancelFunc = context.WithCancel(ctx)
+	if m.outboxStore == nil {
+		m.outboxStore = NewMongoOutboxStore()
+	}
 
 	// Cargar configuraciones desde MongoDB
 	if err := m.loadConfigs(); err != nil {
@@ -40,27 +59,19 @@ func (m *Manager) Start(ctx context.Context) error {
 	}
 
 	// Conectar a los brokers habilitados
-	m.mu.RLock()
-	for id, config := range m.configs {
+	m.mu.Lock()
+	for _, config := range m.configs {
 		if config.Enabled {
-			go func(brokerID string, cfg *BrokerConfig) {
-				publisher := NewPublisher(cfg)
-				if err := publisher.Connect(m.ctx); err != nil {
-					fmt.Printf("⚠️ Error connecting to broker %s: %v\n", cfg.Name, err)
-					return
-				}
-				m.mu.Lock()
-				m.publishers[brokerID] = publisher
-				m.mu.Unlock()
-			}(id, config)
+			m.startBrokerLocked(config)
 		}
 	}
-	m.mu.RUnlock()
+	m.mu.Unlock()
 
 	return nil
 }
 
-// Stop detiene el manager y desconecta todos los publishers
+// Stop detiene el manager y desconecta todos los publishers. Los mensajes en cola quedan
+// persistidos y se reenvían en el próximo arranque.
 func (m *Manager) Stop() {
 	if m.cancelFunc != nil {
 		m.cancelFunc()
@@ -72,12 +83,95 @@ func (m *Manager) Stop() {
 	for _, publisher := range m.publishers {
 		publisher.Disconnect()
 	}
-	m.publishers = make(map[string]*Publisher)
+	m.publishers = make(map[string]Sink)
+	m.outboxes = make(map[string]*Outbox)
+	m.running = make(map[string]context.CancelFunc)
 	fmt.Println("🔌 Broker Manager stopped")
 }
 
-// GetPublisher obtiene un publisher por ID
-func (m *Manager) GetPublisher(brokerID string) (*Publisher, bool) {
+// startBrokerLocked arranca la conexión y el outbox de un broker (reemplaza los anteriores)
+func (m *Manager) startBrokerLocked(config *BrokerConfig) {
+	m.stopBrokerLocked(config.ID)
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running[config.ID] = cancel
+
+	if config.Outbox.enabled() && m.outboxStore != nil {
+		outbox := NewOutbox(config.ID, config.Outbox, m.outboxStore)
+		m.outboxes[config.ID] = outbox
+		go outbox.run(ctx, func() outboxSender {
+			if publisher, ok := m.GetSink(config.ID); ok {
+				return publisher
+			}
+			return nil
+		})
+	}
+
+	go m.connectLoop(ctx, config)
+}
+
+// stopBrokerLocked detiene la conexión y el outbox de un broker; los mensajes en cola se conservan
+func (m *Manager) stopBrokerLocked(brokerID string) {
+	if cancel, ok := m.running[brokerID]; ok {
+		cancel()
+		delete(m.running, brokerID)
+	}
+	if publisher, exists := m.publishers[brokerID]; exists {
+		publisher.Disconnect()
+		delete(m.publishers, brokerID)
+	}
+	delete(m.outboxes, brokerID)
+}
+
+// connectLoop conecta al broker reintentando hasta lograrlo. Una vez conectado, el sink
+// se encarga de reconectar y cada conexión despierta el reenvío del outbox.
+func (m *Manager) connectLoop(ctx context.Context, config *BrokerConfig) {
+	delay := connectRetryInitial
+	for {
+		publisher := NewSink(config)
+		publisher.OnConnect(func() { m.notifyOutbox(config.ID) })
+
+		err := publisher.Connect(ctx)
+		if err == nil {
+			m.mu.Lock()
+			if ctx.Err() != nil {
+				m.mu.Unlock()
+				publisher.Disconnect()
+				return
+			}
+			m.publishers[config.ID] = publisher
+			m.mu.Unlock()
+
+			m.notifyOutbox(config.ID)
+			return
+		}
+
+		fmt.Printf("⚠️ Error connecting to broker %s: %v (retrying in %s)\n", config.Name, err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > connectRetryMax {
+			delay = connectRetryMax
+		}
+	}
+}
+
+// notifyOutbox despierta el reenvío de la cola de un broker
+func (m *Manager) notifyOutbox(brokerID string) {
+	m.mu.RLock()
+	outbox := m.outboxes[brokerID]
+	m.mu.RUnlock()
+
+	if outbox != nil {
+		outbox.Notify()
+	}
+}
+
+// GetSink obtiene el sink conectado de un broker por ID
+func (m *Manager) GetSink(brokerID string) (Sink, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	publisher, exists := m.publishers[brokerID]
@@ -86,7 +180,7 @@ func (m *Manager) GetPublisher(brokerID string) (*Publisher, bool) {
 
 // Publish publica a un broker específico
 func (m *Manager) Publish(brokerID, topic string, payload interface{}) PublishResult {
-	publisher, exists := m.GetPublisher(brokerID)
+	publisher, exists := m.GetSink(brokerID)
 	if !exists {
 		return PublishResult{
 			Topic:     topic,
@@ -97,9 +191,29 @@ func (m *Manager) Publish(brokerID, topic string, payload interface{}) PublishRe
 	return publisher.Publish(topic, payload)
 }
 
-// PublishAsync publica de forma asíncrona a un broker específico
+// PublishAsync publica sin bloquear al llamador. Con outbox, los mensajes se publican en orden
+// desde el goroutine del outbox y solo se persisten si el broker está desconectado, hay cola
+// pendiente o la publicación no se confirmó; la cola se reenvía al reconectar.
 func (m *Manager) PublishAsync(brokerID, topic string, payload interface{}) {
-	go m.Publish(brokerID, topic, payload)
+	m.mu.RLock()
+	outbox := m.outboxes[brokerID]
+	m.mu.RUnlock()
+
+	if outbox == nil {
+		go m.Publish(brokerID, topic, payload)
+		return
+	}
+
+	data, err := serializePayload(payload)
+	if err != nil {
+		fmt.Printf("⚠️ Error publishing to broker %s: %v\n", brokerID, err)
+		return
+	}
+
+	if err := outbox.Submit(topic, data); err != nil {
+		fmt.Printf("⚠️ Outbox %s: could not queue message for %s: %v\n", brokerID, topic, err)
+		go m.Publish(brokerID, topic, data)
+	}
 }
 
 // AddBroker agrega y guarda un nuevo broker
@@ -107,6 +221,10 @@ func (m *Manager) AddBroker(config *BrokerConfig) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
 	// Asignar ID si no tiene
 	if config.ID == "" {
 		config.ID = primitive.NewObjectID().Hex()
@@ -123,16 +241,7 @@ func (m *Manager) AddBroker(config *BrokerConfig) error {
 
 	// Si está habilitado, conectar
 	if config.Enabled {
-		publisher := NewPublisher(config)
-		go func() {
-			if err := publisher.Connect(m.ctx); err != nil {
-				fmt.Printf("⚠️ Error connecting to broker %s: %v\n", config.Name, err)
-				return
-			}
-			m.mu.Lock()
-			m.publishers[config.ID] = publisher
-			m.mu.Unlock()
-		}()
+		m.startBrokerLocked(config)
 	}
 
 	return nil
@@ -143,13 +252,14 @@ func (m *Manager) UpdateBroker(config *BrokerConfig) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
 	config.UpdatedAt = time.Now()
 
-	// Desconectar el publisher existente
-	if publisher, exists := m.publishers[config.ID]; exists {
-		publisher.Disconnect()
-		delete(m.publishers, config.ID)
-	}
+	// Desconectar el publisher existente (la cola pendiente se conserva)
+	m.stopBrokerLocked(config.ID)
 
 	// Guardar en MongoDB
 	if err := m.saveBrokerConfig(config); err != nil {
@@ -160,16 +270,7 @@ func (m *Manager) UpdateBroker(config *BrokerConfig) error {
 
 	// Si está habilitado, reconectar
 	if config.Enabled {
-		publisher := NewPublisher(config)
-		go func() {
-			if err := publisher.Connect(m.ctx); err != nil {
-				fmt.Printf("⚠️ Error connecting to broker %s: %v\n", config.Name, err)
-				return
-			}
-			m.mu.Lock()
-			m.publishers[config.ID] = publisher
-			m.mu.Unlock()
-		}()
+		m.startBrokerLocked(config)
 	}
 
 	return nil
@@ -181,16 +282,21 @@ func (m *Manager) RemoveBroker(brokerID string) error {
 	defer m.mu.Unlock()
 
 	// Desconectar si está conectado
-	if publisher, exists := m.publishers[brokerID]; exists {
-		publisher.Disconnect()
-		delete(m.publishers, brokerID)
-	}
+	m.stopBrokerLocked(brokerID)
 
 	// Eliminar de MongoDB
 	if err := m.deleteBrokerConfig(brokerID); err != nil {
 		return err
 	}
 
+	// Los mensajes pendientes de un broker eliminado ya no tienen destino
+	if m.outboxStore != nil {
+		if err := m.outboxStore.Purge(brokerID); err != nil {
+			fmt.Printf("⚠️ Error purging outbox of broker %s: %v\n", brokerID, err)
+		}
+	}
+	metrics.BrokerOutboxDepth.DeleteLabelValues(brokerID)
+
 	delete(m.configs, brokerID)
 	return nil
 }
@@ -233,11 +339,16 @@ func (m *Manager) GetStatus() map[string]interface{} {
 		brokerStatus := map[string]interface{}{
 			"id":        id,
 			"name":      config.Name,
+			"type":      config.SinkType(),
 			"url":       config.BrokerURL,
 			"enabled":   config.Enabled,
 			"connected": false,
 		}
 
+		if outbox, exists := m.outboxes[id]; exists {
+			brokerStatus["outbox"] = outbox.GetStats()
+		}
+
 		if publisher, exists := m.publishers[id]; exists {
 			brokerStatus["connected"] = publisher.IsConnected()
 			brokerStatus["stats"] = publisher.GetStats()
@@ -272,6 +383,10 @@ func (m *Manager) loadConfigs() error {
 		if err := cursor.Decode(&config); err != nil {
 			continue
 		}
+		if err := decryptBrokerPassword(&config); err != nil {
+			fmt.Printf("⚠️ Error decrypting password of broker %s: %v\n", config.Name, err)
+			continue
+		}
 		m.configs[config.ID] = &config
 	}
 
@@ -285,14 +400,69 @@ func (m *Manager) saveBrokerConfig(config *BrokerConfig) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// El password se guarda cifrado; en memoria se mantiene en claro para el publisher
+	stored := *config
+	if err := encryptBrokerPassword(&stored); err != nil {
+		return err
+	}
+
 	filter := bson.M{"_id": config.ID}
-	update := bson.M{"$set": config}
+	update := bson.M{"$set": stored}
 	opts := options.Update().SetUpsert(true)
 
 	_, err := collection.UpdateOne(ctx, filter, update, opts)
 	return err
 }
 
+// encryptBrokerPassword cifra el password con la clave activa.
+// Sin clave de encriptación configurada se guarda en claro, como antes.
+func encryptBrokerPassword(config *BrokerConfig) error {
+	if config.Password == "" {
+		return nil
+	}
+
+	cryptoService, err := crypto.GetService()
+	if err != nil {
+		fmt.Printf("⚠️ Broker %s password stored without encryption: %v\n", config.Name, err)
+		return nil
+	}
+	if cryptoService.IsEncrypted(config.Password) {
+		return nil
+	}
+
+	encrypted, err := cryptoService.Encrypt(config.Password)
+	if err != nil {
+		return fmt.Errorf("error encrypting broker password: %w", err)
+	}
+	config.Password = encrypted
+	return nil
+}
+
+// decryptBrokerPassword descifra el password guardado (los passwords en claro se mantienen)
+func decryptBrokerPassword(config *BrokerConfig) error {
+	if config.Password == "" {
+		return nil
+	}
+
+	cryptoService, err := crypto.GetService()
+	if err != nil {
+		if strings.HasPrefix(config.Password, "enc:") {
+			return err
+		}
+		return nil
+	}
+	if !cryptoService.IsEncrypted(config.Password) {
+		return nil
+	}
+
+	decrypted, err := cryptoService.Decrypt(config.Password)
+	if err != nil {
+		return err
+	}
+	config.Password = decrypted
+	return nil
+}
+
 // deleteBrokerConfig elimina una configuración de MongoDB
 func (m *Manager) deleteBrokerConfig(brokerID string) error {
 	collection := database.GetCollection("broker_configs")
@@ -305,7 +475,10 @@ func (m *Manager) deleteBrokerConfig(brokerID string) error {
 
 // TestConnection prueba la conexión a un broker sin guardarlo
 func (m *Manager) TestConnection(config *BrokerConfig) error {
-	publisher := NewPublisher(config)
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	publisher := NewSink(config)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
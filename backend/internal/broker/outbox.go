@@ -0,0 +1,610 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"omniapi/internal/database"
+	"omniapi/internal/metrics"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Límites por defecto del outbox de un broker
+	defaultOutboxMaxAge      = 24 * time.Hour
+	defaultOutboxMaxMessages = 100000
+
+	// outboxBatchSize mensajes leídos por cada vuelta de reenvío
+	outboxBatchSize = 100
+
+	// outboxTick frecuencia con que se reintenta el reenvío y se aplican los límites
+	outboxTick = 5 * time.Second
+
+	// outboxSubmitBuffer mensajes en memoria esperando su publicación directa
+	outboxSubmitBuffer = 1024
+)
+
+// OutboxConfig configuración del outbox (store-and-forward) de un broker. Sin configurar,
+// el outbox está habilitado con los límites por defecto.
+type OutboxConfig struct {
+	Disabled    bool  `bson:"disabled,omitempty" json:"disabled,omitempty"`         // Publicar sin persistir (se pierde lo que falle)
+	MaxAgeS     int64 `bson:"max_age_s,omitempty" json:"max_age_s,omitempty"`       // Antigüedad máxima de un mensaje en cola (default: 24h)
+	MaxMessages int64 `bson:"max_messages,omitempty" json:"max_messages,omitempty"` // Mensajes máximos en cola; se descartan los más antiguos (default: 100000)
+}
+
+func (c *OutboxConfig) enabled() bool {
+	return c == nil || !c.Disabled
+}
+
+func (c *OutboxConfig) maxAge() time.Duration {
+	if c == nil || c.MaxAgeS <= 0 {
+		return defaultOutboxMaxAge
+	}
+	return time.Duration(c.MaxAgeS) * time.Second
+}
+
+func (c *OutboxConfig) maxMessages() int64 {
+	if c == nil || c.MaxMessages <= 0 {
+		return defaultOutboxMaxMessages
+	}
+	return c.MaxMessages
+}
+
+// Validate verifica los límites del outbox
+func (c *OutboxConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.MaxAgeS < 0 {
+		return fmt.Errorf("outbox.max_age_s must be positive")
+	}
+	if c.MaxMessages < 0 {
+		return fmt.Errorf("outbox.max_messages must be positive")
+	}
+	return nil
+}
+
+// OutboxMessage mensaje pendiente de publicar (colección broker_outbox)
+type OutboxMessage struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"` // Orden de publicación
+	BrokerID  string             `bson:"broker_id" json:"broker_id"`
+	Topic     string             `bson:"topic" json:"topic"`
+	Payload   []byte             `bson:"payload" json:"-"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// OutboxStats estado del outbox de un broker
+type OutboxStats struct {
+	Enabled       bool      `json:"enabled"`
+	Depth         int64     `json:"depth"` // Mensajes en cola
+	TotalQueued   int64     `json:"total_queued"`
+	TotalReplayed int64     `json:"total_replayed"`
+	TotalExpired  int64     `json:"total_expired"` // Descartados por max_age_s
+	TotalDropped  int64     `json:"total_dropped"` // Descartados por max_messages
+	LastReplayAt  time.Time `json:"last_replay_at,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// OutboxStore persistencia de los mensajes pendientes
+type OutboxStore interface {
+	Append(msg *OutboxMessage) error
+	// Next retorna los mensajes más antiguos del broker en orden de publicación
+	Next(brokerID string, limit int) ([]OutboxMessage, error)
+	Delete(brokerID string, ids []primitive.ObjectID) error
+	Count(brokerID string) (int64, error)
+	DropOlderThan(brokerID string, before time.Time) (int64, error)
+	DropOldest(brokerID string, n int64) (int64, error)
+	Purge(brokerID string) error
+}
+
+// outboxSender publica un mensaje ya serializado (Publisher)
+type outboxSender interface {
+	IsConnected() bool
+	Publish(topic string, payload interface{}) PublishResult
+}
+
+// Outbox cola persistente de un broker: guarda los mensajes que no se pudieron publicar
+// (sin conexión o sin confirmación) y los reenvía en orden al reconectar. Un mensaje solo se
+// borra cuando el broker confirmó la publicación (PUBACK/PUBCOMP con QoS 1/2), por lo que la
+// entrega es al menos una vez.
+type Outbox struct {
+	brokerID string
+	store    OutboxStore
+	signal   chan struct{}
+	submit   chan outboxItem // Mensajes nuevos, publicados en orden por dispatch
+
+	mu     sync.Mutex
+	config *OutboxConfig
+	stats  OutboxStats
+
+	drainMu sync.Mutex // Un solo reenvío a la vez para mantener el orden
+}
+
+// NewOutbox crea el outbox de un broker
+func NewOutbox(brokerID string, config *OutboxConfig, store OutboxStore) *Outbox {
+	o := &Outbox{
+		brokerID: brokerID,
+		store:    store,
+		config:   config,
+		signal:   make(chan struct{}, 1),
+		submit:   make(chan outboxItem, outboxSubmitBuffer),
+		stats:    OutboxStats{Enabled: config.enabled()},
+	}
+	o.refreshDepth()
+	return o
+}
+
+// SetConfig actualiza los límites del outbox
+func (o *Outbox) SetConfig(config *OutboxConfig) {
+	o.mu.Lock()
+	o.config = config
+	o.stats.Enabled = config.enabled()
+	o.mu.Unlock()
+}
+
+// Enqueue guarda un mensaje al final de la cola
+func (o *Outbox) Enqueue(topic string, payload []byte) error {
+	msg := &OutboxMessage{
+		ID:        primitive.NewObjectID(),
+		BrokerID:  o.brokerID,
+		Topic:     topic,
+		Payload:   payload,
+		CreatedAt: time.Now(),
+	}
+	if err := o.store.Append(msg); err != nil {
+		o.setError(err)
+		return err
+	}
+
+	o.mu.Lock()
+	o.stats.TotalQueued++
+	o.stats.Depth++
+	o.mu.Unlock()
+	o.updateGauge()
+
+	o.Notify()
+	return nil
+}
+
+// outboxItem mensaje nuevo pendiente de publicación directa
+type outboxItem struct {
+	topic   string
+	payload []byte
+}
+
+// Submit entrega un mensaje nuevo sin bloquear: dispatch lo publica directo y solo lo
+// persiste si falla. Si el buffer en memoria está lleno se persiste en el llamador.
+func (o *Outbox) Submit(topic string, payload []byte) error {
+	select {
+	case o.submit <- outboxItem{topic: topic, payload: payload}:
+		return nil
+	default:
+		return o.Enqueue(topic, payload)
+	}
+}
+
+// deliver publica un mensaje nuevo si hay conexión y nada en cola (para no adelantarse a
+// los pendientes); si no, o si la publicación falla, lo persiste para el reenvío
+func (o *Outbox) deliver(sender outboxSender, item outboxItem) {
+	if o.Depth() == 0 && sender != nil && sender.IsConnected() {
+		if result := sender.Publish(item.topic, item.payload); result.Success {
+			return
+		}
+	}
+	if err := o.Enqueue(item.topic, item.payload); err != nil {
+		fmt.Printf("⚠️ Outbox %s: could not queue message for %s: %v\n", o.brokerID, item.topic, err)
+	}
+}
+
+// dispatch publica los mensajes de Submit en orden hasta que se cancele el contexto; los
+// que queden en memoria se persisten para el próximo arranque
+func (o *Outbox) dispatch(ctx context.Context, sender func() outboxSender) {
+	for ctx.Err() == nil {
+		select {
+		case item := <-o.submit:
+			o.deliver(sender(), item)
+		case <-ctx.Done():
+		}
+	}
+
+	// Al detenerse, lo pendiente en memoria se persiste
+	for {
+		select {
+		case item := <-o.submit:
+			if err := o.Enqueue(item.topic, item.payload); err != nil {
+				fmt.Printf("⚠️ Outbox %s: message for %s lost on stop: %v\n", o.brokerID, item.topic, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Notify despierta el reenvío (mensaje nuevo o reconexión)
+func (o *Outbox) Notify() {
+	select {
+	case o.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Depth mensajes en cola
+func (o *Outbox) Depth() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stats.Depth
+}
+
+// GetStats retorna el estado del outbox
+func (o *Outbox) GetStats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stats
+}
+
+// Drain reenvía la cola en orden mientras haya conexión. Se detiene en el primer fallo para no
+// desordenar los mensajes; el resto se reintenta en la siguiente vuelta.
+func (o *Outbox) Drain(sender outboxSender) (int, error) {
+	o.drainMu.Lock()
+	defer o.drainMu.Unlock()
+
+	sent := 0
+	for sender != nil && sender.IsConnected() {
+		batch, err := o.store.Next(o.brokerID, outboxBatchSize)
+		if err != nil {
+			o.setError(err)
+			return sent, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		var published []primitive.ObjectID
+		var failure error
+		for _, msg := range batch {
+			result := sender.Publish(msg.Topic, msg.Payload)
+			if !result.Success {
+				failure = fmt.Errorf("%s", result.Error)
+				break
+			}
+			published = append(published, msg.ID)
+		}
+
+		if len(published) > 0 {
+			if err := o.store.Delete(o.brokerID, published); err != nil {
+				// Se reenviarán en la próxima vuelta (al menos una vez)
+				o.setError(err)
+				return sent, err
+			}
+			sent += len(published)
+
+			o.mu.Lock()
+			o.stats.TotalReplayed += int64(len(published))
+			o.stats.Depth -= int64(len(published))
+			if o.stats.Depth < 0 {
+				o.stats.Depth = 0
+			}
+			o.stats.LastReplayAt = time.Now()
+			o.mu.Unlock()
+			metrics.BrokerOutboxReplayedTotal.WithLabelValues(o.brokerID).Add(float64(len(published)))
+			o.updateGauge()
+		}
+
+		if failure != nil {
+			o.setError(failure)
+			return sent, failure
+		}
+	}
+	return sent, nil
+}
+
+// enforceLimits descarta los mensajes vencidos y, si la cola supera el máximo, los más antiguos
+func (o *Outbox) enforceLimits(now time.Time) {
+	o.mu.Lock()
+	maxAge, maxMessages := o.config.maxAge(), o.config.maxMessages()
+	o.mu.Unlock()
+
+	expired, err := o.store.DropOlderThan(o.brokerID, now.Add(-maxAge))
+	if err != nil {
+		o.setError(err)
+		return
+	}
+
+	var dropped int64
+	depth, err := o.store.Count(o.brokerID)
+	if err != nil {
+		o.setError(err)
+		return
+	}
+	if depth > maxMessages {
+		dropped, err = o.store.DropOldest(o.brokerID, depth-maxMessages)
+		if err != nil {
+			o.setError(err)
+		}
+		depth -= dropped
+	}
+
+	o.mu.Lock()
+	o.stats.TotalExpired += expired
+	o.stats.TotalDropped += dropped
+	o.stats.Depth = depth
+	o.mu.Unlock()
+	o.updateGauge()
+
+	if expired > 0 {
+		metrics.BrokerOutboxDroppedTotal.WithLabelValues(o.brokerID, "max_age").Add(float64(expired))
+		fmt.Printf("🗑️ Outbox %s: %d expired messages discarded\n", o.brokerID, expired)
+	}
+	if dropped > 0 {
+		metrics.BrokerOutboxDroppedTotal.WithLabelValues(o.brokerID, "max_messages").Add(float64(dropped))
+		fmt.Printf("🗑️ Outbox %s: %d oldest messages discarded (queue full)\n", o.brokerID, dropped)
+	}
+}
+
+// run reenvía la cola al recibir señales y periódicamente, hasta que se cancele el contexto
+func (o *Outbox) run(ctx context.Context, sender func() outboxSender) {
+	go o.dispatch(ctx, sender)
+
+	ticker := time.NewTicker(outboxTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.enforceLimits(time.Now())
+		case <-o.signal:
+		}
+
+		if sent, err := o.Drain(sender()); sent > 0 {
+			fmt.Printf("📤 Outbox %s: replayed %d queued messages\n", o.brokerID, sent)
+		} else if err != nil {
+			fmt.Printf("⚠️ Outbox %s: replay paused: %v\n", o.brokerID, err)
+		}
+	}
+}
+
+func (o *Outbox) refreshDepth() {
+	depth, err := o.store.Count(o.brokerID)
+	if err != nil {
+		o.setError(err)
+		return
+	}
+	o.mu.Lock()
+	o.stats.Depth = depth
+	o.mu.Unlock()
+	o.updateGauge()
+}
+
+func (o *Outbox) setError(err error) {
+	o.mu.Lock()
+	o.stats.LastError = err.Error()
+	o.mu.Unlock()
+}
+
+func (o *Outbox) updateGauge() {
+	metrics.BrokerOutboxDepth.WithLabelValues(o.brokerID).Set(float64(o.Depth()))
+}
+
+// ═══════════════════════════════════════════════════════════
+// MongoDB
+// ═══════════════════════════════════════════════════════════
+
+// mongoOutboxStore guarda los mensajes pendientes en la colección broker_outbox
+type mongoOutboxStore struct {
+	collection string
+}
+
+// NewMongoOutboxStore crea el store y asegura el índice por broker en orden de publicación
+func NewMongoOutboxStore() OutboxStore {
+	store := &mongoOutboxStore{collection: "broker_outbox"}
+
+	if database.Database != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		indexes := []mongo.IndexModel{
+			{Keys: bson.D{{Key: "broker_id", Value: 1}, {Key: "_id", Value: 1}}},
+			{Keys: bson.D{{Key: "broker_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		}
+		if _, err := database.GetCollection(store.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			fmt.Printf("⚠️  Warning: could not create broker outbox indexes: %v\n", err)
+		}
+	}
+
+	return store
+}
+
+func (s *mongoOutboxStore) Append(msg *OutboxMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.collection).InsertOne(ctx, msg)
+	return err
+}
+
+func (s *mongoOutboxStore) Next(brokerID string, limit int) ([]OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := database.GetCollection(s.collection).Find(ctx, bson.M{"broker_id": brokerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []OutboxMessage
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (s *mongoOutboxStore) Delete(brokerID string, ids []primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.collection).DeleteMany(ctx, bson.M{
+		"broker_id": brokerID,
+		"_id":       bson.M{"$in": ids},
+	})
+	return err
+}
+
+func (s *mongoOutboxStore) Count(brokerID string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return database.GetCollection(s.collection).CountDocuments(ctx, bson.M{"broker_id": brokerID})
+}
+
+func (s *mongoOutboxStore) DropOlderThan(brokerID string, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := database.GetCollection(s.collection).DeleteMany(ctx, bson.M{
+		"broker_id":  brokerID,
+		"created_at": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (s *mongoOutboxStore) DropOldest(brokerID string, n int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := database.GetCollection(s.collection)
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(n).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := collection.Find(ctx, bson.M{"broker_id": brokerID}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (s *mongoOutboxStore) Purge(brokerID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.collection).DeleteMany(ctx, bson.M{"broker_id": brokerID})
+	return err
+}
+
+// ═══════════════════════════════════════════════════════════
+// Memoria (tests)
+// ═══════════════════════════════════════════════════════════
+
+// memoryOutboxStore implementación en memoria del OutboxStore
+type memoryOutboxStore struct {
+	mu       sync.Mutex
+	messages map[string][]OutboxMessage // Key: broker_id, en orden de publicación
+}
+
+func newMemoryOutboxStore() *memoryOutboxStore {
+	return &memoryOutboxStore{messages: make(map[string][]OutboxMessage)}
+}
+
+func (s *memoryOutboxStore) Append(msg *OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[msg.BrokerID] = append(s.messages[msg.BrokerID], *msg)
+	return nil
+}
+
+func (s *memoryOutboxStore) Next(brokerID string, limit int) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.messages[brokerID]
+	if len(queue) > limit {
+		queue = queue[:limit]
+	}
+	return append([]OutboxMessage{}, queue...), nil
+}
+
+func (s *memoryOutboxStore) Delete(brokerID string, ids []primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remove := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+	s.filter(brokerID, func(msg OutboxMessage) bool { return !remove[msg.ID] })
+	return nil
+}
+
+func (s *memoryOutboxStore) Count(brokerID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.messages[brokerID])), nil
+}
+
+func (s *memoryOutboxStore) DropOlderThan(brokerID string, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter(brokerID, func(msg OutboxMessage) bool { return !msg.CreatedAt.Before(before) }), nil
+}
+
+func (s *memoryOutboxStore) DropOldest(brokerID string, n int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.messages[brokerID]
+	if n > int64(len(queue)) {
+		n = int64(len(queue))
+	}
+	s.messages[brokerID] = queue[n:]
+	return n, nil
+}
+
+func (s *memoryOutboxStore) Purge(brokerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.messages, brokerID)
+	return nil
+}
+
+// filter conserva los mensajes que cumplen keep y retorna cuántos se eliminaron
+func (s *memoryOutboxStore) filter(brokerID string, keep func(OutboxMessage) bool) int64 {
+	var kept []OutboxMessage
+	for _, msg := range s.messages[brokerID] {
+		if keep(msg) {
+			kept = append(kept, msg)
+		}
+	}
+	removed := int64(len(s.messages[brokerID]) - len(kept))
+	s.messages[brokerID] = kept
+	return removed
+}
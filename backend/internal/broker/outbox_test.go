@@ -0,0 +1,134 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	connected bool
+	failAt    int // Falla la publicación número failAt (1-based); 0 = nunca
+	published []string
+}
+
+func (s *fakeSender) IsConnected() bool { return s.connected }
+
+func (s *fakeSender) Publish(topic string, payload interface{}) PublishResult {
+	if s.failAt > 0 && len(s.published)+1 == s.failAt {
+		s.failAt = 0
+		return PublishResult{Topic: topic, Error: "timeout publishing message"}
+	}
+	s.published = append(s.published, string(payload.([]byte)))
+	return PublishResult{Topic: topic, Success: true}
+}
+
+func TestOutbox_StoreAndForwardInOrder(t *testing.T) {
+	store := newMemoryOutboxStore()
+	outbox := NewOutbox("farm-1", &OutboxConfig{}, store)
+	sender := &fakeSender{}
+
+	// Sin conexión los mensajes quedan en cola
+	for i := 1; i <= 5; i++ {
+		if err := outbox.Enqueue("omniapi/site/data", []byte(fmt.Sprintf("m%d", i))); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if sent, _ := outbox.Drain(sender); sent != 0 || outbox.Depth() != 5 {
+		t.Fatalf("expected messages kept while disconnected, sent=%d depth=%d", sent, outbox.Depth())
+	}
+
+	// Reconexión con un fallo en el tercer mensaje: se detiene para no desordenar
+	sender.connected = true
+	sender.failAt = 3
+	sent, err := outbox.Drain(sender)
+	if err == nil || sent != 2 || outbox.Depth() != 3 {
+		t.Fatalf("expected replay to stop at the failure, sent=%d depth=%d err=%v", sent, outbox.Depth(), err)
+	}
+
+	// El reintento continúa desde el mensaje que falló
+	if sent, err := outbox.Drain(sender); err != nil || sent != 3 {
+		t.Fatalf("expected remaining messages replayed, sent=%d err=%v", sent, err)
+	}
+	want := []string{"m1", "m2", "m3", "m4", "m5"}
+	if fmt.Sprint(sender.published) != fmt.Sprint(want) {
+		t.Errorf("expected in-order delivery %v, got %v", want, sender.published)
+	}
+
+	stats := outbox.GetStats()
+	if stats.Depth != 0 || stats.TotalQueued != 5 || stats.TotalReplayed != 5 || stats.LastError == "" {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestOutbox_PersistsOnlyWhatCannotBePublished(t *testing.T) {
+	store := newMemoryOutboxStore()
+	outbox := NewOutbox("farm-1", &OutboxConfig{}, store)
+	sender := &fakeSender{connected: true}
+
+	// Conectado y sin cola: se publica directo sin tocar el store
+	outbox.deliver(sender, outboxItem{topic: "t", payload: []byte("m1")})
+	if len(sender.published) != 1 || outbox.GetStats().TotalQueued != 0 {
+		t.Fatalf("expected direct publish without persisting, published=%v stats=%+v", sender.published, outbox.GetStats())
+	}
+
+	// Publicación fallida: se persiste para el reenvío
+	sender.failAt = 2
+	outbox.deliver(sender, outboxItem{topic: "t", payload: []byte("m2")})
+	if outbox.Depth() != 1 {
+		t.Fatalf("expected failed message queued, depth=%d", outbox.Depth())
+	}
+
+	// Con cola pendiente los nuevos van detrás para mantener el orden
+	outbox.deliver(sender, outboxItem{topic: "t", payload: []byte("m3")})
+	if outbox.Depth() != 2 || len(sender.published) != 1 {
+		t.Fatalf("expected message queued behind pending ones, depth=%d", outbox.Depth())
+	}
+	outbox.Drain(sender)
+	if fmt.Sprint(sender.published) != fmt.Sprint([]string{"m1", "m2", "m3"}) {
+		t.Errorf("expected in-order delivery, got %v", sender.published)
+	}
+
+	// Lo que quede en memoria al detenerse se persiste
+	outbox.Submit("t", []byte("m4"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outbox.dispatch(ctx, func() outboxSender { return sender })
+	if outbox.Depth() != 1 {
+		t.Errorf("expected pending message persisted on stop, depth=%d", outbox.Depth())
+	}
+}
+
+func TestOutbox_Limits(t *testing.T) {
+	store := newMemoryOutboxStore()
+	outbox := NewOutbox("farm-1", &OutboxConfig{MaxAgeS: 60, MaxMessages: 3}, store)
+
+	for i := 1; i <= 5; i++ {
+		outbox.Enqueue("t", []byte(fmt.Sprintf("m%d", i)))
+	}
+
+	// Se descartan los más antiguos al superar max_messages
+	outbox.enforceLimits(time.Now())
+	messages, _ := store.Next("farm-1", 10)
+	if len(messages) != 3 || string(messages[0].Payload) != "m3" {
+		t.Fatalf("expected the 3 newest messages, got %d starting at %s", len(messages), messages[0].Payload)
+	}
+
+	// Y todos los que superan max_age_s
+	outbox.enforceLimits(time.Now().Add(2 * time.Minute))
+	stats := outbox.GetStats()
+	if stats.Depth != 0 || stats.TotalDropped != 2 || stats.TotalExpired != 3 {
+		t.Errorf("unexpected stats after limits: %+v", stats)
+	}
+
+	// Un outbox nuevo (reinicio) recupera la profundidad persistida
+	outbox.Enqueue("t", []byte("m6"))
+	if restarted := NewOutbox("farm-1", nil, store); restarted.Depth() != 1 || !restarted.GetStats().Enabled {
+		t.Errorf("expected persisted depth on restart, got %+v", restarted.GetStats())
+	}
+
+	if err := (&OutboxConfig{MaxMessages: -1}).Validate(); err == nil {
+		t.Error("expected error for negative max_messages")
+	}
+}
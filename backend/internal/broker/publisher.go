@@ -11,21 +11,26 @@ import (
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-// BrokerConfig configuración de conexión al broker MQTT
+// BrokerConfig configuración de conexión a un broker de salida (MQTT, Kafka o AMQP)
 type BrokerConfig struct {
-	ID           string    `bson:"_id,omitempty" json:"id,omitempty"`
-	Name         string    `bson:"name" json:"name"`             // Nombre descriptivo
-	BrokerURL    string    `bson:"broker_url" json:"broker_url"` // tcp://host:port o ssl://host:port
-	ClientID     string    `bson:"client_id" json:"client_id"`   // ID único del cliente
-	Username     string    `bson:"username,omitempty" json:"username,omitempty"`
-	Password     string    `bson:"password,omitempty" json:"password,omitempty"`
-	QoS          byte      `bson:"qos" json:"qos"`           // 0, 1, 2
-	Retained     bool      `bson:"retained" json:"retained"` // Si los mensajes deben ser retained
-	CleanSession bool      `bson:"clean_session" json:"clean_session"`
-	KeepAlive    int       `bson:"keep_alive" json:"keep_alive"` // Segundos
-	Enabled      bool      `bson:"enabled" json:"enabled"`
-	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
-	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+	ID           string        `bson:"_id,omitempty" json:"id,omitempty"`
+	Name         string        `bson:"name" json:"name"`                     // Nombre descriptivo
+	Type         string        `bson:"type,omitempty" json:"type,omitempty"` // mqtt (default), kafka, amqp
+	BrokerURL    string        `bson:"broker_url" json:"broker_url"`         // tcp://host:port, ssl://, kafka://host:port[,host:port], amqp://host:port/vhost
+	ClientID     string        `bson:"client_id" json:"client_id"`           // ID único del cliente
+	Username     string        `bson:"username,omitempty" json:"username,omitempty"`
+	Password     string        `bson:"password,omitempty" json:"password,omitempty"`
+	QoS          byte          `bson:"qos" json:"qos"`           // 0, 1, 2
+	Retained     bool          `bson:"retained" json:"retained"` // Si los mensajes deben ser retained
+	CleanSession bool          `bson:"clean_session" json:"clean_session"`
+	KeepAlive    int           `bson:"keep_alive" json:"keep_alive"` // Segundos
+	Enabled      bool          `bson:"enabled" json:"enabled"`
+	Outbox       *OutboxConfig `bson:"outbox,omitempty" json:"outbox,omitempty"` // Cola persistente mientras no hay conexión
+	Kafka        *KafkaConfig  `bson:"kafka,omitempty" json:"kafka,omitempty"`   // Opciones del sink Kafka
+	AMQP         *AMQPConfig   `bson:"amqp,omitempty" json:"amqp,omitempty"`     // Opciones del sink AMQP 0-9-1
+	TLS          *TLSConfig    `bson:"tls,omitempty" json:"tls,omitempty"`       // Certificados para ssl://, kafka+ssl:// y amqps://
+	CreatedAt    time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time     `bson:"updated_at" json:"updated_at"`
 }
 
 // TopicTemplate template para generar topics dinámicamente
@@ -62,6 +67,7 @@ type Publisher struct {
 	mu         sync.RWMutex
 	connected  bool
 	onPublish  func(PublishResult)
+	onConnect  func()
 	stats      PublisherStats
 	ctx        context.Context
 	cancelFunc context.CancelFunc
@@ -107,6 +113,14 @@ func (p *Publisher) Connect(ctx context.Context) error {
 		opts.SetPassword(p.config.Password)
 	}
 
+	if p.config.TLS != nil {
+		tlsConfig, err := p.config.TLS.build("")
+		if err != nil {
+			return err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
 	opts.SetCleanSession(p.config.CleanSession)
 	opts.SetKeepAlive(time.Duration(p.config.KeepAlive) * time.Second)
 	opts.SetAutoReconnect(true)
@@ -117,8 +131,13 @@ func (p *Publisher) Connect(ctx context.Context) error {
 		p.mu.Lock()
 		p.connected = true
 		p.stats.ConnectedSince = time.Now()
+		onConnect := p.onConnect
 		p.mu.Unlock()
 		fmt.Printf("📡 MQTT Publisher connected to %s\n", p.config.BrokerURL)
+
+		if onConnect != nil {
+			onConnect()
+		}
 	})
 
 	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
@@ -188,21 +207,11 @@ func (p *Publisher) Publish(topic string, payload interface{}) PublishResult {
 	p.mu.RUnlock()
 
 	// Serializar payload
-	var payloadBytes []byte
-	var err error
-
-	switch v := payload.(type) {
-	case []byte:
-		payloadBytes = v
-	case string:
-		payloadBytes = []byte(v)
-	default:
-		payloadBytes, err = json.Marshal(payload)
-		if err != nil {
-			result.Error = fmt.Sprintf("error serializing payload: %v", err)
-			p.recordError(result.Error)
-			return result
-		}
+	payloadBytes, err := serializePayload(payload)
+	if err != nil {
+		result.Error = err.Error()
+		p.recordError(result.Error)
+		return result
 	}
 
 	// Publicar
@@ -237,6 +246,29 @@ func (p *Publisher) PublishAsync(topic string, payload interface{}) {
 	}()
 }
 
+// serializePayload convierte el payload a bytes: []byte y string tal cual, el resto como JSON
+func serializePayload(payload interface{}) ([]byte, error) {
+	switch v := payload.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing payload: %w", err)
+		}
+		return data, nil
+	}
+}
+
+// OnConnect registra callback para cada conexión o reconexión al broker
+func (p *Publisher) OnConnect(callback func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onConnect = callback
+}
+
 // OnPublish registra callback para resultados de publicación
 func (p *Publisher) OnPublish(callback func(PublishResult)) {
 	p.onPublish = callback
@@ -335,4 +367,9 @@ var DefaultTopicTemplates = []TopicTemplate{
 		Pattern:     "omniapi/data/{instance_id}",
 		Description: "Topic plano por instancia",
 	},
+	{
+		Name:        "dotted",
+		Pattern:     "omniapi.{tenant}.{site}.{provider}.{endpoint}",
+		Description: "Separado por puntos, para topics de Kafka y routing keys de AMQP",
+	},
 }
@@ -0,0 +1,261 @@
+package broker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tipos de sink de salida
+const (
+	SinkMQTT  = "mqtt"
+	SinkKafka = "kafka"
+	SinkAMQP  = "amqp"
+)
+
+const (
+	// Espera entre intentos de reconexión de los sinks Kafka y AMQP (crece hasta el máximo)
+	sinkReconnectInitial = time.Second
+	sinkReconnectMax     = 30 * time.Second
+
+	// sinkPublishTimeout espera máxima de la confirmación de un mensaje
+	sinkPublishTimeout = 5 * time.Second
+)
+
+// Sink destino de publicación de un broker. Publisher (MQTT), KafkaSink y AMQPSink lo implementan;
+// el topic recibido es el generado con BuildTopic y cada sink lo adapta a su protocolo.
+type Sink interface {
+	Connect(ctx context.Context) error
+	Disconnect()
+	IsConnected() bool
+	// Publish publica y espera la confirmación del broker (PUBACK, acks de Kafka, publisher confirms)
+	Publish(topic string, payload interface{}) PublishResult
+	// OnConnect registra callback para cada conexión o reconexión
+	OnConnect(callback func())
+	GetStats() PublisherStats
+}
+
+// NewSink crea el sink correspondiente al tipo del broker
+func NewSink(config *BrokerConfig) Sink {
+	switch config.SinkType() {
+	case SinkKafka:
+		return NewKafkaSink(config)
+	case SinkAMQP:
+		return NewAMQPSink(config)
+	default:
+		return NewPublisher(config)
+	}
+}
+
+// SinkType tipo de sink del broker (mqtt si no se indica)
+func (c *BrokerConfig) SinkType() string {
+	if c.Type == "" {
+		return SinkMQTT
+	}
+	return strings.ToLower(c.Type)
+}
+
+// Validate verifica la configuración del broker según su tipo
+func (c *BrokerConfig) Validate() error {
+	if err := c.Outbox.Validate(); err != nil {
+		return err
+	}
+	if err := c.TLS.Validate(); err != nil {
+		return err
+	}
+
+	switch c.SinkType() {
+	case SinkMQTT:
+		return nil
+	case SinkKafka:
+		if _, _, err := parseKafkaURL(c.BrokerURL); err != nil {
+			return err
+		}
+		return c.Kafka.Validate()
+	case SinkAMQP:
+		if _, err := url.Parse(c.BrokerURL); err != nil || !strings.HasPrefix(c.BrokerURL, "amqp") {
+			return fmt.Errorf("amqp broker_url must be amqp://host:port/vhost or amqps://")
+		}
+		return c.AMQP.Validate()
+	default:
+		return fmt.Errorf("unsupported broker type: %s", c.Type)
+	}
+}
+
+// TLSConfig certificados de las conexiones TLS (ssl://, kafka+ssl://, amqps://). Sin
+// configurar se valida el broker con las CAs del sistema.
+type TLSConfig struct {
+	CAFile             string `bson:"ca_file,omitempty" json:"ca_file,omitempty"`                           // CA (PEM) para validar el broker
+	CertFile           string `bson:"cert_file,omitempty" json:"cert_file,omitempty"`                       // Certificado de cliente (PEM)
+	KeyFile            string `bson:"key_file,omitempty" json:"key_file,omitempty"`                         // Clave del certificado de cliente (PEM)
+	InsecureSkipVerify bool   `bson:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"` // No validar el certificado del broker (solo pruebas)
+}
+
+// Validate verifica las opciones TLS
+func (c *TLSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	return nil
+}
+
+// build crea la configuración TLS; serverName vacío deja que el cliente use el host del broker
+func (c *TLSConfig) build(serverName string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName}
+	if c == nil {
+		return config, nil
+	}
+	config.InsecureSkipVerify = c.InsecureSkipVerify
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls.ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls.ca_file has no PEM certificates")
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading tls client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// sinkState estado común de los sinks Kafka y AMQP: conexión, estadísticas y reconexión
+type sinkState struct {
+	mu           sync.RWMutex
+	connected    bool
+	reconnecting bool
+	stats        PublisherStats
+	onConnect    func()
+}
+
+// IsConnected retorna si está conectado
+func (s *sinkState) IsConnected() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connected
+}
+
+// GetStats retorna estadísticas
+func (s *sinkState) GetStats() PublisherStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats
+}
+
+// OnConnect registra callback para cada conexión o reconexión
+func (s *sinkState) OnConnect(callback func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onConnect = callback
+}
+
+// setConnected marca la conexión como establecida y notifica al callback
+func (s *sinkState) setConnected() {
+	s.mu.Lock()
+	s.connected = true
+	s.stats.ConnectedSince = time.Now()
+	onConnect := s.onConnect
+	s.mu.Unlock()
+
+	if onConnect != nil {
+		onConnect()
+	}
+}
+
+func (s *sinkState) setDisconnected() {
+	s.mu.Lock()
+	s.connected = false
+	s.mu.Unlock()
+}
+
+// connectionLost marca la conexión como caída y reintenta dial en segundo plano hasta
+// lograrlo o hasta que se cancele ctx (Disconnect)
+func (s *sinkState) connectionLost(ctx context.Context, name string, err error, dial func(context.Context) error) {
+	s.mu.Lock()
+	s.connected = false
+	s.stats.LastError = err.Error()
+	s.stats.LastErrorAt = time.Now()
+	if s.reconnecting || ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.reconnecting = true
+	s.mu.Unlock()
+
+	fmt.Printf("⚠️ %s disconnected: %v\n", name, err)
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.reconnecting = false
+			s.mu.Unlock()
+		}()
+
+		delay := sinkReconnectInitial
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			s.mu.Lock()
+			s.stats.ReconnectCount++
+			s.mu.Unlock()
+			fmt.Printf("🔄 %s reconnecting...\n", name)
+
+			if err := dial(ctx); err == nil {
+				fmt.Printf("📡 %s reconnected\n", name)
+				s.setConnected()
+				return
+			}
+
+			delay *= 2
+			if delay > sinkReconnectMax {
+				delay = sinkReconnectMax
+			}
+		}
+	}()
+}
+
+func (s *sinkState) recordSuccess() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.TotalPublished++
+	s.stats.TotalSuccess++
+	s.stats.LastPublishAt = time.Now()
+}
+
+func (s *sinkState) recordError(errMsg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.TotalPublished++
+	s.stats.TotalErrors++
+	s.stats.LastError = errMsg
+	s.stats.LastErrorAt = time.Now()
+}
+
+// fail registra el error en las estadísticas y lo retorna como resultado
+func (s *sinkState) fail(result PublishResult, err error) PublishResult {
+	result.Error = err.Error()
+	s.recordError(result.Error)
+	return result
+}
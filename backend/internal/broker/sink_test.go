@@ -0,0 +1,488 @@
+package broker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+)
+
+// ═══════════════════════════════════════════════════════════
+// Kafka en proceso: un nodo con dos particiones por topic
+// ═══════════════════════════════════════════════════════════
+
+type kafkaRecord struct {
+	topic     string
+	partition int32
+	key       []byte
+	value     []byte
+}
+
+type fakeKafka struct {
+	addr     string
+	port     int32
+	records  chan kafkaRecord
+	produces atomic.Int64 // Requests de produce recibidos (un lote por partición)
+
+	mu     sync.Mutex
+	topics map[string]bool // Topics creados al pedir su metadata
+}
+
+func startFakeKafka(t *testing.T) *fakeKafka {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	_, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	broker := &fakeKafka{addr: ln.Addr().String(), port: int32(port), records: make(chan kafkaRecord, 100), topics: make(map[string]bool)}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(t, conn)
+		}
+	}()
+	return broker
+}
+
+func (b *fakeKafka) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		version, correlationID, _, msg, err := protocol.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+
+		var resp protocol.Message
+		switch req := msg.(type) {
+		case *apiversions.Request:
+			var keys []apiversions.ApiKeyResponse
+			for _, key := range []protocol.ApiKey{protocol.ApiVersions, protocol.Metadata, protocol.Produce} {
+				keys = append(keys, apiversions.ApiKeyResponse{ApiKey: int16(key), MinVersion: key.MinVersion(), MaxVersion: key.MaxVersion()})
+			}
+			resp = &apiversions.Response{ApiKeys: keys}
+		case *metadata.Request:
+			meta := &metadata.Response{Brokers: []metadata.ResponseBroker{{NodeID: 0, Host: "127.0.0.1", Port: b.port}}}
+			for _, topic := range b.metadataTopics(req.TopicNames) {
+				meta.Topics = append(meta.Topics, metadata.ResponseTopic{Name: topic, Partitions: []metadata.ResponsePartition{
+					{PartitionIndex: 0, ReplicaNodes: []int32{0}, IsrNodes: []int32{0}},
+					{PartitionIndex: 1, ReplicaNodes: []int32{0}, IsrNodes: []int32{0}},
+				}})
+			}
+			resp = meta
+		case *produce.Request:
+			b.produces.Add(1)
+			produced := &produce.Response{}
+			for _, topic := range req.Topics {
+				result := produce.ResponseTopic{Topic: topic.Topic}
+				for _, partition := range topic.Partitions {
+					for {
+						record, err := partition.RecordSet.Records.ReadRecord()
+						if err != nil {
+							break
+						}
+						key, _ := protocol.ReadAll(record.Key)
+						value, _ := protocol.ReadAll(record.Value)
+						b.records <- kafkaRecord{topic: topic.Topic, partition: partition.Partition, key: key, value: value}
+					}
+					result.Partitions = append(result.Partitions, produce.ResponsePartition{Partition: partition.Partition})
+				}
+				produced.Topics = append(produced.Topics, result)
+			}
+			if req.Acks == 0 {
+				continue
+			}
+			resp = produced
+		default:
+			t.Errorf("unexpected kafka request %T", msg)
+			return
+		}
+
+		if err := protocol.WriteResponse(conn, version, correlationID, resp); err != nil {
+			return
+		}
+	}
+}
+
+// metadataTopics crea los topics pedidos; sin nombres retorna todos los conocidos
+func (b *fakeKafka) metadataTopics(names []string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range names {
+		b.topics[name] = true
+	}
+	if len(names) > 0 {
+		return names
+	}
+	for name := range b.topics {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestKafkaSink_Publish(t *testing.T) {
+	broker := startFakeKafka(t)
+	topic := BuildTopic("omniapi/{tenant}/{site}/{endpoint}", map[string]string{"tenant": "acme", "site": "Farm 1", "endpoint": "oxygen"})
+
+	// Topic derivado del template
+	config := &BrokerConfig{Name: "kafka", Type: "kafka", BrokerURL: "kafka://" + broker.addr, ClientID: "test"}
+	if err := (&Manager{}).TestConnection(config); err != nil {
+		t.Fatalf("expected connection test to succeed, got %v", err)
+	}
+
+	sink := NewSink(config)
+	if _, ok := sink.(*KafkaSink); !ok {
+		t.Fatalf("expected KafkaSink, got %T", sink)
+	}
+	if err := sink.Connect(t.Context()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer sink.Disconnect()
+
+	result := sink.Publish(topic, map[string]interface{}{"value": 7.5})
+	if !result.Success || result.Topic != "omniapi.acme.farm_1.oxygen" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	record := <-broker.records
+	if record.topic != "omniapi.acme.farm_1.oxygen" || record.key != nil || string(record.value) != `{"value":7.5}` {
+		t.Errorf("unexpected record: topic=%s key=%q value=%s", record.topic, record.key, record.value)
+	}
+
+	// Topic fijo: el topic generado viaja como key y define la partición
+	fixed := &BrokerConfig{Type: "kafka", BrokerURL: "kafka://" + broker.addr, Kafka: &KafkaConfig{Topic: "telemetry", Acks: "all"}}
+	keyed := NewSink(fixed)
+	if err := keyed.Connect(t.Context()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer keyed.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		if result := keyed.Publish(topic, []byte("raw")); !result.Success {
+			t.Fatalf("unexpected error: %s", result.Error)
+		}
+	}
+	first, second := <-broker.records, <-broker.records
+	if first.topic != "telemetry" || string(first.key) != topic || first.partition != second.partition {
+		t.Errorf("expected keyed records on the same partition, got %+v / %+v", first, second)
+	}
+	if stats := keyed.GetStats(); stats.TotalSuccess != 2 || stats.TotalErrors != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestKafkaSink_BatchesConcurrentPublishes(t *testing.T) {
+	broker := startFakeKafka(t)
+	config := &BrokerConfig{Type: "kafka", BrokerURL: "kafka://" + broker.addr, Kafka: &KafkaConfig{Topic: "telemetry", LingerMS: 200}}
+
+	sink := NewSink(config)
+	if err := sink.Connect(t.Context()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer sink.Disconnect()
+
+	const messages = 20
+	var wg sync.WaitGroup
+	for i := 0; i < messages; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if result := sink.Publish(fmt.Sprintf("omniapi/acme/cage-%d", i), "x"); !result.Success {
+				t.Errorf("publish %d failed: %s", i, result.Error)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < messages; i++ {
+		<-broker.records
+	}
+	if produces := broker.produces.Load(); produces >= messages {
+		t.Errorf("expected concurrent publishes to share batches, got %d produce requests", produces)
+	}
+}
+
+// ═══════════════════════════════════════════════════════════
+// AMQP en proceso: handshake, canal en modo confirm, acks y devoluciones
+// ═══════════════════════════════════════════════════════════
+
+const (
+	testAMQPFrameMethod = 1
+	testAMQPFrameHeader = 2
+	testAMQPFrameBody   = 3
+)
+
+type amqpMessage struct {
+	exchange   string
+	routingKey string
+	body       string
+}
+
+type amqpTestFrame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+// method identificador class<<16|method de un frame de método
+func (f amqpTestFrame) method() uint32 {
+	if f.typ != testAMQPFrameMethod || len(f.payload) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(f.payload)
+}
+
+func readAMQPTestFrame(r io.Reader) (amqpTestFrame, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return amqpTestFrame{}, err
+	}
+	frame := amqpTestFrame{typ: header[0], channel: binary.BigEndian.Uint16(header[1:3])}
+	frame.payload = make([]byte, binary.BigEndian.Uint32(header[3:7])+1)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return frame, err
+	}
+	frame.payload = frame.payload[:len(frame.payload)-1] // frame-end
+	return frame, nil
+}
+
+func writeAMQPTestFrame(w io.Writer, typ byte, channel uint16, payload []byte) {
+	frame := []byte{typ}
+	frame = binary.BigEndian.AppendUint16(frame, channel)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(payload)))
+	frame = append(frame, payload...)
+	w.Write(append(frame, 0xCE))
+}
+
+func amqpShortstr(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+
+func amqpLongstr(s string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(s))), s...)
+}
+
+// readShortstr lee un shortstr y retorna el resto del buffer
+func readShortstr(buf []byte) (string, []byte) {
+	n := int(buf[0])
+	return string(buf[1 : 1+n]), buf[1+n:]
+}
+
+func startFakeAMQP(t *testing.T) (string, chan amqpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan amqpMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeAMQP(t, conn, messages)
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func serveFakeAMQP(t *testing.T, conn net.Conn, messages chan amqpMessage) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	send := func(channel uint16, method uint32, args []byte) {
+		writeAMQPTestFrame(conn, testAMQPFrameMethod, channel, append(binary.BigEndian.AppendUint32(nil, method), args...))
+	}
+	// next lee el siguiente frame de método (se ignoran los heartbeats)
+	next := func() (amqpTestFrame, error) {
+		for {
+			frame, err := readAMQPTestFrame(reader)
+			if err != nil || frame.typ == testAMQPFrameMethod {
+				return frame, err
+			}
+		}
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header) != "AMQP\x00\x00\x09\x01" {
+		t.Errorf("unexpected protocol header %q", header)
+		return
+	}
+
+	// Connection.Start: versión 0-9, sin propiedades, PLAIN
+	start := append([]byte{0, 9}, 0, 0, 0, 0)
+	start = append(start, amqpLongstr("PLAIN")...)
+	send(0, 10<<16|10, append(start, amqpLongstr("en_US")...))
+
+	startOk, err := next()
+	if err != nil {
+		return
+	}
+	args := startOk.payload[4:]
+	args = args[4+binary.BigEndian.Uint32(args):] // client-properties
+	_, args = readShortstr(args)                  // mechanism
+	if response := string(args[4 : 4+binary.BigEndian.Uint32(args)]); response != "\x00guest\x00secret" {
+		t.Errorf("unexpected PLAIN response %q", response)
+	}
+
+	// Connection.Tune: sin límite de canales, frame_max 4096, sin heartbeat
+	send(0, 10<<16|30, []byte{0, 0, 0, 0, 16, 0, 0, 0})
+	next() // Connection.TuneOk
+
+	open, _ := next()
+	if vhost, _ := readShortstr(open.payload[4:]); vhost != "plant" {
+		t.Errorf("expected vhost plant, got %s", vhost)
+	}
+	send(0, 10<<16|41, []byte{0})
+
+	var tag uint64
+	for {
+		frame, err := next()
+		if err != nil {
+			return
+		}
+		switch frame.method() {
+		case 10<<16 | 50: // Connection.Close
+			send(0, 10<<16|51, nil)
+			return
+		case 20<<16 | 10: // Channel.Open
+			send(frame.channel, 20<<16|11, []byte{0, 0, 0, 0})
+		case 85<<16 | 10: // Confirm.Select
+			send(frame.channel, 85<<16|11, nil)
+		case 60<<16 | 40: // Basic.Publish
+			var message amqpMessage
+			message.exchange, args = readShortstr(frame.payload[6:])
+			message.routingKey, _ = readShortstr(args)
+
+			contentHeader, _ := readAMQPTestFrame(reader)
+			size := binary.BigEndian.Uint64(contentHeader.payload[4:12])
+			var body []byte
+			for uint64(len(body)) < size {
+				frame, err := readAMQPTestFrame(reader)
+				if err != nil {
+					return
+				}
+				body = append(body, frame.payload...)
+			}
+			message.body = string(body)
+			messages <- message
+
+			// Sin cola para el mensaje: Basic.Return (con las mismas propiedades) antes del ack
+			if strings.Contains(message.routingKey, "unroutable") {
+				ret := binary.BigEndian.AppendUint16(nil, 312)
+				ret = append(ret, amqpShortstr("NO_ROUTE")...)
+				ret = append(ret, amqpShortstr(message.exchange)...)
+				send(frame.channel, 60<<16|50, append(ret, amqpShortstr(message.routingKey)...))
+				writeAMQPTestFrame(conn, testAMQPFrameHeader, frame.channel, contentHeader.payload)
+				writeAMQPTestFrame(conn, testAMQPFrameBody, frame.channel, body)
+			}
+
+			tag++
+			method := uint32(60<<16 | 80) // Basic.Ack
+			if strings.Contains(message.routingKey, "reject") {
+				method = 60<<16 | 120 // Basic.Nack
+			}
+			send(frame.channel, method, append(binary.BigEndian.AppendUint64(nil, tag), 0))
+		}
+	}
+}
+
+func TestAMQPSink_Publish(t *testing.T) {
+	addr, messages := startFakeAMQP(t)
+	config := &BrokerConfig{
+		Type:      "amqp",
+		BrokerURL: "amqp://guest:secret@" + addr + "/plant",
+		QoS:       1,
+		AMQP:      &AMQPConfig{Exchange: "omniapi", Mandatory: true},
+	}
+	if err := (&Manager{}).TestConnection(config); err != nil {
+		t.Fatalf("expected connection test to succeed, got %v", err)
+	}
+
+	sink := NewSink(config)
+	if err := sink.Connect(t.Context()); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer sink.Disconnect()
+
+	// Body mayor que frame_max: se envía en varios frames
+	large := strings.Repeat("x", 10000)
+	result := sink.Publish("omniapi/acme/farm_1/oxygen", large)
+	if !result.Success || result.Topic != "omniapi.acme.farm_1.oxygen" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	message := <-messages
+	if message.exchange != "omniapi" || message.routingKey != "omniapi.acme.farm_1.oxygen" || message.body != large {
+		t.Errorf("unexpected message: exchange=%s key=%s body=%d bytes", message.exchange, message.routingKey, len(message.body))
+	}
+
+	// Un nack del broker es un error de publicación
+	if result := sink.Publish("omniapi/reject", "x"); result.Success {
+		t.Error("expected nack to fail the publish")
+	}
+	<-messages
+
+	// Mandatory: un mensaje devuelto por el broker también
+	if result := sink.Publish("omniapi/unroutable", "x"); result.Success || !strings.Contains(result.Error, "NO_ROUTE") {
+		t.Errorf("expected returned message to fail the publish, got %+v", result)
+	}
+	<-messages
+
+	stats := sink.GetStats()
+	if stats.TotalSuccess != 1 || stats.TotalErrors != 2 || !sink.IsConnected() {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestBrokerConfig_Validate(t *testing.T) {
+	valid := []*BrokerConfig{
+		{BrokerURL: "tcp://localhost:1883"},
+		{Type: "kafka", BrokerURL: "kafka://a:9092,b", Kafka: &KafkaConfig{Acks: "leader", SASLMechanism: "SCRAM-SHA-512"}},
+		{Type: "kafka", BrokerURL: "kafka+ssl://a:9093", TLS: &TLSConfig{CertFile: "client.pem", KeyFile: "client.key"}},
+		{Type: "AMQP", BrokerURL: "amqps://rabbit/prod", AMQP: &AMQPConfig{Exchange: "data", Declare: true}},
+	}
+	for _, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Errorf("expected %s %s to be valid, got %v", config.Type, config.BrokerURL, err)
+		}
+	}
+
+	invalid := []*BrokerConfig{
+		{Type: "nats", BrokerURL: "nats://localhost"},
+		{Type: "kafka", BrokerURL: "http://localhost:9092"},
+		{Type: "kafka", BrokerURL: "kafka://localhost", Kafka: &KafkaConfig{Acks: "two"}},
+		{Type: "kafka", BrokerURL: "kafka://localhost", Kafka: &KafkaConfig{SASLMechanism: "gssapi"}},
+		{Type: "kafka", BrokerURL: "kafka+ssl://localhost", TLS: &TLSConfig{CertFile: "client.pem"}},
+		{Type: "amqp", BrokerURL: "tcp://rabbit"},
+		{Type: "amqp", BrokerURL: "amqp://rabbit", AMQP: &AMQPConfig{Declare: true}},
+	}
+	for _, config := range invalid {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected %s %s to be invalid", config.Type, config.BrokerURL)
+		}
+	}
+
+	if name := kafkaTopicName("omniapi/acme/site#1/"); name != "omniapi.acme.site_1" {
+		t.Errorf("unexpected kafka topic name %s", name)
+	}
+}
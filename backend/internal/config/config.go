@@ -44,6 +44,7 @@ type AppConfig struct {
 	Policies  PoliciesConfig  `yaml:"policies"`
 	Requester RequesterConfig `yaml:"requester"`
 	Status    StatusConfig    `yaml:"status"`
+	Rollups   []RollupConfig  `yaml:"rollups"`
 }
 
 // HTTPConfig configuración del servidor HTTP
@@ -86,6 +87,15 @@ type QuotasConfig struct {
 	Default []QuotaConfig `yaml:"default"`
 }
 
+// ToDomainQuotas convierte las quotas por defecto a entidades de dominio
+func (qc QuotasConfig) ToDomainQuotas() []domain.Quota {
+	quotas := make([]domain.Quota, 0, len(qc.Default))
+	for _, quotaConfig := range qc.Default {
+		quotas = append(quotas, domain.Quota{Resource: quotaConfig.Resource, Limit: quotaConfig.Limit})
+	}
+	return quotas
+}
+
 // QuotaConfig configuración de una quota específica
 type QuotaConfig struct {
 	Resource string `yaml:"resource"`
@@ -117,6 +127,7 @@ type RequesterConfig struct {
 	TimeoutSeconds int                  `yaml:"timeout_seconds"`
 	BackoffSeconds []int                `yaml:"backoff_seconds"`
 	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	FailoverPolicy string               `yaml:"failover_policy"` // priority|fallback|merge|round_robin (default: fallback)
 }
 
 // CircuitBreakerConfig configuración del circuit breaker
@@ -130,6 +141,24 @@ type StatusConfig struct {
 	HeartbeatSeconds int `yaml:"heartbeat_seconds"`
 }
 
+// RollupConfig ventana de agregación publicada como salida a un broker
+type RollupConfig struct {
+	Name      string   `yaml:"name"`
+	TenantID  string   `yaml:"tenant_id"`
+	Kind      string   `yaml:"kind"`
+	FarmID    string   `yaml:"farm_id"`
+	SiteID    string   `yaml:"site_id"`
+	Metric    string   `yaml:"metric"` // Métrica exacta o prefijo ("climate.*")
+	Where     string   `yaml:"where"`  // Predicado sobre el payload
+	Window    string   `yaml:"window"` // 1m, 5m o 1h
+	Slide     string   `yaml:"slide"`  // Paso de la ventana deslizante (default: window)
+	Fields    []string `yaml:"fields"`
+	Functions []string `yaml:"functions"` // min, max, avg, sum, count (default: todas)
+	GroupBy   string   `yaml:"group_by"`  // stream (default), site, farm o tenant
+	BrokerID  string   `yaml:"broker_id"`
+	Topic     string   `yaml:"topic"` // Template del topic (default: omniapi/rollups/{tenant_id}/{kind}/{site}/{window})
+}
+
 // TenantConfig configuración de un tenant
 type TenantConfig struct {
 	ID          string                 `yaml:"id"`
@@ -195,7 +224,7 @@ type TransformConfig struct {
 
 // SecretRef representa una referencia a un secreto
 type SecretRef struct {
-	Provider string `yaml:"provider"` // "env", "file", "vault", etc.
+	Provider string `yaml:"provider"` // "env", "file", "encfile", "vault" (ver secrets.go)
 	Key      string `yaml:"key"`      // La clave del secreto
 }
 
@@ -374,7 +403,7 @@ func loadMappingsConfig(config *Config) error {
 
 // resolveSecrets resuelve todas las referencias de secretos en la configuración
 func resolveSecrets(config *Config) error {
-	secretProvider := &EnvSecretProvider{}
+	secretProvider := GetSecretRegistry()
 
 	// Resolver secreto de JWT
 	if config.App.Auth.JWTSecret.Provider != "" {
@@ -439,6 +468,9 @@ func getDefaultAppConfig() AppConfig {
 				{Resource: "storage_gb", Limit: 10},
 				{Resource: "connections", Limit: 5},
 				{Resource: "streams", Limit: 50},
+				{Resource: "events_per_day", Limit: 10000},
+				{Resource: "concurrent_connections", Limit: 10},
+				{Resource: "polling_configs", Limit: 20},
 			},
 		},
 		Policies: PoliciesConfig{
@@ -551,7 +583,7 @@ func (cic *ConnectionInstanceConfig) ToDomainConnectionInstance() (*domain.Conne
 		TypeID:      typeID,
 		DisplayName: cic.DisplayName,
 		Description: cic.Description,
-		SecretsRef:  fmt.Sprintf("%s://%s", cic.SecretsRef.Provider, cic.SecretsRef.Key),
+		SecretsRef:  cic.SecretsRef.String(),
 		Config:      cic.Config,
 		Mappings:    []domain.Mapping{},
 		Status:      domain.ConnectionStatus(cic.Status),
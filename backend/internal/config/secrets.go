@@ -0,0 +1,396 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"omniapi/internal/crypto"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Proveedores de secretos soportados
+const (
+	SecretProviderEnv     = "env"     // Variable de entorno (key: nombre de la variable)
+	SecretProviderFile    = "file"    // Archivo en un directorio de secretos montado (key: ruta relativa)
+	SecretProviderEncFile = "encfile" // Archivo local cifrado con el crypto service (key: nombre del secreto)
+	SecretProviderVault   = "vault"   // HashiCorp Vault KV (key: "ruta#campo")
+)
+
+// ServiceSecretEnvPrefix prefijo obligatorio de las variables que pueden referenciar las
+// credenciales de servicios externos (env://OMNIAPI_SECRET_*). Las referencias de los
+// archivos de configuración no tienen esta restricción.
+const ServiceSecretEnvPrefix = "OMNIAPI_SECRET_"
+
+// String retorna la referencia en formato URI ("provider://key")
+func (r SecretRef) String() string {
+	if r.Provider == "" {
+		return ""
+	}
+	return r.Provider + "://" + r.Key
+}
+
+// ParseSecretRef parsea una referencia en formato URI ("vault://omniapi/innovex#client_secret")
+func ParseSecretRef(uri string) (SecretRef, error) {
+	provider, key, ok := strings.Cut(strings.TrimSpace(uri), "://")
+	if !ok || provider == "" || key == "" {
+		return SecretRef{}, fmt.Errorf("invalid secret reference %q: expected provider://key", uri)
+	}
+	return SecretRef{Provider: provider, Key: key}, nil
+}
+
+// ValidateServiceSecretRef verifica una referencia de credenciales de un servicio externo.
+// Se guardan desde la API y su valor se envía al base_url del servicio, así que env:// solo
+// puede nombrar variables con ServiceSecretEnvPrefix (no JWT_SECRET, ENCRYPTION_KEY, etc.).
+func ValidateServiceSecretRef(ref SecretRef) error {
+	if ref.Provider == SecretProviderEnv && (!strings.HasPrefix(ref.Key, ServiceSecretEnvPrefix) || ref.Key == ServiceSecretEnvPrefix) {
+		return fmt.Errorf("env secret references must name a variable prefixed with %s: %s", ServiceSecretEnvPrefix, ref.Key)
+	}
+	return nil
+}
+
+// SecretRegistry resuelve referencias delegando en el proveedor registrado para cada nombre
+type SecretRegistry struct {
+	providers map[string]SecretProvider
+	mu        sync.RWMutex
+}
+
+// NewSecretRegistry crea un registry vacío
+func NewSecretRegistry() *SecretRegistry {
+	return &SecretRegistry{
+		providers: make(map[string]SecretProvider),
+	}
+}
+
+// Register registra (o reemplaza) el proveedor para un nombre
+func (r *SecretRegistry) Register(name string, provider SecretProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = provider
+}
+
+// Providers retorna los nombres de los proveedores registrados
+func (r *SecretRegistry) Providers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Supports indica si hay un proveedor registrado con ese nombre
+func (r *SecretRegistry) Supports(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.providers[name]
+	return ok
+}
+
+// GetSecret resuelve una referencia con su proveedor (implementa SecretProvider)
+func (r *SecretRegistry) GetSecret(ref SecretRef) (string, error) {
+	r.mu.RLock()
+	provider, ok := r.providers[ref.Provider]
+	r.mu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("unsupported provider: %s", ref.Provider)
+	}
+	return provider.GetSecret(ref)
+}
+
+// Resolve resuelve una referencia en formato URI
+func (r *SecretRegistry) Resolve(uri string) (string, error) {
+	ref, err := ParseSecretRef(uri)
+	if err != nil {
+		return "", err
+	}
+	return r.GetSecret(ref)
+}
+
+// ResolveServiceRef resuelve una referencia de credenciales de un servicio externo
+// (aplica ValidateServiceSecretRef también a las ya guardadas)
+func (r *SecretRegistry) ResolveServiceRef(uri string) (string, error) {
+	ref, err := ParseSecretRef(uri)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateServiceSecretRef(ref); err != nil {
+		return "", err
+	}
+	return r.GetSecret(ref)
+}
+
+var (
+	secretRegistry     *SecretRegistry
+	secretRegistryOnce sync.Once
+)
+
+// GetSecretRegistry retorna el registry global configurado desde variables de entorno:
+//   - env: siempre disponible
+//   - file: SECRETS_DIR (default /run/secrets)
+//   - encfile: SECRETS_FILE (default configs/secrets.enc.yaml), cifrado con el crypto service
+//   - vault: solo si VAULT_ADDR está definida (VAULT_TOKEN, VAULT_NAMESPACE, VAULT_KV_MOUNT, VAULT_KV_VERSION)
+func GetSecretRegistry() *SecretRegistry {
+	secretRegistryOnce.Do(func() {
+		registry := NewSecretRegistry()
+		registry.Register(SecretProviderEnv, &EnvSecretProvider{})
+		registry.Register(SecretProviderFile, NewFileSecretProvider(getEnv("SECRETS_DIR", "/run/secrets")))
+		registry.Register(SecretProviderEncFile, NewEncryptedFileSecretProvider(getEnv("SECRETS_FILE", "configs/secrets.enc.yaml"), crypto.GetService))
+
+		if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+			kvVersion, _ := strconv.Atoi(getEnv("VAULT_KV_VERSION", "2"))
+			registry.Register(SecretProviderVault, &VaultSecretProvider{
+				Address:   addr,
+				Token:     os.Getenv("VAULT_TOKEN"),
+				Namespace: os.Getenv("VAULT_NAMESPACE"),
+				Mount:     getEnv("VAULT_KV_MOUNT", "secret"),
+				KVVersion: kvVersion,
+			})
+		}
+
+		secretRegistry = registry
+	})
+	return secretRegistry
+}
+
+// ============================================================
+// File (Docker / Kubernetes secrets montados)
+// ============================================================
+
+// FileSecretProvider lee cada secreto de un archivo dentro de un directorio montado.
+// Docker monta los secrets en /run/secrets/<nombre>; Kubernetes un archivo por key del Secret.
+type FileSecretProvider struct {
+	Dir string
+}
+
+// NewFileSecretProvider crea un proveedor sobre el directorio indicado
+func NewFileSecretProvider(dir string) *FileSecretProvider {
+	return &FileSecretProvider{Dir: dir}
+}
+
+// GetSecret lee el archivo <Dir>/<key> sin el salto de línea final
+func (p *FileSecretProvider) GetSecret(ref SecretRef) (string, error) {
+	name := filepath.Clean(ref.Key)
+	if ref.Key == "" || filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid secret file key: %q", ref.Key)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("secret file %s not found in %s", name, p.Dir)
+		}
+		return "", fmt.Errorf("failed to read secret file %s: %w", name, err)
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", name)
+	}
+	return value, nil
+}
+
+// ============================================================
+// Encrypted file (archivo YAML local con valores cifrados)
+// ============================================================
+
+// EncryptedFileSecretProvider lee secretos de un archivo YAML "nombre: enc:<keyID>:<base64>"
+// cuyos valores se descifran con el crypto service. El archivo se recarga si cambia.
+type EncryptedFileSecretProvider struct {
+	Path string
+
+	getCrypto func() (crypto.CryptoService, error)
+	values    map[string]string
+	modTime   time.Time
+	mu        sync.Mutex
+}
+
+// NewEncryptedFileSecretProvider crea un proveedor sobre el archivo indicado
+func NewEncryptedFileSecretProvider(path string, getCrypto func() (crypto.CryptoService, error)) *EncryptedFileSecretProvider {
+	return &EncryptedFileSecretProvider{
+		Path:      path,
+		getCrypto: getCrypto,
+	}
+}
+
+// GetSecret descifra el secreto con nombre key
+func (p *EncryptedFileSecretProvider) GetSecret(ref SecretRef) (string, error) {
+	values, err := p.load()
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, ok := values[ref.Key]
+	if !ok || encrypted == "" {
+		return "", fmt.Errorf("secret %s not found in %s", ref.Key, p.Path)
+	}
+
+	cryptoService, err := p.getCrypto()
+	if err != nil {
+		return "", fmt.Errorf("crypto service unavailable: %w", err)
+	}
+	if !cryptoService.IsEncrypted(encrypted) {
+		return "", fmt.Errorf("secret %s in %s is not encrypted", ref.Key, p.Path)
+	}
+
+	value, err := cryptoService.Decrypt(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %w", ref.Key, err)
+	}
+	return value, nil
+}
+
+// load lee el archivo solo si cambió desde la última lectura
+func (p *EncryptedFileSecretProvider) load() (map[string]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s not available: %w", p.Path, err)
+	}
+	if p.values != nil && info.ModTime().Equal(p.modTime) {
+		return p.values, nil
+	}
+
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file %s: %w", p.Path, err)
+	}
+
+	values := make(map[string]string)
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file %s: %w", p.Path, err)
+	}
+
+	p.values = values
+	p.modTime = info.ModTime()
+	return values, nil
+}
+
+// ============================================================
+// HashiCorp Vault (KV v1 / v2)
+// ============================================================
+
+// VaultSecretProvider lee secretos del motor KV de Vault.
+// La key tiene el formato "ruta#campo"; sin campo se usa "value".
+type VaultSecretProvider struct {
+	Address   string
+	Token     string
+	Namespace string
+	Mount     string // Mount del motor KV (default "secret")
+	KVVersion int    // 1 o 2 (default 2)
+	Client    *http.Client
+}
+
+// GetSecret lee el campo del secreto en Vault
+func (p *VaultSecretProvider) GetSecret(ref SecretRef) (string, error) {
+	path, field, _ := strings.Cut(ref.Key, "#")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("invalid vault secret key: %q", ref.Key)
+	}
+	if field == "" {
+		field = "value"
+	}
+
+	mount := strings.Trim(p.Mount, "/")
+	if mount == "" {
+		mount = "secret"
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/%s/%s", strings.TrimSuffix(p.Address, "/"), mount, vaultPathEscape(path))
+	if p.KVVersion != 1 {
+		endpoint = fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(p.Address, "/"), mount, vaultPathEscape(path))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid vault address: %w", err)
+	}
+	if p.Token != "" {
+		req.Header.Set("X-Vault-Token", p.Token)
+	}
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("vault secret %s not found", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(body, &vaultErr)
+		return "", fmt.Errorf("vault returned HTTP %d for %s: %s", resp.StatusCode, path, strings.Join(vaultErr.Errors, "; "))
+	}
+
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	data := payload.Data
+	if p.KVVersion != 1 {
+		nested, _ := payload.Data["data"].(map[string]interface{})
+		data = nested
+	}
+
+	value, ok := data[field]
+	if !ok || value == nil {
+		return "", fmt.Errorf("field %s not found in vault secret %s", field, path)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("field %s in vault secret %s is not a scalar value", field, path)
+	}
+}
+
+// vaultPathEscape escapa cada segmento de la ruta del secreto
+func vaultPathEscape(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"omniapi/internal/crypto"
+)
+
+func TestSecretRegistry_Resolve(t *testing.T) {
+	t.Setenv("OMNIAPI_TEST_SECRET", "from-env")
+
+	registry := NewSecretRegistry()
+	registry.Register(SecretProviderEnv, &EnvSecretProvider{})
+
+	value, err := registry.Resolve("env://OMNIAPI_TEST_SECRET")
+	if err != nil || value != "from-env" {
+		t.Fatalf("expected env secret, got %q: %v", value, err)
+	}
+
+	if _, err := registry.Resolve("vault://omniapi/innovex"); err == nil {
+		t.Error("expected error for unregistered provider")
+	}
+	if _, err := registry.Resolve("OMNIAPI_TEST_SECRET"); err == nil {
+		t.Error("expected error for reference without provider")
+	}
+
+	ref, _ := ParseSecretRef("vault://omniapi/innovex#client_secret")
+	if ref.Provider != SecretProviderVault || ref.Key != "omniapi/innovex#client_secret" || ref.String() != "vault://omniapi/innovex#client_secret" {
+		t.Errorf("unexpected parsed ref: %+v", ref)
+	}
+}
+
+func TestSecretRegistry_ResolveServiceRef(t *testing.T) {
+	t.Setenv("OMNIAPI_SECRET_INNOVEX_PASSWORD", "service-secret")
+	t.Setenv("JWT_SECRET", "must-not-leak")
+
+	registry := NewSecretRegistry()
+	registry.Register(SecretProviderEnv, &EnvSecretProvider{})
+
+	value, err := registry.ResolveServiceRef("env://OMNIAPI_SECRET_INNOVEX_PASSWORD")
+	if err != nil || value != "service-secret" {
+		t.Fatalf("expected prefixed env secret, got %q: %v", value, err)
+	}
+
+	// Los servicios no pueden leer variables arbitrarias del proceso
+	for _, uri := range []string{"env://JWT_SECRET", "env://OMNIAPI_SECRET_", "env://omniapi_secret_x"} {
+		if value, err := registry.ResolveServiceRef(uri); err == nil {
+			t.Errorf("expected %s to be rejected, got %q", uri, value)
+		}
+	}
+	if err := ValidateServiceSecretRef(SecretRef{Provider: SecretProviderVault, Key: "omniapi/innovex#password"}); err != nil {
+		t.Errorf("non-env providers must not be restricted: %v", err)
+	}
+
+	// Las referencias de configuración siguen sin restricción
+	if value, err := registry.Resolve("env://JWT_SECRET"); err != nil || value != "must-not-leak" {
+		t.Errorf("config refs must resolve any variable, got %q: %v", value, err)
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "innovex"), 0o755)
+	os.WriteFile(filepath.Join(dir, "innovex", "password"), []byte("mounted-secret\n"), 0o600)
+
+	provider := NewFileSecretProvider(dir)
+
+	value, err := provider.GetSecret(SecretRef{Provider: SecretProviderFile, Key: "innovex/password"})
+	if err != nil || value != "mounted-secret" {
+		t.Fatalf("expected mounted secret without newline, got %q: %v", value, err)
+	}
+
+	for _, key := range []string{"missing", "../etc/passwd", "/etc/passwd"} {
+		if _, err := provider.GetSecret(SecretRef{Provider: SecretProviderFile, Key: key}); err == nil {
+			t.Errorf("expected error for key %q", key)
+		}
+	}
+}
+
+func TestEncryptedFileSecretProvider(t *testing.T) {
+	keyring, err := crypto.NewKeyringCryptoService("k1", map[string]string{"k1": "12345678901234567890123456789012"})
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+	encrypted, _ := keyring.Encrypt("sealed-secret")
+
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	os.WriteFile(path, []byte("scaleaq_password: \""+encrypted+"\"\nplain: not-encrypted\n"), 0o600)
+
+	provider := NewEncryptedFileSecretProvider(path, func() (crypto.CryptoService, error) { return keyring, nil })
+
+	value, err := provider.GetSecret(SecretRef{Provider: SecretProviderEncFile, Key: "scaleaq_password"})
+	if err != nil || value != "sealed-secret" {
+		t.Fatalf("expected decrypted secret, got %q: %v", value, err)
+	}
+
+	if _, err := provider.GetSecret(SecretRef{Provider: SecretProviderEncFile, Key: "plain"}); err == nil {
+		t.Error("expected error for a value that is not encrypted")
+	}
+	if _, err := provider.GetSecret(SecretRef{Provider: SecretProviderEncFile, Key: "missing"}); err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/omniapi/innovex":
+			w.Write([]byte(`{"data":{"data":{"client_secret":"kv2-secret","port":8883},"metadata":{"version":3}}}`))
+		case "/v1/kv/omniapi/scaleaq":
+			w.Write([]byte(`{"data":{"value":"kv1-secret"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	kv2 := &VaultSecretProvider{Address: server.URL, Token: "test-token", Mount: "secret", KVVersion: 2}
+
+	value, err := kv2.GetSecret(SecretRef{Provider: SecretProviderVault, Key: "omniapi/innovex#client_secret"})
+	if err != nil || value != "kv2-secret" {
+		t.Fatalf("expected KV v2 secret, got %q: %v", value, err)
+	}
+	if value, _ := kv2.GetSecret(SecretRef{Provider: SecretProviderVault, Key: "omniapi/innovex#port"}); value != "8883" {
+		t.Errorf("expected numeric field as string, got %q", value)
+	}
+	if _, err := kv2.GetSecret(SecretRef{Provider: SecretProviderVault, Key: "omniapi/innovex#missing"}); err == nil {
+		t.Error("expected error for missing field")
+	}
+	if _, err := kv2.GetSecret(SecretRef{Provider: SecretProviderVault, Key: "omniapi/unknown"}); err == nil {
+		t.Error("expected error for missing secret")
+	}
+
+	kv1 := &VaultSecretProvider{Address: server.URL, Token: "test-token", Mount: "kv", KVVersion: 1}
+	if value, err := kv1.GetSecret(SecretRef{Provider: SecretProviderVault, Key: "omniapi/scaleaq"}); err != nil || value != "kv1-secret" {
+		t.Fatalf("expected KV v1 secret with default field, got %q: %v", value, err)
+	}
+
+	unauthorized := &VaultSecretProvider{Address: server.URL, Token: "wrong", KVVersion: 2}
+	if _, err := unauthorized.GetSecret(SecretRef{Provider: SecretProviderVault, Key: "omniapi/innovex#client_secret"}); err == nil {
+		t.Error("expected error with an invalid token")
+	}
+}
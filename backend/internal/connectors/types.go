@@ -45,6 +45,9 @@ const (
 	EventFlagDuplicate                        // Posible duplicado
 	EventFlagLate                             // Evento tardío
 	EventFlagSynthetic                        // Evento sintético/calculado
+	EventFlagSnapshot                         // Último valor conocido reenviado al suscribirse (no es en vivo)
+	EventFlagPartial                          // Respuesta incompleta del origen (páginas o series faltantes)
+	EventFlagReplay                           // Re-emitido desde el histórico a pedido del cliente (no es en vivo)
 )
 
 // Envelope contiene metadatos del evento
@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LegacyKeyID identificador de la clave histórica (ENCRYPTION_KEY).
+// Sus textos cifrados usan el formato "enc::<base64>", es decir, un key ID vacío.
+const LegacyKeyID = ""
+
+// KeyRotator servicio de encriptación con varias claves que permite migrar secretos a la clave activa
+type KeyRotator interface {
+	CryptoService
+
+	// ActiveKeyID retorna el ID de la clave con la que se cifra
+	ActiveKeyID() string
+
+	// KeyID retorna el ID de la clave con la que se cifró un texto
+	KeyID(ciphertext string) (string, bool)
+
+	// NeedsRotation indica si un texto no está cifrado con la clave activa (incluye texto plano)
+	NeedsRotation(text string) bool
+
+	// Rotate descifra con cualquier clave conocida y vuelve a cifrar con la activa
+	Rotate(text string) (string, error)
+}
+
+// KeyringCryptoService implementación AES-GCM con varias claves identificadas por key ID.
+// Cifra con la clave activa ("enc:<keyID>:<base64>") y descifra con cualquiera del keyring.
+type KeyringCryptoService struct {
+	keys     map[string]*AESCryptoService
+	activeID string
+}
+
+// NewKeyringCryptoService crea un keyring con las claves dadas (key ID -> clave de 32 bytes)
+func NewKeyringCryptoService(activeID string, keys map[string]string) (*KeyringCryptoService, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("el keyring no tiene claves")
+	}
+
+	keyring := &KeyringCryptoService{
+		keys:     make(map[string]*AESCryptoService, len(keys)),
+		activeID: activeID,
+	}
+	for id, key := range keys {
+		if strings.ContainsAny(id, ":, ") {
+			return nil, fmt.Errorf("key ID inválido %q: no puede contener ':', ',' ni espacios", id)
+		}
+		service, err := NewAESCryptoService(key)
+		if err != nil {
+			return nil, fmt.Errorf("clave %q: %w", id, err)
+		}
+		keyring.keys[id] = service
+	}
+
+	if _, ok := keyring.keys[activeID]; !ok {
+		return nil, fmt.Errorf("la clave activa %q no está en el keyring", activeID)
+	}
+
+	return keyring, nil
+}
+
+// NewKeyringFromEnv crea el keyring desde variables de entorno:
+//   - ENCRYPTION_KEYS: claves con ID, "id1:clave1,id2:clave2"
+//   - ENCRYPTION_ACTIVE_KEY_ID: ID de la clave con la que se cifra
+//   - ENCRYPTION_KEY: clave histórica sin ID (se sigue pudiendo descifrar)
+//
+// Sin ENCRYPTION_KEYS la clave histórica es la activa y el formato no cambia.
+func NewKeyringFromEnv() (*KeyringCryptoService, error) {
+	keys := make(map[string]string)
+
+	if legacy := os.Getenv("ENCRYPTION_KEY"); legacy != "" {
+		keys[LegacyKeyID] = legacy
+	}
+
+	if raw := os.Getenv("ENCRYPTION_KEYS"); raw != "" {
+		for _, entry := range strings.Split(raw, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			id, key, ok := strings.Cut(entry, ":")
+			if !ok || id == "" {
+				return nil, fmt.Errorf("ENCRYPTION_KEYS inválida: se esperaba 'id:clave'")
+			}
+			if _, exists := keys[id]; exists {
+				return nil, fmt.Errorf("ENCRYPTION_KEYS inválida: key ID duplicado %q", id)
+			}
+			keys[id] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("ENCRYPTION_KEY o ENCRYPTION_KEYS no configuradas en variables de entorno")
+	}
+
+	activeID := os.Getenv("ENCRYPTION_ACTIVE_KEY_ID")
+	if activeID == "" {
+		if _, ok := keys[LegacyKeyID]; !ok || len(keys) > 1 {
+			return nil, fmt.Errorf("ENCRYPTION_ACTIVE_KEY_ID es obligatoria cuando se usa ENCRYPTION_KEYS")
+		}
+	}
+
+	return NewKeyringCryptoService(activeID, keys)
+}
+
+// Encrypt cifra con la clave activa
+func (k *KeyringCryptoService) Encrypt(plaintext string) (string, error) {
+	encrypted, err := k.keys[k.activeID].Encrypt(plaintext)
+	if err != nil || encrypted == "" {
+		return encrypted, err
+	}
+	return taggedPrefix(k.activeID) + strings.TrimPrefix(encrypted, encryptedPrefix), nil
+}
+
+// Decrypt descifra con la clave indicada en el texto.
+// Los valores sin prefijo (anteriores a "enc::") se prueban con todas las claves.
+func (k *KeyringCryptoService) Decrypt(ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+
+	if id, payload, ok := parseTagged(ciphertext); ok {
+		service, exists := k.keys[id]
+		if !exists {
+			return "", fmt.Errorf("clave de encriptación desconocida: %q", id)
+		}
+		return service.Decrypt(payload)
+	}
+
+	for _, id := range k.keyIDs() {
+		if plain, err := k.keys[id].Decrypt(ciphertext); err == nil {
+			return plain, nil
+		}
+	}
+	return "", fmt.Errorf("error desencriptando: ninguna clave del keyring es válida")
+}
+
+// IsEncrypted verificar si un texto está encriptado (prefijo o descifrable con alguna clave)
+func (k *KeyringCryptoService) IsEncrypted(text string) bool {
+	_, ok := k.KeyID(text)
+	return ok
+}
+
+// ActiveKeyID retorna el ID de la clave con la que se cifra
+func (k *KeyringCryptoService) ActiveKeyID() string {
+	return k.activeID
+}
+
+// KeyID retorna el ID de la clave con la que se cifró un texto.
+// Para textos con prefijo no se valida que la clave exista en el keyring.
+func (k *KeyringCryptoService) KeyID(ciphertext string) (string, bool) {
+	if ciphertext == "" {
+		return "", false
+	}
+
+	if id, _, ok := parseTagged(ciphertext); ok {
+		return id, true
+	}
+
+	for _, id := range k.keyIDs() {
+		if k.keys[id].IsEncrypted(ciphertext) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// NeedsRotation indica si un texto no está cifrado con la clave activa o no usa el formato con prefijo
+func (k *KeyringCryptoService) NeedsRotation(text string) bool {
+	if text == "" {
+		return false
+	}
+	id, _, ok := parseTagged(text)
+	return !ok || id != k.activeID
+}
+
+// Rotate descifra con cualquier clave conocida y vuelve a cifrar con la activa.
+// El texto plano se cifra directamente.
+func (k *KeyringCryptoService) Rotate(text string) (string, error) {
+	if !k.NeedsRotation(text) {
+		return text, nil
+	}
+
+	plain := text
+	if k.IsEncrypted(text) {
+		decrypted, err := k.Decrypt(text)
+		if err != nil {
+			return "", err
+		}
+		plain = decrypted
+	}
+	return k.Encrypt(plain)
+}
+
+// keyIDs IDs ordenados, la clave activa primero
+func (k *KeyringCryptoService) keyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		if id != k.activeID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return append([]string{k.activeID}, ids...)
+}
+
+// taggedPrefix prefijo "enc:<keyID>:"; con LegacyKeyID equivale a encryptedPrefix
+func taggedPrefix(keyID string) string {
+	return "enc:" + keyID + ":"
+}
+
+// parseTagged separa "enc:<keyID>:<base64>" en key ID y payload
+func parseTagged(text string) (keyID string, payload string, ok bool) {
+	rest, found := strings.CutPrefix(text, "enc:")
+	if !found {
+		return "", "", false
+	}
+	keyID, payload, found = strings.Cut(rest, ":")
+	if !found {
+		return "", "", false
+	}
+	if _, err := base64.StdEncoding.DecodeString(payload); err != nil {
+		return "", "", false
+	}
+	return keyID, payload, true
+}
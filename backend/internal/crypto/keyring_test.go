@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+const newTestKey = "abcdefghijklmnopqrstuvwxyz012345"
+
+func TestKeyringTagsCiphertextWithActiveKey(t *testing.T) {
+	keyring, err := NewKeyringCryptoService("2026-10", map[string]string{
+		LegacyKeyID: testKey,
+		"2026-10":   newTestKey,
+	})
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+
+	encrypted, err := keyring.Encrypt("super-secret")
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+	if !strings.HasPrefix(encrypted, "enc:2026-10:") {
+		t.Fatalf("expected ciphertext tagged with active key, got %q", encrypted)
+	}
+	if id, ok := keyring.KeyID(encrypted); !ok || id != "2026-10" {
+		t.Fatalf("expected key ID 2026-10, got %q", id)
+	}
+	if keyring.NeedsRotation(encrypted) {
+		t.Fatal("value encrypted with the active key must not need rotation")
+	}
+
+	decrypted, err := keyring.Decrypt(encrypted)
+	if err != nil || decrypted != "super-secret" {
+		t.Fatalf("unexpected decrypt result %q: %v", decrypted, err)
+	}
+}
+
+func TestKeyringDecryptsAndRotatesLegacyValues(t *testing.T) {
+	legacy, err := NewAESCryptoService(testKey)
+	if err != nil {
+		t.Fatalf("failed to create legacy service: %v", err)
+	}
+	prefixed, _ := legacy.Encrypt("legacy-secret")
+	unprefixed := strings.TrimPrefix(prefixed, encryptedPrefix)
+
+	keyring, err := NewKeyringCryptoService("2026-10", map[string]string{
+		LegacyKeyID: testKey,
+		"2026-10":   newTestKey,
+	})
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+
+	for _, value := range []string{prefixed, unprefixed, "plain-secret"} {
+		if !keyring.NeedsRotation(value) {
+			t.Fatalf("expected %q to need rotation", value)
+		}
+
+		rotated, err := keyring.Rotate(value)
+		if err != nil {
+			t.Fatalf("rotate failed: %v", err)
+		}
+		if id, _ := keyring.KeyID(rotated); id != "2026-10" || keyring.NeedsRotation(rotated) {
+			t.Fatalf("expected value rotated to active key, got %q", rotated)
+		}
+
+		want := "legacy-secret"
+		if value == "plain-secret" {
+			want = value
+		}
+		if decrypted, _ := keyring.Decrypt(rotated); decrypted != want {
+			t.Fatalf("unexpected decrypted value after rotation: %q", decrypted)
+		}
+	}
+}
+
+func TestKeyringRejectsUnknownKeys(t *testing.T) {
+	old, _ := NewKeyringCryptoService("old", map[string]string{"old": testKey})
+	encrypted, _ := old.Encrypt("secret")
+
+	keyring, _ := NewKeyringCryptoService("new", map[string]string{"new": newTestKey})
+	if _, err := keyring.Decrypt(encrypted); err == nil {
+		t.Fatal("expected error decrypting with a key outside the keyring")
+	}
+	if _, err := keyring.Rotate(encrypted); err == nil {
+		t.Fatal("rotation must fail instead of re-encrypting the ciphertext as plaintext")
+	}
+
+	if _, err := NewKeyringCryptoService("missing", map[string]string{"new": newTestKey}); err == nil {
+		t.Fatal("expected error when the active key is not in the keyring")
+	}
+}
+
+func TestNewKeyringFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", testKey)
+	t.Setenv("ENCRYPTION_KEYS", "")
+	t.Setenv("ENCRYPTION_ACTIVE_KEY_ID", "")
+
+	// Solo la clave histórica: mismo formato que AESCryptoService
+	keyring, err := NewKeyringFromEnv()
+	if err != nil {
+		t.Fatalf("failed to load legacy keyring: %v", err)
+	}
+	encrypted, _ := keyring.Encrypt("secret")
+	if !strings.HasPrefix(encrypted, encryptedPrefix) {
+		t.Fatalf("expected legacy format, got %q", encrypted)
+	}
+
+	t.Setenv("ENCRYPTION_KEYS", "2026-10:"+newTestKey)
+	if _, err := NewKeyringFromEnv(); err == nil {
+		t.Fatal("expected error without ENCRYPTION_ACTIVE_KEY_ID")
+	}
+
+	t.Setenv("ENCRYPTION_ACTIVE_KEY_ID", "2026-10")
+	keyring, err = NewKeyringFromEnv()
+	if err != nil {
+		t.Fatalf("failed to load keyring: %v", err)
+	}
+	if decrypted, err := keyring.Decrypt(encrypted); err != nil || decrypted != "secret" {
+		t.Fatalf("expected legacy value to stay readable, got %q: %v", decrypted, err)
+	}
+}
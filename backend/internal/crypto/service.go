@@ -7,7 +7,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
-	"os"
 	"strings"
 )
 
@@ -149,14 +148,8 @@ func GetService() (CryptoService, error) {
 		return globalCryptoService, nil
 	}
 
-	// Obtener clave de encriptación desde variable de entorno
-	encryptionKey := os.Getenv("ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		return nil, fmt.Errorf("ENCRYPTION_KEY no configurada en variables de entorno")
-	}
-
-	// Crear servicio AES
-	service, err := NewAESCryptoService(encryptionKey)
+	// Keyring desde variables de entorno (ENCRYPTION_KEY y/o ENCRYPTION_KEYS)
+	service, err := NewKeyringFromEnv()
 	if err != nil {
 		return nil, fmt.Errorf("error inicializando servicio de encriptación: %w", err)
 	}
@@ -165,6 +158,11 @@ func GetService() (CryptoService, error) {
 	return globalCryptoService, nil
 }
 
+// InitKeyring inicializar servicio con un keyring específico (para testing y herramientas)
+func InitKeyring(service *KeyringCryptoService) {
+	globalCryptoService = service
+}
+
 // InitService inicializar servicio con clave específica (para testing)
 func InitService(key string) error {
 	service, err := NewAESCryptoService(key)
@@ -18,6 +18,80 @@ func CanAccess(scope Scope, capability Capability, streamKey StreamKey) bool {
 	return scope.CanAccessStream(streamKey)
 }
 
+// CanAccessAny verifica si algún scope permite la capability sobre el stream y si la
+// capability está además entre los permisos del cliente. Si capability es vacía
+// (ej: streams sin capability asociada) sólo se validan las restricciones del scope.
+func CanAccessAny(scopes []Scope, permissions []Capability, capability Capability, streamKey StreamKey) bool {
+	if capability != "" && !ContainsCapability(permissions, capability) {
+		return false
+	}
+
+	for i := range scopes {
+		if capability == "" {
+			if scopes[i].TenantID == streamKey.TenantID && scopes[i].CanAccessStream(streamKey) {
+				return true
+			}
+			continue
+		}
+		if CanAccess(scopes[i], capability, streamKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanSubscribe verifica si algún scope permite suscribirse a un filtro.
+// Los campos vacíos del filtro son comodines: se permite la suscripción y los
+// eventos se filtran uno a uno al enrutarse. Las granjas no se validan aquí porque
+// los filtros de suscripción no las incluyen.
+func CanSubscribe(scopes []Scope, permissions []Capability, capability Capability, tenantID primitive.ObjectID, siteID, cageID string) bool {
+	if capability != "" && !ContainsCapability(permissions, capability) {
+		return false
+	}
+
+	for i := range scopes {
+		scope := &scopes[i]
+		if scope.TenantID != tenantID {
+			continue
+		}
+		if capability != "" && !scope.HasCapability(capability) {
+			continue
+		}
+		if scope.Resource == "*" {
+			return true
+		}
+		if siteID != "" && len(scope.SiteIDs) > 0 && !containsString(scope.SiteIDs, siteID) {
+			continue
+		}
+		if cageID != "" && len(scope.CageIDs) > 0 && !containsString(scope.CageIDs, cageID) {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
+
+// ContainsCapability indica si la capability está en la lista
+func ContainsCapability(list []Capability, capability Capability) bool {
+	for _, c := range list {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateConnectionForTenant verifica que una ConnectionInstance pertenezca al tenant
 func ValidateConnectionForTenant(connection *ConnectionInstance, tenantID primitive.ObjectID) error {
 	if connection.TenantID != tenantID {
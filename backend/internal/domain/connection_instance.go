@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -72,7 +73,7 @@ type ConnectionInstance struct {
 	Description string             `json:"description,omitempty" bson:"description,omitempty"`
 
 	// Configuración
-	SecretsRef string                 `json:"secrets_ref" bson:"secrets_ref"` // referencia a secrets store
+	SecretsRef string                 `json:"secrets_ref" bson:"secrets_ref"` // referencia a secrets store ("vault://ruta#campo")
 	Config     map[string]interface{} `json:"config" bson:"config"`           // configuración específica
 
 	// Mapeos por capability
@@ -139,6 +140,14 @@ func (ci *ConnectionInstance) Validate() error {
 		return ErrInvalidConnectionInstance
 	}
 
+	// SecretsRef es opcional; si existe debe tener formato "provider://key"
+	if ci.SecretsRef != "" {
+		provider, key, ok := strings.Cut(ci.SecretsRef, "://")
+		if !ok || provider == "" || key == "" {
+			return ErrInvalidSecretsRef
+		}
+	}
+
 	// Validar mappings
 	for _, mapping := range ci.Mappings {
 		if err := mapping.Validate(); err != nil {
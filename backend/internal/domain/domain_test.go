@@ -129,6 +129,17 @@ func TestConnectionInstance_Validate(t *testing.T) {
 	if err := invalidConn2.Validate(); err == nil {
 		t.Error("ConnectionInstance with empty display name should fail validation")
 	}
+
+	// Test secrets reference format
+	withRef := *conn
+	withRef.SecretsRef = "vault://omniapi/innovex#client_secret"
+	if err := withRef.Validate(); err != nil {
+		t.Errorf("ConnectionInstance with valid secrets ref should pass validation, got error: %v", err)
+	}
+	withRef.SecretsRef = "INNOVEX_SECRET"
+	if err := withRef.Validate(); err != ErrInvalidSecretsRef {
+		t.Errorf("Expected ErrInvalidSecretsRef, got %v", err)
+	}
 }
 
 func TestMapping_Validate(t *testing.T) {
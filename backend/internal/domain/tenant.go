@@ -171,6 +171,9 @@ func defaultQuotas() []Quota {
 		{Resource: "storage_gb", Limit: 10, Used: 0},
 		{Resource: "connections", Limit: 5, Used: 0},
 		{Resource: "streams", Limit: 50, Used: 0},
+		{Resource: "events_per_day", Limit: 10000, Used: 0},
+		{Resource: "concurrent_connections", Limit: 10, Used: 0},
+		{Resource: "polling_configs", Limit: 20, Used: 0},
 	}
 }
 
@@ -0,0 +1,205 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFromPollResult(t *testing.T) {
+	polledAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CLT", -4*3600))
+
+	point := FromPollResult(PollResult{
+		InstanceID: "inst-1",
+		EndpointID: "ep-1",
+		Provider:   "scaleaq",
+		TenantID:   "tenant-1",
+		SiteID:     "site-A",
+		Data:       json.RawMessage(`{"temperature": 12.5}`),
+		LatencyMS:  42,
+		PolledAt:   polledAt,
+	})
+
+	if point.Meta.Kind != KindPolling || point.Meta.Metric != "ep-1" || point.Meta.Source != "scaleaq" {
+		t.Fatalf("unexpected meta: %+v", point.Meta)
+	}
+	if !point.Timestamp.Equal(polledAt) || point.Timestamp.Location() != time.UTC {
+		t.Fatalf("expected UTC timestamp, got %v", point.Timestamp)
+	}
+	payload, ok := point.Payload.(map[string]interface{})
+	if !ok || payload["temperature"] != 12.5 {
+		t.Fatalf("expected decoded payload, got %#v", point.Payload)
+	}
+}
+
+func TestFromEvent(t *testing.T) {
+	tenantID := primitive.NewObjectID()
+	cageID := "cage-1"
+
+	point := FromEvent(&connectors.CanonicalEvent{
+		Envelope: connectors.Envelope{
+			Timestamp: time.Now(),
+			Source:    "recipe:feeding",
+			Stream: domain.StreamKey{
+				TenantID: tenantID,
+				Kind:     domain.StreamKindFeeding,
+				SiteID:   "site-A",
+				CageID:   &cageID,
+			},
+		},
+		Kind:    "feeding.appetite",
+		Payload: json.RawMessage(`{"records": [{"value": 1}], "count": 1}`),
+	})
+
+	want := Meta{
+		TenantID: tenantID.Hex(),
+		SiteID:   "site-A",
+		CageID:   "cage-1",
+		Kind:     "feeding",
+		Source:   "recipe:feeding",
+		Metric:   "feeding.appetite",
+	}
+	if point.Meta != want {
+		t.Fatalf("unexpected meta: %+v", point.Meta)
+	}
+	if payload, ok := point.Payload.(map[string]interface{}); !ok || payload["count"] != float64(1) {
+		t.Fatalf("unexpected payload: %#v", point.Payload)
+	}
+}
+
+func TestQueryValidateAndFilter(t *testing.T) {
+	to := time.Now()
+	q := Query{TenantID: "t1", Kind: "climate", From: to.Add(-time.Hour), To: to, PerPage: 5000}
+
+	if err := q.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Page != 1 || q.PerPage != MaxPerPage {
+		t.Fatalf("expected normalized pagination, got page=%d per_page=%d", q.Page, q.PerPage)
+	}
+
+	filter := q.filter()
+	if filter["meta.tenant_id"] != "t1" || filter["meta.kind"] != "climate" {
+		t.Fatalf("unexpected filter: %v", filter)
+	}
+	if _, ok := filter["meta.site_id"]; ok {
+		t.Fatal("empty fields must not filter")
+	}
+
+	inverted := Query{From: to, To: to.Add(-time.Minute)}
+	if err := inverted.Validate(); err == nil {
+		t.Fatal("expected error for inverted range")
+	}
+}
+
+func TestDownsamplePipeline(t *testing.T) {
+	to := time.Now()
+	q := Query{From: to.Add(-time.Hour), To: to}
+
+	pipeline, err := downsamplePipeline(q, "payload.temperature", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	match := pipeline[0]["$match"].(bson.M)
+	if _, ok := match["payload.temperature"]; !ok {
+		t.Fatalf("expected numeric match on field, got %v", match)
+	}
+	group := pipeline[1]["$group"].(bson.M)
+	if group["avg"].(bson.M)["$avg"] != "$payload.temperature" {
+		t.Fatalf("unexpected group: %v", group)
+	}
+
+	if _, err := downsamplePipeline(q, "", time.Minute); err == nil {
+		t.Error("expected error for empty field")
+	}
+	if _, err := downsamplePipeline(q, "temperature", 100*time.Millisecond); err == nil {
+		t.Error("expected error for sub-second interval")
+	}
+	if _, err := downsamplePipeline(Query{From: to.Add(-30 * 24 * time.Hour), To: to}, "temperature", time.Second); err == nil {
+		t.Error("expected error when the range produces too many buckets")
+	}
+}
+
+func TestPointToEvent(t *testing.T) {
+	tenantID := primitive.NewObjectID()
+	cageID := "cage-1"
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	event := &connectors.CanonicalEvent{
+		Envelope: connectors.Envelope{
+			Timestamp: ts,
+			Source:    "cloud",
+			Sequence:  42,
+			Flags:     connectors.EventFlagPartial,
+			Stream: domain.StreamKey{
+				TenantID: tenantID,
+				Kind:     domain.StreamKindFeeding,
+				SiteID:   "site-A",
+				CageID:   &cageID,
+			},
+		},
+		Kind:    "feeding.appetite",
+		Payload: json.RawMessage(`{"count":1,"records":[{"value":1}]}`),
+	}
+
+	// Simular el round-trip por MongoDB (los objetos se decodifican como bson.D)
+	raw, err := bson.Marshal(FromEvent(event))
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var point Point
+	if err := bson.Unmarshal(raw, &point); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	replayed, err := point.ToEvent()
+	if err != nil {
+		t.Fatalf("ToEvent failed: %v", err)
+	}
+	if replayed.Envelope.Sequence != 42 || replayed.Envelope.Flags != connectors.EventFlagPartial {
+		t.Fatalf("sequence and flags must be preserved, got %+v", replayed.Envelope)
+	}
+	if replayed.Envelope.Stream.String() != event.Envelope.Stream.String() || replayed.Kind != event.Kind {
+		t.Fatalf("unexpected stream: %v kind=%s", replayed.Envelope.Stream, replayed.Kind)
+	}
+	if string(replayed.Payload) != string(event.Payload) {
+		t.Fatalf("unexpected payload: %s", replayed.Payload)
+	}
+
+	if _, err := FromPollResult(PollResult{TenantID: tenantID.Hex()}).ToEvent(); err == nil {
+		t.Error("polling points must not convert to events")
+	}
+}
+
+func TestNormalizePointsRoundTripsNestedPayload(t *testing.T) {
+	payload := map[string]interface{}{
+		"temperature": 12.5,
+		"sensor":      map[string]interface{}{"id": "s-1", "tags": []interface{}{"a", map[string]interface{}{"b": true}}},
+	}
+
+	// Simular Find: el payload vuelve de MongoDB como bson.D
+	raw, err := bson.Marshal(Point{Timestamp: time.Now().UTC(), Payload: payload})
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var point Point
+	if err := bson.Unmarshal(raw, &point); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	body, err := json.Marshal(normalizePoints([]Point{point})[0].Payload)
+	if err != nil {
+		t.Fatalf("json marshal failed: %v", err)
+	}
+	expected, _ := json.Marshal(payload)
+	if string(body) != string(expected) {
+		t.Fatalf("expected payload %s, got %s", expected, body)
+	}
+}
@@ -0,0 +1,236 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KindPolling kind asignado a los resultados crudos de polling
+const KindPolling = "polling"
+
+// Meta identifica la serie a la que pertenece un punto (metaField de la colección time-series)
+type Meta struct {
+	TenantID   string `bson:"tenant_id" json:"tenant_id"`
+	SiteID     string `bson:"site_id,omitempty" json:"site_id,omitempty"`
+	CageID     string `bson:"cage_id,omitempty" json:"cage_id,omitempty"`
+	Kind       string `bson:"kind" json:"kind"`                                   // feeding, climate, ... o "polling"
+	InstanceID string `bson:"instance_id,omitempty" json:"instance_id,omitempty"` // Instancia de polling (si aplica)
+	EndpointID string `bson:"endpoint_id,omitempty" json:"endpoint_id,omitempty"` // Endpoint de polling (si aplica)
+	Source     string `bson:"source,omitempty" json:"source,omitempty"`           // Proveedor o fuente del evento
+	Metric     string `bson:"metric,omitempty" json:"metric,omitempty"`           // Kind del evento canónico o label del endpoint
+}
+
+// Point un registro histórico
+type Point struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Timestamp time.Time          `bson:"ts" json:"ts"`
+	Meta      Meta               `bson:"meta" json:"meta"`
+	Payload   interface{}        `bson:"payload,omitempty" json:"payload,omitempty"`
+	LatencyMS int64              `bson:"latency_ms,omitempty" json:"latency_ms,omitempty"`
+	Sequence  uint64             `bson:"seq,omitempty" json:"seq,omitempty"`     // Envelope.Sequence del evento original
+	Flags     int                `bson:"flags,omitempty" json:"flags,omitempty"` // Envelope.Flags del evento original
+}
+
+// PollResult datos de un resultado de polling necesarios para el histórico.
+// Se define aquí para no acoplar el paquete a polling.
+type PollResult struct {
+	InstanceID string
+	EndpointID string
+	Label      string
+	Provider   string
+	TenantID   string
+	SiteID     string
+	Data       interface{}
+	LatencyMS  int64
+	PolledAt   time.Time
+	Partial    bool // Resultado truncado (páginas sin leer): se guarda con EventFlagPartial
+}
+
+// FromPollResult convierte un resultado de polling exitoso en un punto
+func FromPollResult(result PollResult) Point {
+	metric := result.Label
+	if metric == "" {
+		metric = result.EndpointID
+	}
+
+	ts := result.PolledAt
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	point := Point{
+		Timestamp: ts.UTC(),
+		Meta: Meta{
+			TenantID:   result.TenantID,
+			SiteID:     result.SiteID,
+			Kind:       KindPolling,
+			InstanceID: result.InstanceID,
+			EndpointID: result.EndpointID,
+			Source:     result.Provider,
+			Metric:     metric,
+		},
+		Payload:   normalizePayload(result.Data),
+		LatencyMS: result.LatencyMS,
+	}
+	if result.Partial {
+		point.Flags = int(connectors.EventFlagPartial)
+	}
+	return point
+}
+
+// FromEvent convierte un evento canónico enrutado en un punto
+func FromEvent(event *connectors.CanonicalEvent) Point {
+	stream := event.Envelope.Stream
+
+	meta := Meta{
+		TenantID: stream.TenantID.Hex(),
+		SiteID:   stream.SiteID,
+		Kind:     string(stream.Kind),
+		Source:   event.Envelope.Source,
+		Metric:   event.Kind,
+	}
+	if stream.CageID != nil {
+		meta.CageID = *stream.CageID
+	}
+
+	ts := event.Envelope.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var payload interface{}
+	if len(event.Payload) > 0 {
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			payload = string(event.Payload)
+		}
+	}
+
+	return Point{
+		Timestamp: ts.UTC(),
+		Meta:      meta,
+		Payload:   payload,
+		Sequence:  event.Envelope.Sequence,
+		Flags:     int(event.Envelope.Flags),
+	}
+}
+
+// ToEvent reconstruye el evento canónico de un punto registrado con FromEvent.
+// Los resultados crudos de polling no son eventos y retornan error.
+func (p Point) ToEvent() (*connectors.CanonicalEvent, error) {
+	if p.Meta.Kind == KindPolling {
+		return nil, fmt.Errorf("polling points are not canonical events")
+	}
+
+	tenantID, err := primitive.ObjectIDFromHex(p.Meta.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant id %q: %w", p.Meta.TenantID, err)
+	}
+
+	stream := domain.StreamKey{
+		TenantID: tenantID,
+		Kind:     domain.StreamKind(p.Meta.Kind),
+		SiteID:   p.Meta.SiteID,
+	}
+	if p.Meta.CageID != "" {
+		cageID := p.Meta.CageID
+		stream.CageID = &cageID
+	}
+
+	var payload json.RawMessage
+	if p.Payload != nil {
+		raw, err := json.Marshal(normalizeStored(p.Payload))
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		payload = raw
+	}
+
+	return &connectors.CanonicalEvent{
+		Envelope: connectors.Envelope{
+			Version:   "1.0",
+			Timestamp: p.Timestamp,
+			Stream:    stream,
+			Source:    p.Meta.Source,
+			Sequence:  p.Sequence,
+			Flags:     connectors.EventFlags(p.Flags),
+		},
+		Payload:       payload,
+		Kind:          p.Meta.Metric,
+		SchemaVersion: "1.0",
+	}, nil
+}
+
+// normalizePayload convierte datos de polling a tipos genéricos serializables en BSON
+func normalizePayload(data interface{}) interface{} {
+	switch v := data.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		var out interface{}
+		if err := json.Unmarshal(v, &out); err != nil {
+			return string(v)
+		}
+		return out
+	case []byte:
+		var out interface{}
+		if err := json.Unmarshal(v, &out); err != nil {
+			return string(v)
+		}
+		return out
+	case map[string]interface{}, []interface{}, string, float64, bool:
+		return v
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		var out interface{}
+		json.Unmarshal(raw, &out)
+		return out
+	}
+}
+
+// normalizeStored convierte los tipos BSON decodificados (bson.D, bson.A) a tipos JSON
+func normalizeStored(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		out := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			out[elem.Key] = normalizeStored(elem.Value)
+		}
+		return out
+	case bson.M:
+		out := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			out[key] = normalizeStored(elem)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			out[key] = normalizeStored(elem)
+		}
+		return out
+	case bson.A:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = normalizeStored(elem)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = normalizeStored(elem)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,300 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"omniapi/internal/connectors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxPerPage máximo de puntos por página
+	MaxPerPage = 1000
+
+	// MaxBuckets máximo de buckets por consulta de downsampling
+	MaxBuckets = 10000
+
+	// MaxReplayEvents máximo de eventos re-emitidos por replay
+	MaxReplayEvents = 100000
+)
+
+// Query filtros de consulta del histórico. Los campos vacíos no filtran.
+type Query struct {
+	TenantID   string
+	SiteID     string
+	CageID     string
+	Kind       string
+	InstanceID string
+	EndpointID string
+	Source     string
+	Metric     string
+	From       time.Time
+	To         time.Time
+	AfterSeq   uint64 // Solo eventos con secuencia mayor (0 = sin límite)
+	UpToSeq    uint64 // Solo eventos con secuencia menor o igual (0 = sin límite)
+
+	Page       int
+	PerPage    int
+	Descending bool
+}
+
+// Bucket agregado de un intervalo de tiempo
+type Bucket struct {
+	Start time.Time `bson:"_id" json:"start"`
+	Count int64     `bson:"count" json:"count"`
+	Min   *float64  `bson:"min" json:"min"`
+	Max   *float64  `bson:"max" json:"max"`
+	Avg   *float64  `bson:"avg" json:"avg"`
+}
+
+// Validate verifica el rango y normaliza la paginación
+func (q *Query) Validate() error {
+	if q.From.IsZero() || q.To.IsZero() {
+		return fmt.Errorf("from and to are required")
+	}
+	if !q.To.After(q.From) {
+		return fmt.Errorf("to must be after from")
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage < 1 {
+		q.PerPage = 100
+	}
+	if q.PerPage > MaxPerPage {
+		q.PerPage = MaxPerPage
+	}
+	return nil
+}
+
+// filter construye el filtro MongoDB de la consulta
+func (q *Query) filter() bson.M {
+	filter := bson.M{
+		"ts": bson.M{"$gte": q.From.UTC(), "$lt": q.To.UTC()},
+	}
+
+	fields := map[string]string{
+		"meta.tenant_id":   q.TenantID,
+		"meta.site_id":     q.SiteID,
+		"meta.cage_id":     q.CageID,
+		"meta.kind":        q.Kind,
+		"meta.instance_id": q.InstanceID,
+		"meta.endpoint_id": q.EndpointID,
+		"meta.source":      q.Source,
+		"meta.metric":      q.Metric,
+	}
+	for key, value := range fields {
+		if value != "" {
+			filter[key] = value
+		}
+	}
+
+	if q.AfterSeq > 0 || q.UpToSeq > 0 {
+		seq := bson.M{}
+		if q.AfterSeq > 0 {
+			seq["$gt"] = int64(q.AfterSeq)
+		}
+		if q.UpToSeq > 0 {
+			seq["$lte"] = int64(q.UpToSeq)
+		}
+		filter["seq"] = seq
+	}
+
+	return filter
+}
+
+// Find retorna una página de puntos y el total del rango
+func (s *Store) Find(q Query) ([]Point, int64, error) {
+	if err := q.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.RLock()
+	collection := s.collection
+	s.mu.RUnlock()
+
+	if collection == nil {
+		return []Point{}, 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	filter := q.filter()
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting history: %w", err)
+	}
+
+	order := 1
+	if q.Descending {
+		order = -1
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "ts", Value: order}}).
+		SetSkip(int64((q.Page - 1) * q.PerPage)).
+		SetLimit(int64(q.PerPage))
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	points := []Point{}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, 0, fmt.Errorf("error decoding history: %w", err)
+	}
+
+	return normalizePoints(points), total, nil
+}
+
+// normalizePoints convierte los payloads decodificados como bson.D/bson.A a objetos y
+// arrays JSON (igual que ToEvent), para que la API no los serialice como pares Key/Value
+func normalizePoints(points []Point) []Point {
+	for i := range points {
+		points[i].Payload = normalizeStored(points[i].Payload)
+	}
+	return points
+}
+
+// Downsample agrupa los valores numéricos de un campo del payload en buckets
+// de duración interval (min/max/avg/count). field usa notación con puntos ("temperature", "data.o2").
+func (s *Store) Downsample(q Query, field string, interval time.Duration) ([]Bucket, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	pipeline, err := downsamplePipeline(q, field, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	collection := s.collection
+	s.mu.RUnlock()
+
+	if collection == nil {
+		return []Bucket{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error aggregating history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	buckets := []Bucket{}
+	if err := cursor.All(ctx, &buckets); err != nil {
+		return nil, fmt.Errorf("error decoding buckets: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// Replay recorre en orden cronológico (y por secuencia) los eventos canónicos del rango
+// y llama fn por cada uno. Se detiene ante el primer error de fn o al cancelar ctx.
+// Los resultados crudos de polling se omiten. Retorna la cantidad de eventos entregados.
+func (s *Store) Replay(ctx context.Context, q Query, fn func(*connectors.CanonicalEvent) error) (int, error) {
+	if err := q.Validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.RLock()
+	collection := s.collection
+	s.mu.RUnlock()
+
+	if collection == nil {
+		return 0, fmt.Errorf("history store not started")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "ts", Value: 1}, {Key: "seq", Value: 1}}).
+		SetLimit(MaxReplayEvents)
+
+	// Sin timeout fijo: el consumidor puede ir a ritmo del throttle del cliente
+	cursor, err := collection.Find(ctx, q.replayFilter(), opts)
+	if err != nil {
+		return 0, fmt.Errorf("error querying history: %w", err)
+	}
+	defer cursor.Close(context.Background())
+
+	delivered := 0
+	for cursor.Next(ctx) {
+		var point Point
+		if err := cursor.Decode(&point); err != nil {
+			return delivered, fmt.Errorf("error decoding history: %w", err)
+		}
+
+		event, err := point.ToEvent()
+		if err != nil {
+			continue
+		}
+
+		if err := fn(event); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+
+	if err := cursor.Err(); err != nil {
+		return delivered, fmt.Errorf("error reading history: %w", err)
+	}
+	return delivered, nil
+}
+
+// replayFilter filtro de Replay: excluye los resultados de polling salvo que se pida ese kind
+func (q *Query) replayFilter() bson.M {
+	filter := q.filter()
+	if q.Kind == "" {
+		filter["meta.kind"] = bson.M{"$ne": KindPolling}
+	}
+	return filter
+}
+
+// downsamplePipeline construye el pipeline de agregación por buckets de tiempo
+func downsamplePipeline(q Query, field string, interval time.Duration) ([]bson.M, error) {
+	field = strings.TrimPrefix(strings.TrimSpace(field), "payload.")
+	if field == "" || strings.HasPrefix(field, "$") {
+		return nil, fmt.Errorf("field is required")
+	}
+	if interval < time.Second {
+		return nil, fmt.Errorf("interval must be at least 1s")
+	}
+	if buckets := q.To.Sub(q.From) / interval; buckets > MaxBuckets {
+		return nil, fmt.Errorf("range too large for interval: %d buckets (max %d)", buckets, MaxBuckets)
+	}
+
+	path := "payload." + field
+	bucketMs := interval.Milliseconds()
+
+	match := q.filter()
+	match[path] = bson.M{"$type": "number"}
+
+	tsMs := bson.M{"$toLong": "$ts"}
+	bucketStart := bson.M{"$toDate": bson.M{
+		"$subtract": bson.A{tsMs, bson.M{"$mod": bson.A{tsMs, bucketMs}}},
+	}}
+
+	return []bson.M{
+		{"$match": match},
+		{"$group": bson.M{
+			"_id":   bucketStart,
+			"count": bson.M{"$sum": 1},
+			"min":   bson.M{"$min": "$" + path},
+			"max":   bson.M{"$max": "$" + path},
+			"avg":   bson.M{"$avg": "$" + path},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}, nil
+}
@@ -0,0 +1,267 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// CollectionName colección time-series del histórico
+	CollectionName = "history"
+
+	queueSize     = 10000
+	batchSize     = 500
+	flushInterval = time.Second
+)
+
+// Stats estadísticas del writer
+type Stats struct {
+	Recorded int64 `json:"recorded"`
+	Written  int64 `json:"written"`
+	Dropped  int64 `json:"dropped"`
+	Errors   int64 `json:"errors"`
+}
+
+// Store persiste y consulta el histórico de datos
+type Store struct {
+	collection *mongo.Collection
+	retention  time.Duration
+
+	queue chan Point
+	done  chan struct{}
+
+	stats Stats
+	mu    sync.RWMutex
+}
+
+var (
+	storeInstance *Store
+	storeOnce     sync.Once
+)
+
+// GetStore retorna la instancia singleton del Store
+func GetStore() *Store {
+	storeOnce.Do(func() {
+		storeInstance = &Store{
+			queue: make(chan Point, queueSize),
+		}
+	})
+	return storeInstance
+}
+
+// Start crea (o actualiza) la colección time-series con la retención indicada
+// e inicia el writer en background. Una retención <= 0 desactiva la expiración.
+func (s *Store) Start(ctx context.Context, retention time.Duration) error {
+	if database.Database == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	s.mu.Lock()
+	if s.done != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("history store already started")
+	}
+	s.retention = retention
+	s.collection = database.GetCollection(CollectionName)
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	if err := s.ensureCollection(); err != nil {
+		return err
+	}
+
+	go s.writeLoop(ctx)
+
+	fmt.Printf("📚 History Store initialized (retention=%s)\n", retention)
+	return nil
+}
+
+// Wait espera a que el writer vacíe la cola tras cancelar el contexto de Start
+func (s *Store) Wait(timeout time.Duration) {
+	s.mu.RLock()
+	done := s.done
+	s.mu.RUnlock()
+
+	if done == nil {
+		return
+	}
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// ensureCollection crea la colección time-series o ajusta su TTL si ya existe
+func (s *Store) ensureCollection() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := database.Database
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": CollectionName})
+	if err != nil {
+		return fmt.Errorf("error listing collections: %w", err)
+	}
+
+	if len(names) == 0 {
+		opts := options.CreateCollection().SetTimeSeriesOptions(
+			options.TimeSeries().
+				SetTimeField("ts").
+				SetMetaField("meta").
+				SetGranularity("seconds"),
+		)
+		if s.retention > 0 {
+			opts.SetExpireAfterSeconds(int64(s.retention.Seconds()))
+		}
+		if err := db.CreateCollection(ctx, CollectionName, opts); err != nil {
+			return fmt.Errorf("error creating history collection: %w", err)
+		}
+	} else {
+		// La retención puede cambiar entre reinicios: aplicar la configurada
+		var expire interface{} = "off"
+		if s.retention > 0 {
+			expire = int64(s.retention.Seconds())
+		}
+		cmd := bson.D{{Key: "collMod", Value: CollectionName}, {Key: "expireAfterSeconds", Value: expire}}
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			fmt.Printf("⚠️  Warning: could not update history retention: %v\n", err)
+		}
+	}
+
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "meta.tenant_id", Value: 1},
+				{Key: "meta.kind", Value: 1},
+				{Key: "meta.site_id", Value: 1},
+				{Key: "ts", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{{Key: "meta.instance_id", Value: 1}, {Key: "ts", Value: -1}},
+		},
+	}
+	if _, err := s.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		fmt.Printf("⚠️  Warning: could not create history indexes: %v\n", err)
+	}
+
+	return nil
+}
+
+// Record encola un punto para escritura. Nunca bloquea: si la cola está llena se descarta.
+// Antes de Start los puntos se ignoran.
+func (s *Store) Record(point Point) {
+	s.mu.RLock()
+	started := s.done != nil
+	s.mu.RUnlock()
+
+	if !started {
+		return
+	}
+
+	select {
+	case s.queue <- point:
+		s.mu.Lock()
+		s.stats.Recorded++
+		s.mu.Unlock()
+	default:
+		s.mu.Lock()
+		s.stats.Dropped++
+		s.mu.Unlock()
+	}
+}
+
+// RecordPoll registra un resultado de polling exitoso
+func (s *Store) RecordPoll(result PollResult) {
+	s.Record(FromPollResult(result))
+}
+
+// RecordEvent registra un evento canónico enrutado
+func (s *Store) RecordEvent(event *connectors.CanonicalEvent) {
+	if event == nil {
+		return
+	}
+	s.Record(FromEvent(event))
+}
+
+// GetStats retorna las estadísticas del writer
+func (s *Store) GetStats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats
+}
+
+// writeLoop agrupa puntos en lotes y los inserta periódicamente
+func (s *Store) writeLoop(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]interface{}, 0, batchSize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Vaciar lo pendiente antes de salir
+			for {
+				select {
+				case point := <-s.queue:
+					batch = append(batch, point)
+					if len(batch) >= batchSize {
+						s.flush(batch)
+						batch = batch[:0]
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+
+		case point := <-s.queue:
+			batch = append(batch, point)
+			if len(batch) >= batchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush inserta un lote en MongoDB
+func (s *Store) flush(batch []interface{}) {
+	if len(batch) == 0 || s.collection == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if result != nil {
+		s.stats.Written += int64(len(result.InsertedIDs))
+	}
+	if err != nil {
+		s.stats.Errors++
+		fmt.Printf("⚠️  Error writing history batch (%d points): %v\n", len(batch), err)
+	}
+}
@@ -0,0 +1,58 @@
+// Package jsonpath lee valores de documentos JSON decodificados (map[string]interface{} /
+// []interface{}) con notación de puntos. Lo usan los adapters de autenticación, los
+// drivers de polling y las recetas.
+package jsonpath
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Lookup obtiene un valor con notación de puntos ("data.items.0.id"); vacío o "$" retorna
+// la raíz. Acepta también el prefijo "$." e índices entre corchetes ("items[0]", "items[-1]";
+// los negativos cuentan desde el final). Retorna nil si el path no existe.
+func Lookup(data interface{}, path string) interface{} {
+	current := data
+	for _, part := range split(path) {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[part]
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil {
+				return nil
+			}
+			if index < 0 {
+				index += len(node)
+			}
+			if index < 0 || index >= len(node) {
+				return nil
+			}
+			current = node[index]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// split convierte "$.a.b[0].c" en ["a", "b", "0", "c"]
+func split(path string) []string {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	if path == "" {
+		return nil
+	}
+
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+
+	raw := strings.Split(path, ".")
+	parts := make([]string, 0, len(raw))
+	for _, p := range raw {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
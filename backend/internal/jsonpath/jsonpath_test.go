@@ -0,0 +1,37 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"site":{"name":"Farm 1","cages":[{"id":"c1"},{"id":"c2"}]}}`), &data); err != nil {
+		t.Fatalf("invalid test payload: %v", err)
+	}
+
+	cases := map[string]interface{}{
+		"site.name":          "Farm 1",
+		"$.site.name":        "Farm 1",
+		"site.cages[1].id":   "c2",
+		"site.cages[-1].id":  "c2",
+		"site.cages.0.id":    "c1",
+		"site.cages[5].id":   nil,
+		"site.cages.x.id":    nil,
+		"site.missing.field": nil,
+		"site.name.deeper":   nil,
+	}
+
+	for path, expected := range cases {
+		if value := Lookup(data, path); value != expected {
+			t.Errorf("%s: expected %v, got %v", path, expected, value)
+		}
+	}
+
+	for _, root := range []string{"", "$", " $ "} {
+		if _, ok := Lookup(data, root).(map[string]interface{}); !ok {
+			t.Errorf("%q: expected the root document", root)
+		}
+	}
+}
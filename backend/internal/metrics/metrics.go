@@ -230,6 +230,78 @@ var (
 	)
 )
 
+// ═══════════════════════════════════════════════════════════
+// Métricas de Broker MQTT (internal/broker)
+// ═══════════════════════════════════════════════════════════
+
+var (
+	// BrokerOutboxDepth mensajes en el outbox pendientes de publicar
+	// Labels: broker
+	BrokerOutboxDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "omniapi_broker_outbox_depth",
+			Help: "Número de mensajes en el outbox pendientes de publicar",
+		},
+		[]string{"broker"},
+	)
+
+	// BrokerOutboxReplayedTotal mensajes del outbox publicados tras quedar en cola
+	// Labels: broker
+	BrokerOutboxReplayedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "omniapi_broker_outbox_replayed_total",
+			Help: "Total de mensajes del outbox publicados",
+		},
+		[]string{"broker"},
+	)
+
+	// BrokerOutboxDroppedTotal mensajes descartados del outbox sin publicar
+	// Labels: broker, reason (max_age|max_messages)
+	BrokerOutboxDroppedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "omniapi_broker_outbox_dropped_total",
+			Help: "Total de mensajes descartados del outbox por antigüedad o tamaño",
+		},
+		[]string{"broker", "reason"},
+	)
+)
+
+// ═══════════════════════════════════════════════════════════
+// Métricas de Quotas por tenant (internal/quota)
+// ═══════════════════════════════════════════════════════════
+
+var (
+	// TenantQuotaUsed uso actual de cada quota
+	// Labels: tenant, resource
+	TenantQuotaUsed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "omniapi_tenant_quota_used",
+			Help: "Uso actual de la quota del tenant",
+		},
+		[]string{"tenant", "resource"},
+	)
+
+	// TenantQuotaLimit límite configurado de cada quota
+	// Labels: tenant, resource
+	TenantQuotaLimit = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "omniapi_tenant_quota_limit",
+			Help: "Límite configurado de la quota del tenant",
+		},
+		[]string{"tenant", "resource"},
+	)
+
+	// TenantQuotaRejectedTotal operaciones rechazadas o degradadas por quota superada
+	// Labels: tenant, resource
+	TenantQuotaRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "omniapi_tenant_quota_rejected_total",
+			Help: "Total de operaciones rechazadas o degradadas por quota superada",
+		},
+		[]string{"tenant", "resource"},
+	)
+)
+
 // ═══════════════════════════════════════════════════════════
 // Helpers para evitar cardinalidad explosiva
 // ═══════════════════════════════════════════════════════════
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"omniapi/internal/domain"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -14,8 +16,10 @@ type User struct {
 	Password  string                 `bson:"password" json:"-"` // No incluir en JSON
 	FullName  string                 `bson:"full_name" json:"full_name"`
 	Avatar    string                 `bson:"avatar,omitempty" json:"avatar,omitempty"`
-	Status    string                 `bson:"status" json:"status"` // active, inactive, banned
-	Role      string                 `bson:"role" json:"role"`     // admin, user, moderator
+	Status    string                 `bson:"status" json:"status"`                           // active, inactive, banned
+	Role      string                 `bson:"role" json:"role"`                               // admin, operator, viewer (legacy: user, moderator)
+	TenantID  string                 `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"` // Tenant al que pertenece (vacío = admin global)
+	Scopes    []domain.Scope         `bson:"scopes,omitempty" json:"scopes,omitempty"`       // Restringe el acceso dentro del tenant (farm/site/cage)
 	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time              `bson:"updated_at" json:"updated_at"`
 	LastLogin *time.Time             `bson:"last_login,omitempty" json:"last_login,omitempty"`
@@ -39,12 +43,13 @@ type Message struct {
 type Session struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Token     string             `bson:"token" json:"token"`
+	Token     string             `bson:"token" json:"-"` // ID (jti) del refresh token vigente; rota en cada refresh
 	IPAddress string             `bson:"ip_address" json:"ip_address"`
 	UserAgent string             `bson:"user_agent" json:"user_agent"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
 	IsActive  bool               `bson:"is_active" json:"is_active"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
 }
 
 // APILog modelo para logs de API
@@ -186,6 +191,12 @@ type ServiceCredentials struct {
 	// API Key (genérico)
 	APIKey string `bson:"api_key,omitempty" json:"api_key,omitempty"` // Encriptado
 
+	// Referencias a un secret provider ("vault://omniapi/innovex#client_secret", "file://innovex_password").
+	// Si están definidas tienen prioridad sobre el valor almacenado. env:// solo admite variables OMNIAPI_SECRET_*.
+	PasswordRef     string `bson:"password_ref,omitempty" json:"password_ref,omitempty"`
+	ClientSecretRef string `bson:"client_secret_ref,omitempty" json:"client_secret_ref,omitempty"`
+	APIKeyRef       string `bson:"api_key_ref,omitempty" json:"api_key_ref,omitempty"`
+
 	// Headers personalizados
 	CustomHeaders map[string]string `bson:"custom_headers,omitempty" json:"custom_headers,omitempty"`
 }
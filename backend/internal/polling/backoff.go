@@ -0,0 +1,126 @@
+package polling
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"omniapi/internal/polling/drivers"
+	"omniapi/internal/queue/requester"
+)
+
+const (
+	// jitterFraction variación aleatoria (±) aplicada a cada espera
+	jitterFraction = 0.1
+
+	// maxStartJitter desfase máximo de la primera ejecución de un worker
+	maxStartJitter = 5 * time.Second
+)
+
+// pollingBackoffConfig backoff y circuit breaker del polling. Usa el mismo calculador que el
+// requester pero con escalones acordes a intervalos de segundos.
+func pollingBackoffConfig() requester.Config {
+	return requester.Config{
+		BackoffInitial:       5 * time.Second,
+		BackoffStep2:         30 * time.Second,
+		BackoffStep3:         2 * time.Minute,
+		MaxConsecutiveErrors: 5,
+		CircuitPauseDuration: 2 * time.Minute,
+	}
+}
+
+// serviceGuard estado compartido por todos los workers de un mismo ExternalService:
+// circuit breaker ante caídas del proveedor y pausa por rate limit
+type serviceGuard struct {
+	breaker *requester.CircuitBreaker
+
+	mu          sync.Mutex
+	pausedUntil time.Time // Rate limit informado por el proveedor (Retry-After, X-RateLimit-Reset)
+}
+
+func newServiceGuard() *serviceGuard {
+	return &serviceGuard{breaker: requester.NewCircuitBreaker(pollingBackoffConfig())}
+}
+
+// blockedUntil indica si los workers del servicio deben esperar y hasta cuándo
+func (g *serviceGuard) blockedUntil(now time.Time) (time.Time, string, bool) {
+	if g.breaker.IsOpen() {
+		if retryAt := g.breaker.GetNextRetryAt(); retryAt != nil {
+			return *retryAt, "circuit_open", true
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Before(g.pausedUntil) {
+		return g.pausedUntil, "rate_limited", true
+	}
+	return time.Time{}, "", false
+}
+
+// record registra el resultado de un worker. Solo los errores que indican un problema del
+// proveedor o de las credenciales cuentan para el circuit breaker; una request inválida de un
+// endpoint no debe pausar al resto.
+func (g *serviceGuard) record(result PollingResult, now time.Time) {
+	switch {
+	case result.Success:
+		g.breaker.RecordSuccess()
+	case result.ErrorClass == string(drivers.ErrorUnavailable),
+		result.ErrorClass == string(drivers.ErrorRateLimited),
+		result.ErrorClass == string(drivers.ErrorAuth):
+		g.breaker.RecordFailure()
+	}
+
+	if result.RateLimit == nil {
+		return
+	}
+
+	until := time.Time{}
+	if result.RateLimit.RetryAfter > 0 {
+		until = now.Add(result.RateLimit.RetryAfter)
+	}
+	if result.RateLimit.Remaining == 0 && result.RateLimit.Reset.After(until) {
+		until = result.RateLimit.Reset
+	}
+
+	g.mu.Lock()
+	if until.After(g.pausedUntil) {
+		g.pausedUntil = until
+	}
+	g.mu.Unlock()
+}
+
+// state estado del circuit breaker del servicio
+func (g *serviceGuard) state() requester.CircuitBreakerState {
+	return g.breaker.GetState()
+}
+
+// nextDelay espera hasta la siguiente ejecución: el intervalo normal, o el backoff
+// exponencial si hay errores consecutivos (lo que sea mayor)
+func nextDelay(interval time.Duration, consecutiveErrs int, backoff *requester.BackoffCalculator) time.Duration {
+	delay := interval
+	if consecutiveErrs > 0 {
+		if b := backoff.CalculateBackoff(consecutiveErrs); b > delay {
+			delay = b
+		}
+	}
+	return delay
+}
+
+// withJitter aplica una variación aleatoria de ±jitterFraction a la espera
+func withJitter(delay time.Duration, random float64) time.Duration {
+	factor := 1 + jitterFraction*(2*random-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// startDelay desfase aleatorio de la primera ejecución para no sincronizar a todos los workers
+func startDelay(interval time.Duration, random float64) time.Duration {
+	window := interval
+	if window > maxStartJitter {
+		window = maxStartJitter
+	}
+	return time.Duration(float64(window) * random)
+}
+
+// randomFloat fuente de aleatoriedad del jitter
+var randomFloat = rand.Float64
@@ -0,0 +1,113 @@
+package polling
+
+import (
+	"testing"
+	"time"
+
+	"omniapi/internal/polling/drivers"
+	"omniapi/internal/queue/requester"
+)
+
+func TestNextDelayAndJitter(t *testing.T) {
+	backoff := requester.NewBackoffCalculator(pollingBackoffConfig())
+
+	cases := []struct {
+		interval time.Duration
+		errors   int
+		want     time.Duration
+	}{
+		{2 * time.Second, 0, 2 * time.Second},
+		{2 * time.Second, 1, 5 * time.Second},
+		{2 * time.Second, 2, 30 * time.Second},
+		{2 * time.Second, 10, 2 * time.Minute},
+		{10 * time.Minute, 3, 10 * time.Minute}, // El intervalo ya es mayor que el backoff
+	}
+	for _, tc := range cases {
+		if got := nextDelay(tc.interval, tc.errors, backoff); got != tc.want {
+			t.Errorf("interval %s with %d errors: expected %s, got %s", tc.interval, tc.errors, tc.want, got)
+		}
+	}
+
+	if got := withJitter(10*time.Second, 0); got != 9*time.Second {
+		t.Errorf("expected -10%% jitter, got %s", got)
+	}
+	if got := withJitter(10*time.Second, 1); got != 11*time.Second {
+		t.Errorf("expected +10%% jitter, got %s", got)
+	}
+	if got := startDelay(2*time.Second, 0.5); got != time.Second {
+		t.Errorf("expected start offset within the interval, got %s", got)
+	}
+	if got := startDelay(time.Hour, 1); got != maxStartJitter {
+		t.Errorf("expected start offset capped at %s, got %s", maxStartJitter, got)
+	}
+}
+
+func TestServiceGuard_CircuitBreaker(t *testing.T) {
+	guard := newServiceGuard()
+	now := time.Now()
+
+	// Los errores propios de un endpoint no abren el circuito del servicio
+	for i := 0; i < 10; i++ {
+		guard.record(PollingResult{ErrorClass: string(drivers.ErrorRejected)}, now)
+	}
+	if _, _, blocked := guard.blockedUntil(now); blocked {
+		t.Fatal("rejected requests should not open the circuit")
+	}
+
+	for i := 0; i < pollingBackoffConfig().MaxConsecutiveErrors; i++ {
+		guard.record(PollingResult{ErrorClass: string(drivers.ErrorUnavailable)}, now)
+	}
+	until, reason, blocked := guard.blockedUntil(now)
+	if !blocked || reason != "circuit_open" || until.Before(now.Add(time.Minute)) {
+		t.Fatalf("expected open circuit, got %s until %s (%v)", reason, until, blocked)
+	}
+	if guard.state() != requester.CircuitBreakerStateOpen {
+		t.Errorf("expected open state, got %s", guard.state())
+	}
+
+	guard.record(PollingResult{Success: true}, now)
+	if _, _, blocked := guard.blockedUntil(now); blocked {
+		t.Error("expected circuit closed after a success")
+	}
+}
+
+func TestServiceGuard_RateLimit(t *testing.T) {
+	guard := newServiceGuard()
+	now := time.Now()
+
+	guard.record(PollingResult{
+		ErrorClass: string(drivers.ErrorRateLimited),
+		RateLimit:  &drivers.RateLimit{Remaining: -1, RetryAfter: 30 * time.Second},
+	}, now)
+	until, reason, blocked := guard.blockedUntil(now)
+	if !blocked || reason != "rate_limited" || !until.Equal(now.Add(30*time.Second)) {
+		t.Fatalf("expected Retry-After pause, got %s until %s (%v)", reason, until, blocked)
+	}
+
+	// Cuota agotada en una respuesta exitosa: esperar al reset
+	reset := now.Add(2 * time.Minute)
+	guard.record(PollingResult{Success: true, RateLimit: &drivers.RateLimit{Limit: 100, Remaining: 0, Reset: reset}}, now)
+	if until, _, _ := guard.blockedUntil(now); !until.Equal(reset) {
+		t.Errorf("expected pause until reset %s, got %s", reset, until)
+	}
+	if _, _, blocked := guard.blockedUntil(reset.Add(time.Second)); blocked {
+		t.Error("expected pause to end after reset")
+	}
+
+	// Con cuota disponible no se pausa
+	other := newServiceGuard()
+	other.record(PollingResult{Success: true, RateLimit: &drivers.RateLimit{Limit: 100, Remaining: 40, Reset: reset}}, now)
+	if _, _, blocked := other.blockedUntil(now); blocked {
+		t.Error("expected no pause with remaining quota")
+	}
+}
+
+func TestEngine_GuardSharedPerService(t *testing.T) {
+	engine := &Engine{guards: make(map[string]*serviceGuard)}
+	if engine.guardFor("svc-1") != engine.guardFor("svc-1") {
+		t.Error("expected the same guard for workers of the same service")
+	}
+	if engine.guardFor("svc-1") == engine.guardFor("svc-2") {
+		t.Error("expected independent guards per service")
+	}
+}
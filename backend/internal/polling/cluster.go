@@ -0,0 +1,560 @@
+package polling
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"omniapi/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// leaseTTL tiempo que una réplica conserva una configuración sin renovar su lease.
+	// Si la réplica muere, otra toma la configuración al vencer.
+	leaseTTL = 30 * time.Second
+
+	// leaseRenewInterval cada cuánto se renuevan los leases y se buscan configuraciones huérfanas
+	leaseRenewInterval = 10 * time.Second
+)
+
+// Lease propiedad de una configuración de polling por una réplica (colección polling_leases)
+type Lease struct {
+	ConfigID   string    `bson:"_id" json:"config_id"`
+	Owner      string    `bson:"owner" json:"owner"` // NodeID de la réplica que ejecuta los workers
+	Provider   string    `bson:"provider" json:"provider"`
+	SiteCode   string    `bson:"site_code" json:"site_code"`
+	Instances  []string  `bson:"instances" json:"instances"` // InstanceIDs de los workers de la configuración
+	AcquiredAt time.Time `bson:"acquired_at" json:"acquired_at"`
+	RenewedAt  time.Time `bson:"renewed_at" json:"renewed_at"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+// NodeInfo réplica del API que participa en el polling (colección polling_nodes)
+type NodeInfo struct {
+	NodeID        string    `bson:"_id" json:"node_id"`
+	Hostname      string    `bson:"hostname" json:"hostname"`
+	PID           int       `bson:"pid" json:"pid"`
+	Workers       int       `bson:"workers" json:"workers"`
+	StartedAt     time.Time `bson:"started_at" json:"started_at"`
+	LastHeartbeat time.Time `bson:"last_heartbeat" json:"last_heartbeat"`
+	Alive         bool      `bson:"-" json:"alive"`
+}
+
+// ClusterStatus reparto de configuraciones entre réplicas
+type ClusterStatus struct {
+	NodeID string     `json:"node_id"` // Réplica que responde
+	Nodes  []NodeInfo `json:"nodes"`
+	Leases []Lease    `json:"leases"`
+}
+
+// ClusterStore persistencia de leases y heartbeats compartida por todas las réplicas
+type ClusterStore interface {
+	// Acquire toma o renueva el lease de lease.ConfigID para lease.Owner. Retorna false si
+	// otra réplica lo tiene vigente.
+	Acquire(lease Lease, ttl time.Duration) (bool, error)
+	Release(configID, nodeID string) error
+	Leases() ([]Lease, error)
+
+	Heartbeat(node NodeInfo) error
+	RemoveNode(nodeID string) error
+	Nodes() ([]NodeInfo, error)
+}
+
+// resolveNodeID identificador de esta réplica: POLLING_NODE_ID o hostname-pid
+func resolveNodeID() string {
+	if id := os.Getenv("POLLING_NODE_ID"); id != "" {
+		return id
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "node"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// configFingerprint resume los campos que determinan los workers de una configuración.
+// Un cambio indica que el dueño debe reiniciarlos.
+func configFingerprint(config *PollingConfig) string {
+	data, _ := json.Marshal(struct {
+		ServiceID  string
+		Endpoints  []EndpointInstance
+		IntervalMS int64
+		Output     *OutputConfig
+	}{config.ServiceID, config.Endpoints, config.IntervalMS, config.Output})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// leaseFor construye el lease de una configuración para esta réplica
+func leaseFor(config *PollingConfig, nodeID string) Lease {
+	lease := Lease{
+		ConfigID: config.ID.Hex(),
+		Owner:    nodeID,
+		Provider: config.Provider,
+		SiteCode: config.SiteCode,
+	}
+	for _, endpoint := range config.Endpoints {
+		if endpoint.Enabled {
+			lease.Instances = append(lease.Instances, endpoint.InstanceID)
+		}
+	}
+	return lease
+}
+
+// ═══════════════════════════════════════════════════════════
+// MongoDB
+// ═══════════════════════════════════════════════════════════
+
+// mongoClusterStore guarda leases y nodos en MongoDB
+type mongoClusterStore struct {
+	leases string
+	nodes  string
+}
+
+// NewMongoClusterStore crea el store sobre las colecciones polling_leases y polling_nodes
+func NewMongoClusterStore() ClusterStore {
+	return &mongoClusterStore{leases: "polling_leases", nodes: "polling_nodes"}
+}
+
+// Acquire usa un upsert condicionado: solo modifica el documento si el lease es propio o
+// está vencido. Si otra réplica lo tiene vigente, el filtro no coincide y el upsert intenta
+// insertar un _id existente, lo que MongoDB rechaza con duplicate key.
+func (s *mongoClusterStore) Acquire(lease Lease, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id": lease.ConfigID,
+		"$or": bson.A{
+			bson.M{"owner": lease.Owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		},
+	}
+
+	// Pipeline para conservar acquired_at al renovar y reiniciarlo al tomar el lease de otra réplica
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"acquired_at": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$owner", lease.Owner}}, "$acquired_at", now,
+		}},
+		"owner":      lease.Owner,
+		"provider":   lease.Provider,
+		"site_code":  lease.SiteCode,
+		"instances":  bson.M{"$literal": lease.Instances},
+		"renewed_at": now,
+		"expires_at": now.Add(ttl),
+	}}}}
+
+	_, err := database.GetCollection(s.leases).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *mongoClusterStore) Release(configID, nodeID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.leases).DeleteOne(ctx, bson.M{"_id": configID, "owner": nodeID})
+	return err
+}
+
+func (s *mongoClusterStore) Leases() ([]Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetCollection(s.leases).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	leases := []Lease{}
+	if err := cursor.All(ctx, &leases); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+func (s *mongoClusterStore) Heartbeat(node NodeInfo) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.nodes).ReplaceOne(ctx,
+		bson.M{"_id": node.NodeID}, node, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *mongoClusterStore) RemoveNode(nodeID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.nodes).DeleteOne(ctx, bson.M{"_id": nodeID})
+	return err
+}
+
+func (s *mongoClusterStore) Nodes() ([]NodeInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := database.GetCollection(s.nodes).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	nodes := []NodeInfo{}
+	if err := cursor.All(ctx, &nodes); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// ═══════════════════════════════════════════════════════════
+// Memoria (una sola réplica, tests)
+// ═══════════════════════════════════════════════════════════
+
+// memoryClusterStore implementación en memoria del ClusterStore
+type memoryClusterStore struct {
+	mu     sync.Mutex
+	leases map[string]Lease
+	nodes  map[string]NodeInfo
+}
+
+func newMemoryClusterStore() *memoryClusterStore {
+	return &memoryClusterStore{leases: make(map[string]Lease), nodes: make(map[string]NodeInfo)}
+}
+
+func (s *memoryClusterStore) Acquire(lease Lease, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	current, exists := s.leases[lease.ConfigID]
+	if exists && current.Owner != lease.Owner && now.Before(current.ExpiresAt) {
+		return false, nil
+	}
+
+	lease.AcquiredAt = now
+	if exists && current.Owner == lease.Owner {
+		lease.AcquiredAt = current.AcquiredAt
+	}
+	lease.RenewedAt = now
+	lease.ExpiresAt = now.Add(ttl)
+	s.leases[lease.ConfigID] = lease
+	return true, nil
+}
+
+func (s *memoryClusterStore) Release(configID, nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.leases[configID]; ok && current.Owner == nodeID {
+		delete(s.leases, configID)
+	}
+	return nil
+}
+
+func (s *memoryClusterStore) Leases() ([]Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	leases := make([]Lease, 0, len(s.leases))
+	for _, lease := range s.leases {
+		leases = append(leases, lease)
+	}
+	return leases, nil
+}
+
+func (s *memoryClusterStore) Heartbeat(node NodeInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes[node.NodeID] = node
+	return nil
+}
+
+func (s *memoryClusterStore) RemoveNode(nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.nodes, nodeID)
+	return nil
+}
+
+func (s *memoryClusterStore) Nodes() ([]NodeInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := make([]NodeInfo, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// ═══════════════════════════════════════════════════════════
+// Engine
+// ═══════════════════════════════════════════════════════════
+
+// clusterLoop renueva los leases propios y toma configuraciones huérfanas periódicamente
+func (e *Engine) clusterLoop(ctx context.Context) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			configs, err := e.fetchActiveConfigs()
+			if err != nil {
+				// Los leases sin renovar vencen solos (setLeaseDeadlineLocked)
+				fmt.Printf("⚠️  Cluster: could not load polling configs: %v\n", err)
+				continue
+			}
+			e.reconcile(configs)
+		}
+	}
+}
+
+// reconcile ajusta los workers locales a las configuraciones activas y a los leases:
+// detiene lo que ya no está activo o perdió el lease, reinicia lo que cambió en otra
+// réplica y toma las configuraciones sin dueño. Los leases se renuevan y adquieren sin
+// tener e.mu (cada operación va a MongoDB) y los resultados se aplican después.
+// El vencimiento de cada lease se calcula antes de pedirlo: una renovación que responde
+// tarde no extiende el lease más allá de lo que el store garantiza.
+func (e *Engine) reconcile(configs []PollingConfig) {
+	active := make(map[string]*PollingConfig, len(configs))
+	for i := range configs {
+		active[configs[i].ID.Hex()] = &configs[i]
+	}
+
+	// 1. Con el lock: detener lo que ya no está activo y reunir los leases a renovar/adquirir
+	e.mu.Lock()
+	if e.ctx == nil || e.ctx.Err() != nil {
+		e.mu.Unlock()
+		return
+	}
+	var released []string
+	renewals := make(map[string]Lease, len(e.configs))
+	for configID, running := range e.configs {
+		if _, ok := active[configID]; !ok {
+			fmt.Printf("🛑 Cluster: config %s no longer active, stopping its workers\n", configID)
+			e.dropConfigLocked(configID)
+			released = append(released, configID)
+			continue
+		}
+		renewals[configID] = leaseFor(running, e.nodeID)
+	}
+	candidates := make(map[string]Lease)
+	for configID, config := range active {
+		if _, owned := e.configs[configID]; !owned {
+			candidates[configID] = leaseFor(config, e.nodeID)
+		}
+	}
+	e.mu.Unlock()
+
+	// 2. Sin el lock: I/O contra el ClusterStore
+	e.releaseLeases(released)
+	deadlines := make(map[string]time.Time, len(renewals)+len(candidates))
+	renewed := make(map[string]bool, len(renewals))
+	for configID, lease := range renewals {
+		deadlines[configID] = time.Now().Add(leaseTTL)
+		acquired, err := e.cluster.Acquire(lease, leaseTTL)
+		if err != nil {
+			// El lease vence en su deadline anterior si no se renueva antes
+			fmt.Printf("⚠️  Cluster: could not renew lease for %s: %v\n", configID, err)
+			continue
+		}
+		renewed[configID] = acquired
+	}
+	acquired := make(map[string]bool, len(candidates))
+	for configID, lease := range candidates {
+		deadlines[configID] = time.Now().Add(leaseTTL)
+		ok, err := e.cluster.Acquire(lease, leaseTTL)
+		if err != nil {
+			fmt.Printf("⚠️  Cluster: could not acquire lease for %s: %v\n", configID, err)
+			continue
+		}
+		acquired[configID] = ok
+	}
+
+	// 3. Con el lock: aplicar los resultados sobre el estado actual (StartPolling/StopPolling
+	// pudieron cambiarlo mientras tanto)
+	e.mu.Lock()
+	if e.ctx == nil || e.ctx.Err() != nil {
+		e.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	var orphaned []string
+	for configID := range renewals {
+		running, owned := e.configs[configID]
+		result, ok := renewed[configID]
+		if !owned {
+			// Detenida mientras se renovaba: liberar el lease recién renovado
+			if ok && result {
+				orphaned = append(orphaned, configID)
+			}
+			continue
+		}
+
+		if !ok {
+			// Sin respuesta del store: el timer del lease detiene los workers al vencer
+			continue
+		}
+		if !result {
+			fmt.Printf("🔀 Cluster: lease for %s/%s lost, stopping its workers\n", running.Provider, running.SiteCode)
+			e.dropConfigLocked(configID)
+			continue
+		}
+		if !deadlines[configID].After(now) {
+			// La renovación respondió cuando el lease ya había vencido: otra réplica pudo tomarlo
+			fmt.Printf("🔀 Cluster: lease for %s renewed too late, stopping its workers\n", configID)
+			e.dropConfigLocked(configID)
+			continue
+		}
+		e.setLeaseDeadlineLocked(configID, deadlines[configID])
+
+		// Modificada desde otra réplica (StartPolling sobre una config que no era suya)
+		config := active[configID]
+		if configFingerprint(config) != configFingerprint(running) {
+			fmt.Printf("🔄 Cluster: config %s/%s changed, restarting workers\n", config.Provider, config.SiteCode)
+			e.stopConfigWorkersLocked(configID)
+			if err := e.startConfigLocked(config); err != nil {
+				fmt.Printf("⚠️  Cluster: could not restart %s: %v\n", configID, err)
+			}
+		}
+	}
+
+	// Configuraciones sin dueño (nuevas o de una réplica caída)
+	for configID, ok := range acquired {
+		if !ok {
+			continue
+		}
+		if _, owned := e.configs[configID]; owned {
+			// Arrancada por StartPolling mientras tanto
+			continue
+		}
+
+		if !deadlines[configID].After(now) {
+			orphaned = append(orphaned, configID)
+			continue
+		}
+
+		config := active[configID]
+		fmt.Printf("🔀 Cluster: node %s took over %s/%s\n", e.nodeID, config.Provider, config.SiteCode)
+		if err := e.startConfigLocked(config); err != nil {
+			fmt.Printf("⚠️  Cluster: could not start %s: %v\n", configID, err)
+			orphaned = append(orphaned, configID)
+			continue
+		}
+		e.setLeaseDeadlineLocked(configID, deadlines[configID])
+	}
+	node := e.nodeInfoLocked(now)
+	e.mu.Unlock()
+
+	e.releaseLeases(orphaned)
+	if err := e.cluster.Heartbeat(node); err != nil {
+		fmt.Printf("⚠️  Cluster: heartbeat failed: %v\n", err)
+	}
+}
+
+// setLeaseDeadlineLocked registra el vencimiento del lease propio de configID y programa la
+// detención de sus workers para ese momento: si no se renueva antes, otra réplica puede
+// tomarlo (p. ej. sin conexión a MongoDB o con renovaciones lentas)
+func (e *Engine) setLeaseDeadlineLocked(configID string, deadline time.Time) {
+	if timer, ok := e.leaseTimers[configID]; ok {
+		timer.Stop()
+	}
+	e.leaseDeadlines[configID] = deadline
+	e.leaseTimers[configID] = time.AfterFunc(time.Until(deadline), func() {
+		e.expireLease(configID, deadline)
+	})
+}
+
+// clearLeaseLocked descarta el vencimiento y el timer del lease de configID
+func (e *Engine) clearLeaseLocked(configID string) {
+	if timer, ok := e.leaseTimers[configID]; ok {
+		timer.Stop()
+	}
+	delete(e.leaseTimers, configID)
+	delete(e.leaseDeadlines, configID)
+}
+
+// expireLease detiene los workers de configID si su lease venció sin renovarse
+func (e *Engine) expireLease(configID string, deadline time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if current, ok := e.leaseDeadlines[configID]; !ok || !current.Equal(deadline) {
+		return // Renovado o liberado mientras tanto
+	}
+	fmt.Printf("🔀 Cluster: lease for %s expired without renewal, stopping its workers\n", configID)
+	e.dropConfigLocked(configID)
+}
+
+// nodeInfoLocked estado de esta réplica para el heartbeat
+func (e *Engine) nodeInfoLocked(now time.Time) NodeInfo {
+	hostname, _ := os.Hostname()
+	return NodeInfo{
+		NodeID:        e.nodeID,
+		Hostname:      hostname,
+		PID:           os.Getpid(),
+		Workers:       len(e.workers),
+		StartedAt:     e.startedAt,
+		LastHeartbeat: now,
+	}
+}
+
+// dropConfigLocked detiene los workers de una configuración y la quita de esta réplica.
+// Su lease no se libera aquí: el llamador lo hace con releaseLeases tras soltar e.mu.
+func (e *Engine) dropConfigLocked(configID string) {
+	e.stopConfigWorkersLocked(configID)
+	delete(e.configs, configID)
+	e.clearLeaseLocked(configID)
+}
+
+// releaseLeases libera leases propios en el ClusterStore (sin tener e.mu)
+func (e *Engine) releaseLeases(configIDs []string) {
+	for _, configID := range configIDs {
+		if err := e.cluster.Release(configID, e.nodeID); err != nil {
+			fmt.Printf("⚠️  Cluster: could not release lease for %s: %v\n", configID, err)
+		}
+	}
+}
+
+// GetClusterStatus retorna las réplicas conocidas y qué configuraciones ejecuta cada una
+func (e *Engine) GetClusterStatus() (ClusterStatus, error) {
+	status := ClusterStatus{NodeID: e.nodeID}
+
+	nodes, err := e.cluster.Nodes()
+	if err != nil {
+		return status, err
+	}
+	leases, err := e.cluster.Leases()
+	if err != nil {
+		return status, err
+	}
+
+	now := time.Now()
+	for i := range nodes {
+		nodes[i].Alive = now.Sub(nodes[i].LastHeartbeat) <= leaseTTL
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].NodeID < nodes[j].NodeID })
+	sort.Slice(leases, func(i, j int) bool { return leases[i].ConfigID < leases[j].ConfigID })
+
+	status.Nodes = nodes
+	status.Leases = leases
+	return status, nil
+}
@@ -0,0 +1,252 @@
+package polling
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newClusterTestEngine(nodeID string, store ClusterStore) *Engine {
+	engine := &Engine{
+		workers:     make(map[string]*Worker),
+		configs:     make(map[string]*PollingConfig),
+		lastResults: make(map[string]*PollingResult),
+		guards:      make(map[string]*serviceGuard),
+		nodeID:      nodeID,
+		cluster:     store,
+
+		leaseDeadlines: make(map[string]time.Time),
+		leaseTimers:    make(map[string]*time.Timer),
+		serviceLookup: func(serviceID string) (*models.ExternalService, error) {
+			return &models.ExternalService{Name: "svc", ServiceType: "apikey", BaseURL: "http://127.0.0.1:0"}, nil
+		},
+	}
+	engine.ctx, engine.cancel = context.WithCancel(context.Background())
+	return engine
+}
+
+func clusterTestConfig(site string) PollingConfig {
+	return PollingConfig{
+		ID:         primitive.NewObjectID(),
+		Provider:   "acme",
+		SiteID:     site,
+		SiteCode:   site,
+		ServiceID:  primitive.NewObjectID().Hex(),
+		Status:     "active",
+		IntervalMS: int64(time.Hour / time.Millisecond), // Los workers no llegan a consultar durante el test
+		Endpoints: []EndpointInstance{
+			{InstanceID: site + "-readings", EndpointID: "readings", Path: "/readings", Enabled: true},
+		},
+	}
+}
+
+func expireLeases(store *memoryClusterStore) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, lease := range store.leases {
+		lease.ExpiresAt = time.Now().Add(-time.Second)
+		store.leases[id] = lease
+	}
+}
+
+func TestCluster_SingleOwnerAndTakeover(t *testing.T) {
+	store := newMemoryClusterStore()
+	nodeA := newClusterTestEngine("node-a", store)
+	nodeB := newClusterTestEngine("node-b", store)
+	defer nodeA.Stop()
+	defer nodeB.Stop()
+
+	configs := []PollingConfig{clusterTestConfig("site-1"), clusterTestConfig("site-2")}
+
+	// Cada configuración la ejecuta una sola réplica
+	nodeA.reconcile(append([]PollingConfig{}, configs...))
+	nodeB.reconcile(append([]PollingConfig{}, configs...))
+	if len(nodeA.workers) != 2 || len(nodeB.workers) != 0 {
+		t.Fatalf("expected all workers on node-a, got a=%d b=%d", len(nodeA.workers), len(nodeB.workers))
+	}
+	for _, worker := range nodeA.GetStatus().Workers {
+		if worker.Node != "node-a" {
+			t.Errorf("expected worker owned by node-a, got %q", worker.Node)
+		}
+	}
+
+	// node-a deja de renovar (caída): node-b toma sus configuraciones al vencer el lease
+	expireLeases(store)
+	nodeB.reconcile(append([]PollingConfig{}, configs...))
+	if len(nodeB.workers) != 2 {
+		t.Fatalf("expected node-b to take over both configs, got %d workers", len(nodeB.workers))
+	}
+
+	// node-a vuelve: detecta que perdió los leases y detiene sus workers
+	nodeA.reconcile(append([]PollingConfig{}, configs...))
+	if len(nodeA.workers) != 0 || len(nodeA.configs) != 0 {
+		t.Fatalf("expected node-a to stop after losing its leases, got %d workers", len(nodeA.workers))
+	}
+
+	status, err := nodeB.GetClusterStatus()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(status.Leases) != 2 || status.Leases[0].Owner != "node-b" || len(status.Leases[0].Instances) != 1 {
+		t.Errorf("expected leases owned by node-b, got %+v", status.Leases)
+	}
+	if len(status.Nodes) != 2 || !status.Nodes[1].Alive || status.Nodes[1].Workers != 2 {
+		t.Errorf("expected heartbeats from both nodes, got %+v", status.Nodes)
+	}
+}
+
+func TestCluster_ConfigChangesAndStop(t *testing.T) {
+	store := newMemoryClusterStore()
+	node := newClusterTestEngine("node-a", store)
+	defer node.Stop()
+
+	configs := []PollingConfig{clusterTestConfig("site-1"), clusterTestConfig("site-2")}
+	node.reconcile(append([]PollingConfig{}, configs...))
+	configID := configs[0].ID.Hex()
+	workerKey := configID + ":site-1-readings"
+	before := node.workers[workerKey]
+
+	// Sin cambios los workers se conservan al renovar
+	node.reconcile(append([]PollingConfig{}, configs...))
+	if node.workers[workerKey] != before {
+		t.Fatal("expected workers to be kept when the config did not change")
+	}
+
+	// Cambio hecho desde otra réplica: el dueño reinicia los workers
+	configs[0].IntervalMS = 60000
+	node.reconcile(append([]PollingConfig{}, configs...))
+	if after := node.workers[workerKey]; after == nil || after == before || after.config.IntervalMS != 60000 {
+		t.Fatal("expected workers restarted with the new config")
+	}
+
+	// Config detenida (ya no activa): se detienen sus workers y se libera el lease
+	node.reconcile(append([]PollingConfig{}, configs[1:]...))
+	if _, ok := node.workers[workerKey]; ok {
+		t.Error("expected workers of the stopped config to be removed")
+	}
+	if leases, _ := store.Leases(); len(leases) != 1 || leases[0].ConfigID != configs[1].ID.Hex() {
+		t.Errorf("expected only the active config lease, got %+v", leases)
+	}
+
+	// Al detener el engine se liberan los leases para que otra réplica los tome de inmediato
+	node.Stop()
+	if leases, _ := store.Leases(); len(leases) != 0 {
+		t.Errorf("expected leases released on stop, got %+v", leases)
+	}
+	if nodes, _ := store.Nodes(); len(nodes) != 0 {
+		t.Errorf("expected node removed on stop, got %+v", nodes)
+	}
+}
+
+// unreachableClusterStore simula un ClusterStore sin conexión al renovar leases
+type unreachableClusterStore struct {
+	*memoryClusterStore
+	down bool
+}
+
+func (s *unreachableClusterStore) Acquire(lease Lease, ttl time.Duration) (bool, error) {
+	if s.down {
+		return false, errors.New("mongo unreachable")
+	}
+	return s.memoryClusterStore.Acquire(lease, ttl)
+}
+
+func TestCluster_StopsWorkersWhenRenewalFailsPastTTL(t *testing.T) {
+	store := &unreachableClusterStore{memoryClusterStore: newMemoryClusterStore()}
+	node := newClusterTestEngine("node-a", store)
+	defer node.Stop()
+
+	configs := []PollingConfig{clusterTestConfig("site-1")}
+	node.reconcile(append([]PollingConfig{}, configs...))
+	if len(node.workers) != 1 {
+		t.Fatalf("expected 1 worker, got %d", len(node.workers))
+	}
+
+	// Un fallo dentro del TTL conserva los workers
+	store.down = true
+	node.reconcile(append([]PollingConfig{}, configs...))
+	if len(node.workers) != 1 {
+		t.Fatalf("expected workers kept while the lease is still valid, got %d", len(node.workers))
+	}
+
+	// Vencido el lease sin renovar, otra réplica puede tenerlo: se detienen en el momento,
+	// sin esperar al siguiente reconcile
+	configID := configs[0].ID.Hex()
+	node.mu.Lock()
+	node.setLeaseDeadlineLocked(configID, time.Now().Add(20*time.Millisecond))
+	node.mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		node.mu.RLock()
+		stopped := len(node.workers) == 0 && len(node.configs) == 0
+		node.mu.RUnlock()
+		if stopped {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	node.mu.RLock()
+	if len(node.workers) != 0 || len(node.configs) != 0 {
+		node.mu.RUnlock()
+		t.Fatalf("expected workers stopped after the lease expired, got %d", len(node.workers))
+	}
+	node.mu.RUnlock()
+
+	// Al volver el store se retoma la configuración
+	store.down = false
+	node.reconcile(append([]PollingConfig{}, configs...))
+	if len(node.workers) != 1 {
+		t.Fatalf("expected config taken again once the store is back, got %d workers", len(node.workers))
+	}
+}
+
+// slowClusterStore demora cada Acquire (MongoDB lento)
+type slowClusterStore struct {
+	*memoryClusterStore
+	delay time.Duration
+}
+
+func (s *slowClusterStore) Acquire(lease Lease, ttl time.Duration) (bool, error) {
+	time.Sleep(s.delay)
+	return s.memoryClusterStore.Acquire(lease, ttl)
+}
+
+func TestCluster_LeaseDeadlineComputedBeforeRenewal(t *testing.T) {
+	store := &slowClusterStore{memoryClusterStore: newMemoryClusterStore()}
+	node := newClusterTestEngine("node-a", store)
+	defer node.Stop()
+
+	configs := []PollingConfig{clusterTestConfig("site-1")}
+	node.reconcile(append([]PollingConfig{}, configs...))
+
+	// Con un store lento el vencimiento local se cuenta desde antes de pedir el lease
+	store.delay = 50 * time.Millisecond
+	before := time.Now()
+	node.reconcile(append([]PollingConfig{}, configs...))
+
+	configID := configs[0].ID.Hex()
+	node.mu.RLock()
+	deadline := node.leaseDeadlines[configID]
+	workers := len(node.workers)
+	node.mu.RUnlock()
+	if workers != 1 {
+		t.Fatalf("expected 1 worker, got %d", workers)
+	}
+	if deadline.After(before.Add(leaseTTL).Add(store.delay / 2)) {
+		t.Fatalf("lease deadline %s must not include the store latency (request sent at %s)", deadline, before)
+	}
+
+	// Al desactivarse la configuración se descarta su timer y se libera el lease
+	node.reconcile(nil)
+	node.mu.RLock()
+	_, tracked := node.leaseTimers[configID]
+	node.mu.RUnlock()
+	if leases, _ := store.Leases(); tracked || len(leases) != 0 {
+		t.Fatalf("expected lease released and timer cleared, got %d leases (timer: %v)", len(leases), tracked)
+	}
+}
@@ -0,0 +1,140 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorClass clasificación de una respuesta fallida del proveedor
+type ErrorClass string
+
+const (
+	ErrorNone            ErrorClass = ""
+	ErrorAuth            ErrorClass = "auth"             // 401/403: renovar token
+	ErrorRateLimited     ErrorClass = "rate_limited"     // 429 o cuota agotada
+	ErrorUnavailable     ErrorClass = "unavailable"      // 5xx, timeouts: transitorio
+	ErrorRejected        ErrorClass = "rejected"         // 4xx restantes: la request es inválida
+	ErrorInvalidResponse ErrorClass = "invalid_response" // 2xx con un body que no se puede interpretar
+)
+
+// Endpoint describe la consulta de una instancia de polling
+type Endpoint struct {
+	BaseURL string
+	Method  string
+	Path    string            // Path con placeholders ({monitor_id})
+	Params  map[string]string // Placeholders, query string (GET) o body (POST)
+
+	// RecordsPath ruta al arreglo de registros en la respuesta ("data.items"); vacío = raíz
+	RecordsPath string
+
+	// Paginación (nil = una sola página)
+	Pagination *Pagination
+	Page       int // Página actual en paginación por número (0 = página inicial)
+
+	// NextURL URL absoluta de la siguiente página (link "next"); si está definida reemplaza BaseURL+Path
+	NextURL string
+}
+
+// RateLimit información de rate limit informada por el proveedor en los headers
+type RateLimit struct {
+	Limit      int           `json:"limit,omitempty"`
+	Remaining  int           `json:"remaining"`
+	Reset      time.Time     `json:"reset,omitempty"`
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+// Driver define cómo el polling engine construye e interpreta las requests de un proveedor.
+// La autenticación la aplica el worker (adapters.AuthorizeRequest) sobre la request construida.
+type Driver interface {
+	// Provider nombre del proveedor (coincide con PollingConfig.Provider)
+	Provider() string
+
+	// BuildRequest construye la request sin autenticación
+	BuildRequest(ctx context.Context, endpoint Endpoint) (*http.Request, error)
+
+	// NextPage retorna el endpoint de la siguiente página, o false si la respuesta es la última
+	NextPage(endpoint Endpoint, resp *http.Response, data interface{}) (Endpoint, bool)
+
+	// Unwrap extrae los datos útiles del envelope de la respuesta
+	Unwrap(data interface{}) interface{}
+
+	// RateLimit lee los headers de rate limit (nil si el proveedor no los informa)
+	RateLimit(resp *http.Response) *RateLimit
+
+	// ClassifyError clasifica una respuesta (ErrorNone si fue exitosa)
+	ClassifyError(statusCode int, body []byte) ErrorClass
+}
+
+// Registry registro de drivers por proveedor
+type Registry struct {
+	mu      sync.RWMutex
+	drivers map[string]Driver
+}
+
+// NewRegistry crea un registro vacío
+func NewRegistry() *Registry {
+	return &Registry{drivers: make(map[string]Driver)}
+}
+
+// Register registra el driver de un proveedor
+func (r *Registry) Register(driver Driver) error {
+	if driver == nil {
+		return fmt.Errorf("driver cannot be nil")
+	}
+
+	provider := strings.ToLower(driver.Provider())
+	if provider == "" {
+		return fmt.Errorf("driver provider cannot be empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.drivers[provider]; exists {
+		return fmt.Errorf("polling driver '%s' already registered", provider)
+	}
+	r.drivers[provider] = driver
+	return nil
+}
+
+// Get retorna el driver del proveedor o el driver HTTP genérico si no hay uno registrado
+func (r *Registry) Get(provider string) Driver {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if driver, ok := r.drivers[strings.ToLower(provider)]; ok {
+		return driver
+	}
+	return NewHTTPDriver(provider, nil)
+}
+
+// Providers lista los proveedores registrados
+func (r *Registry) Providers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	providers := make([]string, 0, len(r.drivers))
+	for provider := range r.drivers {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// GlobalRegistry registro global usado por el polling engine
+var GlobalRegistry = NewRegistry()
+
+// Register registra un driver en el registro global
+func Register(driver Driver) error {
+	return GlobalRegistry.Register(driver)
+}
+
+// Get retorna el driver de un proveedor desde el registro global
+func Get(provider string) Driver {
+	return GlobalRegistry.Get(provider)
+}
@@ -0,0 +1,190 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuildURL(t *testing.T) {
+	endpoint := Endpoint{
+		BaseURL: "https://api.provider.com/",
+		Method:  "GET",
+		Path:    "/monitors/{monitor_id}/data?format=json",
+		Params: map[string]string{
+			"monitor_id": "M 1/2",
+			"from":       "2026-01-01T00:00:00+03:00",
+			"format":     "csv",
+		},
+	}
+
+	got, err := BuildURL(endpoint)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "https://api.provider.com/monitors/M%201%2F2/data?format=json&from=2026-01-01T00%3A00%3A00%2B03%3A00"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	endpoint.Method = "POST"
+	if got, _ := BuildURL(endpoint); got != "https://api.provider.com/monitors/M%201%2F2/data?format=json" {
+		t.Errorf("POST params should not be added to the query string, got %s", got)
+	}
+
+	endpoint.NextURL = "https://api.provider.com/monitors/page/2"
+	if got, _ := BuildURL(endpoint); got != endpoint.NextURL {
+		t.Errorf("expected next link, got %s", got)
+	}
+}
+
+func TestBuildRequest_TypedPOSTBody(t *testing.T) {
+	driver := NewScaleAQDriver()
+	req, err := driver.BuildRequest(context.Background(), Endpoint{
+		BaseURL: "https://cloud.scaleaq.com",
+		Method:  "POST",
+		Path:    "/sites/{site_id}/time_series/retrieve",
+		Params: map[string]string{
+			"site_id":   "S1",
+			"channels":  `["oxygen","temperature"]`,
+			"timeRange": `{"from":"2026-01-01"}`,
+			"label":     "[not json",
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Header.Get("Scale-Version") != ScaleAQVersion || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("missing ScaleAQ headers: %v", req.Header)
+	}
+
+	raw, _ := io.ReadAll(req.Body)
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("invalid body %s: %v", raw, err)
+	}
+	if _, ok := body["site_id"]; ok {
+		t.Error("path placeholders should not be sent in the body")
+	}
+	if channels, ok := body["channels"].([]interface{}); !ok || len(channels) != 2 {
+		t.Errorf("expected channels as JSON array, got %#v", body["channels"])
+	}
+	if _, ok := body["timeRange"].(map[string]interface{}); !ok {
+		t.Errorf("expected timeRange as JSON object, got %#v", body["timeRange"])
+	}
+	if body["label"] != "[not json" {
+		t.Errorf("expected invalid JSON to be sent as string, got %#v", body["label"])
+	}
+}
+
+func TestInnovexDriver_ClassifyError(t *testing.T) {
+	driver := NewInnovexDriver()
+
+	cases := []struct {
+		status int
+		body   string
+		want   ErrorClass
+	}{
+		{200, `{"monitor_id":"1","last_data":{}}`, ErrorNone},
+		{200, `{"response":"Miss information"}`, ErrorRejected},
+		{200, `{"response":"time out"}`, ErrorUnavailable},
+		{200, `{"response":"ok, data follows"}`, ErrorNone},
+		{401, `{"response":"Access Denied"}`, ErrorAuth},
+		{429, ``, ErrorRateLimited},
+		{503, ``, ErrorUnavailable},
+	}
+	for _, tc := range cases {
+		if got := driver.ClassifyError(tc.status, []byte(tc.body)); got != tc.want {
+			t.Errorf("status %d body %s: expected %q, got %q", tc.status, tc.body, tc.want, got)
+		}
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+
+	if rl := ParseRateLimit(http.Header{}, now); rl != nil {
+		t.Errorf("expected nil without headers, got %+v", rl)
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+	header.Set("X-RateLimit-Limit", "100")
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", "1800000060")
+
+	rl := ParseRateLimit(header, now)
+	if rl == nil || rl.RetryAfter != 30*time.Second || rl.Limit != 100 || rl.Remaining != 0 || !rl.Reset.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected rate limit: %+v", rl)
+	}
+
+	header = http.Header{}
+	header.Set("RateLimit-Reset", "15")
+	rl = ParseRateLimit(header, now)
+	if rl == nil || rl.Remaining != -1 || !rl.Reset.Equal(now.Add(15*time.Second)) {
+		t.Errorf("expected relative reset with unknown remaining, got %+v", rl)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register(NewScaleAQDriver()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := registry.Register(NewScaleAQDriver()); err == nil {
+		t.Error("expected error registering a duplicate driver")
+	}
+
+	if _, ok := registry.Get("ScaleAQ").(*ScaleAQDriver); !ok {
+		t.Error("expected ScaleAQ driver (case-insensitive)")
+	}
+	if driver, ok := registry.Get("acme").(*HTTPDriver); !ok || driver.Provider() != "acme" {
+		t.Errorf("expected generic driver for unregistered provider, got %#v", driver)
+	}
+}
+
+func TestNextPageFor(t *testing.T) {
+	current, _ := http.NewRequest(http.MethodGet, "https://api.provider.com/v1/readings?cursor=a", nil)
+	resp := &http.Response{Header: http.Header{}, Request: current}
+
+	// next link en el body, relativo a la página actual
+	endpoint := Endpoint{Pagination: &Pagination{Type: PaginationNextLink, NextPath: "links.next"}}
+	data := map[string]interface{}{"links": map[string]interface{}{"next": "/v1/readings?cursor=b"}}
+	next, ok := NextPageFor(endpoint, resp, data)
+	if !ok || next.NextURL != "https://api.provider.com/v1/readings?cursor=b" {
+		t.Errorf("expected resolved next link, got %q (%v)", next.NextURL, ok)
+	}
+	if _, ok := NextPageFor(endpoint, resp, map[string]interface{}{"links": map[string]interface{}{"next": nil}}); ok {
+		t.Error("expected last page without next link")
+	}
+
+	// next link en el header Link
+	endpoint.Pagination.NextPath = ""
+	resp.Header.Set("Link", `<https://api.provider.com/v1/readings?cursor=c>; rel="next", <https://api.provider.com/v1/readings>; rel="first"`)
+	if next, ok := NextPageFor(endpoint, resp, nil); !ok || next.NextURL != "https://api.provider.com/v1/readings?cursor=c" {
+		t.Errorf("expected next from Link header, got %q", next.NextURL)
+	}
+
+	// número de página: se detiene con una página incompleta
+	endpoint = Endpoint{
+		Method:      "GET",
+		BaseURL:     "https://api.provider.com",
+		Path:        "/items",
+		RecordsPath: "items",
+		Pagination:  &Pagination{Type: PaginationPage, PageParam: "page", PageSizeParam: "size", PageSize: 2},
+	}
+	if got, _ := BuildURL(endpoint); got != "https://api.provider.com/items?page=1&size=2" {
+		t.Errorf("expected first page params, got %s", got)
+	}
+	full := map[string]interface{}{"items": []interface{}{1, 2}}
+	next, ok = NextPageFor(endpoint, nil, full)
+	if got, _ := BuildURL(next); !ok || got != "https://api.provider.com/items?page=2&size=2" {
+		t.Errorf("expected second page, got %s", got)
+	}
+	if _, ok := NextPageFor(next, nil, map[string]interface{}{"items": []interface{}{3}}); ok {
+		t.Error("expected pagination to stop on a partial page")
+	}
+}
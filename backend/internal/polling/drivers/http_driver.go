@@ -0,0 +1,213 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPDriver driver genérico para APIs REST/JSON. Los drivers de proveedores lo embeben
+// y sobreescriben solo lo que difiere.
+type HTTPDriver struct {
+	provider string
+	headers  map[string]string
+}
+
+// NewHTTPDriver crea un driver genérico con headers fijos opcionales
+func NewHTTPDriver(provider string, headers map[string]string) *HTTPDriver {
+	return &HTTPDriver{provider: provider, headers: headers}
+}
+
+// Provider retorna el nombre del proveedor
+func (d *HTTPDriver) Provider() string {
+	return d.provider
+}
+
+// BuildRequest construye la request: GET con params en la query string, POST con params en un body JSON
+func (d *HTTPDriver) BuildRequest(ctx context.Context, endpoint Endpoint) (*http.Request, error) {
+	fullURL, err := BuildURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	method := strings.ToUpper(endpoint.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if method != http.MethodGet && method != http.MethodDelete && endpoint.NextURL == "" {
+		payload, err := BuildBody(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range d.headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// NextPage sigue la paginación configurada en el endpoint (next link o número de página)
+func (d *HTTPDriver) NextPage(endpoint Endpoint, resp *http.Response, data interface{}) (Endpoint, bool) {
+	return NextPageFor(endpoint, resp, data)
+}
+
+// Unwrap el driver genérico retorna la respuesta completa
+func (d *HTTPDriver) Unwrap(data interface{}) interface{} {
+	return data
+}
+
+// RateLimit lee Retry-After y los headers X-RateLimit-* / RateLimit-*
+func (d *HTTPDriver) RateLimit(resp *http.Response) *RateLimit {
+	return ParseRateLimit(resp.Header, time.Now())
+}
+
+// ClassifyError clasifica la respuesta según el status HTTP
+func (d *HTTPDriver) ClassifyError(statusCode int, body []byte) ErrorClass {
+	return ClassifyStatus(statusCode)
+}
+
+// BuildURL construye la URL final: reemplaza placeholders del path (escapados) y, en GET,
+// agrega como query string los params que no son placeholders ni están ya en el path
+func BuildURL(endpoint Endpoint) (string, error) {
+	if endpoint.NextURL != "" {
+		return endpoint.NextURL, nil
+	}
+
+	params := endpoint.RequestParams()
+	path := endpoint.Path
+	for key, value := range params {
+		path = strings.ReplaceAll(path, "{"+key+"}", url.PathEscape(value))
+	}
+
+	path, rawQuery, _ := strings.Cut(path, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("query string inválida en path '%s': %w", endpoint.Path, err)
+	}
+
+	if method := strings.ToUpper(endpoint.Method); method == "" || method == http.MethodGet {
+		for key, value := range params {
+			if isPlaceholder(endpoint.Path, key) || query.Has(key) {
+				continue
+			}
+			query.Set(key, value)
+		}
+	}
+
+	fullURL := strings.TrimSuffix(endpoint.BaseURL, "/") + "/" + strings.TrimPrefix(path, "/")
+	if len(query) > 0 {
+		fullURL += "?" + query.Encode()
+	}
+	return fullURL, nil
+}
+
+// BuildBody construye el body JSON de un POST con los params que no son placeholders del path.
+// Los valores que son un objeto o arreglo JSON ("[\"ch1\",\"ch2\"]") se envían como JSON y no como string.
+func BuildBody(endpoint Endpoint) ([]byte, error) {
+	params := endpoint.RequestParams()
+	body := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if isPlaceholder(endpoint.Path, key) {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+			var raw json.RawMessage
+			if json.Unmarshal([]byte(trimmed), &raw) == nil {
+				body[key] = raw
+				continue
+			}
+		}
+		body[key] = value
+	}
+	return json.Marshal(body)
+}
+
+// ClassifyStatus clasificación estándar por status HTTP
+func ClassifyStatus(statusCode int) ErrorClass {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return ErrorNone
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorAuth
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorRateLimited
+	case statusCode >= 500 || statusCode == http.StatusRequestTimeout:
+		return ErrorUnavailable
+	default:
+		return ErrorRejected
+	}
+}
+
+// ParseRateLimit lee Retry-After (segundos o fecha HTTP) y los headers X-RateLimit-* o RateLimit-*.
+// El reset se acepta como epoch unix o como segundos restantes.
+func ParseRateLimit(header http.Header, now time.Time) *RateLimit {
+	var rl RateLimit
+	found := false
+
+	if value := header.Get("Retry-After"); value != "" {
+		if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+			rl.RetryAfter = time.Duration(secs) * time.Second
+			found = true
+		} else if at, err := http.ParseTime(value); err == nil && at.After(now) {
+			rl.RetryAfter = at.Sub(now)
+			found = true
+		}
+	}
+
+	headerInt := func(names ...string) (int, bool) {
+		for _, name := range names {
+			if n, err := strconv.Atoi(strings.TrimSpace(header.Get(name))); err == nil {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+
+	if n, ok := headerInt("X-RateLimit-Limit", "RateLimit-Limit"); ok {
+		rl.Limit = n
+		found = true
+	}
+	if n, ok := headerInt("X-RateLimit-Remaining", "RateLimit-Remaining"); ok {
+		rl.Remaining = n
+		found = true
+	} else {
+		rl.Remaining = -1 // Desconocido
+	}
+	if n, ok := headerInt("X-RateLimit-Reset", "RateLimit-Reset"); ok {
+		if n > 1_000_000_000 {
+			rl.Reset = time.Unix(int64(n), 0)
+		} else {
+			rl.Reset = now.Add(time.Duration(n) * time.Second)
+		}
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return &rl
+}
+
+func isPlaceholder(path, key string) bool {
+	return strings.Contains(path, "{"+key+"}")
+}
@@ -0,0 +1,48 @@
+package drivers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// InnovexDriver driver de Innovex. La API puede responder errores con HTTP 200 y un body
+// {"response": "<mensaje>"}, por lo que la clasificación revisa también el body.
+type InnovexDriver struct {
+	*HTTPDriver
+}
+
+// NewInnovexDriver crea el driver de Innovex
+func NewInnovexDriver() *InnovexDriver {
+	return &InnovexDriver{HTTPDriver: NewHTTPDriver("innovex", nil)}
+}
+
+// innovexErrors mensajes de error documentados por Innovex
+var innovexErrors = map[string]ErrorClass{
+	"unauthorized sensor information": ErrorRejected,
+	"miss information":                ErrorRejected,
+	"not found":                       ErrorRejected,
+	"method not allowed":              ErrorRejected,
+	"access denied":                   ErrorRejected,
+	"internal error":                  ErrorUnavailable,
+	"time out":                        ErrorUnavailable,
+}
+
+// ClassifyError clasifica por status y por los mensajes de error de Innovex
+func (d *InnovexDriver) ClassifyError(statusCode int, body []byte) ErrorClass {
+	if class := ClassifyStatus(statusCode); class != ErrorNone {
+		return class
+	}
+
+	var envelope map[string]interface{}
+	if json.Unmarshal(body, &envelope) != nil || len(envelope) != 1 {
+		return ErrorNone
+	}
+	message, ok := envelope["response"].(string)
+	if !ok {
+		return ErrorNone
+	}
+	if class, known := innovexErrors[strings.ToLower(strings.TrimSpace(message))]; known {
+		return class
+	}
+	return ErrorNone
+}
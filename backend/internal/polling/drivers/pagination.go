@@ -0,0 +1,140 @@
+package drivers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"omniapi/internal/jsonpath"
+)
+
+// Tipos de paginación soportados por el driver genérico
+const (
+	PaginationNextLink = "next_link" // La respuesta (o el header Link) trae la URL de la siguiente página
+	PaginationPage     = "page"      // Número de página en un param, hasta recibir una página vacía o incompleta
+)
+
+// Pagination configuración de paginación de un endpoint
+type Pagination struct {
+	Type string `bson:"type" json:"type"`
+
+	// next_link: ruta al link en el JSON ("links.next"); vacío = header Link rel="next"
+	NextPath string `bson:"next_path,omitempty" json:"next_path,omitempty"`
+
+	// page: param del número de página, tamaño de página y página inicial (default 1)
+	PageParam     string `bson:"page_param,omitempty" json:"page_param,omitempty"`
+	PageSizeParam string `bson:"page_size_param,omitempty" json:"page_size_param,omitempty"`
+	PageSize      int    `bson:"page_size,omitempty" json:"page_size,omitempty"`
+	StartPage     int    `bson:"start_page,omitempty" json:"start_page,omitempty"`
+}
+
+// Validate verifica la configuración de paginación
+func (p *Pagination) Validate() error {
+	switch p.Type {
+	case PaginationNextLink:
+		return nil
+	case PaginationPage:
+		if p.PageParam == "" {
+			return fmt.Errorf("pagination.page_param is required for page pagination")
+		}
+		if p.PageSize > 0 && p.PageSizeParam == "" {
+			return fmt.Errorf("pagination.page_size_param is required when page_size is set")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported pagination type: %s", p.Type)
+	}
+}
+
+// RequestParams retorna los params del endpoint con el número y tamaño de página aplicados
+func (e Endpoint) RequestParams() map[string]string {
+	if e.Pagination == nil || e.Pagination.Type != PaginationPage {
+		return e.Params
+	}
+
+	params := make(map[string]string, len(e.Params)+2)
+	for key, value := range e.Params {
+		params[key] = value
+	}
+	params[e.Pagination.PageParam] = strconv.Itoa(e.currentPage())
+	if e.Pagination.PageSize > 0 {
+		params[e.Pagination.PageSizeParam] = strconv.Itoa(e.Pagination.PageSize)
+	}
+	return params
+}
+
+func (e Endpoint) currentPage() int {
+	if e.Page > 0 {
+		return e.Page
+	}
+	if e.Pagination.StartPage > 0 {
+		return e.Pagination.StartPage
+	}
+	return 1
+}
+
+// NextPageFor calcula la siguiente página según la configuración del endpoint
+func NextPageFor(endpoint Endpoint, resp *http.Response, data interface{}) (Endpoint, bool) {
+	if endpoint.Pagination == nil {
+		return Endpoint{}, false
+	}
+
+	switch endpoint.Pagination.Type {
+	case PaginationNextLink:
+		link := ""
+		if endpoint.Pagination.NextPath != "" {
+			link, _ = jsonpath.Lookup(data, endpoint.Pagination.NextPath).(string)
+		} else if resp != nil {
+			link = nextFromLinkHeader(resp.Header.Get("Link"))
+		}
+		if link == "" {
+			return Endpoint{}, false
+		}
+
+		// Resolver links relativos contra la URL de la página actual
+		if resp != nil && resp.Request != nil {
+			if ref, err := url.Parse(link); err == nil {
+				link = resp.Request.URL.ResolveReference(ref).String()
+			}
+		}
+		if resp != nil && resp.Request != nil && link == resp.Request.URL.String() {
+			return Endpoint{}, false // Evitar ciclos si el proveedor repite el link
+		}
+
+		next := endpoint
+		next.NextURL = link
+		return next, true
+
+	case PaginationPage:
+		items, _ := jsonpath.Lookup(data, endpoint.RecordsPath).([]interface{})
+		if len(items) == 0 || (endpoint.Pagination.PageSize > 0 && len(items) < endpoint.Pagination.PageSize) {
+			return Endpoint{}, false
+		}
+
+		next := endpoint
+		next.Page = endpoint.currentPage() + 1
+		return next, true
+	}
+
+	return Endpoint{}, false
+}
+
+// nextFromLinkHeader extrae el link rel="next" de un header Link (RFC 8288)
+func nextFromLinkHeader(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		segments := strings.Split(part, ";")
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range segments[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if param == `rel="next"` || param == "rel=next" {
+				return strings.Trim(target, "<>")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,19 @@
+package drivers
+
+// ScaleAQVersion versión de API enviada en el header Scale-Version
+const ScaleAQVersion = "2025-01-01"
+
+// ScaleAQDriver driver de ScaleAQ Cloud: requiere el header Scale-Version en cada request
+type ScaleAQDriver struct {
+	*HTTPDriver
+}
+
+// NewScaleAQDriver crea el driver de ScaleAQ
+func NewScaleAQDriver() *ScaleAQDriver {
+	return &ScaleAQDriver{
+		HTTPDriver: NewHTTPDriver("scaleaq", map[string]string{
+			"Scale-Version": ScaleAQVersion,
+			"Accept":        "application/json",
+		}),
+	}
+}
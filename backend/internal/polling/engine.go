@@ -9,6 +9,8 @@ import (
 	"omniapi/internal/broker"
 	"omniapi/internal/database"
 	"omniapi/internal/models"
+	"omniapi/internal/quota"
+	"omniapi/internal/recipes"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -30,8 +32,22 @@ type Engine struct {
 	// Callback global para resultados
 	onResult func(PollingResult)
 
+	// Callback para registros normalizados por recetas
+	onRecipeOutput func(recipes.Output)
+
 	// Broker manager para publicar resultados
 	brokerManager *broker.Manager
+
+	// Circuit breaker y rate limit por ExternalService, compartidos por sus workers
+	guards   map[string]*serviceGuard // Key: serviceID
+	guardsMu sync.Mutex
+
+	// Reparto de configuraciones entre réplicas del API mediante leases
+	nodeID         string
+	cluster        ClusterStore
+	leaseDeadlines map[string]time.Time   // Key: configID - vencimiento del lease propio (calculado antes de pedirlo)
+	leaseTimers    map[string]*time.Timer // Key: configID - detiene los workers al vencer el lease
+	serviceLookup  func(serviceID string) (*models.ExternalService, error)
 }
 
 var (
@@ -46,43 +62,53 @@ func GetEngine() *Engine {
 			workers:     make(map[string]*Worker),
 			configs:     make(map[string]*PollingConfig),
 			lastResults: make(map[string]*PollingResult),
+			guards:      make(map[string]*serviceGuard),
+			nodeID:      resolveNodeID(),
+			cluster:     NewMongoClusterStore(),
+
+			leaseDeadlines: make(map[string]time.Time),
+			leaseTimers:    make(map[string]*time.Timer),
 		}
+		engineInstance.serviceLookup = engineInstance.getExternalService
 	})
 	return engineInstance
 }
 
-// Start inicia el engine
+// Start inicia el engine. Con varias réplicas del API cada configuración activa la ejecuta
+// una sola réplica: la que tiene su lease en polling_leases.
 func (e *Engine) Start(ctx context.Context) error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 
 	if e.ctx != nil {
+		e.mu.Unlock()
 		return fmt.Errorf("engine already started")
 	}
 
 	e.ctx, e.cancel = context.WithCancel(ctx)
 	e.startedAt = time.Now()
 
-	fmt.Println("🔄 Polling Engine started")
+	fmt.Printf("🔄 Polling Engine started (node %s)\n", e.nodeID)
 
 	// Iniciar el broker manager
 	e.brokerManager = broker.NewManager()
 	if err := e.brokerManager.Start(ctx); err != nil {
 		fmt.Printf("⚠️  Warning: could not start broker manager: %v\n", err)
 	}
+	e.mu.Unlock()
 
-	// Cargar configuraciones activas desde MongoDB
+	// Cargar configuraciones activas desde MongoDB y tomar las que no tienen dueño
 	if err := e.loadActiveConfigs(); err != nil {
 		fmt.Printf("⚠️  Warning: could not load active polling configs: %v\n", err)
 	}
 
+	go e.clusterLoop(e.ctx)
+
 	return nil
 }
 
 // Stop detiene el engine y todos los workers
 func (e *Engine) Stop() {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 
 	if e.cancel != nil {
 		e.cancel()
@@ -98,8 +124,25 @@ func (e *Engine) Stop() {
 		worker.Stop()
 	}
 
+	// Liberar los leases (después de soltar e.mu) para que otra réplica tome las
+	// configuraciones sin esperar el TTL
+	started := e.ctx != nil
+	var released []string
+	for configID := range e.configs {
+		released = append(released, configID)
+		e.clearLeaseLocked(configID)
+	}
+
 	e.workers = make(map[string]*Worker)
 	e.configs = make(map[string]*PollingConfig)
+	e.mu.Unlock()
+
+	if started {
+		e.releaseLeases(released)
+		if err := e.cluster.RemoveNode(e.nodeID); err != nil {
+			fmt.Printf("⚠️  Cluster: could not remove node %s: %v\n", e.nodeID, err)
+		}
+	}
 
 	fmt.Println("🛑 Polling Engine stopped")
 }
@@ -109,6 +152,24 @@ func (e *Engine) OnResult(callback func(PollingResult)) {
 	e.onResult = callback
 }
 
+// OnRecipeOutput registra callback para los registros producidos por recetas
+func (e *Engine) OnRecipeOutput(callback func(recipes.Output)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onRecipeOutput = callback
+}
+
+// emitRecipeOutput entrega un output de receta al callback registrado
+func (e *Engine) emitRecipeOutput(out recipes.Output) {
+	e.mu.RLock()
+	callback := e.onRecipeOutput
+	e.mu.RUnlock()
+
+	if callback != nil {
+		callback(out)
+	}
+}
+
 // GetBrokerManager retorna el manager de brokers
 func (e *Engine) GetBrokerManager() *broker.Manager {
 	return e.brokerManager
@@ -152,12 +213,37 @@ func (e *Engine) StartPolling(req StartPollingRequest) (*PollingConfig, error) {
 		return nil, fmt.Errorf("at least one endpoint is required")
 	}
 
+	for _, endpoint := range req.Endpoints {
+		if endpoint.Pagination != nil {
+			if err := endpoint.Pagination.Validate(); err != nil {
+				return nil, fmt.Errorf("endpoint %s: %w", endpoint.EndpointID, err)
+			}
+		}
+		if endpoint.Incremental != nil {
+			if err := endpoint.Incremental.Validate(); err != nil {
+				return nil, fmt.Errorf("endpoint %s: %w", endpoint.EndpointID, err)
+			}
+		}
+	}
+
 	// Obtener el ExternalService para autenticación
-	service, err := e.getExternalService(req.ServiceID)
+	service, err := e.serviceLookup(req.ServiceID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting external service: %w", err)
 	}
 
+	// Una configuración nueva consume quota del tenant; actualizar una existente no
+	if req.TenantID != "" {
+		exists, err := e.configExists(req.Provider, req.SiteID)
+		if err != nil {
+			fmt.Printf("⚠️  Warning: could not check existing polling config: %v\n", err)
+		} else if !exists {
+			if err := quota.GetMeter().Admit(req.TenantID, quota.ResourcePollingConfigs); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Crear configuración
 	config := &PollingConfig{
 		ID:         primitive.NewObjectID(),
@@ -199,34 +285,27 @@ func (e *Engine) StartPolling(req StartPollingRequest) (*PollingConfig, error) {
 		return nil, fmt.Errorf("error saving config: %w", err)
 	}
 
-	// Crear y arrancar workers
+	// Si la config ya corría en esta réplica, reemplazar sus workers
 	configID := config.ID.Hex()
-	e.configs[configID] = config
+	e.dropConfigLocked(configID)
 
-	for _, endpoint := range config.Endpoints {
-		if !endpoint.Enabled {
-			continue
-		}
-
-		workerKey := fmt.Sprintf("%s:%s", configID, endpoint.InstanceID)
-		worker := NewWorker(config, endpoint, service)
-
-		// Asignar broker manager para publicación MQTT
-		worker.SetBrokerManager(e.brokerManager)
-
-		// Registrar callback
-		if e.onResult != nil {
-			worker.OnResult(e.onResult)
-		}
-
-		if err := worker.Start(e.ctx); err != nil {
-			fmt.Printf("⚠️  Error starting worker %s: %v\n", workerKey, err)
-			continue
-		}
-
-		e.workers[workerKey] = worker
-		fmt.Printf("✅ Worker started: %s (%s)\n", endpoint.Label, endpoint.InstanceID)
+	// Solo la réplica con el lease ejecuta los workers; si lo tiene otra, ella aplicará
+	// los cambios en su próxima renovación
+	deadline := time.Now().Add(leaseTTL)
+	acquired, err := e.cluster.Acquire(leaseFor(config, e.nodeID), leaseTTL)
+	if err != nil {
+		return nil, fmt.Errorf("error acquiring polling lease: %w", err)
 	}
+	if !acquired {
+		config.Owner = e.leaseOwner(configID)
+		fmt.Printf("🔀 Polling for %s/%s is owned by node %s\n", config.Provider, config.SiteID, config.Owner)
+		return config, nil
+	}
+	config.Owner = e.nodeID
+	e.setLeaseDeadlineLocked(configID, deadline)
+
+	// Crear y arrancar workers
+	e.startWorkersLocked(config, service)
 
 	fmt.Printf("🚀 Polling started for %s/%s with %d endpoints\n",
 		config.Provider, config.SiteID, len(config.Endpoints))
@@ -237,9 +316,9 @@ func (e *Engine) StartPolling(req StartPollingRequest) (*PollingConfig, error) {
 // StopPolling detiene polling según los criterios del request
 func (e *Engine) StopPolling(req StopPollingRequest) (int, error) {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 
 	stopped := 0
+	var released []string
 
 	for workerKey, worker := range e.workers {
 		shouldStop := false
@@ -270,21 +349,31 @@ func (e *Engine) StopPolling(req StopPollingRequest) (int, error) {
 		}
 	}
 
-	// Actualizar estado en MongoDB si se detuvo por configID
+	// Actualizar estado en MongoDB si se detuvo por configID. Si la ejecuta otra réplica,
+	// la detendrá al ver el nuevo estado.
 	if req.ConfigID != "" {
 		e.updateConfigStatus(req.ConfigID, "stopped")
-		delete(e.configs, req.ConfigID)
+		if _, owned := e.configs[req.ConfigID]; owned {
+			e.dropConfigLocked(req.ConfigID)
+			released = append(released, req.ConfigID)
+		}
 	}
 
 	// Eliminar config de MongoDB si se detuvo por site_id + provider
 	if req.SiteID != "" && req.Provider != "" && req.ConfigID == "" {
-		if err := e.deleteConfigBySiteAndProvider(req.SiteID, req.Provider); err != nil {
+		configID, err := e.deleteConfigBySiteAndProvider(req.SiteID, req.Provider)
+		if err != nil {
 			fmt.Printf("⚠️  Error deleting config for %s/%s: %v\n", req.Provider, req.SiteID, err)
 		} else {
 			fmt.Printf("🗑️  Config deleted for %s/%s\n", req.Provider, req.SiteID)
 		}
+		if configID != "" {
+			released = append(released, configID)
+		}
 	}
+	e.mu.Unlock()
 
+	e.releaseLeases(released)
 	return stopped, nil
 }
 
@@ -294,6 +383,7 @@ func (e *Engine) GetStatus() EngineStatus {
 	defer e.mu.RUnlock()
 
 	status := EngineStatus{
+		NodeID:        e.nodeID,
 		Status:        "stopped",
 		ActiveWorkers: len(e.workers),
 		TotalConfigs:  len(e.configs),
@@ -306,12 +396,36 @@ func (e *Engine) GetStatus() EngineStatus {
 	}
 
 	for key, worker := range e.workers {
-		status.Workers[key] = worker.GetStatus()
+		workerStatus := worker.GetStatus()
+		workerStatus.Node = e.nodeID
+		status.Workers[key] = workerStatus
 	}
 
+	e.guardsMu.Lock()
+	for serviceID, guard := range e.guards {
+		if status.CircuitBreakers == nil {
+			status.CircuitBreakers = make(map[string]string)
+		}
+		status.CircuitBreakers[serviceID] = string(guard.state())
+	}
+	e.guardsMu.Unlock()
+
 	return status
 }
 
+// guardFor retorna el estado compartido de un ExternalService (lo crea si no existe)
+func (e *Engine) guardFor(serviceID string) *serviceGuard {
+	e.guardsMu.Lock()
+	defer e.guardsMu.Unlock()
+
+	guard, ok := e.guards[serviceID]
+	if !ok {
+		guard = newServiceGuard()
+		e.guards[serviceID] = guard
+	}
+	return guard
+}
+
 // GetConfigStatus retorna el estado de una configuración específica
 func (e *Engine) GetConfigStatus(configID string) (*PollingConfig, []WorkerStatus, error) {
 	e.mu.RLock()
@@ -325,7 +439,9 @@ func (e *Engine) GetConfigStatus(configID string) (*PollingConfig, []WorkerStatu
 	var workerStatuses []WorkerStatus
 	for workerKey, worker := range e.workers {
 		if e.extractConfigID(workerKey) == configID {
-			workerStatuses = append(workerStatuses, worker.GetStatus())
+			workerStatus := worker.GetStatus()
+			workerStatus.Node = e.nodeID
+			workerStatuses = append(workerStatuses, workerStatus)
 		}
 	}
 
@@ -348,6 +464,89 @@ func (e *Engine) ListConfigs() []*PollingConfig {
 // Helpers
 // ═══════════════════════════════════════════════════════════
 
+// leaseOwner réplica que tiene el lease de una configuración ("" si no se conoce)
+func (e *Engine) leaseOwner(configID string) string {
+	leases, err := e.cluster.Leases()
+	if err != nil {
+		return ""
+	}
+	for _, lease := range leases {
+		if lease.ConfigID == configID {
+			return lease.Owner
+		}
+	}
+	return ""
+}
+
+// stopConfigWorkersLocked detiene los workers locales de una configuración
+func (e *Engine) stopConfigWorkersLocked(configID string) {
+	for workerKey, worker := range e.workers {
+		if e.extractConfigID(workerKey) == configID {
+			worker.Stop()
+			delete(e.workers, workerKey)
+			fmt.Printf("🛑 Worker stopped: %s\n", workerKey)
+		}
+	}
+}
+
+// startConfigLocked arranca los workers de una configuración cuyo lease ya se tiene
+func (e *Engine) startConfigLocked(config *PollingConfig) error {
+	service, err := e.serviceLookup(config.ServiceID)
+	if err != nil {
+		return fmt.Errorf("could not get external service: %w", err)
+	}
+	fmt.Printf("   ✓ External service found: %s (%s)\n", service.Name, service.ServiceType)
+
+	config.Owner = e.nodeID
+	workersStarted := e.startWorkersLocked(config, service)
+
+	// Actualizar status a active si se iniciaron workers
+	if workersStarted > 0 {
+		if config.Status != "active" {
+			e.updateConfigStatus(config.ID.Hex(), "active")
+		}
+		fmt.Printf("   ✅ Started %d workers for %s/%s\n", workersStarted, config.Provider, config.SiteCode)
+	} else {
+		fmt.Printf("   ⚠️  No workers started for %s/%s\n", config.Provider, config.SiteCode)
+	}
+	return nil
+}
+
+// startWorkersLocked registra la configuración y arranca un worker por endpoint habilitado
+func (e *Engine) startWorkersLocked(config *PollingConfig, service *models.ExternalService) int {
+	configID := config.ID.Hex()
+	e.configs[configID] = config
+
+	workersStarted := 0
+	for _, endpoint := range config.Endpoints {
+		if !endpoint.Enabled {
+			continue
+		}
+
+		workerKey := fmt.Sprintf("%s:%s", configID, endpoint.InstanceID)
+		worker := NewWorker(config, endpoint, service)
+
+		// Asignar broker manager para publicación MQTT
+		worker.SetBrokerManager(e.brokerManager)
+		worker.setServiceGuard(e.guardFor(config.ServiceID))
+
+		// Registrar callback
+		if e.onResult != nil {
+			worker.OnResult(e.onResult)
+		}
+
+		if err := worker.Start(e.ctx); err != nil {
+			fmt.Printf("⚠️  Error starting worker %s: %v\n", workerKey, err)
+			continue
+		}
+
+		e.workers[workerKey] = worker
+		workersStarted++
+		fmt.Printf("✅ Worker started: %s (%s)\n", endpoint.Label, endpoint.InstanceID)
+	}
+	return workersStarted
+}
+
 func (e *Engine) extractConfigID(workerKey string) string {
 	// workerKey format: configID:instanceID
 	parts := splitFirst(workerKey, ":")
@@ -393,6 +592,18 @@ func (e *Engine) getExternalService(serviceID string) (*models.ExternalService,
 	return &service, nil
 }
 
+// configExists indica si ya hay una configuración para provider + site_id (clave de upsert)
+func (e *Engine) configExists(provider, siteID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := database.GetCollection("polling_configs").CountDocuments(ctx, bson.M{
+		"provider": provider,
+		"site_id":  siteID,
+	})
+	return count > 0, err
+}
+
 func (e *Engine) saveConfig(config *PollingConfig) error {
 	collection := database.GetCollection("polling_configs")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -415,6 +626,7 @@ func (e *Engine) saveConfig(config *PollingConfig) error {
 			"interval_ms": config.IntervalMS,
 			"auto_start":  config.AutoStart,
 			"status":      config.Status,
+			"output":      config.Output,
 			"updated_at":  time.Now(),
 		},
 		"$setOnInsert": bson.M{
@@ -457,8 +669,9 @@ func (e *Engine) updateConfigStatus(configID string, status string) error {
 	return err
 }
 
-// deleteConfigBySiteAndProvider elimina la config de MongoDB por site_id y provider
-func (e *Engine) deleteConfigBySiteAndProvider(siteID, provider string) error {
+// deleteConfigBySiteAndProvider elimina la config de MongoDB por site_id y provider.
+// Retorna el ID de la config que corría en esta réplica (su lease queda por liberar).
+func (e *Engine) deleteConfigBySiteAndProvider(siteID, provider string) (string, error) {
 	collection := database.GetCollection("polling_configs")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -470,20 +683,20 @@ func (e *Engine) deleteConfigBySiteAndProvider(siteID, provider string) error {
 
 	result, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if result.DeletedCount > 0 {
 		// También eliminar de la caché interna
 		for configID, config := range e.configs {
 			if config.SiteID == siteID && config.Provider == provider {
-				delete(e.configs, configID)
-				break
+				e.dropConfigLocked(configID)
+				return configID, nil
 			}
 		}
 	}
 
-	return nil
+	return "", nil
 }
 
 // cleanupDuplicateConfigs elimina configs duplicadas manteniendo solo la más reciente
@@ -580,17 +793,38 @@ func (e *Engine) cleanupDuplicateConfigs() error {
 	return nil
 }
 
+// loadActiveConfigs restaura al arrancar las configuraciones activas cuyo lease está libre
 func (e *Engine) loadActiveConfigs() error {
 	// Limpiar duplicados antes de cargar
 	if err := e.cleanupDuplicateConfigs(); err != nil {
 		fmt.Printf("⚠️  Error cleaning duplicate configs: %v\n", err)
 	}
 
+	configs, err := e.fetchActiveConfigs()
+	if err != nil {
+		return err
+	}
+
+	if len(configs) == 0 {
+		fmt.Println("📋 No active polling configs found to restore")
+	} else {
+		fmt.Printf("📋 Found %d polling configs to restore\n", len(configs))
+	}
+
+	e.reconcile(configs)
+
+	e.mu.RLock()
+	fmt.Printf("\n✅ Polling Engine restored %d configs with %d total workers on node %s\n", len(e.configs), len(e.workers), e.nodeID)
+	e.mu.RUnlock()
+	return nil
+}
+
+// fetchActiveConfigs configuraciones activas O con auto_start habilitado
+func (e *Engine) fetchActiveConfigs() ([]PollingConfig, error) {
 	collection := database.GetCollection("polling_configs")
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Buscar configs activas O con auto_start habilitado
 	cursor, err := collection.Find(ctx, bson.M{
 		"$or": []bson.M{
 			{"status": "active"},
@@ -598,74 +832,13 @@ func (e *Engine) loadActiveConfigs() error {
 		},
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer cursor.Close(ctx)
 
 	var configs []PollingConfig
 	if err := cursor.All(ctx, &configs); err != nil {
-		return err
-	}
-
-	if len(configs) == 0 {
-		fmt.Println("📋 No active polling configs found to restore")
-		return nil
-	}
-
-	fmt.Printf("📋 Found %d polling configs to restore\n", len(configs))
-
-	for _, config := range configs {
-		fmt.Printf("\n🔄 Restoring config: %s/%s (%s)\n", config.Provider, config.SiteCode, config.SiteName)
-
-		// Obtener el servicio externo
-		service, err := e.getExternalService(config.ServiceID)
-		if err != nil {
-			fmt.Printf("   ❌ Could not get external service: %v\n", err)
-			continue
-		}
-		fmt.Printf("   ✓ External service found: %s (%s)\n", service.Name, service.ServiceType)
-
-		// Verificar autenticación antes de iniciar workers
-		fmt.Printf("   🔐 Validating authentication for %s...\n", config.Provider)
-
-		configID := config.ID.Hex()
-		configCopy := config
-		e.configs[configID] = &configCopy
-
-		workersStarted := 0
-		for _, endpoint := range config.Endpoints {
-			if !endpoint.Enabled {
-				continue
-			}
-
-			workerKey := fmt.Sprintf("%s:%s", configID, endpoint.InstanceID)
-			worker := NewWorker(&configCopy, endpoint, service)
-
-			// Asignar broker manager para publicación MQTT
-			worker.SetBrokerManager(e.brokerManager)
-
-			if e.onResult != nil {
-				worker.OnResult(e.onResult)
-			}
-
-			if err := worker.Start(e.ctx); err != nil {
-				fmt.Printf("   ⚠️  Error starting worker %s: %v\n", endpoint.Label, err)
-				continue
-			}
-
-			e.workers[workerKey] = worker
-			workersStarted++
-		}
-
-		// Actualizar status a active si se iniciaron workers
-		if workersStarted > 0 {
-			e.updateConfigStatus(configID, "active")
-			fmt.Printf("   ✅ Started %d workers for %s/%s\n", workersStarted, config.Provider, config.SiteCode)
-		} else {
-			fmt.Printf("   ⚠️  No workers started for %s/%s\n", config.Provider, config.SiteCode)
-		}
+		return nil, err
 	}
-
-	fmt.Printf("\n✅ Polling Engine restored %d configs with %d total workers\n", len(e.configs), len(e.workers))
-	return nil
+	return configs, nil
 }
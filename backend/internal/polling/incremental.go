@@ -0,0 +1,255 @@
+package polling
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"omniapi/internal/database"
+	"omniapi/internal/jsonpath"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tipos de cursor del modo incremental
+const (
+	CursorTypeTimestamp = "timestamp"
+	CursorTypeID        = "id"
+)
+
+// maxBoundaryKeys límite de claves guardadas para deduplicar registros con el mismo cursor
+const maxBoundaryKeys = 1000
+
+// Validate verifica la configuración incremental
+func (c *IncrementalConfig) Validate() error {
+	if c.CursorParam == "" {
+		return fmt.Errorf("incremental.cursor_param is required")
+	}
+	if c.CursorField == "" {
+		return fmt.Errorf("incremental.cursor_field is required")
+	}
+	switch c.CursorType {
+	case "", CursorTypeTimestamp, CursorTypeID:
+		return nil
+	default:
+		return fmt.Errorf("unsupported incremental.cursor_type: %s", c.CursorType)
+	}
+}
+
+// CursorState estado incremental persistido por instancia (colección polling_cursors)
+type CursorState struct {
+	InstanceID   string    `bson:"_id" json:"instance_id"`
+	ConfigID     string    `bson:"config_id" json:"config_id"`
+	Cursor       string    `bson:"cursor" json:"cursor"`
+	BoundaryKeys []string  `bson:"boundary_keys,omitempty" json:"boundary_keys,omitempty"` // Registros ya entregados con el cursor actual
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// CursorStore persistencia de los cursores incrementales
+type CursorStore interface {
+	// Load retorna el estado de la instancia (nil si nunca se consultó)
+	Load(instanceID string) (*CursorState, error)
+	Save(state *CursorState) error
+}
+
+// mongoCursorStore guarda los cursores en MongoDB
+type mongoCursorStore struct {
+	collection string
+}
+
+// NewMongoCursorStore crea el store de cursores sobre la colección polling_cursors
+func NewMongoCursorStore() CursorStore {
+	return &mongoCursorStore{collection: "polling_cursors"}
+}
+
+func (s *mongoCursorStore) Load(instanceID string) (*CursorState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var state CursorState
+	err := database.GetCollection(s.collection).FindOne(ctx, bson.M{"_id": instanceID}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *mongoCursorStore) Save(state *CursorState) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := database.GetCollection(s.collection).ReplaceOne(ctx,
+		bson.M{"_id": state.InstanceID}, state, options.Replace().SetUpsert(true))
+	return err
+}
+
+// recordSelection resultado de deduplicar los registros de una ejecución
+type recordSelection struct {
+	Fresh        []interface{}
+	Duplicates   int
+	Cursor       string
+	BoundaryKeys []string
+}
+
+// selectRecords descarta los registros repetidos entre páginas y, en modo incremental, los ya
+// entregados en ejecuciones anteriores (anteriores al cursor, o iguales al cursor y ya vistos).
+// Calcula el cursor resultante y las claves de los registros entregados con ese cursor.
+func selectRecords(records []interface{}, inc *IncrementalConfig, keyFields []string, state CursorState) recordSelection {
+	selection := recordSelection{Cursor: state.Cursor, BoundaryKeys: state.BoundaryKeys}
+
+	delivered := make(map[string]bool, len(state.BoundaryKeys))
+	for _, key := range state.BoundaryKeys {
+		delivered[key] = true
+	}
+	seen := make(map[string]bool, len(records))
+
+	maxCursor := ""
+	var maxKeys []string
+
+	for _, record := range records {
+		key := recordKey(record, keyFields)
+
+		value, hasCursor := "", false
+		if inc != nil {
+			value, hasCursor = cursorValue(record, inc.CursorField)
+			if hasCursor && state.Cursor != "" {
+				cmp := compareCursors(value, state.Cursor, inc.CursorType)
+				if cmp < 0 || (cmp == 0 && delivered[key]) {
+					selection.Duplicates++
+					continue
+				}
+			}
+		}
+
+		if seen[key] {
+			selection.Duplicates++
+			continue
+		}
+		seen[key] = true
+		selection.Fresh = append(selection.Fresh, record)
+
+		if hasCursor {
+			switch cmp := compareCursors(value, maxCursor, inc.CursorType); {
+			case maxCursor == "" || cmp > 0:
+				maxCursor, maxKeys = value, []string{key}
+			case cmp == 0:
+				maxKeys = append(maxKeys, key)
+			}
+		}
+	}
+
+	if maxCursor == "" {
+		return selection
+	}
+
+	if state.Cursor != "" && compareCursors(maxCursor, state.Cursor, inc.CursorType) == 0 {
+		maxKeys = append(append([]string{}, state.BoundaryKeys...), maxKeys...)
+	}
+	if len(maxKeys) > maxBoundaryKeys {
+		maxKeys = maxKeys[len(maxKeys)-maxBoundaryKeys:]
+	}
+	selection.Cursor = maxCursor
+	selection.BoundaryKeys = maxKeys
+	return selection
+}
+
+// recordKey identifica un registro: por los campos clave o por el hash del registro completo
+func recordKey(record interface{}, keyFields []string) string {
+	if len(keyFields) > 0 {
+		parts := make([]string, len(keyFields))
+		for i, field := range keyFields {
+			parts[i] = fmt.Sprint(jsonpath.Lookup(record, field))
+		}
+		return strings.Join(parts, "|")
+	}
+
+	// json.Marshal ordena las claves de los maps: el hash es estable
+	data, _ := json.Marshal(record)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// cursorValue obtiene el valor del cursor de un registro como string
+func cursorValue(record interface{}, field string) (string, bool) {
+	switch v := jsonpath.Lookup(record, field).(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// compareCursors compara dos cursores: timestamps como fechas, ids numéricos como números
+// y en otro caso como strings
+func compareCursors(a, b, cursorType string) int {
+	if cursorType != CursorTypeID {
+		ta, okA := parseCursorTime(a)
+		tb, okB := parseCursorTime(b)
+		if okA && okB {
+			return ta.Compare(tb)
+		}
+	}
+
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// parseCursorTime interpreta RFC3339, fechas sin zona (UTC) y epoch en segundos o milisegundos
+func parseCursorTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if n > 1_000_000_000_000 {
+			return time.UnixMilli(n), true
+		}
+		return time.Unix(n, 0), true
+	}
+	return time.Time{}, false
+}
+
+// replaceRecords reemplaza el arreglo de registros de la respuesta (en path) por los registros seleccionados
+func replaceRecords(data interface{}, path string, records []interface{}) interface{} {
+	if records == nil {
+		records = []interface{}{}
+	}
+	if path == "" {
+		return records
+	}
+
+	parentPath, field := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parentPath, field = path[:i], path[i+1:]
+	}
+	parent, ok := jsonpath.Lookup(data, parentPath).(map[string]interface{})
+	if !ok {
+		return records
+	}
+	parent[field] = records
+	return data
+}
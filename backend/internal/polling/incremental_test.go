@@ -0,0 +1,262 @@
+package polling
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"omniapi/internal/crypto"
+	"omniapi/internal/models"
+	"omniapi/internal/polling/drivers"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryCursorStore struct {
+	mu     sync.Mutex
+	states map[string]CursorState
+}
+
+func (s *memoryCursorStore) Load(instanceID string) (*CursorState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[instanceID]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (s *memoryCursorStore) Save(state *CursorState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.InstanceID] = *state
+	return nil
+}
+
+func TestSelectRecords(t *testing.T) {
+	inc := &IncrementalConfig{CursorParam: "since_id", CursorField: "id", CursorType: CursorTypeID}
+	records := []interface{}{
+		map[string]interface{}{"id": float64(9), "v": 1.0},
+		map[string]interface{}{"id": float64(10), "v": 2.0},
+		map[string]interface{}{"id": float64(10), "v": 2.0}, // Repetido entre páginas
+		map[string]interface{}{"id": float64(11), "v": 3.0},
+	}
+
+	selection := selectRecords(records, inc, nil, CursorState{Cursor: "10", BoundaryKeys: []string{recordKey(records[1], nil)}})
+	if len(selection.Fresh) != 1 || selection.Duplicates != 3 || selection.Cursor != "11" {
+		t.Fatalf("expected only id 11 as fresh, got %+v", selection)
+	}
+
+	// Sin registros nuevos el cursor y las claves se conservan
+	again := selectRecords(records[:2], inc, nil, CursorState{Cursor: selection.Cursor, BoundaryKeys: selection.BoundaryKeys})
+	if len(again.Fresh) != 0 || again.Cursor != "11" || len(again.BoundaryKeys) != 1 {
+		t.Errorf("expected cursor to be kept, got %+v", again)
+	}
+
+	if compareCursors("2026-01-01T10:00:00Z", "2026-01-01T07:00:00-03:00", CursorTypeTimestamp) != 0 {
+		t.Error("expected equal timestamps across time zones")
+	}
+	if compareCursors("9", "10", CursorTypeID) >= 0 {
+		t.Error("expected numeric comparison for ids")
+	}
+}
+
+func TestReplaceRecords(t *testing.T) {
+	data := map[string]interface{}{"data": map[string]interface{}{"items": []interface{}{1, 2, 3}, "total": 3}}
+	replaced := replaceRecords(data, "data.items", []interface{}{3}).(map[string]interface{})
+	inner := replaced["data"].(map[string]interface{})
+	if items := inner["items"].([]interface{}); len(items) != 1 || inner["total"] != 3 {
+		t.Errorf("expected only records replaced, got %v", replaced)
+	}
+
+	if root, ok := replaceRecords([]interface{}{1, 2}, "", nil).([]interface{}); !ok || len(root) != 0 {
+		t.Errorf("expected empty root array, got %v", root)
+	}
+}
+
+func TestWorker_IncrementalPagination(t *testing.T) {
+	if err := crypto.InitService("12345678901234567890123456789012"); err != nil {
+		t.Fatalf("failed to init crypto: %v", err)
+	}
+
+	var mu sync.Mutex
+	readings := []map[string]interface{}{
+		{"id": "r1", "ts": "2026-03-01T10:00:00Z"},
+		{"id": "r2", "ts": "2026-03-01T10:01:00Z"},
+		{"id": "r3", "ts": "2026-03-01T10:02:00Z"},
+		{"id": "r4", "ts": "2026-03-01T10:03:00Z"},
+		{"id": "r5", "ts": "2026-03-01T10:03:00Z"},
+	}
+	var froms []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer key-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// Filtro inclusivo (from <= ts) como hacen la mayoría de las APIs
+		from := r.URL.Query().Get("from")
+		if r.URL.Query().Get("page") == "1" {
+			froms = append(froms, from)
+		}
+		var matched []map[string]interface{}
+		for _, reading := range readings {
+			if from == "" || reading["ts"].(string) >= from {
+				matched = append(matched, reading)
+			}
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		start, end := (page-1)*limit, page*limit
+		if start > len(matched) {
+			start = len(matched)
+		}
+		if end > len(matched) {
+			end = len(matched)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sensor": "S1", "items": matched[start:end]})
+	}))
+	defer server.Close()
+
+	store := &memoryCursorStore{states: map[string]CursorState{}}
+	config := &PollingConfig{ID: primitive.NewObjectID(), Provider: "acme", SiteID: "site-1"}
+	instance := EndpointInstance{
+		InstanceID:  "acme-readings-1",
+		EndpointID:  "readings",
+		Label:       "Readings",
+		Method:      "GET",
+		Path:        "/sensors/{sensor}/readings",
+		Params:      map[string]string{"sensor": "S1"},
+		RecordsPath: "items",
+		Pagination:  &drivers.Pagination{Type: drivers.PaginationPage, PageParam: "page", PageSizeParam: "limit", PageSize: 2},
+		Incremental: &IncrementalConfig{CursorParam: "from", CursorField: "ts", KeyFields: []string{"id"}},
+	}
+	service := &models.ExternalService{
+		ID:          primitive.NewObjectID(),
+		ServiceType: "apikey",
+		BaseURL:     server.URL,
+		Credentials: &models.ServiceCredentials{APIKey: "key-1"},
+	}
+
+	var results []PollingResult
+	worker := NewWorker(config, instance, service)
+	worker.cursors = store
+	worker.ctx = context.Background()
+	worker.OnResult(func(result PollingResult) { results = append(results, result) })
+
+	// 1. Sin cursor: todo el historial en 3 páginas
+	worker.executePoll()
+	first := results[0]
+	if !first.Success || first.Pages != 3 || first.Records != 5 || first.Cursor != "2026-03-01T10:03:00Z" {
+		t.Fatalf("unexpected first poll: %+v", first)
+	}
+	if data := first.Data.(map[string]interface{}); data["sensor"] != "S1" || len(data["items"].([]interface{})) != 5 {
+		t.Errorf("expected envelope with all records, got %v", first.Data)
+	}
+
+	// 2. Con cursor: el proveedor repite r4 y r5 (mismo timestamp que el cursor)
+	worker.executePoll()
+	second := results[1]
+	if !second.Success || second.Records != 0 || second.Duplicates != 2 || second.Data != nil {
+		t.Fatalf("expected only duplicates on second poll, got %+v", second)
+	}
+
+	// 3. Llega un registro nuevo
+	mu.Lock()
+	readings = append(readings, map[string]interface{}{"id": "r6", "ts": "2026-03-01T10:05:00Z"})
+	mu.Unlock()
+
+	worker.executePoll()
+	third := results[2]
+	items := third.Data.(map[string]interface{})["items"].([]interface{})
+	if third.Records != 1 || items[0].(map[string]interface{})["id"] != "r6" {
+		t.Fatalf("expected only r6 on third poll, got %+v", third)
+	}
+
+	if froms[0] != "" || froms[1] != "2026-03-01T10:03:00Z" {
+		t.Errorf("expected cursor injected into params, got %v", froms)
+	}
+	if saved := store.states["acme-readings-1"]; saved.Cursor != "2026-03-01T10:05:00Z" || saved.ConfigID != config.ID.Hex() {
+		t.Errorf("expected persisted cursor, got %+v", saved)
+	}
+
+	// Un worker nuevo (reinicio) retoma desde el cursor persistido
+	restarted := NewWorker(config, instance, service)
+	restarted.cursors = store
+	restarted.ctx = context.Background()
+	restarted.OnResult(func(result PollingResult) { results = append(results, result) })
+	restarted.executePoll()
+	if last := results[3]; last.Records != 0 || last.Duplicates != 1 {
+		t.Errorf("expected restart to resume from persisted cursor, got %+v", last)
+	}
+}
+
+func TestWorker_ReportsTruncatedResultAtPageLimit(t *testing.T) {
+	if err := crypto.InitService("12345678901234567890123456789012"); err != nil {
+		t.Fatalf("failed to init crypto: %v", err)
+	}
+
+	// Siempre hay una página siguiente: el worker se detiene en maxPagesPerPoll
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": []map[string]interface{}{{"id": page + "-a"}, {"id": page + "-b"}},
+		})
+	}))
+	defer server.Close()
+
+	config := &PollingConfig{ID: primitive.NewObjectID(), Provider: "acme", SiteID: "site-1"}
+	instance := EndpointInstance{
+		InstanceID:  "acme-events-1",
+		EndpointID:  "events",
+		Label:       "Events",
+		Method:      "GET",
+		Path:        "/events",
+		RecordsPath: "items",
+		Pagination:  &drivers.Pagination{Type: drivers.PaginationPage, PageParam: "page", PageSizeParam: "limit", PageSize: 2},
+	}
+	service := &models.ExternalService{
+		ID:          primitive.NewObjectID(),
+		ServiceType: "apikey",
+		BaseURL:     server.URL,
+		Credentials: &models.ServiceCredentials{APIKey: "key-1"},
+	}
+
+	var results []PollingResult
+	worker := NewWorker(config, instance, service)
+	worker.cursors = &memoryCursorStore{states: map[string]CursorState{}}
+	worker.ctx = context.Background()
+	worker.OnResult(func(result PollingResult) { results = append(results, result) })
+
+	worker.executePoll()
+	result := results[0]
+	if !result.Success || result.Pages != maxPagesPerPoll || !result.Truncated {
+		t.Fatalf("expected truncated result after %d pages, got %+v", maxPagesPerPoll, result)
+	}
+	if body, _ := json.Marshal(result); !strings.Contains(string(body), `"truncated":true`) {
+		t.Errorf("expected truncated flag in JSON, got %s", body)
+	}
+
+	// En modo incremental el límite no trunca: se continúa desde el cursor
+	instance.Incremental = &IncrementalConfig{CursorParam: "from", CursorField: "id", KeyFields: []string{"id"}}
+	incremental := NewWorker(config, instance, service)
+	incremental.cursors = &memoryCursorStore{states: map[string]CursorState{}}
+	incremental.ctx = context.Background()
+	incremental.OnResult(func(result PollingResult) { results = append(results, result) })
+
+	incremental.executePoll()
+	if last := results[1]; last.Pages != maxPagesPerPoll || last.Truncated {
+		t.Fatalf("incremental poll must not be reported as truncated, got %+v", last)
+	}
+}
@@ -3,6 +3,8 @@ package polling
 import (
 	"time"
 
+	"omniapi/internal/polling/drivers"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -18,6 +20,21 @@ type EndpointInstance struct {
 	Params      map[string]string `bson:"params,omitempty" json:"params,omitempty"`           // Parámetros (monitor_id, sensor_id, etc.)
 	Enabled     bool              `bson:"enabled" json:"enabled"`                             // Si está activo para polling
 	IntervalMS  int64             `bson:"interval_ms,omitempty" json:"interval_ms,omitempty"` // Intervalo en ms (0 = usar global, min: 1000ms)
+
+	// Paginación e incremental (opcionales)
+	RecordsPath string              `bson:"records_path,omitempty" json:"records_path,omitempty"` // Ruta al arreglo de registros ("data.items"); vacío = raíz
+	Pagination  *drivers.Pagination `bson:"pagination,omitempty" json:"pagination,omitempty"`     // Seguir next link o número de página hasta agotar
+	Incremental *IncrementalConfig  `bson:"incremental,omitempty" json:"incremental,omitempty"`   // Consultar solo lo nuevo desde el último cursor
+}
+
+// IncrementalConfig modo incremental: el cursor (último timestamp o id) se persiste por instancia
+// y se inyecta en los params de la siguiente consulta
+type IncrementalConfig struct {
+	CursorParam   string   `bson:"cursor_param" json:"cursor_param"`                         // Param donde se inyecta el cursor ("from", "since_id")
+	CursorField   string   `bson:"cursor_field" json:"cursor_field"`                         // Campo del registro con el cursor ("timestamp", "id", "meta.ts")
+	CursorType    string   `bson:"cursor_type,omitempty" json:"cursor_type,omitempty"`       // timestamp (default) | id
+	InitialCursor string   `bson:"initial_cursor,omitempty" json:"initial_cursor,omitempty"` // Cursor de la primera consulta (vacío = sin filtro)
+	KeyFields     []string `bson:"key_fields,omitempty" json:"key_fields,omitempty"`         // Campos que identifican un registro para deduplicar (vacío = registro completo)
 }
 
 // PollingConfig configuración de polling para un site/provider
@@ -34,31 +51,39 @@ type PollingConfig struct {
 	IntervalMS int64              `bson:"interval_ms" json:"interval_ms"`           // Intervalo de polling en ms (default: 2000)
 	AutoStart  bool               `bson:"auto_start" json:"auto_start"`             // Si debe iniciar automáticamente al arrancar el servidor
 	Status     string             `bson:"status" json:"status"`                     // active, paused, stopped
-	Output     *OutputConfig      `bson:"output,omitempty" json:"output,omitempty"` // Configuración de salida MQTT
+	Output     *OutputConfig      `bson:"output,omitempty" json:"output,omitempty"` // Configuración de salida (broker MQTT, Kafka o AMQP)
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
 	CreatedBy  string             `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	Owner      string             `bson:"-" json:"owner,omitempty"` // Réplica (NodeID) que ejecuta los workers
 }
 
 // PollingResult resultado de una ejecución de polling
 type PollingResult struct {
-	InstanceID   string            `json:"instance_id"`
-	EndpointID   string            `json:"endpoint_id"`
-	Label        string            `json:"label"`
-	Provider     string            `json:"provider"`
-	SiteID       string            `json:"site_id"`
-	TenantID     string            `json:"tenant_id"`
-	Path         string            `json:"path"`
-	FullURL      string            `json:"full_url"`
-	Method       string            `json:"method"`
-	Params       map[string]string `json:"params,omitempty"`
-	StatusCode   int               `json:"status_code"`
-	Success      bool              `json:"success"`
-	Data         interface{}       `json:"data,omitempty"`
-	Error        string            `json:"error,omitempty"`
-	LatencyMS    int64             `json:"latency_ms"`
-	PolledAt     time.Time         `json:"polled_at"`
-	ResponseSize int               `json:"response_size"`
+	InstanceID   string             `json:"instance_id"`
+	EndpointID   string             `json:"endpoint_id"`
+	Label        string             `json:"label"`
+	Provider     string             `json:"provider"`
+	SiteID       string             `json:"site_id"`
+	TenantID     string             `json:"tenant_id"`
+	Path         string             `json:"path"`
+	FullURL      string             `json:"full_url"`
+	Method       string             `json:"method"`
+	Params       map[string]string  `json:"params,omitempty"`
+	StatusCode   int                `json:"status_code"`
+	Success      bool               `json:"success"`
+	Data         interface{}        `json:"data,omitempty"`
+	Error        string             `json:"error,omitempty"`
+	ErrorClass   string             `json:"error_class,omitempty"` // auth, rate_limited, unavailable, rejected (ver drivers.ErrorClass)
+	LatencyMS    int64              `json:"latency_ms"`
+	PolledAt     time.Time          `json:"polled_at"`
+	ResponseSize int                `json:"response_size"`
+	Pages        int                `json:"pages,omitempty"`      // Páginas consultadas en esta ejecución
+	Records      int                `json:"records,omitempty"`    // Registros nuevos (modo paginado/incremental)
+	Duplicates   int                `json:"duplicates,omitempty"` // Registros descartados por repetidos
+	Cursor       string             `json:"cursor,omitempty"`     // Cursor tras la ejecución (modo incremental)
+	Truncated    bool               `json:"truncated,omitempty"`  // Límite de páginas alcanzado sin cursor incremental: faltan páginas
+	RateLimit    *drivers.RateLimit `json:"rate_limit,omitempty"` // Rate limit informado por el proveedor
 }
 
 // WorkerStatus estado de un worker de polling
@@ -66,7 +91,7 @@ type WorkerStatus struct {
 	InstanceID      string    `json:"instance_id"`
 	EndpointID      string    `json:"endpoint_id"`
 	Label           string    `json:"label"`
-	Status          string    `json:"status"`      // running, paused, error, stopped
+	Status          string    `json:"status"`      // running, backoff, circuit_open, rate_limited, stopped
 	IntervalMS      int64     `json:"interval_ms"` // Intervalo efectivo de este worker
 	LastPollAt      time.Time `json:"last_poll_at,omitempty"`
 	LastSuccessAt   time.Time `json:"last_success_at,omitempty"`
@@ -77,15 +102,21 @@ type WorkerStatus struct {
 	TotalErrors     int64     `json:"total_errors"`
 	AvgLatencyMS    float64   `json:"avg_latency_ms"`
 	ConsecutiveErrs int       `json:"consecutive_errors"`
+	NextPollAt      time.Time `json:"next_poll_at,omitempty"`
+	BackoffMS       int64     `json:"backoff_ms,omitempty"`    // Espera actual por backoff ante errores
+	CircuitState    string    `json:"circuit_state,omitempty"` // Circuit breaker del servicio: closed, half_open, open
+	Node            string    `json:"node,omitempty"`          // Réplica que ejecuta el worker
 }
 
 // EngineStatus estado general del polling engine
 type EngineStatus struct {
-	Status        string                  `json:"status"` // running, stopped
-	ActiveWorkers int                     `json:"active_workers"`
-	TotalConfigs  int                     `json:"total_configs"`
-	Workers       map[string]WorkerStatus `json:"workers"` // Key: configID:instanceID
-	StartedAt     time.Time               `json:"started_at,omitempty"`
+	NodeID          string                  `json:"node_id"` // Réplica que responde
+	Status          string                  `json:"status"`  // running, stopped
+	ActiveWorkers   int                     `json:"active_workers"`
+	TotalConfigs    int                     `json:"total_configs"`
+	Workers         map[string]WorkerStatus `json:"workers"`                    // Key: configID:instanceID
+	CircuitBreakers map[string]string       `json:"circuit_breakers,omitempty"` // Key: serviceID, estado del circuit breaker
+	StartedAt       time.Time               `json:"started_at,omitempty"`
 }
 
 // StartPollingRequest request para iniciar polling
@@ -6,16 +6,23 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"omniapi/internal/adapters"
 	"omniapi/internal/broker"
+	"omniapi/internal/jsonpath"
 	"omniapi/internal/models"
+	"omniapi/internal/polling/drivers"
+	"omniapi/internal/queue/requester"
+	"omniapi/internal/recipes"
 	"omniapi/internal/services"
 )
 
+// minPollInterval intervalo mínimo entre ejecuciones de un worker
+const minPollInterval = 1 * time.Second
+
 // Worker ejecuta polling para una instancia de endpoint
 type Worker struct {
 	config   *PollingConfig
@@ -35,6 +42,17 @@ type Worker struct {
 	// Broker manager para publicar resultados
 	brokerManager *broker.Manager
 
+	// Driver del proveedor (construcción de requests, paginación, errores)
+	driver drivers.Driver
+
+	// Backoff ante errores y estado compartido con los workers del mismo servicio
+	backoff *requester.BackoffCalculator
+	guard   *serviceGuard
+
+	// Cursor del modo incremental (solo lo usa la goroutine del worker)
+	cursors CursorStore
+	cursor  *CursorState
+
 	// HTTP client reutilizable
 	httpClient *http.Client
 }
@@ -51,12 +69,21 @@ func NewWorker(config *PollingConfig, instance EndpointInstance, service *models
 			Label:      instance.Label,
 			Status:     "stopped",
 		},
+		driver:  drivers.Get(config.Provider),
+		backoff: requester.NewBackoffCalculator(pollingBackoffConfig()),
+		guard:   newServiceGuard(),
+		cursors: NewMongoCursorStore(),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
 }
 
+// setServiceGuard comparte el circuit breaker y el rate limit con los demás workers del servicio
+func (w *Worker) setServiceGuard(guard *serviceGuard) {
+	w.guard = guard
+}
+
 // OnResult registra callback para recibir resultados
 func (w *Worker) OnResult(callback func(PollingResult)) {
 	w.onResult = callback
@@ -111,30 +138,75 @@ func (w *Worker) GetStatus() WorkerStatus {
 func (w *Worker) pollLoop() {
 	interval := w.getEffectiveInterval()
 
-	// Primera ejecución inmediata
-	w.executePoll()
+	// Primera ejecución con un desfase aleatorio para no disparar todos los sitios a la vez
+	delay := startDelay(interval, randomFloat())
 
 	for {
 		// Crear timer DESPUÉS de que termine la ejecución anterior
 		// Esto garantiza que siempre hay al menos 'interval' entre el FIN de una
 		// request y el INICIO de la siguiente
-		timer := time.NewTimer(interval)
+		w.scheduleNext(delay)
+		timer := time.NewTimer(delay)
 
 		select {
 		case <-w.ctx.Done():
 			timer.Stop()
 			return
 		case <-timer.C:
-			w.executePoll()
 		}
+
+		// Circuit breaker o rate limit del servicio: esperar sin consultar
+		if until, reason, blocked := w.guard.blockedUntil(time.Now()); blocked {
+			w.setRunState(reason)
+			delay = withJitter(time.Until(until), randomFloat())
+			if delay < minPollInterval {
+				delay = minPollInterval
+			}
+			continue
+		}
+
+		w.executePoll()
+
+		w.statusMu.RLock()
+		consecutiveErrs := w.status.ConsecutiveErrs
+		w.statusMu.RUnlock()
+
+		if consecutiveErrs > 0 {
+			w.setRunState("backoff")
+		} else {
+			w.setRunState("running")
+		}
+		delay = withJitter(nextDelay(interval, consecutiveErrs, w.backoff), randomFloat())
+	}
+}
+
+// scheduleNext registra en el estado cuándo será la próxima ejecución
+func (w *Worker) scheduleNext(delay time.Duration) {
+	w.statusMu.Lock()
+	w.status.NextPollAt = time.Now().Add(delay)
+	w.status.BackoffMS = 0
+	if w.status.ConsecutiveErrs > 0 {
+		w.status.BackoffMS = delay.Milliseconds()
 	}
+	w.status.CircuitState = string(w.guard.state())
+	w.statusMu.Unlock()
+}
+
+// setRunState actualiza el estado del worker mientras sigue corriendo
+func (w *Worker) setRunState(state string) {
+	if !w.running.Load() {
+		return
+	}
+	w.statusMu.Lock()
+	w.status.Status = state
+	w.statusMu.Unlock()
 }
 
 // getEffectiveInterval calcula el intervalo efectivo para este endpoint
 // Prioridad: endpoint > config global > default (2s)
 // Mínimo permitido: 1 segundo
 func (w *Worker) getEffectiveInterval() time.Duration {
-	const minInterval = 1 * time.Second
+	const minInterval = minPollInterval
 	const defaultInterval = 2 * time.Second
 
 	var interval time.Duration
@@ -158,7 +230,10 @@ func (w *Worker) getEffectiveInterval() time.Duration {
 	return interval
 }
 
-// executePoll ejecuta una consulta al endpoint
+// maxPagesPerPoll límite de páginas seguidas en una misma ejecución
+const maxPagesPerPoll = 20
+
+// executePoll ejecuta una consulta al endpoint, siguiendo la paginación del driver
 func (w *Worker) executePoll() {
 	startTime := time.Now()
 
@@ -175,127 +250,271 @@ func (w *Worker) executePoll() {
 		PolledAt:   startTime,
 	}
 
-	// Obtener token
-	token, err := services.GetTokenManager().GetToken(w.service)
-	if err != nil {
-		result.Success = false
-		result.Error = fmt.Sprintf("error obteniendo token: %v", err)
-		result.LatencyMS = time.Since(startTime).Milliseconds()
-		w.handleResult(result)
-		return
+	endpoint := drivers.Endpoint{
+		BaseURL:     w.service.BaseURL,
+		Method:      w.instance.Method,
+		Path:        w.instance.Path,
+		Params:      w.instance.Params,
+		RecordsPath: w.instance.RecordsPath,
+		Pagination:  w.instance.Pagination,
+	}
+
+	// Modo incremental: inyectar el último cursor en los params
+	var cursor CursorState
+	if w.instance.Incremental != nil {
+		var err error
+		if cursor, err = w.loadCursor(); err != nil {
+			// Sin el cursor no se puede consultar sin duplicar: se reintenta en la siguiente ejecución
+			result.Success = false
+			result.ErrorClass = string(drivers.ErrorUnavailable)
+			result.Error = fmt.Sprintf("error cargando cursor: %v", err)
+			result.LatencyMS = time.Since(startTime).Milliseconds()
+			w.handleResult(result)
+			return
+		}
+		if cursor.Cursor != "" {
+			params := make(map[string]string, len(endpoint.Params)+1)
+			for key, value := range endpoint.Params {
+				params[key] = value
+			}
+			params[w.instance.Incremental.CursorParam] = cursor.Cursor
+			endpoint.Params = params
+			result.Params = params
+		}
 	}
 
-	// Construir URL
-	url := w.buildURL()
-	result.FullURL = url
+	var pages []interface{}
+	for {
+		page, class, err := w.fetchPage(endpoint)
+		if err != nil {
+			result.Success = false
+			result.ErrorClass = string(class)
+			result.Error = err.Error()
+			result.LatencyMS = time.Since(startTime).Milliseconds()
+			w.handleResult(result)
+			return
+		}
 
-	// Crear request
-	var req *http.Request
-	if w.instance.Method == "POST" {
-		// Para POST, los params van en el body
-		bodyJSON, _ := json.Marshal(w.instance.Params)
-		req, err = http.NewRequestWithContext(w.ctx, "POST", url, strings.NewReader(string(bodyJSON)))
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req, err = http.NewRequestWithContext(w.ctx, "GET", url, nil)
+		if result.FullURL == "" {
+			result.FullURL = page.url
+		}
+		result.StatusCode = page.statusCode
+		result.ResponseSize += len(page.body)
+		result.RateLimit = w.driver.RateLimit(page.resp)
+		result.Pages++
+
+		if class := w.driver.ClassifyError(page.statusCode, page.body); class != drivers.ErrorNone {
+			result.Success = false
+			result.ErrorClass = string(class)
+			result.Error = fmt.Sprintf("HTTP %d: %s", page.statusCode, string(page.body))
+			result.Data = page.data
+			result.LatencyMS = time.Since(startTime).Milliseconds()
+			w.handleResult(result)
+			return
+		}
+		pages = append(pages, w.driver.Unwrap(page.data))
+
+		next, ok := w.driver.NextPage(endpoint, page.resp, page.data)
+		if !ok {
+			break
+		}
+		if result.Pages >= maxPagesPerPoll {
+			// Solo el modo incremental retoma desde su cursor; sin él la siguiente ejecución
+			// vuelve a la primera página y las restantes no se leen
+			if w.instance.Incremental != nil {
+				fmt.Printf("⚠️  [%s] Límite de %d páginas alcanzado, se continúa desde el cursor en la siguiente ejecución\n", w.instance.Label, maxPagesPerPoll)
+			} else {
+				result.Truncated = true
+				fmt.Printf("⚠️  [%s] Límite de %d páginas alcanzado, resultado truncado (las páginas restantes no se leen)\n", w.instance.Label, maxPagesPerPoll)
+			}
+			break
+		}
+		endpoint = next
 	}
 
-	if err != nil {
-		result.Success = false
-		result.Error = fmt.Sprintf("error creando request: %v", err)
+	if !w.recordsMode() {
+		result.Success = true
+		result.Data = mergePages(pages)
 		result.LatencyMS = time.Since(startTime).Milliseconds()
 		w.handleResult(result)
 		return
 	}
 
-	// Headers según provider
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	if w.config.Provider == "scaleaq" {
-		req.Header.Set("Scale-Version", "2025-01-01")
-		req.Header.Set("Accept", "application/json")
+	// Modo paginado/incremental: unir los registros de todas las páginas y descartar repetidos
+	var records []interface{}
+	for _, page := range pages {
+		items, ok := jsonpath.Lookup(page, w.instance.RecordsPath).([]interface{})
+		if !ok && jsonpath.Lookup(page, w.instance.RecordsPath) != nil {
+			result.Success = false
+			result.ErrorClass = string(drivers.ErrorInvalidResponse)
+			result.Error = fmt.Sprintf("records_path '%s' no es un arreglo en la respuesta", w.instance.RecordsPath)
+			result.Data = page
+			result.LatencyMS = time.Since(startTime).Milliseconds()
+			w.handleResult(result)
+			return
+		}
+		records = append(records, items...)
 	}
 
-	// Ejecutar request
-	resp, err := w.httpClient.Do(req)
-	if err != nil {
-		result.Success = false
-		result.Error = fmt.Sprintf("error en request: %v", err)
-		result.LatencyMS = time.Since(startTime).Milliseconds()
-		w.handleResult(result)
-		return
+	selection := selectRecords(records, w.instance.Incremental, w.keyFields(), cursor)
+	result.Success = true
+	result.Records = len(selection.Fresh)
+	result.Duplicates = selection.Duplicates
+	result.Data = replaceRecords(pages[0], w.instance.RecordsPath, selection.Fresh)
+
+	if w.instance.Incremental != nil {
+		result.Cursor = selection.Cursor
+		if len(selection.Fresh) == 0 {
+			result.Data = nil // Sin registros nuevos: nada que publicar
+		} else {
+			w.saveCursor(selection)
+		}
 	}
-	defer resp.Body.Close()
 
-	// Leer respuesta
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		result.Success = false
-		result.Error = fmt.Sprintf("error leyendo respuesta: %v", err)
-		result.LatencyMS = time.Since(startTime).Milliseconds()
-		w.handleResult(result)
-		return
+	result.LatencyMS = time.Since(startTime).Milliseconds()
+	w.handleResult(result)
+}
+
+// recordsMode indica si la instancia trabaja con registros (paginación, incremental o records_path)
+func (w *Worker) recordsMode() bool {
+	return w.instance.RecordsPath != "" || w.instance.Pagination != nil || w.instance.Incremental != nil
+}
+
+func (w *Worker) keyFields() []string {
+	if w.instance.Incremental != nil {
+		return w.instance.Incremental.KeyFields
 	}
+	return nil
+}
 
-	result.StatusCode = resp.StatusCode
-	result.LatencyMS = time.Since(startTime).Milliseconds()
-	result.ResponseSize = len(body)
+// loadCursor retorna el cursor de la instancia (cargado de MongoDB en la primera ejecución)
+func (w *Worker) loadCursor() (CursorState, error) {
+	if w.cursor == nil {
+		state, err := w.cursors.Load(w.instance.InstanceID)
+		if err != nil {
+			return CursorState{}, err
+		}
+		if state == nil {
+			state = &CursorState{
+				InstanceID: w.instance.InstanceID,
+				ConfigID:   w.config.ID.Hex(),
+				Cursor:     w.instance.Incremental.InitialCursor,
+			}
+		}
+		w.cursor = state
+	}
+	return *w.cursor, nil
+}
 
-	// Parsear JSON
-	var data interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		// Si no es JSON válido, guardar como string
-		data = string(body)
+// saveCursor avanza el cursor en memoria y lo persiste
+func (w *Worker) saveCursor(selection recordSelection) {
+	if w.cursor == nil {
+		return
 	}
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		result.Success = true
-		result.Data = data
-	} else {
-		result.Success = false
-		result.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(body))
-		result.Data = data
+	w.cursor.Cursor = selection.Cursor
+	w.cursor.BoundaryKeys = selection.BoundaryKeys
+	w.cursor.UpdatedAt = time.Now()
+	if err := w.cursors.Save(w.cursor); err != nil {
+		fmt.Printf("⚠️  [%s] Error guardando cursor %s: %v\n", w.instance.Label, selection.Cursor, err)
 	}
+}
 
-	w.handleResult(result)
+// polledPage respuesta de una página
+type polledPage struct {
+	url        string
+	statusCode int
+	body       []byte
+	data       interface{}
+	resp       *http.Response // Body ya consumido; solo para headers
 }
 
-// buildURL construye la URL final reemplazando placeholders con params
-func (w *Worker) buildURL() string {
-	baseURL := strings.TrimSuffix(w.service.BaseURL, "/")
-	path := w.instance.Path
-
-	// Reemplazar placeholders en el path: {monitor_id} -> valor real
-	for key, value := range w.instance.Params {
-		placeholder := fmt.Sprintf("{%s}", key)
-		path = strings.ReplaceAll(path, placeholder, value)
-	}
-
-	// Si es GET y hay params que no están en el path, agregarlos como query string
-	if w.instance.Method == "GET" {
-		queryParams := []string{}
-		for key, value := range w.instance.Params {
-			// Solo agregar si no estaba como placeholder
-			if !strings.Contains(w.instance.Path, fmt.Sprintf("{%s}", key)) {
-				// Verificar si ya está en la query string del path
-				if !strings.Contains(path, key+"=") {
-					queryParams = append(queryParams, fmt.Sprintf("%s=%s", key, value))
-				}
-			}
+// fetchPage ejecuta la request de una página. Ante un error de autenticación descarta el
+// token rechazado y reintenta una vez con uno renovado.
+func (w *Worker) fetchPage(endpoint drivers.Endpoint) (*polledPage, drivers.ErrorClass, error) {
+	tokenManager := services.GetTokenManager()
+	for attempt := 0; ; attempt++ {
+		// Obtener token
+		token, err := tokenManager.GetToken(w.service)
+		if err != nil {
+			return nil, drivers.ErrorAuth, fmt.Errorf("error obteniendo token: %v", err)
 		}
-		if len(queryParams) > 0 {
-			separator := "?"
-			if strings.Contains(path, "?") {
-				separator = "&"
-			}
-			path = path + separator + strings.Join(queryParams, "&")
+
+		req, err := w.newRequest(endpoint, token)
+		if err != nil {
+			return nil, drivers.ErrorRejected, fmt.Errorf("error creando request: %v", err)
+		}
+
+		// Ejecutar request
+		resp, err := w.httpClient.Do(req)
+		if err != nil {
+			return nil, drivers.ErrorUnavailable, fmt.Errorf("error en request: %v", err)
+		}
+
+		// Leer respuesta
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, drivers.ErrorUnavailable, fmt.Errorf("error leyendo respuesta: %v", err)
+		}
+
+		if w.driver.ClassifyError(resp.StatusCode, body) == drivers.ErrorAuth && attempt == 0 {
+			fmt.Printf("🔑 [%s] HTTP %d, renovando token y reintentando\n", w.instance.Label, resp.StatusCode)
+			tokenManager.RejectToken(w.service.ID, token)
+			continue
+		}
+
+		// Parsear JSON
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			// Si no es JSON válido, guardar como string
+			data = string(body)
 		}
+
+		return &polledPage{
+			url:        req.URL.String(),
+			statusCode: resp.StatusCode,
+			body:       body,
+			data:       data,
+			resp:       resp,
+		}, drivers.ErrorNone, nil
 	}
+}
 
-	return baseURL + path
+// newRequest crea la request del driver y le aplica la autenticación del servicio
+func (w *Worker) newRequest(endpoint drivers.Endpoint, token string) (*http.Request, error) {
+	req, err := w.driver.BuildRequest(w.ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if err := adapters.AuthorizeRequest(req, w.service, token); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// mergePages une los datos de varias páginas: concatena si cada página es un arreglo
+func mergePages(pages []interface{}) interface{} {
+	if len(pages) == 1 {
+		return pages[0]
+	}
+
+	merged := []interface{}{}
+	for _, page := range pages {
+		items, ok := page.([]interface{})
+		if !ok {
+			return pages
+		}
+		merged = append(merged, items...)
+	}
+	return merged
 }
 
 // handleResult procesa el resultado del polling
 func (w *Worker) handleResult(result PollingResult) {
+	// Circuit breaker y rate limit compartidos por el servicio
+	w.guard.record(result, time.Now())
+
 	// Actualizar estadísticas
 	w.statusMu.Lock()
 	w.status.TotalPolls++
@@ -329,6 +548,9 @@ func (w *Worker) handleResult(result PollingResult) {
 	// Publicar al broker si está configurado y habilitado
 	w.publishToBroker(result)
 
+	// Aplicar recetas de transformación y emitir registros normalizados
+	w.applyRecipes(result)
+
 	// Callback si está registrado
 	if w.onResult != nil {
 		w.onResult(result)
@@ -378,6 +600,7 @@ func (w *Worker) publishToBroker(result PollingResult) {
 		"polled_at":     result.PolledAt,
 		"latency_ms":    result.LatencyMS,
 		"response_size": result.ResponseSize,
+		"truncated":     result.Truncated,
 		"data":          result.Data,
 	})
 	if err != nil {
@@ -391,6 +614,57 @@ func (w *Worker) publishToBroker(result PollingResult) {
 		w.config.Output.BrokerID, topic, len(payload))
 }
 
+// applyRecipes ejecuta las recetas asociadas a la instancia y emite los registros
+// normalizados al broker (topic "<topic>/normalized") y al callback del engine
+func (w *Worker) applyRecipes(result PollingResult) {
+	if !result.Success || result.Data == nil {
+		return
+	}
+
+	outputs := recipes.GetRunner().Execute(result.InstanceID, result.EndpointID, result.TenantID, result.SiteID, result.Data)
+	for _, out := range outputs {
+		if out.Provider == "" {
+			out.Provider = result.Provider
+		}
+		out.Partial = result.Truncated
+
+		w.publishRecipeOutput(out)
+		GetEngine().emitRecipeOutput(out)
+	}
+}
+
+// publishRecipeOutput publica los registros de una receta al broker configurado
+func (w *Worker) publishRecipeOutput(out recipes.Output) {
+	if w.config.Output == nil || !w.config.Output.Enabled || w.brokerManager == nil {
+		return
+	}
+
+	vars := map[string]string{
+		"provider":     out.Provider,
+		"site":         w.config.SiteCode,
+		"site_id":      out.SiteID,
+		"tenant":       w.config.TenantCode,
+		"tenant_id":    out.TenantID,
+		"data_type":    w.instance.TargetBlock,
+		"target_block": w.instance.TargetBlock,
+		"endpoint":     w.instance.EndpointID,
+		"instance":     out.InstanceID,
+		"instance_id":  out.InstanceID,
+	}
+
+	topicPattern := broker.GetTopicPattern(w.config.Output.TopicTemplate)
+	topic := broker.BuildTopic(topicPattern, vars) + "/normalized"
+
+	payload, err := json.Marshal(out)
+	if err != nil {
+		fmt.Printf("⚠️  Error serializando registros de receta '%s': %v\n", out.RecipeName, err)
+		return
+	}
+
+	w.brokerManager.PublishAsync(w.config.Output.BrokerID, topic, payload)
+	fmt.Printf("📤 Receta '%s': %d registros publicados en %s\n", out.RecipeName, len(out.Records), topic)
+}
+
 // logResult imprime el resultado en consola con formato legible
 func (w *Worker) logResult(result PollingResult) {
 	statusIcon := "✅"
@@ -418,6 +692,15 @@ func (w *Worker) logResult(result PollingResult) {
 	fmt.Printf("│ Status:      %d\n", result.StatusCode)
 	fmt.Printf("│ Latency:     %d ms\n", result.LatencyMS)
 	fmt.Printf("│ Size:        %d bytes\n", result.ResponseSize)
+	if w.recordsMode() {
+		fmt.Printf("│ Records:     %d nuevos, %d repetidos (%d páginas)\n", result.Records, result.Duplicates, result.Pages)
+	}
+	if result.Truncated {
+		fmt.Printf("│ Truncated:   límite de %d páginas alcanzado\n", maxPagesPerPoll)
+	}
+	if result.Cursor != "" {
+		fmt.Printf("│ Cursor:      %s\n", result.Cursor)
+	}
 	fmt.Printf("│ Time:        %s\n", result.PolledAt.Format("15:04:05.000"))
 
 	if result.Success {
@@ -1,6 +1,13 @@
 package requester
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
 
 var (
 	// ErrQueueFull indica que la cola está llena
@@ -24,3 +31,96 @@ var (
 	// ErrCircuitOpen indica que el circuit breaker está abierto
 	ErrCircuitOpen = errors.New("circuit breaker is open")
 )
+
+var (
+	// ErrUnauthorized indica que el proveedor rechazó las credenciales (401/403)
+	ErrUnauthorized = errors.New("upstream unauthorized")
+
+	// ErrRateLimited indica que el proveedor limitó la tasa de solicitudes (429)
+	ErrRateLimited = errors.New("upstream rate limited")
+
+	// ErrUpstreamUnavailable indica que el proveedor falló o no respondió (5xx, red)
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+
+	// ErrUpstreamRejected indica que el proveedor rechazó la solicitud (4xx restantes)
+	ErrUpstreamRejected = errors.New("upstream rejected request")
+
+	// ErrInvalidResponse indica que la respuesta del proveedor no se pudo interpretar
+	ErrInvalidResponse = errors.New("invalid upstream response")
+
+	// ErrPartial indica que la estrategia retornó datos incompletos junto con el payload.
+	// El requester lo trata como éxito y marca el resultado como parcial.
+	ErrPartial = errors.New("partial response")
+)
+
+// maxErrorBody longitud máxima del body guardado en un HTTPError
+const maxErrorBody = 512
+
+// HTTPError error HTTP de un proveedor externo.
+// Unwrap lo clasifica en uno de los errores tipados de arriba.
+type HTTPError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // Solo para 429/503 si el proveedor lo indica
+}
+
+// NewHTTPError construye un HTTPError desde una respuesta no exitosa
+func NewHTTPError(provider string, resp *http.Response, body []byte) *HTTPError {
+	e := &HTTPError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+	}
+	if len(e.Body) > maxErrorBody {
+		e.Body = e.Body[:maxErrorBody]
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s: HTTP %d", e.Provider, e.StatusCode)
+	}
+	return fmt.Sprintf("%s: HTTP %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Unwrap permite usar errors.Is con los errores tipados
+func (e *HTTPError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrUpstreamUnavailable
+	default:
+		return ErrUpstreamRejected
+	}
+}
+
+// transportError clasifica un error de red o de contexto de una llamada HTTP
+func transportError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	default:
+		return fmt.Errorf("%w: %v", ErrUpstreamUnavailable, err)
+	}
+}
+
+// CountsAsFailure indica si un error debe contar para abrir el circuit breaker.
+// Las solicitudes inválidas o rechazadas por el proveedor (4xx) no indican un problema del upstream.
+func CountsAsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	return !errors.Is(err, ErrUpstreamRejected) &&
+		!errors.Is(err, ErrInvalidRequest) &&
+		!errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,228 @@
+package requester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// processAPIDataPath endpoint de consulta de series de la ProcessAPI
+	processAPIDataPath = "/api/v1/data"
+
+	// processAPIHealthPath endpoint de salud de la ProcessAPI
+	processAPIHealthPath = "/health"
+
+	// DefaultProcessAPIPageSize tamaño de página solicitado por defecto
+	DefaultProcessAPIPageSize = 500
+
+	// DefaultProcessAPIMaxPages máximo de páginas leídas por solicitud
+	DefaultProcessAPIMaxPages = 50
+)
+
+// ProcessAPIStrategy consulta la ProcessAPI on-premise de un site.
+// Se usa como fallback local cuando el enlace a la nube es pobre.
+type ProcessAPIStrategy struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+	pageSize int
+	maxPages int
+}
+
+// NewProcessAPIStrategy crea una estrategia para ProcessAPI
+func NewProcessAPIStrategy(endpoint string) *ProcessAPIStrategy {
+	return &ProcessAPIStrategy{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+		pageSize: DefaultProcessAPIPageSize,
+		maxPages: DefaultProcessAPIMaxPages,
+	}
+}
+
+// SetAPIKey configura la key enviada en el header X-API-Key (opcional)
+func (pas *ProcessAPIStrategy) SetAPIKey(apiKey string) {
+	pas.apiKey = apiKey
+}
+
+// SetPagination configura el tamaño de página y el máximo de páginas por solicitud
+func (pas *ProcessAPIStrategy) SetPagination(pageSize, maxPages int) {
+	if pageSize > 0 {
+		pas.pageSize = pageSize
+	}
+	if maxPages > 0 {
+		pas.maxPages = maxPages
+	}
+}
+
+// SetHTTPClient reemplaza el cliente HTTP (útil para testing)
+func (pas *ProcessAPIStrategy) SetHTTPClient(client *http.Client) {
+	pas.client = client
+}
+
+// processAPIPage una página de respuesta de /api/v1/data
+type processAPIPage struct {
+	Items []struct {
+		Timestamp time.Time `json:"timestamp"`
+		CageID    string    `json:"cage_id"`
+		Value     *float64  `json:"value"`
+		Unit      string    `json:"unit"`
+	} `json:"items"`
+	Page       int      `json:"page"`
+	TotalPages int      `json:"total_pages"`
+	Partial    bool     `json:"partial"` // La ProcessAPI no pudo leer todas las fuentes
+	Missing    []string `json:"missing"` // Jaulas o sensores sin datos
+}
+
+// Execute consulta la métrica página por página y normaliza al payload canónico.
+// Si faltan páginas o la ProcessAPI reporta datos incompletos retorna el payload con ErrPartial.
+func (pas *ProcessAPIStrategy) Execute(ctx context.Context, req Request) (json.RawMessage, error) {
+	kind, field := splitMetric(req.Metric)
+	if kind == "" {
+		return nil, fmt.Errorf("%w: metric is required", ErrInvalidRequest)
+	}
+	if field == "" {
+		field = "value"
+	}
+
+	payload := TimeSeriesPayload{
+		Kind:      kind,
+		Metric:    req.Metric,
+		SiteID:    req.SiteID,
+		CageID:    req.CageID,
+		Source:    pas.Name(),
+		TimeRange: req.TimeRange,
+		Units:     make(map[string]string),
+	}
+
+	records := newRecordBuilder()
+	var warnings []string
+
+	for page := 1; ; page++ {
+		if page > pas.maxPages {
+			warnings = append(warnings, fmt.Sprintf("se alcanzó el máximo de %d páginas", pas.maxPages))
+			break
+		}
+
+		result, partial, err := pas.fetchPage(ctx, req, page)
+		if err != nil {
+			// Sin ninguna página no hay nada que entregar
+			if page == 1 {
+				return nil, err
+			}
+			warnings = append(warnings, fmt.Sprintf("página %d: %v", page, err))
+			break
+		}
+
+		for _, item := range result.Items {
+			if item.Value == nil {
+				continue
+			}
+			records.Add(item.Timestamp, item.CageID, field, *item.Value)
+			if item.Unit != "" {
+				payload.Units[field] = item.Unit
+			}
+		}
+
+		if partial || result.Partial {
+			reason := fmt.Sprintf("página %d incompleta", page)
+			if len(result.Missing) > 0 {
+				reason += " (sin datos: " + strings.Join(result.Missing, ", ") + ")"
+			}
+			warnings = append(warnings, reason)
+		}
+
+		if result.TotalPages <= page || len(result.Items) == 0 {
+			break
+		}
+	}
+
+	payload.Records = records.Records()
+	payload.Count = len(payload.Records)
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	if len(warnings) > 0 {
+		return out, fmt.Errorf("%w: %s", ErrPartial, strings.Join(warnings, "; "))
+	}
+	return out, nil
+}
+
+// fetchPage obtiene una página. partial es true si la ProcessAPI respondió 206.
+func (pas *ProcessAPIStrategy) fetchPage(ctx context.Context, req Request, page int) (*processAPIPage, bool, error) {
+	params := url.Values{}
+	params.Set("metric", req.Metric)
+	params.Set("site_id", req.SiteID)
+	if req.CageID != nil && *req.CageID != "" {
+		params.Set("cage_id", *req.CageID)
+	}
+	params.Set("from", req.TimeRange.From.UTC().Format(time.RFC3339))
+	params.Set("to", req.TimeRange.To.UTC().Format(time.RFC3339))
+	params.Set("page", strconv.Itoa(page))
+	params.Set("page_size", strconv.Itoa(pas.pageSize))
+
+	resp, body, err := pas.get(ctx, processAPIDataPath+"?"+params.Encode())
+	if err != nil {
+		return nil, false, err
+	}
+
+	var result processAPIPage
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	return &result, resp.StatusCode == http.StatusPartialContent, nil
+}
+
+// Name retorna el nombre
+func (pas *ProcessAPIStrategy) Name() string {
+	return "processapi"
+}
+
+// HealthCheck verifica conectividad con ProcessAPI
+func (pas *ProcessAPIStrategy) HealthCheck(ctx context.Context) error {
+	_, _, err := pas.get(ctx, processAPIHealthPath)
+	return err
+}
+
+// get ejecuta un GET y clasifica los errores HTTP
+func (pas *ProcessAPIStrategy) get(ctx context.Context, path string) (*http.Response, []byte, error) {
+	if pas.endpoint == "" {
+		return nil, nil, fmt.Errorf("%w: endpoint no configurado", ErrInvalidRequest)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, pas.endpoint+path, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if pas.apiKey != "" {
+		httpReq.Header.Set("X-API-Key", pas.apiKey)
+	}
+
+	resp, err := pas.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, transportError(err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, NewHTTPError(pas.Name(), resp, body)
+	}
+
+	return resp, body, nil
+}
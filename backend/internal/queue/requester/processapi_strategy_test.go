@@ -0,0 +1,161 @@
+package requester
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// processAPIStandIn simula una ProcessAPI con 3 páginas de un registro cada una
+func processAPIStandIn(t *testing.T, failPage int, partialPage int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.Write([]byte(`{"status":"ok"}`))
+			return
+		}
+		if r.URL.Path != "/api/v1/data" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("X-API-Key") != "local-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+		if q.Get("metric") != "climate.temperature" || q.Get("site_id") != "site-1" || q.Get("page_size") != "1" {
+			t.Errorf("Unexpected query: %v", q)
+		}
+
+		var page int
+		fmt.Sscanf(q.Get("page"), "%d", &page)
+		if page == failPage {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if page == partialPage {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+
+		fmt.Fprintf(w, `{"items": [{"timestamp": "2024-05-01T10:0%d:00Z", "cage_id": "cage-1", "value": %d.5, "unit": "C"}],
+			"page": %d, "total_pages": 3, "missing": ["cage-9"]}`, page, 10+page, page)
+	}))
+}
+
+func processAPIRequest() Request {
+	from := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return Request{
+		TenantID:  "tenant-1",
+		SiteID:    "site-1",
+		Metric:    "climate.temperature",
+		TimeRange: TimeRange{From: from, To: from.Add(time.Hour)},
+		Source:    SourceProcessAPI,
+	}
+}
+
+func newTestProcessAPI(url string) *ProcessAPIStrategy {
+	strategy := NewProcessAPIStrategy(url)
+	strategy.SetAPIKey("local-key")
+	strategy.SetPagination(1, 10)
+	return strategy
+}
+
+func TestProcessAPIStrategy_Pagination(t *testing.T) {
+	server := processAPIStandIn(t, 0, 0)
+	defer server.Close()
+
+	strategy := newTestProcessAPI(server.URL)
+	if err := strategy.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("HealthCheck failed: %v", err)
+	}
+
+	raw, err := strategy.Execute(context.Background(), processAPIRequest())
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	var payload TimeSeriesPayload
+	json.Unmarshal(raw, &payload)
+	if payload.Count != 3 || payload.Kind != "climate" || payload.Source != "processapi" {
+		t.Fatalf("Expected 3 records from 3 pages, got %+v", payload)
+	}
+	if payload.Records[2]["temperature"] != 13.5 || payload.Units["temperature"] != "C" {
+		t.Errorf("Unexpected records: %v (units %v)", payload.Records, payload.Units)
+	}
+}
+
+func TestProcessAPIStrategy_PartialResponses(t *testing.T) {
+	// Página 2 con 206: se leen todas las páginas pero el resultado es parcial
+	server := processAPIStandIn(t, 0, 2)
+	raw, err := newTestProcessAPI(server.URL).Execute(context.Background(), processAPIRequest())
+	server.Close()
+
+	if !errors.Is(err, ErrPartial) || raw == nil {
+		t.Fatalf("Expected payload with ErrPartial, got %v", err)
+	}
+	var payload TimeSeriesPayload
+	json.Unmarshal(raw, &payload)
+	if payload.Count != 3 {
+		t.Errorf("Expected all 3 records, got %d", payload.Count)
+	}
+
+	// Falla la página 3: se conservan las 2 primeras
+	server = processAPIStandIn(t, 3, 0)
+	raw, err = newTestProcessAPI(server.URL).Execute(context.Background(), processAPIRequest())
+	server.Close()
+
+	if !errors.Is(err, ErrPartial) {
+		t.Fatalf("Expected ErrPartial when a later page fails, got %v", err)
+	}
+	json.Unmarshal(raw, &payload)
+	if payload.Count != 2 {
+		t.Errorf("Expected 2 records before the failed page, got %d", payload.Count)
+	}
+
+	// Falla la primera página: error tipado sin payload
+	server = processAPIStandIn(t, 1, 0)
+	raw, err = newTestProcessAPI(server.URL).Execute(context.Background(), processAPIRequest())
+	server.Close()
+
+	if !errors.Is(err, ErrUpstreamUnavailable) || raw != nil {
+		t.Errorf("Expected ErrUpstreamUnavailable without payload, got %v", err)
+	}
+}
+
+func TestSequentialRequester_PartialResult(t *testing.T) {
+	server := processAPIStandIn(t, 0, 1)
+	defer server.Close()
+
+	config := DefaultConfig()
+	config.RequestTimeout = 2 * time.Second
+	req := NewSequentialRequester(config, newTestProcessAPI(server.URL))
+
+	results := make(chan Result, 1)
+	req.OnResult(func(r Result) { results <- r })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req.Start(ctx)
+	defer req.Stop()
+
+	if err := req.Enqueue(processAPIRequest()); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	select {
+	case result := <-results:
+		if !result.IsSuccess() || !result.Partial || result.Warning == "" || result.Payload == nil {
+			t.Errorf("Expected successful partial result, got %+v", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for result")
+	}
+
+	if metrics := req.GetMetrics(); metrics.ConsecErrors != 0 {
+		t.Errorf("Partial results must not count as errors, got %d", metrics.ConsecErrors)
+	}
+}
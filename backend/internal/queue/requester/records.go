@@ -0,0 +1,100 @@
+package requester
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// recordBuilder agrupa valores de series en registros canónicos por (timestamp, cage_id)
+type recordBuilder struct {
+	index   map[string]map[string]interface{}
+	records []map[string]interface{}
+}
+
+func newRecordBuilder() *recordBuilder {
+	return &recordBuilder{
+		index:   make(map[string]map[string]interface{}),
+		records: []map[string]interface{}{},
+	}
+}
+
+// Add agrega un valor al registro del timestamp y jaula indicados
+func (rb *recordBuilder) Add(ts time.Time, cageID, field string, value float64) {
+	stamp := ts.UTC().Format(time.RFC3339)
+	key := stamp + "|" + cageID
+
+	record, ok := rb.index[key]
+	if !ok {
+		record = map[string]interface{}{"timestamp": stamp}
+		if cageID != "" {
+			record["cage_id"] = cageID
+		}
+		rb.index[key] = record
+		rb.records = append(rb.records, record)
+	}
+	record[field] = value
+}
+
+// Records retorna los registros ordenados por timestamp y jaula
+func (rb *recordBuilder) Records() []map[string]interface{} {
+	sort.SliceStable(rb.records, func(i, j int) bool {
+		ti, tj := rb.records[i]["timestamp"].(string), rb.records[j]["timestamp"].(string)
+		if ti != tj {
+			return ti < tj
+		}
+		ci, _ := rb.records[i]["cage_id"].(string)
+		cj, _ := rb.records[j]["cage_id"].(string)
+		return ci < cj
+	})
+	return rb.records
+}
+
+// MergeTimeSeries combina payloads de varias fuentes en uno solo.
+// Los registros se deduplican por (timestamp, cage_id): gana el primer payload que trae cada campo,
+// por lo que deben pasarse en orden de prioridad.
+func MergeTimeSeries(payloads ...TimeSeriesPayload) TimeSeriesPayload {
+	if len(payloads) == 0 {
+		return TimeSeriesPayload{Records: []map[string]interface{}{}}
+	}
+
+	merged := payloads[0]
+	merged.Units = make(map[string]string)
+
+	var sources []string
+	index := make(map[string]map[string]interface{})
+	records := []map[string]interface{}{}
+
+	for _, payload := range payloads {
+		sources = append(sources, payload.Source)
+		for field, unit := range payload.Units {
+			if _, ok := merged.Units[field]; !ok {
+				merged.Units[field] = unit
+			}
+		}
+
+		for _, record := range payload.Records {
+			ts, _ := record["timestamp"].(string)
+			cageID, _ := record["cage_id"].(string)
+			key := ts + "|" + cageID
+
+			existing, ok := index[key]
+			if !ok {
+				existing = make(map[string]interface{}, len(record))
+				index[key] = existing
+				records = append(records, existing)
+			}
+			for field, value := range record {
+				if _, set := existing[field]; !set {
+					existing[field] = value
+				}
+			}
+		}
+	}
+
+	rb := &recordBuilder{records: records}
+	merged.Records = rb.Records()
+	merged.Count = len(merged.Records)
+	merged.Source = strings.Join(sources, "+")
+	return merged
+}
@@ -2,6 +2,7 @@ package requester
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -220,7 +221,9 @@ func (sr *SequentialRequester) processNext() {
 		sr.circuitBreaker.RecordSuccess()
 	} else {
 		sr.metrics.RecordError()
-		sr.circuitBreaker.RecordFailure()
+		if CountsAsFailure(result.Err) {
+			sr.circuitBreaker.RecordFailure()
+		}
 	}
 
 	// Limpiar current request
@@ -256,6 +259,14 @@ func (sr *SequentialRequester) executeRequest(req Request) Result {
 		RequestID:   req.RequestID,
 	}
 
+	// Datos parciales: éxito con advertencia
+	if err != nil && payload != nil && errors.Is(err, ErrPartial) {
+		result.Err = nil
+		result.Partial = true
+		result.Warning = err.Error()
+		return result
+	}
+
 	if err != nil {
 		result.ErrorMsg = err.Error()
 	}
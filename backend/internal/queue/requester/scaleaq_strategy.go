@@ -0,0 +1,273 @@
+package requester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// scaleAQTimeSeriesPath endpoint de consulta de series temporales
+	scaleAQTimeSeriesPath = "/time-series/retrieve"
+
+	// scaleAQHealthPath endpoint liviano usado para el health check
+	scaleAQHealthPath = "/meta/company"
+
+	// scaleAQVersion versión de API enviada en el header Scale-Version
+	scaleAQVersion = "2025-01-01"
+)
+
+// TokenSource entrega tokens de acceso para un proveedor externo.
+// services.ServiceTokenSource lo implementa sobre el TokenManager.
+type TokenSource interface {
+	// Token retorna un token válido (desde cache o re-autenticando)
+	Token(ctx context.Context) (string, error)
+
+	// Invalidate descarta un token rechazado (401/403) para forzar su renovación
+	Invalidate(token string)
+}
+
+// StaticToken es un TokenSource para API keys que no expiran
+type StaticToken string
+
+// Token retorna la key
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	if t == "" {
+		return "", fmt.Errorf("API key no configurada")
+	}
+	return string(t), nil
+}
+
+// Invalidate no hace nada: la key no se puede renovar
+func (t StaticToken) Invalidate(token string) {}
+
+// ScaleAQCloudStrategy consulta series temporales en ScaleAQ Cloud
+type ScaleAQCloudStrategy struct {
+	endpoint string
+	tokens   TokenSource
+	client   *http.Client
+	siteIDs  map[string]string // site_id interno -> siteId de ScaleAQ
+}
+
+// NewScaleAQCloudStrategy crea una estrategia para ScaleAQ Cloud
+func NewScaleAQCloudStrategy(endpoint string, tokens TokenSource) *ScaleAQCloudStrategy {
+	return &ScaleAQCloudStrategy{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		tokens:   tokens,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		siteIDs:  make(map[string]string),
+	}
+}
+
+// SetSiteAlias asocia un site_id interno con el siteId que usa ScaleAQ
+func (scs *ScaleAQCloudStrategy) SetSiteAlias(siteID, scaleAQSiteID string) {
+	scs.siteIDs[siteID] = scaleAQSiteID
+}
+
+// SetHTTPClient reemplaza el cliente HTTP (útil para testing)
+func (scs *ScaleAQCloudStrategy) SetHTTPClient(client *http.Client) {
+	scs.client = client
+}
+
+// scaleAQRetrieveRequest body de /time-series/retrieve
+type scaleAQRetrieveRequest struct {
+	SiteID    string           `json:"siteId"`
+	UnitIDs   []string         `json:"unitIds,omitempty"`
+	DataTypes []string         `json:"dataTypes,omitempty"`
+	TimeRange scaleAQTimeRange `json:"timeRange"`
+}
+
+type scaleAQTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// scaleAQRetrieveResponse respuesta de /time-series/retrieve
+type scaleAQRetrieveResponse struct {
+	Data []struct {
+		UnitID   string `json:"unitId"`
+		DataType string `json:"dataType"`
+		Unit     string `json:"unit"`
+		Values   []struct {
+			Timestamp time.Time `json:"timestamp"`
+			Value     *float64  `json:"value"`
+		} `json:"values"`
+	} `json:"data"`
+}
+
+// Execute consulta /time-series/retrieve y normaliza la respuesta al payload canónico
+func (scs *ScaleAQCloudStrategy) Execute(ctx context.Context, req Request) (json.RawMessage, error) {
+	kind, field := splitMetric(req.Metric)
+	if kind == "" {
+		return nil, fmt.Errorf("%w: metric is required", ErrInvalidRequest)
+	}
+
+	body := scaleAQRetrieveRequest{
+		SiteID: req.SiteID,
+		TimeRange: scaleAQTimeRange{
+			From: req.TimeRange.From.UTC().Format(time.RFC3339),
+			To:   req.TimeRange.To.UTC().Format(time.RFC3339),
+		},
+	}
+	if alias, ok := scs.siteIDs[req.SiteID]; ok {
+		body.SiteID = alias
+	}
+	if req.CageID != nil && *req.CageID != "" {
+		body.UnitIDs = []string{*req.CageID}
+	}
+	if field != "" {
+		body.DataTypes = []string{field}
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+
+	respBody, err := scs.do(ctx, http.MethodPost, scaleAQTimeSeriesPath, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp scaleAQRetrieveResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	payload := TimeSeriesPayload{
+		Kind:      kind,
+		Metric:    req.Metric,
+		SiteID:    req.SiteID,
+		CageID:    req.CageID,
+		Source:    scs.Name(),
+		TimeRange: req.TimeRange,
+		Units:     make(map[string]string),
+	}
+
+	// Agrupar valores por (timestamp, unidad) para que varias series compartan registro
+	records := newRecordBuilder()
+	for _, series := range resp.Data {
+		name := field
+		if series.DataType != "" {
+			name = toSnakeCase(series.DataType)
+		}
+		if name == "" {
+			name = "value"
+		}
+		if series.Unit != "" {
+			payload.Units[name] = series.Unit
+		}
+
+		for _, v := range series.Values {
+			if v.Value != nil {
+				records.Add(v.Timestamp, series.UnitID, name, *v.Value)
+			}
+		}
+	}
+
+	payload.Records = records.Records()
+	payload.Count = len(payload.Records)
+
+	out, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return out, nil
+}
+
+// Name retorna el nombre
+func (scs *ScaleAQCloudStrategy) Name() string {
+	return "scaleaq-cloud"
+}
+
+// HealthCheck verifica conectividad y credenciales con ScaleAQ Cloud
+func (scs *ScaleAQCloudStrategy) HealthCheck(ctx context.Context) error {
+	_, err := scs.do(ctx, http.MethodGet, scaleAQHealthPath, nil)
+	return err
+}
+
+// do ejecuta una llamada autenticada. Ante un 401/403 invalida el token y reintenta una vez.
+func (scs *ScaleAQCloudStrategy) do(ctx context.Context, method, path string, payload []byte) ([]byte, error) {
+	if scs.endpoint == "" {
+		return nil, fmt.Errorf("%w: endpoint no configurado", ErrInvalidRequest)
+	}
+	if scs.tokens == nil {
+		return nil, fmt.Errorf("%w: token source no configurado", ErrUnauthorized)
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := scs.tokens.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: error obteniendo token: %v", ErrUnauthorized, err)
+		}
+
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+
+		httpReq, err := http.NewRequestWithContext(ctx, method, scs.endpoint+path, body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+		httpReq.Header.Set("Scale-Version", scaleAQVersion)
+		httpReq.Header.Set("Accept", "application/json")
+		if payload != nil {
+			httpReq.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := scs.client.Do(httpReq)
+		if err != nil {
+			return nil, transportError(err)
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: error leyendo respuesta: %v", ErrUpstreamUnavailable, err)
+		}
+
+		if (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && attempt == 0 {
+			// Token revocado o expirado antes de tiempo: renovar una vez
+			scs.tokens.Invalidate(token)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, NewHTTPError(scs.Name(), resp, respBody)
+		}
+
+		return respBody, nil
+	}
+}
+
+// splitMetric separa "feeding.appetite" en kind ("feeding") y campo ("appetite")
+func splitMetric(metric string) (kind, field string) {
+	kind, field, _ = strings.Cut(strings.TrimSpace(metric), ".")
+	return kind, field
+}
+
+// toSnakeCase convierte "feedAmount" o "feed-amount" en "feed_amount"
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + ('a' - 'A'))
+		case r == '-' || r == ' ' || r == '.':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
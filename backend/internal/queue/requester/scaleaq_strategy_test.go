@@ -0,0 +1,174 @@
+package requester
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// countingTokens TokenSource de prueba que entrega un token nuevo tras cada Invalidate
+type countingTokens struct {
+	issued      int
+	invalidated int
+	rejected    string
+}
+
+func (ct *countingTokens) Token(ctx context.Context) (string, error) {
+	if ct.issued == ct.invalidated {
+		ct.issued++
+	}
+	return fmt.Sprintf("token-%d", ct.issued), nil
+}
+
+func (ct *countingTokens) Invalidate(token string) {
+	ct.invalidated++
+	ct.rejected = token
+}
+
+func TestScaleAQCloudStrategy_Execute(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/time-series/retrieve" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Scale-Version") == "" {
+			t.Errorf("Missing ScaleAQ headers: %v", r.Header)
+		}
+
+		var body scaleAQRetrieveRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Invalid body: %v", err)
+		}
+		if body.SiteID != "sq-site-1" || len(body.UnitIDs) != 1 || body.UnitIDs[0] != "cage-1" {
+			t.Errorf("Unexpected site/units: %+v", body)
+		}
+		if len(body.DataTypes) != 1 || body.DataTypes[0] != "appetite" {
+			t.Errorf("Unexpected data types: %v", body.DataTypes)
+		}
+
+		w.Write([]byte(`{"data": [
+			{"unitId": "cage-1", "dataType": "appetite", "unit": "%", "values": [
+				{"timestamp": "2024-05-01T10:10:00Z", "value": 80},
+				{"timestamp": "2024-05-01T10:00:00Z", "value": 75.5},
+				{"timestamp": "2024-05-01T10:20:00Z", "value": null}
+			]},
+			{"unitId": "cage-1", "dataType": "feedAmount", "unit": "kg", "values": [
+				{"timestamp": "2024-05-01T10:00:00Z", "value": 12}
+			]}
+		]}`))
+	}))
+	defer server.Close()
+
+	strategy := NewScaleAQCloudStrategy(server.URL+"/", StaticToken("secret"))
+	strategy.SetSiteAlias("site-1", "sq-site-1")
+
+	cageID := "cage-1"
+	from := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	raw, err := strategy.Execute(context.Background(), Request{
+		TenantID:  "tenant-1",
+		SiteID:    "site-1",
+		CageID:    &cageID,
+		Metric:    "feeding.appetite",
+		TimeRange: TimeRange{From: from, To: from.Add(time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	var payload TimeSeriesPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+
+	if payload.Kind != "feeding" || payload.Source != "scaleaq-cloud" || payload.SiteID != "site-1" {
+		t.Errorf("Unexpected payload header: %+v", payload)
+	}
+	if payload.Count != 2 || len(payload.Records) != 2 {
+		t.Fatalf("Expected 2 records (null skipped, series merged), got %d", payload.Count)
+	}
+
+	first := payload.Records[0]
+	if first["timestamp"] != "2024-05-01T10:00:00Z" || first["cage_id"] != "cage-1" {
+		t.Errorf("Records must be sorted by timestamp, got %v", first)
+	}
+	if first["appetite"] != 75.5 || first["feed_amount"] != float64(12) {
+		t.Errorf("Expected merged appetite and feed_amount, got %v", first)
+	}
+	if payload.Units["feed_amount"] != "kg" {
+		t.Errorf("Unexpected units: %v", payload.Units)
+	}
+}
+
+func TestScaleAQCloudStrategy_RetriesOnceOnUnauthorized(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	tokens := &countingTokens{}
+	strategy := NewScaleAQCloudStrategy(server.URL, tokens)
+
+	if err := strategy.HealthCheck(context.Background()); err != nil {
+		t.Fatalf("Expected success after re-authentication, got %v", err)
+	}
+	if calls != 2 || tokens.invalidated != 1 || tokens.rejected != "token-1" {
+		t.Errorf("Expected 2 calls and token-1 invalidated, got calls=%d invalidated=%d rejected=%q", calls, tokens.invalidated, tokens.rejected)
+	}
+}
+
+func TestScaleAQCloudStrategy_ErrorMapping(t *testing.T) {
+	cases := []struct {
+		status       int
+		want         error
+		countsToTrip bool
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized, true},
+		{http.StatusTooManyRequests, ErrRateLimited, true},
+		{http.StatusBadGateway, ErrUpstreamUnavailable, true},
+		{http.StatusNotFound, ErrUpstreamRejected, false},
+	}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(tc.status)
+			w.Write([]byte(`{"error": "nope"}`))
+		}))
+
+		strategy := NewScaleAQCloudStrategy(server.URL, StaticToken("secret"))
+		_, err := strategy.Execute(context.Background(), Request{
+			SiteID:    "site-1",
+			Metric:    "climate.temperature",
+			TimeRange: TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+		})
+		server.Close()
+
+		if !errors.Is(err, tc.want) {
+			t.Errorf("HTTP %d: expected %v, got %v", tc.status, tc.want, err)
+		}
+		if CountsAsFailure(err) != tc.countsToTrip {
+			t.Errorf("HTTP %d: CountsAsFailure = %v, want %v", tc.status, !tc.countsToTrip, tc.countsToTrip)
+		}
+
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != tc.status || httpErr.RetryAfter != 30*time.Second {
+			t.Errorf("HTTP %d: expected HTTPError with Retry-After, got %#v", tc.status, err)
+		}
+	}
+
+	// Sin servidor: error de red clasificado como upstream no disponible
+	strategy := NewScaleAQCloudStrategy("http://127.0.0.1:1", StaticToken("secret"))
+	if err := strategy.HealthCheck(context.Background()); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("Expected ErrUpstreamUnavailable for connection errors, got %v", err)
+	}
+}
@@ -94,65 +94,3 @@ func (nos *NoOpStrategy) Name() string {
 func (nos *NoOpStrategy) HealthCheck(ctx context.Context) error {
 	return nil
 }
-
-// ScaleAQCloudStrategy es un placeholder para la estrategia de ScaleAQ Cloud
-// Implementación real debe hacerse en el futuro
-type ScaleAQCloudStrategy struct {
-	endpoint string
-	apiKey   string
-}
-
-// NewScaleAQCloudStrategy crea una estrategia para ScaleAQ Cloud
-func NewScaleAQCloudStrategy(endpoint, apiKey string) *ScaleAQCloudStrategy {
-	return &ScaleAQCloudStrategy{
-		endpoint: endpoint,
-		apiKey:   apiKey,
-	}
-}
-
-// Execute ejecuta la solicitud contra ScaleAQ Cloud
-func (scs *ScaleAQCloudStrategy) Execute(ctx context.Context, req Request) (json.RawMessage, error) {
-	// TODO: Implementar llamada real a /time-series/retrieve
-	// Por ahora es un placeholder
-	return nil, fmt.Errorf("ScaleAQ Cloud strategy not implemented yet")
-}
-
-// Name retorna el nombre
-func (scs *ScaleAQCloudStrategy) Name() string {
-	return "scaleaq-cloud"
-}
-
-// HealthCheck verifica conectividad con ScaleAQ Cloud
-func (scs *ScaleAQCloudStrategy) HealthCheck(ctx context.Context) error {
-	// TODO: Implementar health check real
-	return fmt.Errorf("ScaleAQ Cloud health check not implemented yet")
-}
-
-// ProcessAPIStrategy es un placeholder para la estrategia de ProcessAPI local
-type ProcessAPIStrategy struct {
-	endpoint string
-}
-
-// NewProcessAPIStrategy crea una estrategia para ProcessAPI
-func NewProcessAPIStrategy(endpoint string) *ProcessAPIStrategy {
-	return &ProcessAPIStrategy{
-		endpoint: endpoint,
-	}
-}
-
-// Execute ejecuta la solicitud contra ProcessAPI local
-func (pas *ProcessAPIStrategy) Execute(ctx context.Context, req Request) (json.RawMessage, error) {
-	// TODO: Implementar llamada real a ProcessAPI
-	return nil, fmt.Errorf("ProcessAPI strategy not implemented yet")
-}
-
-// Name retorna el nombre
-func (pas *ProcessAPIStrategy) Name() string {
-	return "processapi"
-}
-
-// HealthCheck verifica conectividad con ProcessAPI
-func (pas *ProcessAPIStrategy) HealthCheck(ctx context.Context) error {
-	// TODO: Implementar health check real
-	return fmt.Errorf("ProcessAPI health check not implemented yet")
-}
@@ -21,6 +21,7 @@ type Source string
 const (
 	SourceCloud      Source = "cloud"
 	SourceProcessAPI Source = "processapi"
+	SourceDerived    Source = "derived" // Combinación de varias fuentes (PolicyMerge)
 )
 
 // TimeRange representa un rango de tiempo
@@ -63,6 +64,8 @@ type Result struct {
 	LatencyMS   int64           `json:"latency_ms"`
 	TsRange     TimeRange       `json:"ts_range"`
 	Payload     json.RawMessage `json:"payload,omitempty"` // DATA canónica si llega algo
+	Partial     bool            `json:"partial,omitempty"` // Payload incompleto (ver ErrPartial)
+	Warning     string          `json:"warning,omitempty"` // Motivo del resultado parcial
 	Err         error           `json:"-"`
 	ErrorMsg    string          `json:"error_msg,omitempty"`
 	CompletedAt time.Time       `json:"completed_at"`
@@ -74,9 +77,24 @@ func (r *Result) IsSuccess() bool {
 	return r.Err == nil
 }
 
+// TimeSeriesPayload payload canónico que retornan las estrategias de series temporales.
+// Cada registro lleva "timestamp", "cage_id" (si aplica) y un campo por métrica (ej: "appetite").
+type TimeSeriesPayload struct {
+	Kind      string                   `json:"kind"`   // feeding, climate, ...
+	Metric    string                   `json:"metric"` // Métrica solicitada
+	SiteID    string                   `json:"site_id"`
+	CageID    *string                  `json:"cage_id,omitempty"`
+	Source    string                   `json:"source"` // Nombre de la estrategia
+	TimeRange TimeRange                `json:"time_range"`
+	Units     map[string]string        `json:"units,omitempty"` // campo -> unidad
+	Records   []map[string]interface{} `json:"records"`
+	Count     int                      `json:"count"`
+}
+
 // Strategy define la interfaz para ejecutar solicitudes concretas
 type Strategy interface {
-	// Execute ejecuta una solicitud y retorna el payload o error
+	// Execute ejecuta una solicitud y retorna el payload o error.
+	// Si retorna payload junto con un error que envuelve ErrPartial, el resultado se marca parcial.
 	Execute(ctx context.Context, req Request) (json.RawMessage, error)
 
 	// Name retorna el nombre de la estrategia
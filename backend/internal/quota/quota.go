@@ -0,0 +1,617 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"omniapi/internal/domain"
+	"omniapi/internal/metrics"
+)
+
+// Recursos medidos por tenant (coinciden con domain.Quota.Resource)
+const (
+	ResourceAPICalls              = "api_calls_per_hour"     // Requests HTTP autenticados por hora
+	ResourceEventsPerDay          = "events_per_day"         // Eventos DATA enrutados por día
+	ResourceConcurrentConnections = "concurrent_connections" // Conexiones WebSocket activas
+	ResourceStreams               = "streams"                // Suscripciones activas en el router
+	ResourceConnections           = "connections"            // External services configurados
+	ResourcePollingConfigs        = "polling_configs"        // Configuraciones de polling
+)
+
+// ErrorCode código de error que reciben los clientes al superar una quota
+const ErrorCode = "QUOTA_EXCEEDED"
+
+// flushInterval cada cuánto se persisten los contadores y se actualizan las métricas
+const flushInterval = 10 * time.Second
+
+// limitsTTL cada cuánto se recargan los límites de un tenant desde el TenantLoader
+const limitsTTL = time.Minute
+
+// Tipos de medición
+const (
+	kindRate    = "rate"    // Contador en ventana deslizante, persistido
+	kindGauge   = "gauge"   // Uso concurrente, en memoria
+	kindCounted = "counted" // Recursos existentes, contados bajo demanda
+)
+
+type resourceSpec struct {
+	kind   string
+	window time.Duration // Solo kindRate
+}
+
+var resourceSpecs = map[string]resourceSpec{
+	ResourceAPICalls:              {kind: kindRate, window: time.Hour},
+	ResourceEventsPerDay:          {kind: kindRate, window: 24 * time.Hour},
+	ResourceConcurrentConnections: {kind: kindGauge},
+	ResourceStreams:               {kind: kindGauge},
+	ResourceConnections:           {kind: kindCounted},
+	ResourcePollingConfigs:        {kind: kindCounted},
+}
+
+// ExceededError quota superada; errors.Is(err, domain.ErrQuotaExceeded) es true
+type ExceededError struct {
+	TenantID string `json:"tenant_id"`
+	Resource string `json:"resource"`
+	Limit    int64  `json:"limit"`
+	Used     int64  `json:"used"`
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %d/%d", e.Resource, e.Used, e.Limit)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return domain.ErrQuotaExceeded
+}
+
+// Counter cuenta los recursos existentes de un tenant (ej: documentos en MongoDB)
+type Counter func(tenantID string) (int64, error)
+
+// TenantLoader obtiene un tenant con sus quotas (nil si no existe)
+type TenantLoader func(tenantID string) (*domain.Tenant, error)
+
+// QuotaUsage uso de una quota con los valores derivados
+type QuotaUsage struct {
+	domain.Quota
+	Unlimited      bool    `json:"unlimited"`
+	Remaining      int64   `json:"remaining"`
+	PercentageUsed float64 `json:"percentage_used"`
+	Exceeded       bool    `json:"exceeded"`
+	Window         string  `json:"window,omitempty"` // Ventana de los contadores por tiempo (1h, 24h)
+}
+
+// Usage uso de todas las quotas de un tenant
+type Usage struct {
+	TenantID string       `json:"tenant_id"`
+	Quotas   []QuotaUsage `json:"quotas"`
+}
+
+type usageKey struct {
+	tenant   string
+	resource string
+}
+
+// window contadores de la ventana actual y la anterior. El uso se estima como una ventana
+// deslizante: la actual más la parte de la anterior que aún se solapa.
+type window struct {
+	start    time.Time
+	current  int64               // Total conocido de la ventana actual (persistido + local)
+	previous int64               // Total de la ventana anterior
+	pending  map[time.Time]int64 // Incrementos locales sin persistir, por inicio de ventana
+	synced   bool                // previous ya se leyó del store
+}
+
+func (w *window) roll(now time.Time, size time.Duration) {
+	start := now.Truncate(size)
+	if start.Equal(w.start) {
+		return
+	}
+	if start.Sub(w.start) == size {
+		w.previous = w.current
+	} else {
+		w.previous = 0
+	}
+	w.start = start
+	w.current = 0
+}
+
+func (w *window) estimate(now time.Time, size time.Duration) int64 {
+	overlap := 1 - float64(now.Sub(w.start))/float64(size)
+	if overlap < 0 {
+		overlap = 0
+	}
+	return w.current + int64(float64(w.previous)*overlap)
+}
+
+// Meter mide el uso de recursos por tenant y aplica los límites configurados
+type Meter struct {
+	mu       sync.Mutex
+	defaults map[string]int64            // resource → límite
+	limits   map[string]map[string]int64 // tenant → resource → límite
+	loader   TenantLoader
+	loaded   map[string]time.Time // tenant → última carga de sus límites
+	loading  map[string]bool
+	windows  map[usageKey]*window
+	gauges   map[usageKey]int64
+	counters map[string]Counter
+	store    UsageStore
+	now      func() time.Time
+}
+
+var (
+	meterInstance *Meter
+	meterOnce     sync.Once
+)
+
+// GetMeter retorna la instancia singleton del Meter
+func GetMeter() *Meter {
+	meterOnce.Do(func() {
+		meterInstance = NewMeter()
+	})
+	return meterInstance
+}
+
+// NewMeter crea un meter sin límites (todo permitido hasta llamar a SetLimits)
+func NewMeter() *Meter {
+	return &Meter{
+		defaults: make(map[string]int64),
+		limits:   make(map[string]map[string]int64),
+		loaded:   make(map[string]time.Time),
+		loading:  make(map[string]bool),
+		windows:  make(map[usageKey]*window),
+		gauges:   make(map[usageKey]int64),
+		counters: make(map[string]Counter),
+		now:      time.Now,
+	}
+}
+
+// SetLimits configura los límites: las quotas del tenant reemplazan a las por defecto del
+// mismo recurso. Un recurso sin quota no tiene límite.
+func (m *Meter) SetLimits(defaults []domain.Quota, tenants []domain.Tenant) {
+	byResource := make(map[string]int64, len(defaults))
+	for _, q := range defaults {
+		byResource[q.Resource] = q.Limit
+	}
+
+	byTenant := make(map[string]map[string]int64, len(tenants))
+	for _, tenant := range tenants {
+		byTenant[tenant.ID.Hex()] = quotaLimits(tenant.Quotas)
+	}
+
+	m.mu.Lock()
+	m.defaults = byResource
+	m.limits = byTenant
+	m.loaded = make(map[string]time.Time)
+	m.mu.Unlock()
+}
+
+// SetTenantLoader resuelve los límites de cada tenant bajo demanda (la primera vez que se
+// usa) y los recarga cada limitsTTL. Un tenant que el loader no encuentra conserva los
+// límites de SetLimits.
+func (m *Meter) SetTenantLoader(loader TenantLoader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loader = loader
+	m.loaded = make(map[string]time.Time)
+}
+
+// Invalidate fuerza la recarga de los límites del tenant en el próximo uso (ej: al editarlo)
+func (m *Meter) Invalidate(tenantID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.loaded, tenantID)
+}
+
+// SetCounter registra cómo contar un recurso existente (connections, polling_configs)
+func (m *Meter) SetCounter(resource string, counter Counter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[resource] = counter
+}
+
+// Start persiste los contadores periódicamente en el store hasta que se cancele ctx
+func (m *Meter) Start(ctx context.Context, store UsageStore) {
+	m.mu.Lock()
+	m.store = store
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				m.flush()
+				return
+			case <-ticker.C:
+				m.flush()
+			}
+		}
+	}()
+}
+
+// Allow cuenta una unidad de un recurso por tiempo (api_calls_per_hour) si no supera el límite
+func (m *Meter) Allow(tenantID, resource string) error {
+	if tenantID == "" {
+		return nil
+	}
+	m.ensureLimits(tenantID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	size := resourceSpecs[resource].window
+	w := m.windowLocked(usageKey{tenantID, resource}, now)
+	if limit, ok := m.limitLocked(tenantID, resource); ok {
+		if used := w.estimate(now, size); used >= limit {
+			return reject(tenantID, resource, limit, used)
+		}
+	}
+
+	w.current++
+	w.pending[w.start]++
+	return nil
+}
+
+// Record cuenta una unidad de un recurso por tiempo sin rechazarla (events_per_day).
+// Retorna false si el tenant ya superó el límite: quien consume el evento lo degrada.
+func (m *Meter) Record(tenantID, resource string) bool {
+	if tenantID == "" {
+		return true
+	}
+	m.ensureLimits(tenantID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	w := m.windowLocked(usageKey{tenantID, resource}, now)
+	w.current++
+	w.pending[w.start]++
+
+	if limit, ok := m.limitLocked(tenantID, resource); ok && w.estimate(now, resourceSpecs[resource].window) > limit {
+		metrics.TenantQuotaRejectedTotal.WithLabelValues(metrics.SanitizeTenantID(tenantID), resource).Inc()
+		return false
+	}
+	return true
+}
+
+// Exceeded indica si el tenant superó el límite de un recurso (uso mayor al límite)
+func (m *Meter) Exceeded(tenantID, resource string) bool {
+	if tenantID == "" {
+		return false
+	}
+	m.ensureLimits(tenantID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limit, ok := m.limitLocked(tenantID, resource)
+	if !ok {
+		return false
+	}
+	return m.usedLocked(usageKey{tenantID, resource}) > limit
+}
+
+// Acquire reserva una unidad de un recurso concurrente (conexiones, streams)
+func (m *Meter) Acquire(tenantID, resource string) error {
+	if tenantID == "" {
+		return nil
+	}
+	m.ensureLimits(tenantID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := usageKey{tenantID, resource}
+	if limit, ok := m.limitLocked(tenantID, resource); ok && m.gauges[key] >= limit {
+		return reject(tenantID, resource, limit, m.gauges[key])
+	}
+	m.gauges[key]++
+	return nil
+}
+
+// Release libera una unidad reservada con Acquire
+func (m *Meter) Release(tenantID, resource string) {
+	if tenantID == "" {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := usageKey{tenantID, resource}
+	if m.gauges[key] > 0 {
+		m.gauges[key]--
+	}
+}
+
+// Admit verifica que el tenant pueda crear un recurso contado más (connections, polling_configs).
+// Si no se puede contar, se permite: una caída de MongoDB no debe bloquear la operación.
+func (m *Meter) Admit(tenantID, resource string) error {
+	if tenantID == "" {
+		return nil
+	}
+	m.ensureLimits(tenantID)
+
+	m.mu.Lock()
+	limit, limited := m.limitLocked(tenantID, resource)
+	counter := m.counters[resource]
+	m.mu.Unlock()
+
+	if !limited || counter == nil {
+		return nil
+	}
+
+	used, err := counter(tenantID)
+	if err != nil {
+		fmt.Printf("⚠️  Quota: could not count %s for tenant %s: %v\n", resource, tenantID, err)
+		return nil
+	}
+	metrics.TenantQuotaUsed.WithLabelValues(metrics.SanitizeTenantID(tenantID), resource).Set(float64(used))
+
+	if used >= limit {
+		return reject(tenantID, resource, limit, used)
+	}
+	return nil
+}
+
+// Usage calcula el uso actual de todas las quotas del tenant
+func (m *Meter) Usage(tenantID string) Usage {
+	m.ensureLimits(tenantID)
+
+	m.mu.Lock()
+	tenant := domain.Tenant{}
+	limited := make(map[string]bool)
+	used := make(map[string]int64)
+	counters := make(map[string]Counter)
+
+	for _, resource := range sortedResources() {
+		limit, ok := m.limitLocked(tenantID, resource)
+		tenant.Quotas = append(tenant.Quotas, domain.Quota{Resource: resource, Limit: limit})
+		limited[resource] = ok
+
+		if resourceSpecs[resource].kind == kindCounted {
+			counters[resource] = m.counters[resource]
+		} else {
+			used[resource] = m.usedLocked(usageKey{tenantID, resource})
+		}
+	}
+	m.mu.Unlock()
+
+	for resource, counter := range counters {
+		if counter == nil {
+			continue
+		}
+		if count, err := counter(tenantID); err == nil {
+			used[resource] = count
+		}
+	}
+
+	usage := Usage{TenantID: tenantID, Quotas: make([]QuotaUsage, 0, len(tenant.Quotas))}
+	for resource, value := range used {
+		tenant.UpdateQuotaUsage(resource, value)
+	}
+	for _, q := range tenant.Quotas {
+		item := QuotaUsage{Quota: q, Unlimited: !limited[q.Resource]}
+		if !item.Unlimited {
+			item.Remaining = q.Remaining()
+			item.PercentageUsed = q.PercentageUsed()
+			item.Exceeded = q.IsExceeded()
+		}
+		if window := resourceSpecs[q.Resource].window; window > 0 {
+			item.Window = window.String()
+		}
+		usage.Quotas = append(usage.Quotas, item)
+	}
+	return usage
+}
+
+// Tenants retorna los tenants con límites configurados o uso registrado
+func (m *Meter) Tenants() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for tenantID := range m.limits {
+		seen[tenantID] = true
+	}
+	for key := range m.windows {
+		seen[key.tenant] = true
+	}
+	for key := range m.gauges {
+		seen[key.tenant] = true
+	}
+
+	tenants := make([]string, 0, len(seen))
+	for tenantID := range seen {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// flush persiste los incrementos pendientes, incorpora los de otras réplicas y publica métricas
+func (m *Meter) flush() {
+	type flushItem struct {
+		key          usageKey
+		start        time.Time
+		size         time.Duration
+		delta        int64
+		loadPrevious bool
+	}
+
+	m.mu.Lock()
+	store := m.store
+	now := m.now()
+	var items []flushItem
+	for key, w := range m.windows {
+		size := resourceSpecs[key.resource].window
+		w.roll(now, size)
+		if store == nil {
+			continue
+		}
+		for start, delta := range w.pending {
+			if !start.Equal(w.start) {
+				items = append(items, flushItem{key: key, start: start, size: size, delta: delta})
+			}
+		}
+		// La ventana actual siempre se consulta para sumar lo contado por otras réplicas
+		items = append(items, flushItem{key: key, start: w.start, size: size, delta: w.pending[w.start], loadPrevious: !w.synced})
+		w.pending = make(map[time.Time]int64)
+	}
+	m.mu.Unlock()
+
+	for _, item := range items {
+		total, err := store.Add(item.key.tenant, item.key.resource, item.start, item.delta, item.start.Add(2*item.size))
+
+		var previous int64
+		if err == nil && item.loadPrevious {
+			previous, err = store.Get(item.key.tenant, item.key.resource, item.start.Add(-item.size))
+		}
+
+		m.mu.Lock()
+		w := m.windows[item.key]
+		if err != nil {
+			w.pending[item.start] += item.delta
+		} else if item.start.Equal(w.start) {
+			w.current = total + w.pending[w.start]
+			if item.loadPrevious {
+				w.previous = previous
+				w.synced = true
+			}
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("⚠️  Quota: could not persist %s usage for tenant %s: %v\n", item.key.resource, item.key.tenant, err)
+		}
+	}
+
+	m.publishMetrics()
+}
+
+// publishMetrics actualiza los gauges de Prometheus de uso y límite
+func (m *Meter) publishMetrics() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make(map[usageKey]bool)
+	for key := range m.windows {
+		keys[key] = true
+	}
+	for key := range m.gauges {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		tenant := metrics.SanitizeTenantID(key.tenant)
+		metrics.TenantQuotaUsed.WithLabelValues(tenant, key.resource).Set(float64(m.usedLocked(key)))
+		if limit, ok := m.limitLocked(key.tenant, key.resource); ok {
+			metrics.TenantQuotaLimit.WithLabelValues(tenant, key.resource).Set(float64(limit))
+		}
+	}
+}
+
+func (m *Meter) windowLocked(key usageKey, now time.Time) *window {
+	size := resourceSpecs[key.resource].window
+	if size == 0 {
+		size = time.Hour
+	}
+
+	w, ok := m.windows[key]
+	if !ok {
+		w = &window{start: now.Truncate(size), pending: make(map[time.Time]int64)}
+		m.windows[key] = w
+	}
+	w.roll(now, size)
+	return w
+}
+
+func (m *Meter) usedLocked(key usageKey) int64 {
+	if resourceSpecs[key.resource].kind == kindRate {
+		w, ok := m.windows[key]
+		if !ok {
+			return 0
+		}
+		now := m.now()
+		size := resourceSpecs[key.resource].window
+		w.roll(now, size)
+		return w.estimate(now, size)
+	}
+	return m.gauges[key]
+}
+
+// ensureLimits carga los límites del tenant desde el loader si nunca se cargaron, o los
+// refresca en segundo plano si vencieron. La consulta se hace fuera del lock.
+func (m *Meter) ensureLimits(tenantID string) {
+	m.mu.Lock()
+	loader := m.loader
+	loadedAt, loaded := m.loaded[tenantID]
+	if loader == nil || m.loading[tenantID] || (loaded && m.now().Sub(loadedAt) < limitsTTL) {
+		m.mu.Unlock()
+		return
+	}
+	m.loading[tenantID] = true
+	m.mu.Unlock()
+
+	if loaded {
+		// Mientras tanto siguen rigiendo los límites actuales
+		go m.loadLimits(loader, tenantID)
+		return
+	}
+	m.loadLimits(loader, tenantID)
+}
+
+func (m *Meter) loadLimits(loader TenantLoader, tenantID string) {
+	tenant, err := loader(tenantID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.loading, tenantID)
+	m.loaded[tenantID] = m.now()
+
+	if err != nil {
+		fmt.Printf("⚠️  Quota: could not load limits for tenant %s: %v\n", tenantID, err)
+		return
+	}
+	if tenant != nil {
+		m.limits[tenantID] = quotaLimits(tenant.Quotas)
+	}
+}
+
+func quotaLimits(quotas []domain.Quota) map[string]int64 {
+	limits := make(map[string]int64, len(quotas))
+	for _, q := range quotas {
+		limits[q.Resource] = q.Limit
+	}
+	return limits
+}
+
+func (m *Meter) limitLocked(tenantID, resource string) (int64, bool) {
+	if limits, ok := m.limits[tenantID]; ok {
+		if limit, ok := limits[resource]; ok {
+			return limit, true
+		}
+	}
+	limit, ok := m.defaults[resource]
+	return limit, ok
+}
+
+func reject(tenantID, resource string, limit, used int64) error {
+	metrics.TenantQuotaRejectedTotal.WithLabelValues(metrics.SanitizeTenantID(tenantID), resource).Inc()
+	return &ExceededError{TenantID: tenantID, Resource: resource, Limit: limit, Used: used}
+}
+
+func sortedResources() []string {
+	resources := make([]string, 0, len(resourceSpecs))
+	for resource := range resourceSpecs {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	return resources
+}
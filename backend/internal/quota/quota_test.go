@@ -0,0 +1,248 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestMeter(t *testing.T, now *time.Time, defaults []domain.Quota, tenants ...domain.Tenant) *Meter {
+	t.Helper()
+	meter := NewMeter()
+	meter.now = func() time.Time { return *now }
+	meter.SetLimits(defaults, tenants)
+	return meter
+}
+
+func TestMeter_AllowEnforcesSlidingWindow(t *testing.T) {
+	now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+	meter := newTestMeter(t, &now, []domain.Quota{{Resource: ResourceAPICalls, Limit: 3}})
+
+	for i := 0; i < 3; i++ {
+		if err := meter.Allow("tenant-a", ResourceAPICalls); err != nil {
+			t.Fatalf("call %d rejected: %v", i, err)
+		}
+	}
+
+	err := meter.Allow("tenant-a", ResourceAPICalls)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || !errors.Is(err, domain.ErrQuotaExceeded) {
+		t.Fatalf("expected ExceededError wrapping ErrQuotaExceeded, got %v", err)
+	}
+	if exceeded.Limit != 3 || exceeded.Used != 3 || exceeded.Resource != ResourceAPICalls {
+		t.Errorf("unexpected error detail: %+v", exceeded)
+	}
+
+	// Otro tenant tiene su propio contador
+	if err := meter.Allow("tenant-b", ResourceAPICalls); err != nil {
+		t.Errorf("tenant-b should not be limited: %v", err)
+	}
+
+	// A mitad de la ventana siguiente la anterior pesa la mitad: 3*0.5 = 1 → caben 2 más
+	now = now.Add(90 * time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := meter.Allow("tenant-a", ResourceAPICalls); err != nil {
+			t.Fatalf("call %d after window roll rejected: %v", i, err)
+		}
+	}
+	if err := meter.Allow("tenant-a", ResourceAPICalls); err == nil {
+		t.Error("expected rejection once the sliding estimate reaches the limit")
+	}
+
+	// Dos ventanas después no queda nada
+	now = now.Add(2 * time.Hour)
+	if err := meter.Allow("tenant-a", ResourceAPICalls); err != nil {
+		t.Errorf("expected fresh window, got %v", err)
+	}
+}
+
+func TestMeter_TenantLimitsOverrideDefaults(t *testing.T) {
+	now := time.Now()
+	tenant := domain.Tenant{ID: primitive.NewObjectID(), Quotas: []domain.Quota{{Resource: ResourceStreams, Limit: 1}}}
+	meter := newTestMeter(t, &now, []domain.Quota{{Resource: ResourceStreams, Limit: 5}}, tenant)
+
+	if err := meter.Acquire(tenant.ID.Hex(), ResourceStreams); err != nil {
+		t.Fatalf("first stream rejected: %v", err)
+	}
+	if err := meter.Acquire(tenant.ID.Hex(), ResourceStreams); err == nil {
+		t.Fatal("expected tenant limit of 1 stream")
+	}
+
+	meter.Release(tenant.ID.Hex(), ResourceStreams)
+	if err := meter.Acquire(tenant.ID.Hex(), ResourceStreams); err != nil {
+		t.Errorf("expected stream available after release: %v", err)
+	}
+
+	// Sin quota configurada no hay límite
+	for i := 0; i < 100; i++ {
+		if err := meter.Acquire(tenant.ID.Hex(), ResourceConcurrentConnections); err != nil {
+			t.Fatalf("unlimited resource rejected: %v", err)
+		}
+	}
+}
+
+func TestMeter_LoadsTenantLimitsOnDemand(t *testing.T) {
+	now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+	meter := newTestMeter(t, &now, []domain.Quota{{Resource: ResourceConcurrentConnections, Limit: 5}})
+
+	tenantID := primitive.NewObjectID()
+	limit, loads := int64(1), 0
+	meter.SetTenantLoader(func(id string) (*domain.Tenant, error) {
+		loads++
+		if id != tenantID.Hex() {
+			return nil, nil
+		}
+		return &domain.Tenant{ID: tenantID, Quotas: []domain.Quota{{Resource: ResourceConcurrentConnections, Limit: limit}}}, nil
+	})
+
+	if err := meter.Acquire(tenantID.Hex(), ResourceConcurrentConnections); err != nil {
+		t.Fatalf("first connection rejected: %v", err)
+	}
+	if err := meter.Acquire(tenantID.Hex(), ResourceConcurrentConnections); err == nil {
+		t.Fatal("expected the limit loaded from the store to apply")
+	}
+	if loads != 1 {
+		t.Errorf("expected limits cached after the first load, got %d loads", loads)
+	}
+
+	// Al editar el tenant se recarga en el próximo uso
+	limit = 3
+	meter.Invalidate(tenantID.Hex())
+	if err := meter.Acquire(tenantID.Hex(), ResourceConcurrentConnections); err != nil {
+		t.Errorf("expected the updated limit after invalidation: %v", err)
+	}
+
+	// Un tenant que no está en el store usa las quotas por defecto
+	for i := 0; i < 5; i++ {
+		if err := meter.Acquire("unknown", ResourceConcurrentConnections); err != nil {
+			t.Fatalf("connection %d of unknown tenant rejected: %v", i, err)
+		}
+	}
+	if err := meter.Acquire("unknown", ResourceConcurrentConnections); err == nil {
+		t.Error("expected default limit for tenants missing in the store")
+	}
+}
+
+func TestMeter_RecordDegradesOverDailyLimit(t *testing.T) {
+	now := time.Now()
+	meter := newTestMeter(t, &now, []domain.Quota{{Resource: ResourceEventsPerDay, Limit: 2}})
+
+	if !meter.Record("tenant-a", ResourceEventsPerDay) || !meter.Record("tenant-a", ResourceEventsPerDay) {
+		t.Fatal("events within the limit should be accepted")
+	}
+	if meter.Exceeded("tenant-a", ResourceEventsPerDay) {
+		t.Error("tenant at the limit should not be degraded yet")
+	}
+	if meter.Record("tenant-a", ResourceEventsPerDay) {
+		t.Error("expected third event to be over the limit")
+	}
+	if !meter.Exceeded("tenant-a", ResourceEventsPerDay) {
+		t.Error("expected tenant to be degraded")
+	}
+}
+
+func TestMeter_AdmitUsesCounter(t *testing.T) {
+	now := time.Now()
+	meter := newTestMeter(t, &now, []domain.Quota{{Resource: ResourcePollingConfigs, Limit: 2}})
+
+	count := int64(1)
+	meter.SetCounter(ResourcePollingConfigs, func(tenantID string) (int64, error) { return count, nil })
+
+	if err := meter.Admit("tenant-a", ResourcePollingConfigs); err != nil {
+		t.Fatalf("expected admission with 1/2: %v", err)
+	}
+	count = 2
+	if err := meter.Admit("tenant-a", ResourcePollingConfigs); !errors.Is(err, domain.ErrQuotaExceeded) {
+		t.Fatalf("expected quota exceeded with 2/2, got %v", err)
+	}
+
+	// Si no se puede contar se permite
+	meter.SetCounter(ResourcePollingConfigs, func(tenantID string) (int64, error) { return 0, errors.New("db down") })
+	if err := meter.Admit("tenant-a", ResourcePollingConfigs); err != nil {
+		t.Errorf("expected fail-open on counter error: %v", err)
+	}
+}
+
+func TestMeter_Usage(t *testing.T) {
+	now := time.Now()
+	meter := newTestMeter(t, &now, []domain.Quota{
+		{Resource: ResourceAPICalls, Limit: 10},
+		{Resource: ResourceConnections, Limit: 4},
+	})
+	meter.SetCounter(ResourceConnections, func(tenantID string) (int64, error) { return 4, nil })
+
+	meter.Allow("tenant-a", ResourceAPICalls)
+	meter.Allow("tenant-a", ResourceAPICalls)
+
+	usage := meter.Usage("tenant-a")
+	byResource := make(map[string]QuotaUsage)
+	for _, q := range usage.Quotas {
+		byResource[q.Resource] = q
+	}
+
+	calls := byResource[ResourceAPICalls]
+	if calls.Used != 2 || calls.Remaining != 8 || calls.PercentageUsed != 20 || calls.Window != "1h0m0s" {
+		t.Errorf("unexpected api calls usage: %+v", calls)
+	}
+	if conns := byResource[ResourceConnections]; !conns.Exceeded || conns.Remaining != 0 {
+		t.Errorf("expected connections exhausted: %+v", conns)
+	}
+	if streams := byResource[ResourceStreams]; !streams.Unlimited || streams.Exceeded {
+		t.Errorf("expected streams unlimited: %+v", streams)
+	}
+}
+
+func TestMeter_FlushSharesCountersAcrossReplicas(t *testing.T) {
+	now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+	store := newMemoryUsageStore()
+	defaults := []domain.Quota{{Resource: ResourceAPICalls, Limit: 5}}
+
+	replicaA := newTestMeter(t, &now, defaults)
+	replicaA.store = store
+	replicaB := newTestMeter(t, &now, defaults)
+	replicaB.store = store
+
+	for i := 0; i < 3; i++ {
+		replicaA.Allow("tenant-a", ResourceAPICalls)
+	}
+	replicaB.Allow("tenant-a", ResourceAPICalls)
+
+	replicaA.flush()
+	replicaB.flush()
+
+	// B ya ve los 4 del total; A se entera en su próximo flush
+	if err := replicaB.Allow("tenant-a", ResourceAPICalls); err != nil {
+		t.Fatalf("5th call rejected: %v", err)
+	}
+	if err := replicaB.Allow("tenant-a", ResourceAPICalls); err == nil {
+		t.Error("expected replica B to enforce the shared total")
+	}
+
+	replicaB.flush()
+	replicaA.flush()
+	if got := replicaA.Usage("tenant-a").Quotas; usedOf(got, ResourceAPICalls) != 5 {
+		t.Errorf("expected replica A to see 5 calls, got %d", usedOf(got, ResourceAPICalls))
+	}
+
+	// Los incrementos pendientes de una ventana anterior se persisten en su propia ventana
+	replicaA.Allow("tenant-b", ResourceAPICalls)
+	now = now.Add(time.Hour)
+	replicaA.flush()
+	previous, _ := store.Get("tenant-b", ResourceAPICalls, now.Add(-time.Hour).Truncate(time.Hour))
+	if previous != 1 {
+		t.Errorf("expected 1 call stored for the previous window, got %d", previous)
+	}
+}
+
+func usedOf(quotas []QuotaUsage, resource string) int64 {
+	for _, q := range quotas {
+		if q.Resource == resource {
+			return q.Used
+		}
+	}
+	return -1
+}
@@ -0,0 +1,169 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"omniapi/internal/database"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UsageStore persiste los contadores por ventana, compartidos entre réplicas
+type UsageStore interface {
+	// Add suma delta al contador de la ventana y retorna el total acumulado
+	Add(tenantID, resource string, windowStart time.Time, delta int64, expiresAt time.Time) (int64, error)
+	// Get retorna el total de una ventana (0 si no existe)
+	Get(tenantID, resource string, windowStart time.Time) (int64, error)
+}
+
+// UsageCounter contador persistido de una ventana
+type UsageCounter struct {
+	ID          string    `bson:"_id" json:"id"`
+	TenantID    string    `bson:"tenant_id" json:"tenant_id"`
+	Resource    string    `bson:"resource" json:"resource"`
+	WindowStart time.Time `bson:"window_start" json:"window_start"`
+	Count       int64     `bson:"count" json:"count"`
+	ExpiresAt   time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+func counterID(tenantID, resource string, windowStart time.Time) string {
+	return tenantID + ":" + resource + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+}
+
+// mongoUsageStore guarda los contadores en la colección tenant_usage (con TTL)
+type mongoUsageStore struct {
+	collection string
+}
+
+// NewMongoUsageStore crea el store y asegura el índice TTL de los contadores vencidos
+func NewMongoUsageStore() UsageStore {
+	store := &mongoUsageStore{collection: "tenant_usage"}
+
+	if database.Database != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		indexes := []mongo.IndexModel{
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+			{Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "resource", Value: 1}, {Key: "window_start", Value: -1}}},
+		}
+		if _, err := database.GetCollection(store.collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			fmt.Printf("⚠️  Warning: could not create tenant usage indexes: %v\n", err)
+		}
+	}
+
+	return store
+}
+
+func (s *mongoUsageStore) Add(tenantID, resource string, windowStart time.Time, delta int64, expiresAt time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$inc": bson.M{"count": delta},
+		"$setOnInsert": bson.M{
+			"tenant_id":    tenantID,
+			"resource":     resource,
+			"window_start": windowStart,
+			"expires_at":   expiresAt,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter UsageCounter
+	err := database.GetCollection(s.collection).
+		FindOneAndUpdate(ctx, bson.M{"_id": counterID(tenantID, resource, windowStart)}, update, opts).
+		Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Count, nil
+}
+
+func (s *mongoUsageStore) Get(tenantID, resource string, windowStart time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var counter UsageCounter
+	err := database.GetCollection(s.collection).
+		FindOne(ctx, bson.M{"_id": counterID(tenantID, resource, windowStart)}).
+		Decode(&counter)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return counter.Count, nil
+}
+
+// CollectionCounter cuenta los documentos de una colección que pertenecen al tenant.
+// El tenant_id se busca como ObjectID y como string (las colecciones usan ambos formatos).
+func CollectionCounter(collection string) Counter {
+	return func(tenantID string) (int64, error) {
+		ids := []interface{}{tenantID}
+		if oid, err := primitive.ObjectIDFromHex(tenantID); err == nil {
+			ids = append(ids, oid)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return database.GetCollection(collection).CountDocuments(ctx, bson.M{"tenant_id": bson.M{"$in": ids}})
+	}
+}
+
+// MongoTenantLoader lee los tenants (con sus quotas) de la colección tenants
+func MongoTenantLoader() TenantLoader {
+	return func(tenantID string) (*domain.Tenant, error) {
+		oid, err := primitive.ObjectIDFromHex(tenantID)
+		if err != nil {
+			return nil, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var tenant domain.Tenant
+		err = database.GetCollection("tenants").FindOne(ctx, bson.M{"_id": oid}).Decode(&tenant)
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &tenant, nil
+	}
+}
+
+// memoryUsageStore UsageStore en memoria (tests)
+type memoryUsageStore struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func newMemoryUsageStore() *memoryUsageStore {
+	return &memoryUsageStore{counters: make(map[string]int64)}
+}
+
+func (s *memoryUsageStore) Add(tenantID, resource string, windowStart time.Time, delta int64, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := counterID(tenantID, resource, windowStart)
+	s.counters[id] += delta
+	return s.counters[id], nil
+}
+
+func (s *memoryUsageStore) Get(tenantID, resource string, windowStart time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[counterID(tenantID, resource, windowStart)], nil
+}
@@ -0,0 +1,394 @@
+package recipes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"omniapi/internal/jsonpath"
+)
+
+// Record registro normalizado producido por una receta
+type Record map[string]interface{}
+
+// Output resultado de aplicar una receta a un payload
+type Output struct {
+	RecipeID   string    `json:"recipe_id"`
+	RecipeName string    `json:"recipe_name"`
+	StreamKind string    `json:"stream_kind"`
+	Provider   string    `json:"provider,omitempty"`
+	EndpointID string    `json:"endpoint_id,omitempty"`
+	InstanceID string    `json:"instance_id,omitempty"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	SiteID     string    `json:"site_id,omitempty"`
+	Records    []Record  `json:"records"`
+	Warnings   []string  `json:"warnings,omitempty"`
+	Partial    bool      `json:"partial,omitempty"` // Datos de origen incompletos (ej: polling truncado por límite de páginas)
+	ProducedAt time.Time `json:"produced_at"`
+}
+
+// DefaultStreamKind tipo de stream usado cuando la receta no define uno
+const DefaultStreamKind = "ops"
+
+// rootPrefix permite referenciar el payload completo desde un item iterado
+const rootPrefix = "$root."
+
+// Apply ejecuta una receta sobre un payload (ya decodificado desde JSON).
+// Si SourcePath apunta a un array, se genera un registro por elemento;
+// si apunta a un objeto, se genera un único registro.
+// Los errores por campo no abortan la ejecución: se acumulan como warnings.
+func Apply(recipe *Recipe, data interface{}, now time.Time) ([]Record, []string, error) {
+	if recipe == nil {
+		return nil, nil, fmt.Errorf("recipe is nil")
+	}
+
+	data = normalize(data)
+
+	source := jsonpath.Lookup(data, recipe.SourcePath)
+	if source == nil {
+		return nil, nil, fmt.Errorf("source_path %q not found in payload", recipe.SourcePath)
+	}
+
+	var items []interface{}
+	switch v := source.(type) {
+	case []interface{}:
+		items = v
+	default:
+		items = []interface{}{v}
+	}
+
+	records := make([]Record, 0, len(items))
+	var warnings []string
+
+	for i, item := range items {
+		record := Record{}
+
+		// Campos estáticos primero para que los mapeos puedan sobrescribirlos
+		for _, sf := range recipe.StaticFields {
+			if sf.Field == "" {
+				continue
+			}
+			setPath(record, sf.Field, expandStatic(sf.Value, now))
+		}
+
+		for _, m := range recipe.FieldMappings {
+			if m.From == "" || m.To == "" {
+				continue
+			}
+
+			var value interface{}
+			if strings.HasPrefix(m.From, rootPrefix) {
+				value = jsonpath.Lookup(data, strings.TrimPrefix(m.From, rootPrefix))
+			} else {
+				value = jsonpath.Lookup(item, m.From)
+			}
+			found := value != nil
+
+			if m.Transform != "" {
+				transformed, err := applyTransform(value, found, m.Transform, now)
+				if err != nil {
+					warnings = append(warnings, fmt.Sprintf("item %d: %s: %v", i, m.To, err))
+					continue
+				}
+				value, found = transformed, transformed != nil
+			}
+
+			if !found {
+				continue
+			}
+
+			coerced, err := coerce(value, m.Type)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("item %d: %s: %v", i, m.To, err))
+				continue
+			}
+			setPath(record, m.To, coerced)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, warnings, nil
+}
+
+// Run ejecuta la receta y arma el Output con los metadatos de la receta
+func Run(recipe *Recipe, data interface{}, now time.Time) (*Output, error) {
+	records, warnings, err := Apply(recipe, data, now)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := recipe.StreamKind
+	if kind == "" {
+		kind = DefaultStreamKind
+	}
+
+	return &Output{
+		RecipeID:   recipe.ID.Hex(),
+		RecipeName: recipe.Name,
+		StreamKind: kind,
+		Provider:   recipe.Provider,
+		EndpointID: recipe.EndpointID,
+		InstanceID: recipe.InstanceID,
+		Records:    records,
+		Warnings:   warnings,
+		ProducedAt: now,
+	}, nil
+}
+
+// setPath asigna un valor en un path con puntos creando objetos intermedios
+// (ej: "readings.oxygen")
+func setPath(record Record, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	current := map[string]interface{}(record)
+
+	for i, part := range parts {
+		if i == len(parts)-1 {
+			current[part] = value
+			return
+		}
+
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+}
+
+// expandStatic expande los valores especiales de los campos estáticos
+func expandStatic(value string, now time.Time) interface{} {
+	switch value {
+	case "$NOW":
+		return now.UTC().Format(time.RFC3339)
+	case "$NOW_UNIX":
+		return now.Unix()
+	case "$NOW_MS":
+		return now.UnixMilli()
+	}
+	return value
+}
+
+// coerce convierte un valor al tipo declarado en el mapeo
+func coerce(value interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "", "any":
+		return value, nil
+
+	case "string":
+		switch v := value.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		default:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		}
+
+	case "number":
+		return toNumber(value)
+
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			return v != 0, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, fmt.Errorf("cannot convert %q to boolean", v)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("cannot convert %T to boolean", value)
+
+	case "array":
+		if v, ok := value.([]interface{}); ok {
+			return v, nil
+		}
+		if value == nil {
+			return []interface{}{}, nil
+		}
+		return []interface{}{value}, nil
+
+	case "object":
+		if v, ok := value.(map[string]interface{}); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("cannot convert %T to object", value)
+	}
+
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// toNumber convierte strings y booleanos a float64
+func toNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("cannot convert %q to number", v)
+		}
+		return f, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to number", value)
+}
+
+// applyTransform ejecuta una cadena de transformaciones separadas por "|".
+// Operaciones soportadas:
+//
+//	upper, lower, trim, round[:n], abs, multiply:x, divide:x, add:x,
+//	default:x, unix_to_iso, unix_ms_to_iso, iso_to_unix
+func applyTransform(value interface{}, found bool, transform string, now time.Time) (interface{}, error) {
+	if !found {
+		value = nil
+	}
+
+	for _, step := range strings.Split(transform, "|") {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			continue
+		}
+
+		op, arg, _ := strings.Cut(step, ":")
+		op = strings.ToLower(strings.TrimSpace(op))
+		arg = strings.TrimSpace(arg)
+
+		if op == "default" {
+			if value == nil || value == "" {
+				value = expandStatic(arg, now)
+			}
+			continue
+		}
+
+		// El resto de operaciones no aplican sobre valores ausentes
+		if value == nil {
+			continue
+		}
+
+		switch op {
+		case "upper":
+			value = strings.ToUpper(fmt.Sprint(value))
+		case "lower":
+			value = strings.ToLower(fmt.Sprint(value))
+		case "trim":
+			value = strings.TrimSpace(fmt.Sprint(value))
+
+		case "round", "abs", "multiply", "divide", "add":
+			n, err := toNumber(value)
+			if err != nil {
+				return nil, err
+			}
+			value, err = numericTransform(op, arg, n)
+			if err != nil {
+				return nil, err
+			}
+
+		case "unix_to_iso", "unix_ms_to_iso":
+			n, err := toNumber(value)
+			if err != nil {
+				return nil, err
+			}
+			t := time.Unix(int64(n), 0)
+			if op == "unix_ms_to_iso" {
+				t = time.UnixMilli(int64(n))
+			}
+			value = t.UTC().Format(time.RFC3339)
+
+		case "iso_to_unix":
+			t, err := time.Parse(time.RFC3339, fmt.Sprint(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %v", value)
+			}
+			value = float64(t.Unix())
+
+		default:
+			return nil, fmt.Errorf("unknown transform %q", op)
+		}
+	}
+
+	return value, nil
+}
+
+// numericTransform aplica operaciones aritméticas con argumento opcional
+func numericTransform(op, arg string, n float64) (float64, error) {
+	var x float64
+	if arg != "" {
+		parsed, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid argument %q for %s", arg, op)
+		}
+		x = parsed
+	}
+
+	switch op {
+	case "round":
+		p := math.Pow(10, x)
+		return math.Round(n*p) / p, nil
+	case "abs":
+		return math.Abs(n), nil
+	case "multiply":
+		return n * x, nil
+	case "divide":
+		if x == 0 {
+			return 0, fmt.Errorf("divide by zero")
+		}
+		return n / x, nil
+	case "add":
+		return n + x, nil
+	}
+	return n, nil
+}
+
+// normalize convierte payloads tipados (structs, []byte, json.RawMessage)
+// a la representación genérica de encoding/json
+func normalize(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}, []interface{}, nil:
+		return v
+	case json.RawMessage:
+		var out interface{}
+		if err := json.Unmarshal(v, &out); err == nil {
+			return out
+		}
+		return string(v)
+	case []byte:
+		var out interface{}
+		if err := json.Unmarshal(v, &out); err == nil {
+			return out
+		}
+		return string(v)
+	case string, float64, bool:
+		return v
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return data
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package recipes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func decodePayload(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var data interface{}
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatalf("invalid test payload: %v", err)
+	}
+	return data
+}
+
+func TestApplyIteratesSourcePath(t *testing.T) {
+	data := decodePayload(t, `{
+		"site": "Farm 1",
+		"units": [
+			{"id": "u1", "sensor": {"oxygen": "7.456", "temp": 12}, "active": "true"},
+			{"id": "u2", "sensor": {"oxygen": 8, "temp": 13.5}, "active": false}
+		]
+	}`)
+
+	recipe := &Recipe{
+		Name:       "oxygen",
+		SourcePath: "units",
+		FieldMappings: []FieldMapping{
+			{From: "id", To: "unit_id", Type: "string", Transform: "upper"},
+			{From: "sensor.oxygen", To: "readings.oxygen", Type: "number", Transform: "round:1"},
+			{From: "sensor.temp", To: "readings.temp", Type: "number"},
+			{From: "active", To: "active", Type: "boolean"},
+			{From: "$root.site", To: "site", Type: "string"},
+		},
+		StaticFields: []StaticField{
+			{Field: "timestamp", Value: "$NOW"},
+			{Field: "source", Value: "scaleaq"},
+		},
+	}
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	records, warnings, err := Apply(recipe, data, now)
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	first := records[0]
+	if first["unit_id"] != "U1" {
+		t.Errorf("unexpected unit_id: %v", first["unit_id"])
+	}
+	if first["site"] != "Farm 1" {
+		t.Errorf("unexpected site: %v", first["site"])
+	}
+	if first["active"] != true {
+		t.Errorf("unexpected active: %v", first["active"])
+	}
+	if first["timestamp"] != "2025-01-02T03:04:05Z" {
+		t.Errorf("unexpected timestamp: %v", first["timestamp"])
+	}
+
+	readings, ok := first["readings"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected nested readings object, got %T", first["readings"])
+	}
+	if readings["oxygen"] != 7.5 {
+		t.Errorf("unexpected oxygen: %v", readings["oxygen"])
+	}
+	if readings["temp"] != float64(12) {
+		t.Errorf("unexpected temp: %v", readings["temp"])
+	}
+}
+
+func TestApplyObjectSourceProducesSingleRecord(t *testing.T) {
+	data := decodePayload(t, `{"summary":{"biomass_kg":"1200.5","fish":300}}`)
+
+	recipe := &Recipe{
+		SourcePath: "summary",
+		FieldMappings: []FieldMapping{
+			{From: "biomass_kg", To: "biomass_t", Type: "number", Transform: "divide:1000"},
+			{From: "fish", To: "count", Type: "string"},
+		},
+	}
+
+	records, _, err := Apply(recipe, data, time.Now())
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	if records[0]["biomass_t"] != 1.2005 {
+		t.Errorf("unexpected biomass_t: %v", records[0]["biomass_t"])
+	}
+	if records[0]["count"] != "300" {
+		t.Errorf("unexpected count: %v", records[0]["count"])
+	}
+}
+
+func TestApplyCollectsWarnings(t *testing.T) {
+	data := decodePayload(t, `[{"value":"n/a"},{"value":"4"}]`)
+
+	recipe := &Recipe{
+		FieldMappings: []FieldMapping{
+			{From: "value", To: "value", Type: "number"},
+			{From: "missing", To: "fallback", Type: "number", Transform: "default:0"},
+		},
+	}
+
+	records, warnings, err := Apply(recipe, data, time.Now())
+	if err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+	if _, ok := records[0]["value"]; ok {
+		t.Errorf("invalid value should be skipped")
+	}
+	if records[1]["value"] != float64(4) {
+		t.Errorf("unexpected value: %v", records[1]["value"])
+	}
+	if records[0]["fallback"] != float64(0) {
+		t.Errorf("unexpected fallback: %v", records[0]["fallback"])
+	}
+}
+
+func TestApplyMissingSourcePath(t *testing.T) {
+	recipe := &Recipe{SourcePath: "data.items"}
+	if _, _, err := Apply(recipe, map[string]interface{}{}, time.Now()); err == nil {
+		t.Fatalf("expected error for missing source_path")
+	}
+}
+
+func TestRunDefaultsStreamKind(t *testing.T) {
+	out, err := Run(&Recipe{Name: "r"}, json.RawMessage(`{"a":1}`), time.Now())
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if out.StreamKind != DefaultStreamKind {
+		t.Errorf("unexpected stream kind: %s", out.StreamKind)
+	}
+	if len(out.Records) != 1 {
+		t.Errorf("expected 1 record, got %d", len(out.Records))
+	}
+}
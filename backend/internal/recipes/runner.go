@@ -0,0 +1,111 @@
+package recipes
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// runnerCacheTTL tiempo que se mantienen en memoria las recetas de una instancia
+// para no consultar MongoDB en cada ciclo de polling
+const runnerCacheTTL = 30 * time.Second
+
+// Runner aplica las recetas almacenadas a los resultados de polling
+type Runner struct {
+	cache map[string]runnerCacheEntry // Key: instanceID|endpointID
+	mu    sync.RWMutex
+}
+
+type runnerCacheEntry struct {
+	recipes  []Recipe
+	loadedAt time.Time
+}
+
+var (
+	runnerInstance *Runner
+	runnerOnce     sync.Once
+)
+
+// GetRunner retorna la instancia singleton del Runner
+func GetRunner() *Runner {
+	runnerOnce.Do(func() {
+		runnerInstance = &Runner{
+			cache: make(map[string]runnerCacheEntry),
+		}
+	})
+	return runnerInstance
+}
+
+// Invalidate descarta las recetas cacheadas
+func (r *Runner) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]runnerCacheEntry)
+}
+
+// invalidateRunnerCache se llama desde el Store al crear/actualizar/eliminar recetas
+func invalidateRunnerCache() {
+	GetRunner().Invalidate()
+}
+
+// recipesFor retorna las recetas aplicables usando la cache
+func (r *Runner) recipesFor(instanceID, endpointID string) ([]Recipe, error) {
+	key := instanceID + "|" + endpointID
+
+	r.mu.RLock()
+	entry, ok := r.cache[key]
+	r.mu.RUnlock()
+
+	if ok && time.Since(entry.loadedAt) < runnerCacheTTL {
+		return entry.recipes, nil
+	}
+
+	recipes, err := GetStore().FindForResult(instanceID, endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = runnerCacheEntry{recipes: recipes, loadedAt: time.Now()}
+	r.mu.Unlock()
+
+	return recipes, nil
+}
+
+// Execute aplica todas las recetas habilitadas de una instancia/endpoint al payload.
+// Las recetas que fallan se loguean y se omiten para no afectar al resto.
+func (r *Runner) Execute(instanceID, endpointID, tenantID, siteID string, data interface{}) []Output {
+	recipes, err := r.recipesFor(instanceID, endpointID)
+	if err != nil {
+		fmt.Printf("⚠️  Error loading recipes for instance %s: %v\n", instanceID, err)
+		return nil
+	}
+	if len(recipes) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	outputs := make([]Output, 0, len(recipes))
+
+	for i := range recipes {
+		out, err := Run(&recipes[i], data, now)
+		if err != nil {
+			fmt.Printf("⚠️  Recipe '%s' failed on instance %s: %v\n", recipes[i].Name, instanceID, err)
+			continue
+		}
+
+		// Completar metadatos del resultado real (la receta puede ser genérica del endpoint)
+		out.InstanceID = instanceID
+		out.EndpointID = endpointID
+		out.TenantID = tenantID
+		out.SiteID = siteID
+
+		if len(out.Warnings) > 0 {
+			fmt.Printf("⚠️  Recipe '%s': %d warnings (first: %s)\n", out.RecipeName, len(out.Warnings), out.Warnings[0])
+		}
+
+		outputs = append(outputs, *out)
+	}
+
+	return outputs
+}
@@ -39,6 +39,7 @@ type Recipe struct {
 	SourcePath    string             `bson:"source_path,omitempty" json:"source_path,omitempty"` // Path al array de datos a iterar
 	FieldMappings []FieldMapping     `bson:"field_mappings" json:"field_mappings"`
 	StaticFields  []StaticField      `bson:"static_fields,omitempty" json:"static_fields,omitempty"`
+	StreamKind    string             `bson:"stream_kind,omitempty" json:"stream_kind,omitempty"` // Tipo de stream al emitir al router (feeding, biometric, climate, ops)
 	Enabled       bool               `bson:"enabled" json:"enabled"`
 	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
@@ -184,6 +185,41 @@ func (s *Store) GetByInstanceID(instanceID string) ([]Recipe, error) {
 	return recipes, nil
 }
 
+// FindForResult retorna las recetas habilitadas aplicables a un resultado de polling:
+// las asociadas a la instancia y las genéricas del endpoint (sin instance_id)
+func (s *Store) FindForResult(instanceID, endpointID string) ([]Recipe, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.collection == nil {
+		return []Recipe{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	or := bson.A{bson.M{"instance_id": instanceID}}
+	if endpointID != "" {
+		or = append(or, bson.M{
+			"endpoint_id": endpointID,
+			"instance_id": bson.M{"$in": bson.A{"", nil}},
+		})
+	}
+
+	cursor, err := s.collection.Find(ctx, bson.M{"enabled": true, "$or": or})
+	if err != nil {
+		return nil, fmt.Errorf("error finding recipes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var recipes []Recipe
+	if err := cursor.All(ctx, &recipes); err != nil {
+		return nil, fmt.Errorf("error decoding recipes: %w", err)
+	}
+
+	return recipes, nil
+}
+
 // Create crea una nueva receta
 func (s *Store) Create(recipe *Recipe) (*Recipe, error) {
 	s.mu.Lock()
@@ -206,6 +242,7 @@ func (s *Store) Create(recipe *Recipe) (*Recipe, error) {
 		return nil, fmt.Errorf("error creating recipe: %w", err)
 	}
 
+	invalidateRunnerCache()
 	fmt.Printf("📋 Recipe created: %s\n", recipe.Name)
 	return recipe, nil
 }
@@ -239,6 +276,7 @@ func (s *Store) Update(id string, recipe *Recipe) (*Recipe, error) {
 			"source_path":    recipe.SourcePath,
 			"field_mappings": recipe.FieldMappings,
 			"static_fields":  recipe.StaticFields,
+			"stream_kind":    recipe.StreamKind,
 			"enabled":        recipe.Enabled,
 			"updated_at":     recipe.UpdatedAt,
 		},
@@ -259,6 +297,7 @@ func (s *Store) Update(id string, recipe *Recipe) (*Recipe, error) {
 		return nil, fmt.Errorf("error updating recipe: %w", err)
 	}
 
+	invalidateRunnerCache()
 	fmt.Printf("📋 Recipe updated: %s\n", updated.Name)
 	return &updated, nil
 }
@@ -289,6 +328,7 @@ func (s *Store) Delete(id string) error {
 		return fmt.Errorf("recipe not found")
 	}
 
+	invalidateRunnerCache()
 	fmt.Printf("📋 Recipe deleted: %s\n", id)
 	return nil
 }
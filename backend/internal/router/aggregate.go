@@ -0,0 +1,623 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+)
+
+// Funciones de agregación
+const (
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateAvg   = "avg"
+	AggregateSum   = "sum"
+	AggregateCount = "count"
+)
+
+// Agrupaciones de una agregación
+const (
+	GroupByStream = "stream" // Cada stream (tenant, kind, farm, site, cage) por separado
+	GroupBySite   = "site"   // Todos los streams de un sitio (sin cage)
+	GroupByFarm   = "farm"   // Todos los streams de un farm (sin site ni cage)
+	GroupByTenant = "tenant" // Toda la flota del tenant
+)
+
+const (
+	// RollupSource Source del envelope de los eventos de agregación
+	RollupSource = "rollup"
+
+	// MaxRollupFields campos numéricos por agregación
+	MaxRollupFields = 10
+
+	// MaxRollupGroups grupos activos por agregación; los grupos nuevos por encima se ignoran
+	MaxRollupGroups = 1000
+
+	// MinRollupSlide paso mínimo de una ventana deslizante
+	MinRollupSlide = 10 * time.Second
+)
+
+// RollupWindows tamaños de ventana permitidos
+var RollupWindows = []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+
+// AggregateSpec define una agregación por ventanas sobre campos numéricos del payload.
+// Con Slide 0 (o igual a Window) las ventanas son fijas (tumbling); con Slide menor se
+// emite cada Slide la ventana de tamaño Window que termina en ese instante (sliding).
+type AggregateSpec struct {
+	Window    time.Duration `json:"window"`
+	Slide     time.Duration `json:"slide,omitempty"`
+	Fields    []string      `json:"fields"`              // Rutas del payload (mismas reglas que Where)
+	Functions []string      `json:"functions,omitempty"` // min, max, avg, sum, count (default: todas)
+	GroupBy   string        `json:"group_by,omitempty"`  // stream (default), site, farm, tenant
+}
+
+// ParseAggregateSpec construye y valida una agregación a partir de sus valores en texto
+// (ventanas como "5m" o "1h")
+func ParseAggregateSpec(window, slide string, fields, functions []string, groupBy string) (*AggregateSpec, error) {
+	spec := &AggregateSpec{
+		Fields:    fields,
+		Functions: functions,
+		GroupBy:   groupBy,
+	}
+
+	var err error
+	if spec.Window, err = time.ParseDuration(strings.TrimSpace(window)); err != nil {
+		return nil, fmt.Errorf("invalid window %q", window)
+	}
+	if strings.TrimSpace(slide) != "" {
+		if spec.Slide, err = time.ParseDuration(strings.TrimSpace(slide)); err != nil {
+			return nil, fmt.Errorf("invalid slide %q", slide)
+		}
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Validate verifica ventana, paso, campos, funciones y agrupación
+func (s *AggregateSpec) Validate() error {
+	allowed := false
+	for _, window := range RollupWindows {
+		if s.Window == window {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("window must be one of 1m, 5m, 1h")
+	}
+
+	if s.Slide != 0 && s.Slide != s.Window {
+		if s.Slide < MinRollupSlide || s.Slide > s.Window || s.Window%s.Slide != 0 {
+			return fmt.Errorf("slide must divide the window and be at least %s", MinRollupSlide)
+		}
+	}
+
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("at least one field is required")
+	}
+	if len(s.Fields) > MaxRollupFields {
+		return fmt.Errorf("at most %d fields are allowed", MaxRollupFields)
+	}
+	for _, field := range s.Fields {
+		if strings.TrimSpace(field) == "" {
+			return fmt.Errorf("empty field")
+		}
+	}
+
+	for _, function := range s.Functions {
+		switch function {
+		case AggregateMin, AggregateMax, AggregateAvg, AggregateSum, AggregateCount:
+		default:
+			return fmt.Errorf("unsupported function %q", function)
+		}
+	}
+
+	switch s.GroupBy {
+	case "", GroupByStream, GroupBySite, GroupByFarm, GroupByTenant:
+	default:
+		return fmt.Errorf("unsupported group_by %q", s.GroupBy)
+	}
+
+	return nil
+}
+
+// Key identidad canónica de la agregación (parte de SubscriptionFilter.Key)
+func (s *AggregateSpec) Key() string {
+	normalized := s.normalized()
+	fields := append([]string(nil), normalized.Fields...)
+	sort.Strings(fields)
+	functions := append([]string(nil), normalized.Functions...)
+	sort.Strings(functions)
+
+	return strings.Join([]string{
+		normalized.Window.String(),
+		normalized.Slide.String(),
+		strings.Join(fields, ","),
+		strings.Join(functions, ","),
+		normalized.GroupBy,
+	}, ";")
+}
+
+// normalized retorna la agregación con los valores por defecto aplicados
+func (s AggregateSpec) normalized() AggregateSpec {
+	if s.Slide == 0 {
+		s.Slide = s.Window
+	}
+	if len(s.Functions) == 0 {
+		s.Functions = []string{AggregateMin, AggregateMax, AggregateAvg, AggregateSum, AggregateCount}
+	}
+	if s.GroupBy == "" {
+		s.GroupBy = GroupByStream
+	}
+	fields := make([]string, len(s.Fields))
+	for i, field := range s.Fields {
+		fields[i] = strings.TrimSpace(field)
+	}
+	s.Fields = fields
+	return s
+}
+
+// IsRollup indica si un evento es el resultado de una agregación
+func IsRollup(event *connectors.CanonicalEvent) bool {
+	return event.Envelope.Source == RollupSource && event.Envelope.Flags&connectors.EventFlagSynthetic != 0
+}
+
+// ═══════════════════════════════════════════════════════════
+// Aggregator
+// ═══════════════════════════════════════════════════════════
+
+// Aggregator mantiene las agregaciones activas: las de suscripciones (alimentadas por el
+// router con los eventos ya autorizados) y las de salidas (con filtro propio, ej: broker MQTT)
+type Aggregator struct {
+	rollups map[string]*rollup
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+// rollup estado de una agregación
+type rollup struct {
+	id     string
+	spec   AggregateSpec
+	filter *SubscriptionFilter // Solo salidas: eventos que observa
+	emit   func(*connectors.CanonicalEvent)
+	groups map[string]*rollupGroup
+	fields [][]string // Rutas de Fields ya separadas
+
+	emitted int64 // Ventanas emitidas
+	late    int64 // Eventos de ventanas ya emitidas
+	dropped int64 // Eventos de grupos por encima de MaxRollupGroups
+}
+
+// rollupGroup buckets de un grupo (métrica + stream agrupado)
+type rollupGroup struct {
+	stream  domain.StreamKey
+	metric  string
+	buckets map[int64]*rollupBucket // key: inicio del bucket (Unix ns)
+	emitted time.Time               // Fin de la última ventana emitida
+}
+
+// rollupBucket acumulado de un paso (Slide) de la ventana
+type rollupBucket struct {
+	count   int64
+	streams map[string]bool
+	fields  map[string]*fieldStats
+}
+
+// fieldStats acumulado de un campo numérico
+type fieldStats struct {
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (fs *fieldStats) add(value float64) {
+	if fs.count == 0 || value < fs.min {
+		fs.min = value
+	}
+	if fs.count == 0 || value > fs.max {
+		fs.max = value
+	}
+	fs.count++
+	fs.sum += value
+}
+
+func (fs *fieldStats) merge(other *fieldStats) {
+	if other.count == 0 {
+		return
+	}
+	if fs.count == 0 || other.min < fs.min {
+		fs.min = other.min
+	}
+	if fs.count == 0 || other.max > fs.max {
+		fs.max = other.max
+	}
+	fs.count += other.count
+	fs.sum += other.sum
+}
+
+// NewAggregator crea un agregador vacío
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		rollups: make(map[string]*rollup),
+		now:     time.Now,
+	}
+}
+
+// Register agrega (o reemplaza) una agregación. Con filter nil solo recibe los eventos
+// pasados con Add; con filter, Observe le entrega los eventos que coinciden.
+func (a *Aggregator) Register(id string, spec AggregateSpec, filter *SubscriptionFilter, emit func(*connectors.CanonicalEvent)) error {
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	normalized := spec.normalized()
+	fields := make([][]string, len(normalized.Fields))
+	for i, field := range normalized.Fields {
+		fields[i] = strings.Split(field, ".")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.rollups[id] = &rollup{
+		id:     id,
+		spec:   normalized,
+		filter: filter,
+		emit:   emit,
+		groups: make(map[string]*rollupGroup),
+		fields: fields,
+	}
+	return nil
+}
+
+// Unregister elimina una agregación y descarta sus ventanas abiertas
+func (a *Aggregator) Unregister(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.rollups, id)
+}
+
+// Has indica si existe una agregación con ese ID
+func (a *Aggregator) Has(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, exists := a.rollups[id]
+	return exists
+}
+
+// Add acumula un evento DATA en la agregación indicada
+func (a *Aggregator) Add(id string, event *connectors.CanonicalEvent) {
+	doc, ok := decodeRollupPayload(event)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if r, exists := a.rollups[id]; exists {
+		r.add(event, doc)
+	}
+}
+
+// Observe acumula un evento DATA en las agregaciones de salida cuyo filtro coincide
+func (a *Aggregator) Observe(event *connectors.CanonicalEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var doc interface{}
+	decoded := false
+	for _, r := range a.rollups {
+		if r.filter == nil || !r.filter.Matches(event) {
+			continue
+		}
+		if !decoded {
+			var ok bool
+			if doc, ok = decodeRollupPayload(event); !ok {
+				return
+			}
+			decoded = true
+		}
+		r.add(event, doc)
+	}
+}
+
+// Flush emite las ventanas que terminaron. Los callbacks se llaman fuera del lock.
+func (a *Aggregator) Flush() {
+	a.flush(a.now())
+}
+
+func (a *Aggregator) flush(now time.Time) {
+	type pending struct {
+		emit  func(*connectors.CanonicalEvent)
+		event *connectors.CanonicalEvent
+	}
+	var out []pending
+
+	a.mu.Lock()
+	for _, r := range a.rollups {
+		for _, event := range r.flush(now) {
+			if r.emit != nil {
+				out = append(out, pending{emit: r.emit, event: event})
+			}
+		}
+	}
+	a.mu.Unlock()
+
+	for _, p := range out {
+		p.emit(p.event)
+	}
+}
+
+// GetStats retorna estadísticas del agregador
+func (a *Aggregator) GetStats() map[string]interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	groups := 0
+	var emitted, late, dropped int64
+	for _, r := range a.rollups {
+		groups += len(r.groups)
+		emitted += r.emitted
+		late += r.late
+		dropped += r.dropped
+	}
+
+	return map[string]interface{}{
+		"rollups":        len(a.rollups),
+		"groups":         groups,
+		"windows_sent":   emitted,
+		"events_late":    late,
+		"events_dropped": dropped,
+	}
+}
+
+// decodeRollupPayload decodifica el payload de un evento DATA
+func decodeRollupPayload(event *connectors.CanonicalEvent) (interface{}, bool) {
+	var doc interface{}
+	if err := json.Unmarshal(event.Payload, &doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// groupStream stream del grupo al que pertenece un evento según GroupBy
+func (r *rollup) groupStream(stream domain.StreamKey) domain.StreamKey {
+	switch r.spec.GroupBy {
+	case GroupBySite:
+		stream.CageID = nil
+	case GroupByFarm:
+		stream.SiteID = ""
+		stream.CageID = nil
+	case GroupByTenant:
+		stream.FarmID = ""
+		stream.SiteID = ""
+		stream.CageID = nil
+	}
+	return stream
+}
+
+// add acumula un evento en el bucket de su grupo. Requiere el lock del agregador.
+func (r *rollup) add(event *connectors.CanonicalEvent, doc interface{}) {
+	stream := r.groupStream(event.Envelope.Stream)
+	metric := event.Kind
+	key := metric + "|" + stream.String()
+
+	group, exists := r.groups[key]
+	if !exists {
+		if len(r.groups) >= MaxRollupGroups {
+			r.dropped++
+			return
+		}
+		group = &rollupGroup{
+			stream:  stream,
+			metric:  metric,
+			buckets: make(map[int64]*rollupBucket),
+		}
+		r.groups[key] = group
+	}
+
+	ts := event.Envelope.Timestamp
+	bucketStart := ts.Truncate(r.spec.Slide)
+
+	// Todas las ventanas que incluyen el bucket ya fueron emitidas
+	if !group.emitted.IsZero() && !bucketStart.Add(r.spec.Window).After(group.emitted) {
+		r.late++
+		return
+	}
+
+	bucket, exists := group.buckets[bucketStart.UnixNano()]
+	if !exists {
+		bucket = &rollupBucket{
+			streams: make(map[string]bool),
+			fields:  make(map[string]*fieldStats),
+		}
+		group.buckets[bucketStart.UnixNano()] = bucket
+	}
+
+	bucket.count++
+	bucket.streams[event.Envelope.Stream.String()] = true
+	for i, path := range r.fields {
+		for _, value := range lookupPayloadPath(doc, path) {
+			number, ok := numericValue(value)
+			if !ok {
+				continue
+			}
+			field := r.spec.Fields[i]
+			stats, exists := bucket.fields[field]
+			if !exists {
+				stats = &fieldStats{}
+				bucket.fields[field] = stats
+			}
+			stats.add(number)
+		}
+	}
+}
+
+// flush retorna los eventos de las ventanas terminadas hasta now y descarta los buckets
+// que ya no forman parte de ninguna ventana futura. Requiere el lock del agregador.
+func (r *rollup) flush(now time.Time) []*connectors.CanonicalEvent {
+	var events []*connectors.CanonicalEvent
+	slide := r.spec.Slide.Nanoseconds()
+	window := r.spec.Window.Nanoseconds()
+
+	for key, group := range r.groups {
+		for len(group.buckets) > 0 {
+			end := group.nextWindowEnd(slide)
+			if end > now.UnixNano() {
+				break
+			}
+
+			if event := r.windowEvent(group, end-window, end); event != nil {
+				events = append(events, event)
+				r.emitted++
+			}
+			group.emitted = time.Unix(0, end).UTC()
+
+			// Los buckets anteriores a la próxima ventana ya no se usan
+			for start := range group.buckets {
+				if start < end+slide-window {
+					delete(group.buckets, start)
+				}
+			}
+		}
+
+		// Un grupo vacío conserva su última ventana emitida durante otra ventana más para
+		// seguir detectando eventos atrasados
+		if len(group.buckets) == 0 && !group.emitted.Add(r.spec.Window).After(now) {
+			delete(r.groups, key)
+		}
+	}
+
+	return events
+}
+
+// nextWindowEnd fin de la próxima ventana con datos: la siguiente a la emitida o, si hubo
+// un hueco sin eventos, la primera que incluye el bucket más antiguo
+func (g *rollupGroup) nextWindowEnd(slide int64) int64 {
+	oldest := int64(math.MaxInt64)
+	for start := range g.buckets {
+		if start < oldest {
+			oldest = start
+		}
+	}
+
+	end := oldest + slide
+	if !g.emitted.IsZero() && g.emitted.UnixNano()+slide > end {
+		end = g.emitted.UnixNano() + slide
+	}
+	return end
+}
+
+// windowEvent construye el evento de la ventana [from, to) o nil si no tuvo eventos
+func (r *rollup) windowEvent(group *rollupGroup, from, to int64) *connectors.CanonicalEvent {
+	var count int64
+	streams := make(map[string]bool)
+	totals := make(map[string]*fieldStats)
+
+	for start, bucket := range group.buckets {
+		if start < from || start >= to {
+			continue
+		}
+		count += bucket.count
+		for stream := range bucket.streams {
+			streams[stream] = true
+		}
+		for field, stats := range bucket.fields {
+			total, exists := totals[field]
+			if !exists {
+				total = &fieldStats{}
+				totals[field] = total
+			}
+			total.merge(stats)
+		}
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	fields := make(map[string]map[string]interface{}, len(totals))
+	for field, stats := range totals {
+		values := make(map[string]interface{}, len(r.spec.Functions))
+		for _, function := range r.spec.Functions {
+			switch function {
+			case AggregateMin:
+				values[function] = stats.min
+			case AggregateMax:
+				values[function] = stats.max
+			case AggregateAvg:
+				values[function] = stats.sum / float64(stats.count)
+			case AggregateSum:
+				values[function] = stats.sum
+			case AggregateCount:
+				values[function] = stats.count
+			}
+		}
+		fields[field] = values
+	}
+
+	start := time.Unix(0, from).UTC()
+	end := time.Unix(0, to).UTC()
+	payload := map[string]interface{}{
+		"metric": group.metric,
+		"rollup": map[string]interface{}{
+			"window":    r.spec.Window.String(),
+			"slide":     r.spec.Slide.String(),
+			"group_by":  r.spec.GroupBy,
+			"functions": r.spec.Functions,
+			"start":     start,
+			"end":       end,
+		},
+		"count":   count,
+		"streams": len(streams),
+		"fields":  fields,
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+
+	return &connectors.CanonicalEvent{
+		Envelope: connectors.Envelope{
+			Version:   "1.0",
+			Timestamp: end,
+			Stream:    group.stream,
+			Source:    RollupSource,
+			Flags:     connectors.EventFlagSynthetic,
+		},
+		Payload:       payloadBytes,
+		Kind:          group.metric,
+		SchemaVersion: "1.0",
+	}
+}
+
+// numericValue convierte un valor del payload a número (acepta strings numéricos)
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return 0, false
+		}
+		return parsed, true
+	}
+	return 0, false
+}
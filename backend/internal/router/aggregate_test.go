@@ -0,0 +1,236 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newRollupEvent(tenantID primitive.ObjectID, site string, cage *string, ts time.Time, payload string) *connectors.CanonicalEvent {
+	return &connectors.CanonicalEvent{
+		Envelope: connectors.Envelope{
+			Version:   "1.0",
+			Timestamp: ts,
+			Stream: domain.StreamKey{
+				TenantID: tenantID,
+				Kind:     domain.StreamKindClimate,
+				FarmID:   "farm-1",
+				SiteID:   site,
+				CageID:   cage,
+			},
+			Source: "test-source",
+		},
+		Payload: json.RawMessage(payload),
+		Kind:    "climate.oxygen",
+	}
+}
+
+func decodeRollup(t *testing.T, event *connectors.CanonicalEvent) map[string]interface{} {
+	t.Helper()
+	var payload map[string]interface{}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		t.Fatalf("invalid rollup payload: %v", err)
+	}
+	return payload
+}
+
+func TestAggregateSpec_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  string
+		slide   string
+		fields  []string
+		funcs   []string
+		groupBy string
+		valid   bool
+	}{
+		{"tumbling", "5m", "", []string{"oxygen_mg_l"}, nil, "", true},
+		{"sliding", "1h", "5m", []string{"oxygen_mg_l"}, []string{"avg", "max"}, "site", true},
+		{"window not allowed", "2m", "", []string{"oxygen_mg_l"}, nil, "", false},
+		{"slide does not divide", "5m", "2m", []string{"oxygen_mg_l"}, nil, "", false},
+		{"slide too small", "1m", "1s", []string{"oxygen_mg_l"}, nil, "", false},
+		{"no fields", "1m", "", nil, nil, "", false},
+		{"unknown function", "1m", "", []string{"oxygen_mg_l"}, []string{"median"}, "", false},
+		{"unknown group", "1m", "", []string{"oxygen_mg_l"}, nil, "cage", false},
+		{"invalid duration", "five", "", []string{"oxygen_mg_l"}, nil, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAggregateSpec(tt.window, tt.slide, tt.fields, tt.funcs, tt.groupBy)
+			if (err == nil) != tt.valid {
+				t.Errorf("ParseAggregateSpec() error = %v, valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAggregator_TumblingWindowGroupedBySite(t *testing.T) {
+	aggregator := NewAggregator()
+	tenantID := primitive.NewObjectID()
+	start := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	var emitted []*connectors.CanonicalEvent
+	spec := AggregateSpec{Window: time.Minute, Fields: []string{"oxygen_mg_l"}, GroupBy: GroupBySite}
+	if err := aggregator.Register("rollup-1", spec, nil, func(event *connectors.CanonicalEvent) {
+		emitted = append(emitted, event)
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	cageA, cageB := "cage-A", "cage-B"
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-1", &cageA, start.Add(10*time.Second), `{"oxygen_mg_l": 6}`))
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-1", &cageB, start.Add(20*time.Second), `{"data": {"oxygen_mg_l": "9"}}`))
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-1", &cageA, start.Add(30*time.Second), `{"records": [{"oxygen_mg_l": 3}, {"oxygen_mg_l": 6}]}`))
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-2", &cageA, start.Add(40*time.Second), `{"oxygen_mg_l": 1}`))
+
+	// La ventana sigue abierta
+	aggregator.flush(start.Add(59 * time.Second))
+	if len(emitted) != 0 {
+		t.Fatalf("expected no rollups before the window ends, got %d", len(emitted))
+	}
+
+	aggregator.flush(start.Add(time.Minute))
+	if len(emitted) != 2 {
+		t.Fatalf("expected one rollup per site, got %d", len(emitted))
+	}
+
+	var site1 *connectors.CanonicalEvent
+	for _, event := range emitted {
+		if event.Envelope.Stream.SiteID == "site-1" {
+			site1 = event
+		}
+	}
+	if site1 == nil {
+		t.Fatal("missing rollup of site-1")
+	}
+	if !IsRollup(site1) || site1.Envelope.Stream.CageID != nil || site1.Kind != "climate.oxygen" || !site1.Envelope.Timestamp.Equal(start.Add(time.Minute)) {
+		t.Errorf("unexpected rollup envelope: %+v kind=%s", site1.Envelope, site1.Kind)
+	}
+
+	payload := decodeRollup(t, site1)
+	if payload["count"] != 3.0 || payload["streams"] != 2.0 {
+		t.Errorf("expected 3 events from 2 streams, got %v / %v", payload["count"], payload["streams"])
+	}
+	oxygen := payload["fields"].(map[string]interface{})["oxygen_mg_l"].(map[string]interface{})
+	if oxygen["min"] != 3.0 || oxygen["max"] != 9.0 || oxygen["sum"] != 24.0 || oxygen["avg"] != 6.0 || oxygen["count"] != 4.0 {
+		t.Errorf("unexpected oxygen aggregates: %v", oxygen)
+	}
+
+	// Un evento de una ventana ya emitida se descarta
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-1", &cageA, start.Add(50*time.Second), `{"oxygen_mg_l": 100}`))
+	aggregator.flush(start.Add(3 * time.Minute))
+	if len(emitted) != 2 {
+		t.Errorf("expected late event to be ignored, got %d rollups", len(emitted))
+	}
+	if stats := aggregator.GetStats(); stats["events_late"] != int64(1) || stats["groups"] != 0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
+
+func TestAggregator_SlidingWindow(t *testing.T) {
+	aggregator := NewAggregator()
+	tenantID := primitive.NewObjectID()
+	start := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	var counts []float64
+	spec := AggregateSpec{Window: 5 * time.Minute, Slide: time.Minute, Fields: []string{"oxygen_mg_l"}, Functions: []string{AggregateSum}}
+	aggregator.Register("rollup-1", spec, nil, func(event *connectors.CanonicalEvent) {
+		counts = append(counts, decodeRollup(t, event)["count"].(float64))
+	})
+
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-1", nil, start.Add(30*time.Second), `{"oxygen_mg_l": 1}`))
+	aggregator.Add("rollup-1", newRollupEvent(tenantID, "site-1", nil, start.Add(150*time.Second), `{"oxygen_mg_l": 3}`))
+
+	// Ventanas que terminan a las 10:01, 10:02 y 10:03
+	aggregator.flush(start.Add(3 * time.Minute))
+	// Siguen 10:04 y 10:05 (ambos eventos), 10:06 y 10:07 (solo el segundo)
+	aggregator.flush(start.Add(10 * time.Minute))
+
+	want := []float64{1, 1, 2, 2, 2, 1, 1}
+	if len(counts) != len(want) {
+		t.Fatalf("expected %d windows, got %v", len(want), counts)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("window %d: expected count %v, got %v", i, want[i], counts[i])
+		}
+	}
+}
+
+func TestRouter_AggregateSubscriptionAndOutput(t *testing.T) {
+	router := NewRouter()
+	tenantID := primitive.NewObjectID()
+	capabilities := []domain.Capability{domain.CapabilityClimateRead}
+
+	err := router.RegisterClient("client-1", tenantID, capabilities, []domain.Scope{{
+		TenantID:    tenantID,
+		Resource:    "site:1",
+		Permissions: capabilities,
+		SiteIDs:     []string{"site-1"},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+
+	var sent []*connectors.CanonicalEvent
+	router.SetEventCallback(func(clientID string, event *connectors.CanonicalEvent) error {
+		sent = append(sent, event)
+		return nil
+	})
+
+	climate := domain.StreamKindClimate
+	spec := &AggregateSpec{Window: time.Minute, Fields: []string{"oxygen_mg_l"}, GroupBy: GroupBySite}
+	sub, err := router.Subscribe("client-1", SubscriptionFilter{TenantID: &tenantID, Kind: &climate, Aggregate: spec})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// La misma suscripción sin agregación es otra suscripción
+	raw := SubscriptionFilter{TenantID: &tenantID, Kind: &climate}
+	if raw.Key() == sub.Filter.Key() {
+		t.Error("aggregate and raw filters should have different keys")
+	}
+
+	var published []*connectors.CanonicalEvent
+	if err := router.AddRollup("output-1", SubscriptionFilter{TenantID: &tenantID}, AggregateSpec{Window: time.Minute, Fields: []string{"oxygen_mg_l"}, GroupBy: GroupByTenant}, func(event *connectors.CanonicalEvent) {
+		published = append(published, event)
+	}); err != nil {
+		t.Fatalf("AddRollup failed: %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		router.processEvent(newRollupEvent(tenantID, "site-1", nil, now, `{"oxygen_mg_l": 5}`))
+	}
+	if len(sent) != 0 {
+		t.Fatalf("aggregate subscription should not receive raw events, got %d", len(sent))
+	}
+
+	router.aggregator.flush(now.Add(2 * time.Minute))
+	if len(sent) != 1 || !IsRollup(sent[0]) {
+		t.Fatalf("expected one rollup for the subscriber, got %d", len(sent))
+	}
+	if payload := decodeRollup(t, sent[0]); payload["count"] != 3.0 {
+		t.Errorf("expected 3 aggregated events, got %v", payload["count"])
+	}
+	if len(published) != 1 || published[0].Envelope.Stream.SiteID != "" {
+		t.Errorf("expected one tenant-wide rollup for the output, got %d", len(published))
+	}
+	if stats := router.GetStats(); stats.EventsRollupOut != 1 {
+		t.Errorf("expected 1 rollup sent, got %d", stats.EventsRollupOut)
+	}
+
+	// Al cancelar la suscripción se descartan sus ventanas abiertas
+	router.processEvent(newRollupEvent(tenantID, "site-1", nil, now.Add(3*time.Minute), `{"oxygen_mg_l": 5}`))
+	router.Unsubscribe(sub.ID)
+	router.aggregator.flush(now.Add(10 * time.Minute))
+	if len(sent) != 1 {
+		t.Errorf("expected no rollups after unsubscribe, got %d", len(sent))
+	}
+}
@@ -0,0 +1,429 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"omniapi/internal/domain"
+	"omniapi/internal/queue/requester"
+	"omniapi/internal/queue/status"
+
+	"github.com/google/uuid"
+)
+
+// pendingRequestTTL tiempo máximo que se espera el resultado de una solicitud despachada
+const pendingRequestTTL = 10 * time.Minute
+
+// connectorEndpoint requester registrado bajo el ID de un ConnectorConfig
+type connectorEndpoint struct {
+	id        string
+	siteID    string // Vacío = atiende cualquier site
+	source    requester.Source
+	requester requester.Requester
+}
+
+// pendingRequest solicitud despachada a la espera de resultados
+type pendingRequest struct {
+	request   requester.Request
+	policy    MultiConnectorPolicy
+	tried     map[string]bool
+	order     []string // Conectores en orden de prioridad (merge)
+	results   map[string]requester.Result
+	expected  int
+	createdAt time.Time
+}
+
+// FailoverCoordinator despacha solicitudes al conector (cloud o ProcessAPI) que indica la
+// política multi-conector del tenant y kind, sincroniza CircuitOpen con los circuit breakers
+// reales, cambia al siguiente conector ante fallos y combina resultados bajo PolicyMerge.
+type FailoverCoordinator struct {
+	resolver  *Resolver
+	tracker   *status.StreamTracker
+	endpoints map[string]*connectorEndpoint // key: connector ID
+	pending   map[string]*pendingRequest    // key: RequestID
+	active    map[string]requester.Source   // key: "tenantID:kind" -> fuente activa
+	onResult  func(requester.Result)
+	mu        sync.Mutex
+}
+
+// NewFailoverCoordinator crea un coordinador sobre el Router. Los resultados finales se entregan
+// a Router.OnRequesterResult; tracker (opcional) recibe los KPIs por fuente.
+func NewFailoverCoordinator(r *Router, tracker *status.StreamTracker) *FailoverCoordinator {
+	return &FailoverCoordinator{
+		resolver:  r.resolver,
+		tracker:   tracker,
+		endpoints: make(map[string]*connectorEndpoint),
+		pending:   make(map[string]*pendingRequest),
+		active:    make(map[string]requester.Source),
+		onResult:  r.OnRequesterResult,
+	}
+}
+
+// OnResult reemplaza el destino de los resultados finales
+func (fc *FailoverCoordinator) OnResult(callback func(requester.Result)) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.onResult = callback
+}
+
+// Register asocia un requester a un conector. siteID vacío atiende cualquier site.
+// Los resultados del requester deben entregarse a HandleResult con el mismo connectorID.
+func (fc *FailoverCoordinator) Register(connectorID, siteID string, source requester.Source, req requester.Requester) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.endpoints[connectorID] = &connectorEndpoint{
+		id:        connectorID,
+		siteID:    siteID,
+		source:    source,
+		requester: req,
+	}
+}
+
+// Dispatch encola la solicitud en el conector seleccionado según la política del tenant y kind.
+// Retorna el RequestID asignado.
+func (fc *FailoverCoordinator) Dispatch(req requester.Request) (string, error) {
+	if req.RequestID == "" {
+		req.RequestID = uuid.New().String()
+	}
+	kind := metricKind(req.Metric)
+
+	fc.syncCircuits()
+
+	policy, connectors, err := fc.resolver.ActiveConnectors(req.TenantID, kind)
+	if err != nil {
+		return "", err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	fc.expirePendingLocked(time.Now())
+
+	candidates := fc.candidatesLocked(connectors, req.SiteID)
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no active connectors available for tenant %s, kind %s, site %s", req.TenantID, kind, req.SiteID)
+	}
+
+	pending := &pendingRequest{
+		request:   req,
+		policy:    policy,
+		tried:     make(map[string]bool),
+		results:   make(map[string]requester.Result),
+		createdAt: time.Now(),
+	}
+
+	switch policy {
+	case PolicyMerge:
+		var lastErr error
+		for _, endpoint := range candidates {
+			if err := fc.enqueueLocked(endpoint, req); err != nil {
+				lastErr = err
+				continue
+			}
+			pending.order = append(pending.order, endpoint.id)
+			pending.expected++
+		}
+		if pending.expected == 0 {
+			return "", lastErr
+		}
+		fc.active[activeKey(req.TenantID, kind)] = requester.SourceDerived
+
+	case PolicyRoundRobin:
+		start := int(fc.resolver.nextRoundRobin(req.TenantID, kind) % uint64(len(candidates)))
+		candidates = append(candidates[start:], candidates[:start]...)
+		fallthrough
+
+	default:
+		// Priority solo usa el primero; Fallback y RoundRobin prueban los siguientes
+		if policy == PolicyPriority {
+			candidates = candidates[:1]
+		}
+		var lastErr error
+		for _, endpoint := range candidates {
+			pending.tried[endpoint.id] = true
+			if err := fc.enqueueLocked(endpoint, req); err != nil {
+				lastErr = err
+				continue
+			}
+			pending.expected = 1
+			fc.active[activeKey(req.TenantID, kind)] = endpoint.source
+			break
+		}
+		if pending.expected == 0 {
+			return "", lastErr
+		}
+	}
+
+	fc.pending[req.RequestID] = pending
+	return req.RequestID, nil
+}
+
+// HandleResult procesa el resultado de un requester registrado
+func (fc *FailoverCoordinator) HandleResult(connectorID string, result requester.Result) {
+	fc.syncCircuits()
+
+	fc.mu.Lock()
+	endpoint := fc.endpoints[connectorID]
+	if endpoint != nil {
+		fc.trackLocked(endpoint, result)
+	}
+
+	pending, ok := fc.pending[result.RequestID]
+	if !ok || result.RequestID == "" {
+		callback := fc.onResult
+		fc.mu.Unlock()
+		fc.emit(callback, result)
+		return
+	}
+
+	pending.results[connectorID] = result
+	final, done := fc.resolveLocked(pending, connectorID, result)
+	if done {
+		delete(fc.pending, result.RequestID)
+	}
+	callback := fc.onResult
+	fc.mu.Unlock()
+
+	if done {
+		fc.emit(callback, final)
+	}
+}
+
+// ActiveSource retorna la fuente activa de un tenant y métrica (ej: "feeding" o "feeding.appetite")
+func (fc *FailoverCoordinator) ActiveSource(tenantID, metric string) (string, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	source, ok := fc.active[activeKey(tenantID, metricKind(metric))]
+	return string(source), ok
+}
+
+// GetStats retorna el estado del coordinador
+func (fc *FailoverCoordinator) GetStats() map[string]interface{} {
+	fc.syncCircuits()
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	active := make(map[string]string, len(fc.active))
+	for key, source := range fc.active {
+		active[key] = string(source)
+	}
+
+	connectors := make([]map[string]interface{}, 0, len(fc.endpoints))
+	for _, endpoint := range fc.endpoints {
+		metrics := endpoint.requester.GetMetrics()
+		connectors = append(connectors, map[string]interface{}{
+			"id":           endpoint.id,
+			"site_id":      endpoint.siteID,
+			"source":       endpoint.source,
+			"state":        metrics.State,
+			"circuit_open": metrics.CircuitOpen,
+			"queue_length": metrics.QueueLength,
+		})
+	}
+
+	return map[string]interface{}{
+		"active_sources":   active,
+		"connectors":       connectors,
+		"pending_requests": len(fc.pending),
+		"policies":         fc.resolver.ListMultiConnectorConfigs(),
+	}
+}
+
+// syncCircuits copia el estado real de los circuit breakers a ConnectorConfig.CircuitOpen
+func (fc *FailoverCoordinator) syncCircuits() {
+	fc.mu.Lock()
+	states := make(map[string]bool, len(fc.endpoints))
+	for id, endpoint := range fc.endpoints {
+		states[id] = endpoint.requester.GetMetrics().CircuitOpen
+	}
+	fc.mu.Unlock()
+
+	for id, open := range states {
+		if fc.resolver.SetConnectorCircuit(id, open) {
+			if open {
+				fmt.Printf("⚡ Circuit breaker abierto en conector %s, usando el siguiente disponible\n", id)
+			} else {
+				fmt.Printf("✅ Circuit breaker cerrado en conector %s\n", id)
+			}
+		}
+	}
+}
+
+// candidatesLocked filtra los conectores activos que tienen requester para el site
+func (fc *FailoverCoordinator) candidatesLocked(connectors []ConnectorConfig, siteID string) []*connectorEndpoint {
+	var candidates []*connectorEndpoint
+	for _, conn := range connectors {
+		endpoint, ok := fc.endpoints[conn.ID]
+		if !ok {
+			continue
+		}
+		if endpoint.siteID != "" && endpoint.siteID != siteID {
+			continue
+		}
+		candidates = append(candidates, endpoint)
+	}
+	return candidates
+}
+
+// enqueueLocked encola la solicitud con la fuente del conector
+func (fc *FailoverCoordinator) enqueueLocked(endpoint *connectorEndpoint, req requester.Request) error {
+	req.Source = endpoint.source
+	if err := endpoint.requester.Enqueue(req); err != nil {
+		return fmt.Errorf("connector %s: %w", endpoint.id, err)
+	}
+	return nil
+}
+
+// resolveLocked decide si la solicitud terminó y cuál es el resultado final
+func (fc *FailoverCoordinator) resolveLocked(pending *pendingRequest, connectorID string, result requester.Result) (requester.Result, bool) {
+	switch pending.policy {
+	case PolicyMerge:
+		if len(pending.results) < pending.expected {
+			return requester.Result{}, false
+		}
+		return mergeResults(pending), true
+
+	case PolicyFallback, PolicyRoundRobin:
+		if result.IsSuccess() || !requester.CountsAsFailure(result.Err) {
+			return result, true
+		}
+
+		// Fallo del upstream: probar el siguiente conector no intentado
+		kind := metricKind(pending.request.Metric)
+		_, connectors, err := fc.resolver.ActiveConnectors(pending.request.TenantID, kind)
+		if err == nil {
+			for _, endpoint := range fc.candidatesLocked(connectors, pending.request.SiteID) {
+				if pending.tried[endpoint.id] {
+					continue
+				}
+				pending.tried[endpoint.id] = true
+				if fc.enqueueLocked(endpoint, pending.request) == nil {
+					fmt.Printf("🔀 Failover %s → %s (%s)\n", connectorID, endpoint.id, pending.request.Metric)
+					fc.active[activeKey(pending.request.TenantID, kind)] = endpoint.source
+					return requester.Result{}, false
+				}
+			}
+		}
+		return result, true
+
+	default:
+		return result, true
+	}
+}
+
+// trackLocked actualiza los KPIs del stream por fuente
+func (fc *FailoverCoordinator) trackLocked(endpoint *connectorEndpoint, result requester.Result) {
+	if fc.tracker == nil || result.TenantID == "" {
+		return
+	}
+
+	key := status.StreamKey{
+		TenantID: result.TenantID,
+		SiteID:   result.SiteID,
+		CageID:   result.CageID,
+		Metric:   string(metricKind(result.Metric)),
+		Source:   string(endpoint.source),
+	}
+
+	if result.IsSuccess() {
+		fc.tracker.UpdateSuccess(key, result.LatencyMS)
+		if result.Partial {
+			fc.tracker.SetNotes(key, result.Warning)
+		}
+	} else {
+		fc.tracker.UpdateError(key, result.ErrorMsg)
+	}
+	fc.tracker.SetCircuitBreaker(key, endpoint.requester.GetMetrics().CircuitOpen)
+}
+
+// expirePendingLocked descarta solicitudes sin respuesta; los merge emiten lo que tengan
+func (fc *FailoverCoordinator) expirePendingLocked(now time.Time) {
+	for id, pending := range fc.pending {
+		if now.Sub(pending.createdAt) < pendingRequestTTL {
+			continue
+		}
+		delete(fc.pending, id)
+		if pending.policy == PolicyMerge && len(pending.results) > 0 {
+			fc.emit(fc.onResult, mergeResults(pending))
+		}
+	}
+}
+
+func (fc *FailoverCoordinator) emit(callback func(requester.Result), result requester.Result) {
+	if callback != nil {
+		go callback(result)
+	}
+}
+
+// mergeResults combina los resultados exitosos de un merge en orden de prioridad
+func mergeResults(pending *pendingRequest) requester.Result {
+	var (
+		base     *requester.Result
+		payloads []requester.TimeSeriesPayload
+		failed   []string
+		partial  bool
+	)
+
+	for _, id := range pending.order {
+		result, ok := pending.results[id]
+		if !ok {
+			failed = append(failed, id+": sin respuesta")
+			continue
+		}
+		if !result.IsSuccess() {
+			failed = append(failed, id+": "+result.ErrorMsg)
+			continue
+		}
+		if base == nil {
+			r := result
+			base = &r
+		}
+		partial = partial || result.Partial
+
+		var payload requester.TimeSeriesPayload
+		if err := json.Unmarshal(result.Payload, &payload); err == nil && payload.Records != nil {
+			payloads = append(payloads, payload)
+		}
+	}
+
+	// Todos fallaron: entregar el primer error
+	if base == nil {
+		for _, id := range pending.order {
+			if result, ok := pending.results[id]; ok {
+				return result
+			}
+		}
+		return requester.Result{RequestID: pending.request.RequestID, Err: requester.ErrUpstreamUnavailable}
+	}
+
+	merged := *base
+	merged.Source = requester.SourceDerived
+	merged.Partial = partial || len(failed) > 0
+	if len(failed) > 0 {
+		merged.Warning = strings.Join(failed, "; ")
+	}
+
+	if len(payloads) > 0 {
+		if raw, err := json.Marshal(requester.MergeTimeSeries(payloads...)); err == nil {
+			merged.Payload = raw
+		}
+	}
+
+	return merged
+}
+
+// metricKind extrae el kind de una métrica ("feeding.appetite" -> "feeding")
+func metricKind(metric string) domain.StreamKind {
+	kind, _, _ := strings.Cut(metric, ".")
+	return domain.StreamKind(kind)
+}
+
+func activeKey(tenantID string, kind domain.StreamKind) string {
+	return tenantID + ":" + string(kind)
+}
@@ -0,0 +1,191 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"omniapi/internal/domain"
+	"omniapi/internal/queue/requester"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeRequester registra las solicitudes encoladas sin procesarlas
+type fakeRequester struct {
+	mu          sync.Mutex
+	enqueued    []requester.Request
+	circuitOpen bool
+}
+
+func (f *fakeRequester) Enqueue(req requester.Request) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.enqueued = append(f.enqueued, req)
+	return nil
+}
+
+func (f *fakeRequester) Len() int                                 { return len(f.enqueued) }
+func (f *fakeRequester) Start(ctx context.Context) error          { return nil }
+func (f *fakeRequester) Stop() error                              { return nil }
+func (f *fakeRequester) OnResult(callback func(requester.Result)) {}
+func (f *fakeRequester) GetState() requester.State                { return requester.StateRunning }
+
+func (f *fakeRequester) GetMetrics() requester.Metrics {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return requester.Metrics{CircuitOpen: f.circuitOpen}
+}
+
+func (f *fakeRequester) last() requester.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enqueued[len(f.enqueued)-1]
+}
+
+func (f *fakeRequester) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.enqueued)
+}
+
+func newFailoverFixture(t *testing.T, policy MultiConnectorPolicy) (*FailoverCoordinator, *fakeRequester, *fakeRequester, chan requester.Result, string) {
+	r := NewRouter()
+	tenantID := primitive.NewObjectID()
+
+	err := r.SetMultiConnectorPolicy(&MultiConnectorConfig{
+		TenantID: tenantID,
+		Kind:     domain.StreamKindFeeding,
+		Policy:   policy,
+		Connectors: []ConnectorConfig{
+			{ID: "cloud", Type: "scaleaq-cloud", Priority: 100, Enabled: true},
+			{ID: "local", Type: "process-api", Priority: 50, Enabled: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetMultiConnectorPolicy failed: %v", err)
+	}
+
+	cloud, local := &fakeRequester{}, &fakeRequester{}
+	coordinator := NewFailoverCoordinator(r, nil)
+	coordinator.Register("cloud", "site-1", requester.SourceCloud, cloud)
+	coordinator.Register("local", "site-1", requester.SourceProcessAPI, local)
+
+	results := make(chan requester.Result, 4)
+	coordinator.OnResult(func(result requester.Result) { results <- result })
+
+	return coordinator, cloud, local, results, tenantID.Hex()
+}
+
+func feedingRequest(tenantID string) requester.Request {
+	now := time.Now()
+	return requester.Request{
+		TenantID:  tenantID,
+		SiteID:    "site-1",
+		Metric:    "feeding.appetite",
+		TimeRange: requester.TimeRange{From: now.Add(-time.Hour), To: now},
+	}
+}
+
+func waitResult(t *testing.T, results chan requester.Result) requester.Result {
+	select {
+	case result := <-results:
+		return result
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for final result")
+		return requester.Result{}
+	}
+}
+
+func TestFailover_FallbackOnFailure(t *testing.T) {
+	coordinator, cloud, local, results, tenantID := newFailoverFixture(t, PolicyFallback)
+
+	requestID, err := coordinator.Dispatch(feedingRequest(tenantID))
+	if err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if cloud.count() != 1 || local.count() != 0 || cloud.last().Source != requester.SourceCloud {
+		t.Fatalf("Expected request on cloud connector first")
+	}
+
+	// La nube falla: se re-despacha a la ProcessAPI
+	coordinator.HandleResult("cloud", requester.Result{RequestID: requestID, Err: requester.ErrUpstreamUnavailable})
+	if local.count() != 1 || local.last().Source != requester.SourceProcessAPI {
+		t.Fatalf("Expected failover to local connector")
+	}
+	if source, _ := coordinator.ActiveSource(tenantID, "feeding.appetite"); source != "processapi" {
+		t.Errorf("Expected active source processapi, got %q", source)
+	}
+
+	coordinator.HandleResult("local", requester.Result{RequestID: requestID, Source: requester.SourceProcessAPI})
+	if result := waitResult(t, results); !result.IsSuccess() || result.Source != requester.SourceProcessAPI {
+		t.Errorf("Expected successful local result, got %+v", result)
+	}
+}
+
+func TestFailover_SkipsOpenCircuit(t *testing.T) {
+	coordinator, cloud, local, _, tenantID := newFailoverFixture(t, PolicyFallback)
+	cloud.circuitOpen = true
+
+	if _, err := coordinator.Dispatch(feedingRequest(tenantID)); err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if cloud.count() != 0 || local.count() != 1 {
+		t.Fatalf("Expected request on local connector while cloud circuit is open")
+	}
+
+	// Al cerrarse el breaker la nube vuelve a ser la fuente activa
+	cloud.circuitOpen = false
+	coordinator.Dispatch(feedingRequest(tenantID))
+	if cloud.count() != 1 {
+		t.Errorf("Expected cloud connector after circuit closed")
+	}
+	if source, _ := coordinator.ActiveSource(tenantID, "feeding"); source != "cloud" {
+		t.Errorf("Expected active source cloud, got %q", source)
+	}
+}
+
+func TestFailover_MergeDeduplicates(t *testing.T) {
+	coordinator, cloud, local, results, tenantID := newFailoverFixture(t, PolicyMerge)
+
+	requestID, err := coordinator.Dispatch(feedingRequest(tenantID))
+	if err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if cloud.count() != 1 || local.count() != 1 {
+		t.Fatalf("Expected request on both connectors")
+	}
+
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	payload := func(source string, records ...map[string]interface{}) json.RawMessage {
+		raw, _ := json.Marshal(requester.TimeSeriesPayload{Kind: "feeding", Source: source, Records: records, Count: len(records)})
+		return raw
+	}
+
+	coordinator.HandleResult("local", requester.Result{RequestID: requestID, Payload: payload("processapi",
+		map[string]interface{}{"timestamp": ts, "cage_id": "cage-1", "appetite": 0.5},
+		map[string]interface{}{"timestamp": ts.Add(time.Minute), "cage_id": "cage-1", "appetite": 0.6},
+	)})
+	coordinator.HandleResult("cloud", requester.Result{RequestID: requestID, Payload: payload("scaleaq-cloud",
+		map[string]interface{}{"timestamp": ts, "cage_id": "cage-1", "appetite": 0.9},
+	)})
+
+	result := waitResult(t, results)
+	if result.Source != requester.SourceDerived {
+		t.Errorf("Expected derived source, got %s", result.Source)
+	}
+
+	var merged requester.TimeSeriesPayload
+	json.Unmarshal(result.Payload, &merged)
+	if merged.Count != 2 {
+		t.Fatalf("Expected 2 deduplicated records, got %d", merged.Count)
+	}
+	if merged.Records[0]["appetite"] != 0.9 {
+		t.Errorf("Expected cloud value to win on overlap, got %v", merged.Records[0]["appetite"])
+	}
+	if source, _ := coordinator.ActiveSource(tenantID, "feeding"); source != "derived" {
+		t.Errorf("Expected active source derived, got %q", source)
+	}
+}
@@ -349,6 +349,99 @@ func TestSubscriptionIndex_FindMatching_Specificity(t *testing.T) {
 	}
 }
 
+func TestSubscriptionFilter_MatchesMetricTagsCapabilitiesAndWhere(t *testing.T) {
+	tenantID := primitive.NewObjectID()
+	siteID := "site-001"
+
+	newEvent := func(kind domain.StreamKind, metric string, payload string) *connectors.CanonicalEvent {
+		event := createTestEvent(tenantID, kind, "farm-001", siteID, nil)
+		event.Kind = metric
+		event.Payload = json.RawMessage(payload)
+		return event
+	}
+
+	appetite := newEvent(domain.StreamKindFeeding, "feeding.appetite", `{"metric":"feeding.appetite","tags":{"pen":"north"},"data":{"appetite":0.8}}`)
+	pellets := newEvent(domain.StreamKindFeeding, "feeding.pellets", `{"metric":"feeding.pellets","data":{"kg":12}}`)
+	lowOxygen := newEvent(domain.StreamKindClimate, "climate.oxygen", `{"metric":"climate.oxygen","records":[{"oxygen_mg_l":7.1},{"oxygen_mg_l":5.4}]}`)
+	okOxygen := newEvent(domain.StreamKindClimate, "climate.oxygen", `{"metric":"climate.oxygen","records":[{"oxygen_mg_l":8.2}]}`)
+	status := newEvent("status", "status.climate.oxygen", `{"metric":"climate.oxygen","state":"ok"}`)
+
+	tests := []struct {
+		name     string
+		filter   SubscriptionFilter
+		event    *connectors.CanonicalEvent
+		expected bool
+	}{
+		{"exact metric", SubscriptionFilter{Metrics: []string{"feeding.appetite"}}, appetite, true},
+		{"other metric", SubscriptionFilter{Metrics: []string{"feeding.appetite"}}, pellets, false},
+		{"metric prefix", SubscriptionFilter{Metrics: []string{"feeding.*"}}, pellets, true},
+		{"metric prefix other kind", SubscriptionFilter{Metrics: []string{"feeding.*"}}, okOxygen, false},
+		{"status uses metric without prefix", SubscriptionFilter{Metrics: []string{"climate.oxygen"}}, status, true},
+		{"capability", SubscriptionFilter{Capabilities: []domain.Capability{domain.CapabilityClimateRead}}, okOxygen, true},
+		{"missing capability", SubscriptionFilter{Capabilities: []domain.Capability{domain.CapabilityClimateRead}}, appetite, false},
+		{"status capability from metric", SubscriptionFilter{Capabilities: []domain.Capability{domain.CapabilityClimateRead}}, status, true},
+		{"tag from payload.tags", SubscriptionFilter{Tags: map[string]string{"pen": "north"}}, appetite, true},
+		{"tag from payload root", SubscriptionFilter{Tags: map[string]string{"metric": "feeding.pellets"}}, pellets, true},
+		{"tag mismatch", SubscriptionFilter{Tags: map[string]string{"pen": "south"}}, appetite, false},
+		{"missing tag", SubscriptionFilter{Tags: map[string]string{"pen": "north"}}, pellets, false},
+		{"where on records (any)", SubscriptionFilter{Where: "oxygen_mg_l < 6"}, lowOxygen, true},
+		{"where not satisfied", SubscriptionFilter{Where: "oxygen_mg_l < 6"}, okOxygen, false},
+		{"where on data", SubscriptionFilter{Where: "kg >= 10 and metric == 'feeding.pellets'"}, pellets, true},
+		{"where missing field", SubscriptionFilter{Where: "oxygen_mg_l < 6"}, pellets, false},
+		{"where does not filter STATUS", SubscriptionFilter{Where: "oxygen_mg_l < 6"}, status, true},
+		{"invalid where never matches", SubscriptionFilter{Where: "oxygen_mg_l <"}, lowOxygen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.filter.Matches(tt.event); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSubscriptionIndex_FindMatching_ByMetric(t *testing.T) {
+	index := NewSubscriptionIndex()
+	tenantID := primitive.NewObjectID()
+
+	exact := &Subscription{ID: "sub-exact", ClientID: "c1", Filter: SubscriptionFilter{Metrics: []string{"climate.oxygen"}}}
+	prefix := &Subscription{ID: "sub-prefix", ClientID: "c2", Filter: SubscriptionFilter{Metrics: []string{"climate.*"}}}
+	other := &Subscription{ID: "sub-other", ClientID: "c3", Filter: SubscriptionFilter{Metrics: []string{"climate.temperature"}}}
+	index.Add(exact)
+	index.Add(prefix)
+	index.Add(other)
+
+	event := createTestEvent(tenantID, domain.StreamKindClimate, "farm-001", "site-001", nil)
+	event.Kind = "climate.oxygen"
+
+	matched := make(map[string]bool)
+	for _, sub := range index.FindMatching(event) {
+		matched[sub.ID] = true
+	}
+	if len(matched) != 2 || !matched["sub-exact"] || !matched["sub-prefix"] {
+		t.Errorf("Expected sub-exact and sub-prefix, got %v", matched)
+	}
+
+	index.Remove("sub-exact")
+	if subs := index.FindMatching(event); len(subs) != 1 || subs[0].ID != "sub-prefix" {
+		t.Errorf("Expected only sub-prefix after removal, got %d subscriptions", len(subs))
+	}
+}
+
+func TestSubscriptionFilter_KeyIncludesMetricsAndWhere(t *testing.T) {
+	a := SubscriptionFilter{Metrics: []string{"climate.oxygen", "climate.temperature"}, Where: "oxygen_mg_l < 6"}
+	b := SubscriptionFilter{Metrics: []string{"climate.temperature", "climate.oxygen"}, Where: " oxygen_mg_l < 6 "}
+	c := SubscriptionFilter{Metrics: []string{"climate.oxygen", "climate.temperature"}, Where: "oxygen_mg_l < 5"}
+
+	if a.Key() != b.Key() {
+		t.Errorf("Expected equal keys, got %q and %q", a.Key(), b.Key())
+	}
+	if a.Key() == c.Key() {
+		t.Error("Expected different where to produce a different key")
+	}
+}
+
 // Funciones helper para crear eventos de prueba
 
 func createTestEvent(tenantID primitive.ObjectID, kind domain.StreamKind, farmID, siteID string, cageID *string) *connectors.CanonicalEvent {
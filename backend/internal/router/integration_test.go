@@ -11,6 +11,7 @@ import (
 	"omniapi/internal/domain"
 	"omniapi/internal/queue/requester"
 	"omniapi/internal/queue/status"
+	"omniapi/internal/recipes"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -437,3 +438,47 @@ func TestRouter_DataVsStatus_Segregation(t *testing.T) {
 
 	t.Logf("Data events received: %d, Status events received: %d", dataEvents, statusEvents)
 }
+
+func TestRouter_RecipeOutput_DropsInvalidTenant(t *testing.T) {
+	router := NewRouter()
+
+	var receivedEvents []*connectors.CanonicalEvent
+	router.SetEventCallback(func(clientID string, event *connectors.CanonicalEvent) error {
+		receivedEvents = append(receivedEvents, event)
+		return nil
+	})
+
+	ctx := context.Background()
+	router.Start(ctx)
+	defer router.Stop()
+
+	out := recipes.Output{
+		RecipeName: "oxygen",
+		StreamKind: "ops",
+		TenantID:   "not-an-object-id",
+		SiteID:     "site-A",
+		Records:    []recipes.Record{{"unit_id": "u1"}},
+		ProducedAt: time.Now(),
+	}
+	router.OnRecipeOutput(out)
+
+	time.Sleep(100 * time.Millisecond)
+
+	stats := router.GetStats()
+	if stats.EventsDataOut != 0 || stats.EventsRouted != 0 {
+		t.Errorf("Expected no events routed for invalid tenant, got data_out=%d routed=%d", stats.EventsDataOut, stats.EventsRouted)
+	}
+	if stats.EventsDropped != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", stats.EventsDropped)
+	}
+	if len(receivedEvents) != 0 {
+		t.Errorf("Expected no deliveries, got %d", len(receivedEvents))
+	}
+
+	out.TenantID = primitive.NewObjectID().Hex()
+	router.OnRecipeOutput(out)
+
+	if stats := router.GetStats(); stats.EventsDataOut != 1 {
+		t.Errorf("Expected 1 DATA event out for a valid tenant, got %d", stats.EventsDataOut)
+	}
+}
@@ -0,0 +1,81 @@
+package router
+
+import (
+	"sync"
+
+	"omniapi/internal/connectors"
+)
+
+// LastValueCache mantiene el último evento DATA y STATUS conocido por stream y métrica.
+// Se usa para entregar un snapshot inmediato a los clientes que se suscriben.
+type LastValueCache struct {
+	data   map[string]*connectors.CanonicalEvent // key: streamKey|event.Kind
+	status map[string]*connectors.CanonicalEvent // key: streamKey|event.Kind
+	mu     sync.RWMutex
+}
+
+// NewLastValueCache crea un cache vacío
+func NewLastValueCache() *LastValueCache {
+	return &LastValueCache{
+		data:   make(map[string]*connectors.CanonicalEvent),
+		status: make(map[string]*connectors.CanonicalEvent),
+	}
+}
+
+// PutData guarda un evento DATA si es más reciente que el conocido
+func (c *LastValueCache) PutData(event *connectors.CanonicalEvent) {
+	c.put(c.data, event)
+}
+
+// PutStatus guarda un evento STATUS si es más reciente que el conocido
+func (c *LastValueCache) PutStatus(event *connectors.CanonicalEvent) {
+	c.put(c.status, event)
+}
+
+func (c *LastValueCache) put(target map[string]*connectors.CanonicalEvent, event *connectors.CanonicalEvent) {
+	key := lastValueKey(event)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// No reemplazar con eventos tardíos
+	if current, ok := target[key]; ok && event.Envelope.Timestamp.Before(current.Envelope.Timestamp) {
+		return
+	}
+	target[key] = event
+}
+
+// Match retorna los últimos eventos que coinciden con el filtro (DATA y, opcionalmente, STATUS)
+func (c *LastValueCache) Match(filter SubscriptionFilter, includeStatus bool) []*connectors.CanonicalEvent {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var events []*connectors.CanonicalEvent
+	for _, event := range c.data {
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+
+	if includeStatus {
+		for _, event := range c.status {
+			if filter.Matches(event) {
+				events = append(events, event)
+			}
+		}
+	}
+
+	return events
+}
+
+// Len retorna la cantidad de eventos DATA y STATUS cacheados
+func (c *LastValueCache) Len() (data int, status int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.data), len(c.status)
+}
+
+// lastValueKey identifica stream + métrica de un evento
+func lastValueKey(event *connectors.CanonicalEvent) string {
+	return event.Envelope.Stream.String() + "|" + event.Kind
+}
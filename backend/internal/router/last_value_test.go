@@ -0,0 +1,82 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newCachedEvent(tenantID primitive.ObjectID, kind domain.StreamKind, site, eventKind string, ts time.Time) *connectors.CanonicalEvent {
+	return &connectors.CanonicalEvent{
+		Envelope: connectors.Envelope{
+			Timestamp: ts,
+			Stream:    domain.StreamKey{TenantID: tenantID, Kind: kind, SiteID: site},
+		},
+		Kind: eventKind,
+	}
+}
+
+func TestLastValueCache_KeepsNewest(t *testing.T) {
+	cache := NewLastValueCache()
+	tenantID := primitive.NewObjectID()
+	now := time.Now()
+
+	newer := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now)
+	older := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now.Add(-time.Minute))
+
+	cache.PutData(newer)
+	cache.PutData(older)
+
+	events := cache.Match(SubscriptionFilter{TenantID: &tenantID}, false)
+	if len(events) != 1 || events[0] != newer {
+		t.Fatalf("expected only the newest event, got %d events", len(events))
+	}
+}
+
+func TestRouter_Snapshot(t *testing.T) {
+	router := NewRouter()
+	tenantID := primitive.NewObjectID()
+	now := time.Now()
+
+	router.RegisterClient("client-1", tenantID, []domain.Capability{domain.CapabilityFeedingRead}, []domain.Scope{{
+		TenantID:    tenantID,
+		Resource:    "site:A",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+		SiteIDs:     []string{"site-A"},
+	}}, nil)
+
+	router.lastValues.PutData(newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now))
+	router.lastValues.PutData(newCachedEvent(tenantID, domain.StreamKindFeeding, "site-B", "feeding.appetite", now))
+	router.lastValues.PutData(newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", now))
+	router.lastValues.PutStatus(newCachedEvent(tenantID, "status", "site-A", "status.feeding.appetite", now))
+
+	// Sin kind en el filtro: site-B y climate quedan fuera por permisos
+	events := router.Snapshot("client-1", SubscriptionFilter{TenantID: &tenantID}, false)
+	if len(events) != 1 || events[0].Envelope.Stream.SiteID != "site-A" || events[0].Kind != "feeding.appetite" {
+		t.Fatalf("unexpected snapshot: %+v", events)
+	}
+	if events[0].Envelope.Flags&connectors.EventFlagSnapshot == 0 {
+		t.Fatal("snapshot events must be flagged")
+	}
+
+	// El cache no debe quedar marcado
+	cached := router.lastValues.Match(SubscriptionFilter{TenantID: &tenantID}, false)
+	for _, event := range cached {
+		if event.Envelope.Flags&connectors.EventFlagSnapshot != 0 {
+			t.Fatal("cached event was mutated")
+		}
+	}
+
+	withStatus := router.Snapshot("client-1", SubscriptionFilter{TenantID: &tenantID}, true)
+	if len(withStatus) != 2 {
+		t.Fatalf("expected DATA + STATUS snapshot, got %d events", len(withStatus))
+	}
+
+	if events := router.Snapshot("unknown", SubscriptionFilter{TenantID: &tenantID}, true); len(events) != 0 {
+		t.Fatalf("unknown client must not receive snapshot, got %d", len(events))
+	}
+}
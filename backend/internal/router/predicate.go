@@ -0,0 +1,464 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxPredicateLength largo máximo de una expresión de filtro
+const MaxPredicateLength = 512
+
+// Predicate expresión compilada sobre los campos del payload de un evento, p. ej.
+// "oxygen_mg_l < 6", "temperature > 14 and cage_id == 'cage-1'", "not (status == 'error')".
+//
+// Gramática:
+//
+//	expr       := and { ("or" | "||") and }
+//	and        := unary { ("and" | "&&") unary }
+//	unary      := ("not" | "!") unary | "(" expr ")" | comparison
+//	comparison := field op literal        op: < <= > >= == = !=
+//	literal    := número | 'texto' | "texto" | true | false
+//
+// Los campos son rutas con puntos (data.oxygen_mg_l). Si la ruta no existe en la raíz del
+// payload se busca dentro de "data" y "records". Los arrays se recorren: la comparación se
+// cumple si algún elemento la cumple. Un campo inexistente nunca cumple la comparación.
+type Predicate struct {
+	source string
+	root   predicateNode
+}
+
+// ParsePredicate compila una expresión de filtro
+func ParsePredicate(expr string) (*Predicate, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("empty predicate")
+	}
+	if len(expr) > MaxPredicateLength {
+		return nil, fmt.Errorf("predicate too long (max %d characters)", MaxPredicateLength)
+	}
+
+	tokens, err := tokenizePredicate(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &predicateParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+
+	return &Predicate{source: expr, root: root}, nil
+}
+
+// String retorna la expresión original
+func (p *Predicate) String() string {
+	return p.source
+}
+
+// Eval evalúa el predicado contra un payload JSON
+func (p *Predicate) Eval(payload json.RawMessage) bool {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return false
+	}
+	return p.root.eval(doc)
+}
+
+// EvalValue evalúa el predicado contra un payload ya decodificado
+func (p *Predicate) EvalValue(doc interface{}) bool {
+	return p.root.eval(doc)
+}
+
+// ═══════════════════════════════════════════════════════════
+// Árbol de evaluación
+// ═══════════════════════════════════════════════════════════
+
+type predicateNode interface {
+	eval(doc interface{}) bool
+}
+
+type predicateOr struct{ left, right predicateNode }
+
+func (n predicateOr) eval(doc interface{}) bool { return n.left.eval(doc) || n.right.eval(doc) }
+
+type predicateAnd struct{ left, right predicateNode }
+
+func (n predicateAnd) eval(doc interface{}) bool { return n.left.eval(doc) && n.right.eval(doc) }
+
+type predicateNot struct{ inner predicateNode }
+
+func (n predicateNot) eval(doc interface{}) bool { return !n.inner.eval(doc) }
+
+type predicateComparison struct {
+	path  []string
+	op    string
+	value interface{} // float64 | string | bool
+}
+
+func (n predicateComparison) eval(doc interface{}) bool {
+	for _, value := range lookupPayloadPath(doc, n.path) {
+		if compareValues(value, n.op, n.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPayloadPath resuelve una ruta en el payload, con fallback a "data" y "records"
+func lookupPayloadPath(doc interface{}, path []string) []interface{} {
+	values := collectPath(doc, path, nil)
+	if len(values) > 0 {
+		return values
+	}
+
+	if root, ok := doc.(map[string]interface{}); ok {
+		for _, wrapper := range []string{"data", "records"} {
+			if nested, exists := root[wrapper]; exists {
+				values = collectPath(nested, path, values)
+			}
+		}
+	}
+	return values
+}
+
+func collectPath(value interface{}, path []string, out []interface{}) []interface{} {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			out = collectPath(item, path, out)
+		}
+		return out
+	}
+
+	if len(path) == 0 {
+		if value != nil {
+			out = append(out, value)
+		}
+		return out
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return out
+	}
+	child, exists := object[path[0]]
+	if !exists {
+		return out
+	}
+	return collectPath(child, path[1:], out)
+}
+
+func compareValues(actual interface{}, op string, expected interface{}) bool {
+	switch want := expected.(type) {
+	case float64:
+		var got float64
+		switch v := actual.(type) {
+		case float64:
+			got = v
+		case string:
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return false
+			}
+			got = parsed
+		default:
+			return false
+		}
+		switch op {
+		case "<":
+			return got < want
+		case "<=":
+			return got <= want
+		case ">":
+			return got > want
+		case ">=":
+			return got >= want
+		case "==":
+			return got == want
+		case "!=":
+			return got != want
+		}
+
+	case string:
+		got, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "<":
+			return got < want
+		case "<=":
+			return got <= want
+		case ">":
+			return got > want
+		case ">=":
+			return got >= want
+		case "==":
+			return got == want
+		case "!=":
+			return got != want
+		}
+
+	case bool:
+		got, ok := actual.(bool)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return got == want
+		case "!=":
+			return got != want
+		}
+	}
+	return false
+}
+
+// ═══════════════════════════════════════════════════════════
+// Tokenizer y parser
+// ═══════════════════════════════════════════════════════════
+
+type predicateTokenKind int
+
+const (
+	tokenField predicateTokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type predicateToken struct {
+	kind predicateTokenKind
+	text string
+	pos  int
+}
+
+func tokenizePredicate(expr string) ([]predicateToken, error) {
+	var tokens []predicateToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			tokens = append(tokens, predicateToken{kind: tokenLParen, text: "(", pos: i})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, predicateToken{kind: tokenRParen, text: ")", pos: i})
+			i++
+
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, predicateToken{kind: tokenString, text: string(runes[i+1 : end]), pos: i})
+			i = end + 1
+
+		case strings.ContainsRune("<>=!&|", r):
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch two {
+			case "<=", ">=", "==", "!=":
+				tokens = append(tokens, predicateToken{kind: tokenOperator, text: two, pos: i})
+				i += 2
+			case "&&":
+				tokens = append(tokens, predicateToken{kind: tokenAnd, text: two, pos: i})
+				i += 2
+			case "||":
+				tokens = append(tokens, predicateToken{kind: tokenOr, text: two, pos: i})
+				i += 2
+			default:
+				switch r {
+				case '<', '>':
+					tokens = append(tokens, predicateToken{kind: tokenOperator, text: string(r), pos: i})
+				case '=':
+					tokens = append(tokens, predicateToken{kind: tokenOperator, text: "==", pos: i})
+				case '!':
+					tokens = append(tokens, predicateToken{kind: tokenNot, text: "!", pos: i})
+				default:
+					return nil, fmt.Errorf("unexpected %q at position %d", string(r), i)
+				}
+				i++
+			}
+
+		case unicode.IsDigit(r) || ((r == '-' || r == '.') && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || strings.ContainsRune(".eE+-", runes[end])) {
+				// Un signo solo es parte del número si sigue a un exponente
+				if (runes[end] == '+' || runes[end] == '-') && runes[end-1] != 'e' && runes[end-1] != 'E' {
+					break
+				}
+				end++
+			}
+			tokens = append(tokens, predicateToken{kind: tokenNumber, text: string(runes[i:end]), pos: i})
+			i = end
+
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			word := string(runes[i:end])
+			switch strings.ToLower(word) {
+			case "and":
+				tokens = append(tokens, predicateToken{kind: tokenAnd, text: word, pos: i})
+			case "or":
+				tokens = append(tokens, predicateToken{kind: tokenOr, text: word, pos: i})
+			case "not":
+				tokens = append(tokens, predicateToken{kind: tokenNot, text: word, pos: i})
+			default:
+				tokens = append(tokens, predicateToken{kind: tokenField, text: word, pos: i})
+			}
+			i = end
+
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", string(r), i)
+		}
+	}
+
+	return tokens, nil
+}
+
+type predicateParser struct {
+	tokens []predicateToken
+	pos    int
+}
+
+func (p *predicateParser) peek() (predicateToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return predicateToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *predicateParser) parseOr() (predicateNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenOr {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = predicateOr{left: left, right: right}
+	}
+}
+
+func (p *predicateParser) parseAnd() (predicateNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokenAnd {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = predicateAnd{left: left, right: right}
+	}
+}
+
+func (p *predicateParser) parseUnary() (predicateNode, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of predicate")
+	}
+
+	switch tok.kind {
+	case tokenNot:
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return predicateNot{inner: inner}, nil
+
+	case tokenLParen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing, ok := p.peek()
+		if !ok || closing.kind != tokenRParen {
+			return nil, fmt.Errorf("missing ')' for '(' at position %d", tok.pos)
+		}
+		p.pos++
+		return inner, nil
+
+	case tokenField:
+		return p.parseComparison()
+	}
+
+	return nil, fmt.Errorf("expected field at position %d, got %q", tok.pos, tok.text)
+}
+
+func (p *predicateParser) parseComparison() (predicateNode, error) {
+	field := p.tokens[p.pos]
+	p.pos++
+
+	op, ok := p.peek()
+	if !ok || op.kind != tokenOperator {
+		return nil, fmt.Errorf("expected comparison operator after %q", field.text)
+	}
+	p.pos++
+
+	lit, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expected value after %q", field.text+" "+op.text)
+	}
+	p.pos++
+
+	var value interface{}
+	switch {
+	case lit.kind == tokenNumber:
+		number, err := strconv.ParseFloat(lit.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", lit.text, lit.pos)
+		}
+		value = number
+	case lit.kind == tokenString:
+		value = lit.text
+	case lit.kind == tokenField && (lit.text == "true" || lit.text == "false"):
+		if op.text != "==" && op.text != "!=" {
+			return nil, fmt.Errorf("operator %s not supported for booleans", op.text)
+		}
+		value = lit.text == "true"
+	default:
+		return nil, fmt.Errorf("expected number, string or boolean at position %d, got %q", lit.pos, lit.text)
+	}
+
+	return predicateComparison{path: strings.Split(field.text, "."), op: op.text, value: value}, nil
+}
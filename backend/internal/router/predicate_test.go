@@ -0,0 +1,73 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePredicate_Eval(t *testing.T) {
+	payload := json.RawMessage(`{
+		"metric": "climate.oxygen",
+		"status": "success",
+		"partial": false,
+		"data": {"site": {"temperature": 14.5}, "oxygen_mg_l": "5.8"},
+		"records": [{"cage": "cage-1", "oxygen_mg_l": 7.2}, {"cage": "cage-2", "oxygen_mg_l": 5.1}]
+	}`)
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{"oxygen_mg_l < 6", true},       // data.oxygen_mg_l (texto numérico) y records[1]
+		{"oxygen_mg_l > 8", false},      // ningún valor cumple
+		{"site.temperature > 14", true}, // ruta con puntos dentro de data
+		{"data.site.temperature <= 14", false},
+		{"temperature > 14", false}, // sin la ruta completa no se encuentra
+		{"metric == 'climate.oxygen'", true},
+		{`metric = "climate.oxygen"`, true},
+		{"metric != 'climate.oxygen'", false},
+		{"status == 'success' and partial == false", true},
+		{"status == 'error' or cage == 'cage-2'", true},
+		{"status == 'error' || cage == 'cage-3'", false},
+		{"not (status == 'error')", true},
+		{"!(oxygen_mg_l < 6) && metric == 'climate.oxygen'", false}, // not niega "algún valor cumple"
+		{"!(oxygen_mg_l > 8) && metric == 'climate.oxygen'", true},
+		{"missing < 1", false},
+		{"not missing < 1", true},
+		{"oxygen_mg_l >= -1.5e1", true},
+		{"status == 'success' and (cage == 'cage-9' or oxygen_mg_l < 5.2)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			predicate, err := ParsePredicate(tt.expr)
+			if err != nil {
+				t.Fatalf("ParsePredicate(%q) failed: %v", tt.expr, err)
+			}
+			if got := predicate.Eval(payload); got != tt.expected {
+				t.Errorf("Eval(%q) = %v, want %v", tt.expr, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParsePredicate_Errors(t *testing.T) {
+	invalid := []string{
+		"",
+		"oxygen_mg_l",
+		"oxygen_mg_l <",
+		"oxygen_mg_l < 6 and",
+		"(oxygen_mg_l < 6",
+		"oxygen_mg_l < 6)",
+		"6 < oxygen_mg_l",
+		"status == 'open",
+		"partial > true",
+		"oxygen_mg_l ~ 6",
+	}
+
+	for _, expr := range invalid {
+		if _, err := ParsePredicate(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+)
+
+// MaxResumeAge antigüedad máxima que se busca en el histórico al reanudar un stream
+const MaxResumeAge = 7 * 24 * time.Hour
+
+// ReplayQuery filtros y rango de un replay. Un evento se re-emite si coincide con algún filtro.
+type ReplayQuery struct {
+	Filters []SubscriptionFilter `json:"filters"`
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+
+	// Resume: solo eventos del stream exacto con secuencia en (AfterSeq, UpToSeq]
+	Stream   *domain.StreamKey `json:"stream,omitempty"`
+	AfterSeq uint64            `json:"after_seq,omitempty"`
+	UpToSeq  uint64            `json:"up_to_seq,omitempty"` // 0 = sin límite
+}
+
+// matches verifica si el evento coincide con algún filtro y con el rango de secuencia
+func (q *ReplayQuery) matches(event *connectors.CanonicalEvent) bool {
+	if q.Stream != nil && event.Envelope.Stream.String() != q.Stream.String() {
+		return false
+	}
+	if q.AfterSeq > 0 && event.Envelope.Sequence <= q.AfterSeq {
+		return false
+	}
+	if q.UpToSeq > 0 && event.Envelope.Sequence > q.UpToSeq {
+		return false
+	}
+
+	for i := range q.Filters {
+		if q.Filters[i].Matches(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplaySource lee los eventos históricos del rango en orden cronológico y llama fn por cada uno.
+// main.go lo implementa sobre history.Store.Replay.
+type ReplaySource func(ctx context.Context, q ReplayQuery, fn func(*connectors.CanonicalEvent) error) (int, error)
+
+// ReplayResult resumen de un replay
+type ReplayResult struct {
+	Read      int `json:"read"`      // Eventos leídos del histórico o de memoria
+	Delivered int `json:"delivered"` // Eventos entregados al cliente
+	Skipped   int `json:"skipped"`   // Fuera del filtro o de los permisos del cliente
+	Failed    int `json:"failed"`    // Errores de envío
+}
+
+// SetReplaySource configura la fuente histórica de los replays
+func (r *Router) SetReplaySource(source ReplaySource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replaySource = source
+}
+
+// Replay re-emite a un cliente los eventos históricos del rango que coinciden con los filtros.
+// Los eventos conservan Envelope.Sequence, se marcan con EventFlagReplay y se entregan al
+// ritmo del ThrottleConfig del cliente (sin consumir el throttle de los eventos en vivo).
+// Bloquea hasta terminar o hasta que se cancele ctx.
+func (r *Router) Replay(ctx context.Context, clientID string, q ReplayQuery) (ReplayResult, error) {
+	var result ReplayResult
+
+	source := r.getReplaySource()
+	if source == nil {
+		return result, fmt.Errorf("replay not available: no history source configured")
+	}
+
+	client, err := r.resolver.GetClient(clientID)
+	if err != nil {
+		return result, err
+	}
+
+	if q.From.IsZero() || q.To.IsZero() || !q.To.After(q.From) {
+		return result, fmt.Errorf("invalid replay range: from must be before to")
+	}
+
+	if err := restrictToTenant(&q, client); err != nil {
+		return result, err
+	}
+
+	delivery := r.newReplayDelivery(ctx, client, &q, &result)
+	result.Read, err = source(ctx, q, delivery)
+	return result, err
+}
+
+// Resume re-emite a un cliente los eventos de un stream con secuencia posterior a afterSeq
+// y hasta la última asignada al momento de la llamada; los siguientes llegan en vivo.
+// Usa los eventos recientes en memoria y completa con el histórico lo que falte.
+func (r *Router) Resume(ctx context.Context, clientID string, stream domain.StreamKey, afterSeq uint64) (ReplayResult, error) {
+	var result ReplayResult
+
+	client, err := r.resolver.GetClient(clientID)
+	if err != nil {
+		return result, err
+	}
+
+	if stream.TenantID.IsZero() {
+		stream.TenantID = client.TenantID
+	}
+
+	key := stream.String()
+	upToSeq := r.sequencer.HighWaterMark(key)
+	if afterSeq >= upToSeq {
+		return result, nil
+	}
+
+	now := time.Now()
+	q := ReplayQuery{
+		Filters:  []SubscriptionFilter{{TenantID: &stream.TenantID}},
+		From:     now.Add(-MaxResumeAge),
+		To:       now.Add(time.Second),
+		Stream:   &stream,
+		AfterSeq: afterSeq,
+		UpToSeq:  upToSeq,
+	}
+	if err := restrictToTenant(&q, client); err != nil {
+		return result, err
+	}
+
+	recent, complete := r.sequencer.Recent(key, afterSeq, upToSeq)
+	delivery := r.newReplayDelivery(ctx, client, &q, &result)
+
+	// Lo que no está en memoria se busca en el histórico
+	if !complete {
+		source := r.getReplaySource()
+		if source == nil {
+			return result, fmt.Errorf("resume not available: sequences before %d are not in memory and there is no history source", afterSeq+1)
+		}
+
+		// delivery filtra con q: acotar al tramo anterior a la memoria mientras se lee el histórico
+		if len(recent) > 0 {
+			q.UpToSeq = recent[0].Envelope.Sequence - 1
+		}
+		read, err := source(ctx, q, delivery)
+		q.UpToSeq = upToSeq
+		result.Read += read
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, event := range recent {
+		result.Read++
+		if err := delivery(event); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (r *Router) getReplaySource() ReplaySource {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.replaySource
+}
+
+// restrictToTenant fuerza el tenant del cliente en los filtros: nunca se lee fuera de él
+func restrictToTenant(q *ReplayQuery, client *ClientState) error {
+	tenantID := client.TenantID
+	if q.Stream != nil && q.Stream.TenantID != tenantID {
+		return fmt.Errorf("replay outside of client tenant")
+	}
+
+	if len(q.Filters) == 0 {
+		q.Filters = []SubscriptionFilter{{}}
+	}
+	filters := make([]SubscriptionFilter, len(q.Filters))
+	for i, filter := range q.Filters {
+		if filter.TenantID == nil {
+			filter.TenantID = &tenantID
+		} else if *filter.TenantID != tenantID {
+			return fmt.Errorf("replay outside of client tenant")
+		}
+		filters[i] = filter
+	}
+	q.Filters = filters
+	return nil
+}
+
+// newReplayDelivery retorna la función que filtra, espacia y envía cada evento re-emitido
+func (r *Router) newReplayDelivery(ctx context.Context, client *ClientState, q *ReplayQuery, result *ReplayResult) func(*connectors.CanonicalEvent) error {
+	pacer := newReplayPacer(client.ThrottleConfig)
+
+	return func(event *connectors.CanonicalEvent) error {
+		if !q.matches(event) || !r.resolver.CanDeliver(client.ClientID, event) {
+			result.Skipped++
+			return nil
+		}
+
+		if err := pacer.Wait(ctx); err != nil {
+			return err
+		}
+
+		replayed := *event
+		replayed.Envelope.Flags |= connectors.EventFlagReplay
+
+		if r.sendToClient(client.ClientID, &replayed, client) {
+			result.Delivered++
+		} else {
+			result.Failed++
+		}
+		return nil
+	}
+}
+
+// replayPacer espacia los eventos de un replay según el ThrottleConfig:
+// una ráfaga inicial de BurstSize y luego un evento por intervalo.
+type replayPacer struct {
+	interval time.Duration
+	burst    int
+	next     time.Time
+}
+
+func newReplayPacer(config ThrottleConfig) *replayPacer {
+	interval := time.Duration(config.ThrottleMs) * time.Millisecond
+	if config.MaxRate > 0 {
+		if rateInterval := time.Duration(float64(time.Second) / config.MaxRate); rateInterval > interval {
+			interval = rateInterval
+		}
+	}
+
+	return &replayPacer{
+		interval: interval,
+		burst:    config.BurstSize,
+	}
+}
+
+// Wait bloquea hasta que se pueda enviar el siguiente evento
+func (p *replayPacer) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if p.burst > 0 {
+		p.burst--
+		p.next = time.Now().Add(p.interval)
+		return nil
+	}
+
+	if delay := time.Until(p.next); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	p.next = time.Now().Add(p.interval)
+	return nil
+}
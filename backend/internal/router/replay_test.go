@@ -0,0 +1,155 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newReplayRouter(t *testing.T, throttle *ThrottleConfig) (*Router, primitive.ObjectID, *[]*connectors.CanonicalEvent, *[]time.Time) {
+	router := NewRouter()
+	tenantID := primitive.NewObjectID()
+
+	err := router.RegisterClient("client-1", tenantID, []domain.Capability{domain.CapabilityFeedingRead}, []domain.Scope{{
+		TenantID:    tenantID,
+		Resource:    "site:A",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+		SiteIDs:     []string{"site-A"},
+	}}, throttle)
+	if err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+
+	var sent []*connectors.CanonicalEvent
+	var sentAt []time.Time
+	router.SetEventCallback(func(clientID string, event *connectors.CanonicalEvent) error {
+		sent = append(sent, event)
+		sentAt = append(sentAt, time.Now())
+		return nil
+	})
+
+	return router, tenantID, &sent, &sentAt
+}
+
+// historySource simula el histórico con eventos en orden cronológico
+func historySource(events []*connectors.CanonicalEvent) ReplaySource {
+	return func(ctx context.Context, q ReplayQuery, fn func(*connectors.CanonicalEvent) error) (int, error) {
+		read := 0
+		for _, event := range events {
+			if event.Envelope.Timestamp.Before(q.From) || !event.Envelope.Timestamp.Before(q.To) {
+				continue
+			}
+			if err := fn(event); err != nil {
+				return read, err
+			}
+			read++
+		}
+		return read, nil
+	}
+}
+
+func TestRouter_Replay(t *testing.T) {
+	router, tenantID, sent, _ := newReplayRouter(t, &ThrottleConfig{})
+	start := time.Now().Add(-time.Hour)
+
+	var events []*connectors.CanonicalEvent
+	for i, site := range []string{"site-A", "site-B", "site-A", "site-A"} {
+		event := newCachedEvent(tenantID, domain.StreamKindFeeding, site, "feeding.appetite", start.Add(time.Duration(i)*time.Minute))
+		event.Envelope.Sequence = uint64(10 + i)
+		events = append(events, event)
+	}
+	router.SetReplaySource(historySource(events))
+
+	kind := domain.StreamKindFeeding
+	result, err := router.Replay(context.Background(), "client-1", ReplayQuery{
+		Filters: []SubscriptionFilter{{Kind: &kind}},
+		From:    start,
+		To:      start.Add(3 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	// site-B queda fuera por scope y el 4º evento fuera del rango
+	if result.Read != 3 || result.Delivered != 2 || result.Skipped != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(*sent) != 2 || (*sent)[0].Envelope.Sequence != 10 || (*sent)[1].Envelope.Sequence != 12 {
+		t.Fatalf("expected sequences 10 and 12 in order, got %d events", len(*sent))
+	}
+	for _, event := range *sent {
+		if event.Envelope.Flags&connectors.EventFlagReplay == 0 {
+			t.Fatal("replayed events must be flagged")
+		}
+	}
+	if events[0].Envelope.Flags&connectors.EventFlagReplay != 0 {
+		t.Fatal("source event was mutated")
+	}
+}
+
+func TestRouter_ReplayThrottle(t *testing.T) {
+	router, tenantID, sent, sentAt := newReplayRouter(t, &ThrottleConfig{ThrottleMs: 20, BurstSize: 2})
+	start := time.Now().Add(-time.Hour)
+
+	var events []*connectors.CanonicalEvent
+	for i := 0; i < 4; i++ {
+		events = append(events, newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", start.Add(time.Duration(i)*time.Second)))
+	}
+	router.SetReplaySource(historySource(events))
+
+	if _, err := router.Replay(context.Background(), "client-1", ReplayQuery{From: start, To: start.Add(time.Minute)}); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(*sent) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(*sent))
+	}
+
+	// Ráfaga de 2 y luego un evento cada 20ms
+	if gap := (*sentAt)[3].Sub((*sentAt)[1]); gap < 35*time.Millisecond {
+		t.Errorf("expected paced delivery after burst, got %v for 2 events", gap)
+	}
+
+	// Cancelar detiene el replay
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := router.Replay(ctx, "client-1", ReplayQuery{From: start, To: start.Add(time.Minute)}); err == nil {
+		t.Error("expected error for canceled replay")
+	}
+}
+
+func TestRouter_ReplayValidation(t *testing.T) {
+	router, tenantID, _, _ := newReplayRouter(t, nil)
+	now := time.Now()
+
+	if _, err := router.Replay(context.Background(), "client-1", ReplayQuery{From: now.Add(-time.Hour), To: now}); err == nil {
+		t.Error("expected error without replay source")
+	}
+
+	router.SetReplaySource(historySource(nil))
+
+	if _, err := router.Replay(context.Background(), "client-1", ReplayQuery{From: now, To: now.Add(-time.Hour)}); err == nil {
+		t.Error("expected error for inverted range")
+	}
+
+	otherTenant := primitive.NewObjectID()
+	if _, err := router.Replay(context.Background(), "client-1", ReplayQuery{
+		Filters: []SubscriptionFilter{{TenantID: &otherTenant}},
+		From:    now.Add(-time.Hour),
+		To:      now,
+	}); err == nil {
+		t.Error("expected error for replay outside of client tenant")
+	}
+
+	if _, err := router.Replay(context.Background(), "unknown", ReplayQuery{
+		Filters: []SubscriptionFilter{{TenantID: &tenantID}},
+		From:    now.Add(-time.Hour),
+		To:      now,
+	}); err == nil {
+		t.Error("expected error for unknown client")
+	}
+}
@@ -2,6 +2,7 @@ package router
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,6 +15,7 @@ type Resolver struct {
 	clients      map[string]*ClientState
 	index        *SubscriptionIndex
 	multiConfigs map[string]*MultiConnectorConfig // key: "tenantID:kind"
+	rrCounters   map[string]uint64                // key: "tenantID:kind", para round-robin
 	mu           sync.RWMutex
 }
 
@@ -23,6 +25,7 @@ func NewResolver() *Resolver {
 		clients:      make(map[string]*ClientState),
 		index:        NewSubscriptionIndex(),
 		multiConfigs: make(map[string]*MultiConnectorConfig),
+		rrCounters:   make(map[string]uint64),
 	}
 }
 
@@ -68,14 +71,39 @@ func (r *Resolver) GetClient(clientID string) (*ClientState, error) {
 	return client, nil
 }
 
-// Subscribe crea una nueva suscripción para un cliente
-func (r *Resolver) Subscribe(clientID string, filter SubscriptionFilter) (*Subscription, error) {
+// CanDeliver verifica si un evento puede entregarse a un cliente según sus permisos
+func (r *Resolver) CanDeliver(clientID string, event *connectors.CanonicalEvent) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	client, exists := r.clients[clientID]
+	if !exists {
+		return false
+	}
+
+	return r.hasPermission(client, event)
+}
+
+// Subscribe crea una nueva suscripción para un cliente. Si el cliente ya tiene una con el
+// mismo filtro se retorna esa (created=false) en lugar de duplicarla en el índice.
+func (r *Resolver) Subscribe(clientID string, filter SubscriptionFilter) (*Subscription, bool, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	client, exists := r.clients[clientID]
 	if !exists {
-		return nil, fmt.Errorf("client %s not found", clientID)
+		return nil, false, fmt.Errorf("client %s not found", clientID)
+	}
+
+	if err := filter.Compile(); err != nil {
+		return nil, false, err
+	}
+
+	key := filter.Key()
+	for _, sub := range client.Subscriptions {
+		if sub.Filter.Key() == key {
+			return sub, false, nil
+		}
 	}
 
 	// Crear la suscripción
@@ -89,13 +117,23 @@ func (r *Resolver) Subscribe(clientID string, filter SubscriptionFilter) (*Subsc
 
 	// Agregar al índice
 	if err := r.index.Add(sub); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// Agregar al cliente
 	client.Subscriptions = append(client.Subscriptions, sub)
 
-	return sub, nil
+	return sub, true, nil
+}
+
+// ListSubscriptions retorna copias de las suscripciones de un cliente con sus estadísticas
+func (r *Resolver) ListSubscriptions(clientID string) []Subscription {
+	return r.index.ListByClient(clientID)
+}
+
+// SetSubscriptionThrottle actualiza el throttle propio de una suscripción
+func (r *Resolver) SetSubscriptionThrottle(subscriptionID string, config *ThrottleConfig) (*Subscription, error) {
+	return r.index.SetThrottle(subscriptionID, config)
 }
 
 // Unsubscribe elimina una suscripción
@@ -135,8 +173,8 @@ func (r *Resolver) Resolve(event *connectors.CanonicalEvent) (*RoutingDecision,
 	// Encontrar suscripciones que coinciden
 	matchedSubs := r.index.FindMatching(event)
 
-	// Agrupar por cliente y verificar permisos
-	clientMap := make(map[string]bool)
+	// Agrupar por cliente (con sus suscripciones, para el throttle) y verificar permisos
+	clientMap := make(map[string][]string)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -148,7 +186,7 @@ func (r *Resolver) Resolve(event *connectors.CanonicalEvent) (*RoutingDecision,
 
 		// Verificar permisos del cliente
 		if r.hasPermission(client, event) {
-			clientMap[sub.ClientID] = true
+			clientMap[sub.ClientID] = append(clientMap[sub.ClientID], sub.ID)
 
 			// Actualizar estadísticas de la suscripción
 			r.index.UpdateEventStats(sub.ID)
@@ -164,6 +202,7 @@ func (r *Resolver) Resolve(event *connectors.CanonicalEvent) (*RoutingDecision,
 	decision := &RoutingDecision{
 		Event:       event,
 		Clients:     clients,
+		Matched:     clientMap,
 		Timestamp:   time.Now(),
 		ProcessedIn: time.Since(startTime),
 	}
@@ -177,50 +216,29 @@ func (r *Resolver) Resolve(event *connectors.CanonicalEvent) (*RoutingDecision,
 	return decision, nil
 }
 
-// hasPermission verifica si un cliente tiene permiso para recibir un evento
+// hasPermission verifica si un cliente tiene permiso para recibir un evento.
+// Se valida tenant, restricciones farm/site/cage del scope y la capability del stream.
 func (r *Resolver) hasPermission(client *ClientState, event *connectors.CanonicalEvent) bool {
-	streamKey := &event.Envelope.Stream
+	streamKey := event.Envelope.Stream
 
 	// Verificar tenant
 	if client.TenantID != streamKey.TenantID {
 		return false
 	}
 
-	// Verificar scopes del cliente
-	hasAccess := false
-	for _, scope := range client.Scopes {
-		if scope.CanAccessStream(*streamKey) {
-			hasAccess = true
-
-			// Verificar capability requerida
-			requiredCap := streamKey.GetCapabilityRequired()
-			if requiredCap != "" && !scope.HasCapability(requiredCap) {
-				return false
-			}
-			break
-		}
-	}
-
-	if !hasAccess {
-		return false
-	}
+	return domain.CanAccessAny(client.Scopes, client.Permissions, requiredCapability(event), streamKey)
+}
 
-	// Verificar capabilities específicas del cliente
-	requiredCap := streamKey.GetCapabilityRequired()
-	if requiredCap != "" {
-		hasCapability := false
-		for _, cap := range client.Permissions {
-			if cap == requiredCap {
-				hasCapability = true
-				break
-			}
-		}
-		if !hasCapability {
-			return false
-		}
+// requiredCapability retorna la capability necesaria para recibir un evento.
+// Los eventos STATUS usan la capability del kind de su métrica ("status.feeding.appetite" → feeding).
+func requiredCapability(event *connectors.CanonicalEvent) domain.Capability {
+	streamKey := event.Envelope.Stream
+	if streamKey.Kind == "status" {
+		metric := strings.TrimPrefix(event.Kind, "status.")
+		kind, _, _ := strings.Cut(metric, ".")
+		streamKey.Kind = domain.StreamKind(kind)
 	}
-
-	return true
+	return streamKey.GetCapabilityRequired()
 }
 
 // SetMultiConnectorConfig configura políticas multi-conector
@@ -244,27 +262,70 @@ func (r *Resolver) GetMultiConnectorConfig(tenantID string, kind domain.StreamKi
 	return config, exists
 }
 
+// ActiveConnectors retorna la política y una copia de los conectores activos ordenados por prioridad
+func (r *Resolver) ActiveConnectors(tenantID string, kind domain.StreamKind) (MultiConnectorPolicy, []ConnectorConfig, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	config, exists := r.multiConfigs[fmt.Sprintf("%s:%s", tenantID, kind)]
+	if !exists {
+		return "", nil, fmt.Errorf("no multi-connector config found for tenant %s, kind %s", tenantID, kind)
+	}
+
+	return config.Policy, config.GetActiveConnectors(), nil
+}
+
+// SetConnectorCircuit actualiza CircuitOpen del conector en todas las configuraciones que lo incluyen.
+// Retorna true si el estado cambió en alguna.
+func (r *Resolver) SetConnectorCircuit(connectorID string, open bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, config := range r.multiConfigs {
+		for i := range config.Connectors {
+			if config.Connectors[i].ID == connectorID && config.Connectors[i].CircuitOpen != open {
+				config.Connectors[i].CircuitOpen = open
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// ListMultiConnectorConfigs retorna una copia de todas las configuraciones multi-conector
+func (r *Resolver) ListMultiConnectorConfigs() []MultiConnectorConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	configs := make([]MultiConnectorConfig, 0, len(r.multiConfigs))
+	for _, config := range r.multiConfigs {
+		copied := *config
+		copied.Connectors = append([]ConnectorConfig(nil), config.Connectors...)
+		configs = append(configs, copied)
+	}
+	return configs
+}
+
 // SelectConnector selecciona el conector apropiado según la política
 func (r *Resolver) SelectConnector(tenantID string, kind domain.StreamKind) (*ConnectorConfig, error) {
-	config, exists := r.GetMultiConnectorConfig(tenantID, kind)
-	if !exists {
-		return nil, fmt.Errorf("no multi-connector config found for tenant %s, kind %s", tenantID, kind)
+	policy, activeConnectors, err := r.ActiveConnectors(tenantID, kind)
+	if err != nil {
+		return nil, err
 	}
 
-	activeConnectors := config.GetActiveConnectors()
 	if len(activeConnectors) == 0 {
 		return nil, fmt.Errorf("no active connectors available")
 	}
 
-	switch config.Policy {
+	switch policy {
 	case PolicyPriority, PolicyFallback:
 		// Retornar el de mayor prioridad (ya está ordenado)
 		return &activeConnectors[0], nil
 
 	case PolicyRoundRobin:
-		// Implementación simple: rotar entre conectores
-		// En producción, mantener un contador persistente
-		idx := int(time.Now().Unix()) % len(activeConnectors)
+		// Rotar entre conectores activos
+		idx := int(r.nextRoundRobin(tenantID, kind) % uint64(len(activeConnectors)))
 		return &activeConnectors[idx], nil
 
 	case PolicyMerge:
@@ -276,6 +337,17 @@ func (r *Resolver) SelectConnector(tenantID string, kind domain.StreamKind) (*Co
 	}
 }
 
+// nextRoundRobin incrementa y retorna el contador round-robin de un tenant y kind
+func (r *Resolver) nextRoundRobin(tenantID string, kind domain.StreamKind) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := fmt.Sprintf("%s:%s", tenantID, kind)
+	n := r.rrCounters[key]
+	r.rrCounters[key] = n + 1
+	return n
+}
+
 // GetStats retorna estadísticas del resolver
 func (r *Resolver) GetStats() map[string]interface{} {
 	r.mu.RLock()
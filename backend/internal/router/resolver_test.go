@@ -0,0 +1,130 @@
+package router
+
+import (
+	"testing"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResolver_HasPermission_EnforcesScopes(t *testing.T) {
+	resolver := NewResolver()
+	tenantID := primitive.NewObjectID()
+
+	client := NewClientState("client-1", tenantID)
+	client.Permissions = []domain.Capability{domain.CapabilityFeedingRead}
+	client.Scopes = []domain.Scope{{
+		TenantID:    tenantID,
+		Resource:    "site:A",
+		Permissions: []domain.Capability{domain.CapabilityFeedingRead},
+		FarmIDs:     []string{"farm-1"},
+		SiteIDs:     []string{"site-A"},
+		CageIDs:     []string{"cage-1"},
+	}}
+
+	cage1, cage2 := "cage-1", "cage-2"
+	newEvent := func(tenant primitive.ObjectID, kind domain.StreamKind, farm, site string, cage *string, eventKind string) *connectors.CanonicalEvent {
+		return &connectors.CanonicalEvent{
+			Envelope: connectors.Envelope{Stream: domain.StreamKey{
+				TenantID: tenant,
+				Kind:     kind,
+				FarmID:   farm,
+				SiteID:   site,
+				CageID:   cage,
+			}},
+			Kind: eventKind,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		event   *connectors.CanonicalEvent
+		allowed bool
+	}{
+		{"same scope", newEvent(tenantID, domain.StreamKindFeeding, "farm-1", "site-A", &cage1, "feeding.appetite"), true},
+		{"other tenant", newEvent(primitive.NewObjectID(), domain.StreamKindFeeding, "farm-1", "site-A", &cage1, "feeding.appetite"), false},
+		{"other farm", newEvent(tenantID, domain.StreamKindFeeding, "farm-2", "site-A", &cage1, "feeding.appetite"), false},
+		{"other site", newEvent(tenantID, domain.StreamKindFeeding, "farm-1", "site-B", &cage1, "feeding.appetite"), false},
+		{"other cage", newEvent(tenantID, domain.StreamKindFeeding, "farm-1", "site-A", &cage2, "feeding.appetite"), false},
+		{"missing capability", newEvent(tenantID, domain.StreamKindClimate, "farm-1", "site-A", &cage1, "climate.temperature"), false},
+		{"status in scope", newEvent(tenantID, "status", "farm-1", "site-A", &cage1, "status.feeding.appetite"), true},
+		{"status without capability", newEvent(tenantID, "status", "farm-1", "site-A", &cage1, "status.climate.temperature"), false},
+		{"status other site", newEvent(tenantID, "status", "farm-1", "site-B", nil, "status.feeding.appetite"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.hasPermission(client, tt.event); got != tt.allowed {
+				t.Errorf("hasPermission() = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+
+	// Sin scopes no se entrega nada
+	if resolver.hasPermission(NewClientState("client-2", tenantID), tests[0].event) {
+		t.Error("client without scopes should not receive events")
+	}
+}
+
+func TestRouter_SubscribeIsIdempotentPerFilter(t *testing.T) {
+	r := NewRouter()
+	tenantID := primitive.NewObjectID()
+	r.RegisterClient("client-1", tenantID, nil, nil, nil)
+	r.RegisterClient("client-2", tenantID, nil, nil, nil)
+
+	kind := domain.StreamKindFeeding
+	siteA, sameSite := "site-A", "site-A"
+	first, err := r.Subscribe("client-1", SubscriptionFilter{TenantID: &tenantID, Kind: &kind, SiteID: &siteA, Sources: []string{"cloud", "local"}})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	// Mismo filtro con punteros y orden distintos: misma suscripción
+	again, err := r.Subscribe("client-1", SubscriptionFilter{TenantID: &tenantID, Kind: &kind, SiteID: &sameSite, Sources: []string{"local", "cloud"}})
+	if err != nil {
+		t.Fatalf("re-subscribe failed: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("expected re-SUB to return %s, got %s", first.ID, again.ID)
+	}
+
+	// Otro cliente con el mismo filtro tiene su propia suscripción
+	other, _ := r.Subscribe("client-2", SubscriptionFilter{TenantID: &tenantID, Kind: &kind, SiteID: &siteA, Sources: []string{"cloud", "local"}})
+	if other.ID == first.ID {
+		t.Error("expected a separate subscription for another client")
+	}
+
+	cage := "cage-1"
+	if _, err := r.Subscribe("client-1", SubscriptionFilter{TenantID: &tenantID, Kind: &kind, SiteID: &siteA, CageID: &cage}); err != nil {
+		t.Fatalf("subscribe to cage failed: %v", err)
+	}
+
+	if got := r.resolver.index.Count(); got != 3 {
+		t.Errorf("expected 3 subscriptions in the index, got %d", got)
+	}
+	if got := r.GetStats().ActiveSubscriptions; got != 3 {
+		t.Errorf("expected 3 active subscriptions, got %d", got)
+	}
+
+	r.resolver.index.UpdateEventStats(first.ID)
+	r.resolver.index.UpdateEventStats(first.ID)
+
+	subs := r.Subscriptions("client-1")
+	if len(subs) != 2 {
+		t.Fatalf("expected 2 subscriptions for client-1, got %d", len(subs))
+	}
+	for _, sub := range subs {
+		if sub.ID == first.ID && (sub.EventCount != 2 || sub.LastEvent == nil) {
+			t.Errorf("expected event stats on %s, got count=%d last=%v", sub.ID, sub.EventCount, sub.LastEvent)
+		}
+	}
+
+	if err := r.Unsubscribe(first.ID); err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	if len(r.Subscriptions("client-1")) != 1 {
+		t.Error("expected only the cage subscription to remain")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,29 +13,42 @@ import (
 	"omniapi/internal/metrics"
 	"omniapi/internal/queue/requester"
 	"omniapi/internal/queue/status"
+	"omniapi/internal/recipes"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Router es el componente principal que coordina el routing de eventos
 type Router struct {
-	resolver  *Resolver
-	throttler *Throttler
-	stats     *RouterStats
-	eventChan chan *connectors.CanonicalEvent
-	stopChan  chan struct{}
-	wg        sync.WaitGroup
-	mu        sync.RWMutex
+	resolver   *Resolver
+	throttler  *Throttler
+	lastValues *LastValueCache
+	sequencer  *Sequencer
+	aggregator *Aggregator
+	stats      *RouterStats
+	eventChan  chan *connectors.CanonicalEvent
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	mu         sync.RWMutex
 
 	// Callbacks para enviar eventos a clientes
 	onSendEvent func(clientID string, event *connectors.CanonicalEvent) error
+
+	// Callback para cada evento DATA enrutado (ej: histórico)
+	onEventRouted func(event *connectors.CanonicalEvent)
+
+	// Fuente histórica para Replay
+	replaySource ReplaySource
 }
 
 // NewRouter crea una nueva instancia del router
 func NewRouter() *Router {
 	return &Router{
-		resolver:  NewResolver(),
-		throttler: NewThrottler(),
+		resolver:   NewResolver(),
+		throttler:  NewThrottler(),
+		lastValues: NewLastValueCache(),
+		sequencer:  NewSequencer(),
+		aggregator: NewAggregator(),
 		stats: &RouterStats{
 			EventsByKind:    make(map[string]int64),
 			ClientsByTenant: make(map[string]int),
@@ -56,6 +70,7 @@ func (r *Router) Stop() error {
 	close(r.stopChan)
 	r.wg.Wait()
 	close(r.eventChan)
+	r.sequencer.Sync()
 	return nil
 }
 
@@ -66,6 +81,19 @@ func (r *Router) SetEventCallback(callback func(clientID string, event *connecto
 	r.onSendEvent = callback
 }
 
+// OnEventRouted registra un callback que recibe cada evento DATA procesado,
+// tenga o no clientes suscritos
+func (r *Router) OnEventRouted(callback func(event *connectors.CanonicalEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onEventRouted = callback
+}
+
+// SetSequenceStore persiste los high-water marks de secuencia para continuar la numeración tras un reinicio
+func (r *Router) SetSequenceStore(store SequenceStore) error {
+	return r.sequencer.SetStore(store)
+}
+
 // eventLoop procesa eventos entrantes
 func (r *Router) eventLoop(ctx context.Context) {
 	defer r.wg.Done()
@@ -87,6 +115,9 @@ func (r *Router) eventLoop(ctx context.Context) {
 		case <-ticker.C:
 			// Procesar eventos buffereados periódicamente
 			r.processBufferedEvents()
+
+			// Emitir las ventanas de agregación que terminaron
+			r.aggregator.Flush()
 		}
 	}
 }
@@ -108,6 +139,9 @@ func (r *Router) RouteEvent(event *connectors.CanonicalEvent) error {
 func (r *Router) processEvent(event *connectors.CanonicalEvent) {
 	startTime := time.Now()
 
+	// Numerar en el stream (marca duplicados y tardíos)
+	duplicate := r.sequencer.Assign(event)
+
 	// Resolver a qué clientes debe enviarse
 	decision, err := r.resolver.Resolve(event)
 	if err != nil {
@@ -118,8 +152,28 @@ func (r *Router) processEvent(event *connectors.CanonicalEvent) {
 	r.mu.Lock()
 	r.stats.EventsRouted++
 	r.stats.EventsByKind[event.Kind]++
+	if duplicate {
+		r.stats.EventsDuplicate++
+	}
+	if event.Envelope.Flags&connectors.EventFlagLate != 0 {
+		r.stats.EventsLate++
+	}
+	onEventRouted := r.onEventRouted
 	r.mu.Unlock()
 
+	// Los duplicados se entregan marcados pero no reemplazan el último valor ni se guardan de nuevo
+	if !duplicate {
+		// Guardar último valor para snapshots
+		r.lastValues.PutData(event)
+
+		if onEventRouted != nil {
+			onEventRouted(event)
+		}
+
+		// Agregaciones de salida (ej: rollups publicados a un broker)
+		r.aggregator.Observe(event)
+	}
+
 	// Actualizar métricas de Prometheus para eventos DATA
 	r.updateDataMetrics(event)
 
@@ -130,8 +184,23 @@ func (r *Router) processEvent(event *connectors.CanonicalEvent) {
 			continue
 		}
 
-		// Aplicar throttling
-		canSend, reason := r.throttler.ProcessEvent(clientID, event, client)
+		// Las suscripciones con agregación acumulan el evento en lugar de recibirlo
+		subscriptionIDs := make([]string, 0, len(decision.Matched[clientID]))
+		for _, subscriptionID := range decision.Matched[clientID] {
+			if r.aggregator.Has(subscriptionID) {
+				if !duplicate {
+					r.aggregator.Add(subscriptionID, event)
+				}
+				continue
+			}
+			subscriptionIDs = append(subscriptionIDs, subscriptionID)
+		}
+		if len(subscriptionIDs) == 0 {
+			continue
+		}
+
+		// Aplicar throttling por suscripción y stream
+		canSend, reason := r.throttler.ProcessSubscriptionEvent(clientID, subscriptionIDs, event, client)
 
 		if canSend {
 			r.sendToClient(clientID, event, client)
@@ -166,6 +235,9 @@ func (r *Router) processBufferedEvents() {
 			events = r.throttler.CoalesceEvents(events)
 		}
 
+		// Pendientes del throttle de cada suscripción
+		events = append(events, r.throttler.PendingSubscriptionEvents(client.ClientID)...)
+
 		// Enviar eventos pendientes
 		for _, event := range events {
 			r.sendToClient(client.ClientID, event, client)
@@ -173,27 +245,27 @@ func (r *Router) processBufferedEvents() {
 	}
 }
 
-// sendToClient envía un evento a un cliente específico
-func (r *Router) sendToClient(clientID string, event *connectors.CanonicalEvent, client *ClientState) {
+// sendToClient envía un evento a un cliente específico. Retorna false si no se pudo enviar.
+func (r *Router) sendToClient(clientID string, event *connectors.CanonicalEvent, client *ClientState) bool {
 	if r.onSendEvent == nil {
-		return
+		return false
 	}
 
 	err := r.onSendEvent(clientID, event)
 	if err != nil {
-		client.Stats.EventsDropped++
-		return
+		client.recordDropped()
+		return false
 	}
 
 	// Actualizar estadísticas del cliente
-	client.Stats.EventsSent++
-	client.Stats.EventsReceived++
-	client.LastEvent = time.Now()
+	client.recordSent()
 
 	// Actualizar estadísticas globales
 	r.mu.Lock()
 	r.stats.TotalBytesRouted += int64(len(event.Payload))
 	r.mu.Unlock()
+
+	return true
 }
 
 // RegisterClient registra un nuevo cliente en el router
@@ -243,8 +315,11 @@ func (r *Router) UnregisterClient(clientID string) error {
 		return err
 	}
 
-	// Eliminar del throttler
+	// Eliminar del throttler y descartar sus agregaciones
 	r.throttler.UnregisterClient(clientID)
+	for _, sub := range client.Subscriptions {
+		r.aggregator.Unregister(sub.ID)
+	}
 
 	// Actualizar estadísticas
 	r.mu.Lock()
@@ -263,19 +338,127 @@ func (r *Router) UnregisterClient(clientID string) error {
 
 // Subscribe crea una suscripción para un cliente
 func (r *Router) Subscribe(clientID string, filter SubscriptionFilter) (*Subscription, error) {
-	sub, err := r.resolver.Subscribe(clientID, filter)
+	sub, created, err := r.resolver.Subscribe(clientID, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	// Actualizar estadísticas
-	r.mu.Lock()
-	r.stats.ActiveSubscriptions++
-	r.mu.Unlock()
+	// Actualizar estadísticas (re-suscribir el mismo filtro no crea una nueva)
+	if created {
+		r.mu.Lock()
+		r.stats.ActiveSubscriptions++
+		r.mu.Unlock()
+
+		// Suscripción de agregados: el router le envía las ventanas en lugar de los eventos
+		if sub.Filter.Aggregate != nil {
+			if err := r.aggregator.Register(sub.ID, *sub.Filter.Aggregate, nil, func(event *connectors.CanonicalEvent) {
+				r.sendRollup(clientID, event)
+			}); err != nil {
+				r.Unsubscribe(sub.ID)
+				return nil, err
+			}
+		}
+	}
 
 	return sub, nil
 }
 
+// sendRollup envía la ventana de una suscripción de agregados (sin throttle)
+func (r *Router) sendRollup(clientID string, event *connectors.CanonicalEvent) {
+	client, err := r.resolver.GetClient(clientID)
+	if err != nil {
+		return
+	}
+
+	if r.sendToClient(clientID, event, client) {
+		r.mu.Lock()
+		r.stats.EventsRollupOut++
+		r.mu.Unlock()
+	}
+}
+
+// AddRollup registra una agregación de salida: los eventos DATA que coinciden con el filtro
+// se agregan y cada ventana terminada se entrega a emit (ej: publicación a un broker).
+// Reemplaza la agregación anterior con el mismo ID.
+func (r *Router) AddRollup(id string, filter SubscriptionFilter, spec AggregateSpec, emit func(event *connectors.CanonicalEvent)) error {
+	filter.Aggregate = nil
+	if err := filter.Compile(); err != nil {
+		return err
+	}
+	return r.aggregator.Register(id, spec, &filter, emit)
+}
+
+// RemoveRollup elimina una agregación de salida
+func (r *Router) RemoveRollup(id string) {
+	r.aggregator.Unregister(id)
+}
+
+// Subscriptions retorna las suscripciones activas de un cliente con EventCount/LastEvent
+func (r *Router) Subscriptions(clientID string) []Subscription {
+	return r.resolver.ListSubscriptions(clientID)
+}
+
+// Snapshot retorna el último evento conocido de cada stream que coincide con el filtro
+// (y los STATUS si includeStatus), limitado a lo que el cliente tiene permitido ver.
+// Los eventos retornados son copias marcadas con EventFlagSnapshot.
+func (r *Router) Snapshot(clientID string, filter SubscriptionFilter, includeStatus bool) []*connectors.CanonicalEvent {
+	// Una suscripción de agregados no recibe eventos individuales
+	if filter.Aggregate != nil {
+		return nil
+	}
+
+	cached := r.lastValues.Match(filter, includeStatus)
+
+	events := make([]*connectors.CanonicalEvent, 0, len(cached))
+	for _, event := range cached {
+		if !r.resolver.CanDeliver(clientID, event) {
+			continue
+		}
+
+		snapshot := *event
+		snapshot.Envelope.Flags |= connectors.EventFlagSnapshot
+		events = append(events, &snapshot)
+	}
+
+	// Orden cronológico para que el cliente aplique los valores en secuencia
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Envelope.Timestamp.Before(events[j].Envelope.Timestamp)
+	})
+
+	return events
+}
+
+// SetSubscriptionThrottle configura el throttle de una suscripción (nil usa el del cliente).
+// Retorna la configuración efectiva.
+func (r *Router) SetSubscriptionThrottle(subscriptionID string, config *ThrottleConfig) (ThrottleConfig, error) {
+	if config != nil {
+		if err := config.Validate(); err != nil {
+			return ThrottleConfig{}, err
+		}
+	}
+
+	sub, err := r.resolver.SetSubscriptionThrottle(subscriptionID, config)
+	if err != nil {
+		return ThrottleConfig{}, err
+	}
+
+	return r.throttler.SetSubscriptionConfig(sub.ClientID, subscriptionID, config), nil
+}
+
+// SubscriptionThrottle retorna la configuración de throttle efectiva de una suscripción
+// del cliente: la propia o, si no tiene, la del cliente
+func (r *Router) SubscriptionThrottle(clientID, subscriptionID string) (ThrottleConfig, error) {
+	if config, ok := r.throttler.SubscriptionConfig(subscriptionID); ok {
+		return config, nil
+	}
+
+	client, err := r.resolver.GetClient(clientID)
+	if err != nil {
+		return ThrottleConfig{}, err
+	}
+	return client.ThrottleConfig, nil
+}
+
 // Unsubscribe elimina una suscripción
 func (r *Router) Unsubscribe(subscriptionID string) error {
 	err := r.resolver.Unsubscribe(subscriptionID)
@@ -283,6 +466,10 @@ func (r *Router) Unsubscribe(subscriptionID string) error {
 		return err
 	}
 
+	// Descartar el estado de throttle, los eventos pendientes y las ventanas abiertas de la suscripción
+	r.throttler.RemoveSubscription(subscriptionID)
+	r.aggregator.Unregister(subscriptionID)
+
 	// Actualizar estadísticas
 	r.mu.Lock()
 	r.stats.ActiveSubscriptions--
@@ -326,8 +513,11 @@ func (r *Router) GetStats() *RouterStats {
 	stats := &RouterStats{
 		EventsRouted:        r.stats.EventsRouted,
 		EventsDropped:       r.stats.EventsDropped,
+		EventsDuplicate:     r.stats.EventsDuplicate,
+		EventsLate:          r.stats.EventsLate,
 		EventsDataOut:       r.stats.EventsDataOut,
 		EventsStatusOut:     r.stats.EventsStatusOut,
+		EventsRollupOut:     r.stats.EventsRollupOut,
 		ActiveClients:       r.stats.ActiveClients,
 		ActiveSubscriptions: r.stats.ActiveSubscriptions,
 		TotalBytesRouted:    r.stats.TotalBytesRouted,
@@ -355,16 +545,17 @@ func (r *Router) GetClientStats(clientID string) (map[string]interface{}, error)
 		return nil, err
 	}
 
+	clientStats, lastEvent := client.StatsSnapshot()
 	stats := map[string]interface{}{
 		"client_id":       client.ClientID,
 		"tenant_id":       client.TenantID.Hex(),
 		"subscriptions":   len(client.Subscriptions),
-		"events_sent":     client.Stats.EventsSent,
-		"events_received": client.Stats.EventsReceived,
-		"events_dropped":  client.Stats.EventsDropped,
-		"throttled":       client.Stats.Throttled,
-		"bytes_sent":      client.Stats.BytesSent,
-		"last_event":      client.LastEvent,
+		"events_sent":     clientStats.EventsSent,
+		"events_received": clientStats.EventsReceived,
+		"events_dropped":  clientStats.EventsDropped,
+		"throttled":       clientStats.Throttled,
+		"bytes_sent":      clientStats.BytesSent,
+		"last_event":      lastEvent,
 		"throttle_config": client.ThrottleConfig,
 	}
 
@@ -432,8 +623,7 @@ func (r *Router) OnRequesterResult(result requester.Result) {
 		Timestamp: result.CompletedAt,
 		Stream:    streamKey,
 		Source:    string(result.Source),
-		Sequence:  0, // TODO: mantener secuencia
-		Flags:     connectors.EventFlagNone,
+		Flags:     connectors.EventFlagNone, // Sequence la asigna el router al ingresar
 	}
 
 	// Si hubo error, marcar como sintético
@@ -441,6 +631,11 @@ func (r *Router) OnRequesterResult(result requester.Result) {
 		envelope.Flags = connectors.EventFlagSynthetic
 	}
 
+	// Datos incompletos del origen (páginas o fuentes faltantes)
+	if result.Partial {
+		envelope.Flags |= connectors.EventFlagPartial
+	}
+
 	// Construir payload
 	payload := map[string]interface{}{
 		"metric":     result.Metric,
@@ -451,6 +646,10 @@ func (r *Router) OnRequesterResult(result requester.Result) {
 	if result.IsSuccess() {
 		payload["data"] = result.Payload
 		payload["status"] = "success"
+		if result.Partial {
+			payload["partial"] = true
+			payload["warning"] = result.Warning
+		}
 	} else {
 		payload["error"] = result.ErrorMsg
 		payload["status"] = "error"
@@ -478,6 +677,66 @@ func (r *Router) OnRequesterResult(result requester.Result) {
 	r.mu.Unlock()
 }
 
+// OnRecipeOutput transforma los registros normalizados de una receta en un evento DATA
+// Si el TenantID de la receta no es válido el evento se descarta: no debe llegar a un tenant nulo.
+func (r *Router) OnRecipeOutput(out recipes.Output) {
+	tenantOID, err := primitive.ObjectIDFromHex(out.TenantID)
+	if err != nil {
+		fmt.Printf("⚠️  Recipe %s output dropped: invalid tenant %q\n", out.RecipeName, out.TenantID)
+		r.mu.Lock()
+		r.stats.EventsDropped++
+		r.mu.Unlock()
+		return
+	}
+
+	streamKey := domain.StreamKey{
+		TenantID: tenantOID,
+		Kind:     domain.StreamKind(out.StreamKind),
+		SiteID:   out.SiteID,
+	}
+
+	envelope := connectors.Envelope{
+		Version:   "1.0",
+		Timestamp: out.ProducedAt,
+		Stream:    streamKey,
+		Source:    "recipe:" + out.RecipeName,
+		Flags:     connectors.EventFlagNone,
+	}
+	if out.Partial {
+		envelope.Flags |= connectors.EventFlagPartial
+	}
+
+	payload := map[string]interface{}{
+		"metric":      out.StreamKind,
+		"recipe_id":   out.RecipeID,
+		"recipe":      out.RecipeName,
+		"provider":    out.Provider,
+		"endpoint_id": out.EndpointID,
+		"instance_id": out.InstanceID,
+		"records":     out.Records,
+		"count":       len(out.Records),
+		"status":      "success",
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	event := &connectors.CanonicalEvent{
+		Envelope:      envelope,
+		Payload:       payloadBytes,
+		Kind:          out.StreamKind,
+		SchemaVersion: "1.0",
+	}
+
+	r.RouteEvent(event)
+
+	r.mu.Lock()
+	r.stats.EventsDataOut++
+	r.mu.Unlock()
+}
+
 // OnStatusHeartbeat maneja heartbeats de estado y los transforma en eventos STATUS
 func (r *Router) OnStatusHeartbeat(st status.Status) {
 	// Convertir TenantID string a ObjectID
@@ -504,8 +763,7 @@ func (r *Router) OnStatusHeartbeat(st status.Status) {
 		Timestamp: st.EmittedAt,
 		Stream:    streamKey,
 		Source:    st.Source,
-		Sequence:  0,                             // TODO: mantener secuencia
-		Flags:     connectors.EventFlagSynthetic, // Los heartbeats son sintéticos
+		Flags:     connectors.EventFlagSynthetic, // Los heartbeats son sintéticos y no se numeran (keep-latest)
 	}
 
 	// Construir payload de status
@@ -566,6 +824,9 @@ func (r *Router) OnStatusHeartbeat(st status.Status) {
 func (r *Router) RouteStatusEvent(event *connectors.CanonicalEvent) error {
 	startTime := time.Now()
 
+	// Guardar último STATUS para snapshots
+	r.lastValues.PutStatus(event)
+
 	// Resolver a qué clientes debe enviarse
 	decision, err := r.resolver.ResolveStatus(event)
 	if err != nil {
@@ -0,0 +1,230 @@
+package router
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"omniapi/internal/connectors"
+)
+
+const (
+	// SequenceBlock secuencias reservadas en el SequenceStore por cada escritura.
+	// Tras un reinicio la numeración continúa desde la última reserva (puede quedar un hueco, nunca se repite).
+	SequenceBlock = 1000
+
+	// sequenceRefill se reserva el bloque siguiente cuando quedan menos secuencias reservadas
+	// que este margen, así la escritura termina antes de agotar el bloque actual
+	sequenceRefill = SequenceBlock / 2
+
+	// recentEventsPerStream eventos recientes por stream que se guardan en memoria para resume
+	recentEventsPerStream = 128
+)
+
+// SequenceStore persiste el high-water mark de secuencia de cada stream
+type SequenceStore interface {
+	// LoadSequences retorna la última secuencia reservada por stream (key: StreamKey.String())
+	LoadSequences() (map[string]uint64, error)
+
+	// ReserveSequence registra que el stream puede usar secuencias hasta upTo
+	ReserveSequence(streamKey string, upTo uint64) error
+}
+
+// streamSequence estado de secuencia de un stream
+type streamSequence struct {
+	last      uint64                       // Última secuencia asignada (high-water mark)
+	reserved  uint64                       // Reservada en el store (solo avanza tras escribir)
+	reserving bool                         // Hay una reserva en curso
+	lastTS    time.Time                    // Timestamp más reciente visto
+	recent    []*connectors.CanonicalEvent // Últimos eventos en orden de secuencia
+}
+
+// Sequencer asigna secuencias monótonas por StreamKey al ingresar los eventos al router
+type Sequencer struct {
+	streams map[string]*streamSequence
+	store   SequenceStore
+	mu      sync.Mutex
+	pending sync.WaitGroup // Reservas en curso
+}
+
+// NewSequencer crea un sequencer en memoria
+func NewSequencer() *Sequencer {
+	return &Sequencer{
+		streams: make(map[string]*streamSequence),
+	}
+}
+
+// SetStore carga los high-water marks persistidos y persiste las reservas siguientes
+func (s *Sequencer) SetStore(store SequenceStore) error {
+	marks, err := store.LoadSequences()
+	if err != nil {
+		return fmt.Errorf("error loading sequences: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store = store
+	for key, mark := range marks {
+		st := s.streamLocked(key)
+		if mark > st.last {
+			st.last = mark
+			st.reserved = mark
+		}
+	}
+	return nil
+}
+
+// Assign numera un evento de su stream y marca duplicados y tardíos.
+//   - Sin secuencia: recibe la siguiente; si su timestamp es anterior al último visto es Late.
+//   - Con secuencia del productor mayor al high-water mark: se respeta.
+//   - Con secuencia ya alcanzada: Duplicate si coincide con un evento reciente, si no Late.
+//
+// Retorna true si el evento es un duplicado.
+func (s *Sequencer) Assign(event *connectors.CanonicalEvent) bool {
+	key := event.Envelope.Stream.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.streamLocked(key)
+	seq := event.Envelope.Sequence
+	duplicate := false
+
+	switch {
+	case seq == 0:
+		seq = st.last + 1
+		if !st.lastTS.IsZero() && event.Envelope.Timestamp.Before(st.lastTS) {
+			event.Envelope.Flags |= connectors.EventFlagLate
+		}
+	case seq <= st.last:
+		if st.seen(seq) {
+			event.Envelope.Flags |= connectors.EventFlagDuplicate
+			duplicate = true
+		} else {
+			event.Envelope.Flags |= connectors.EventFlagLate
+		}
+	}
+
+	event.Envelope.Sequence = seq
+	if seq > st.last {
+		st.last = seq
+	}
+	if event.Envelope.Timestamp.After(st.lastTS) {
+		st.lastTS = event.Envelope.Timestamp
+	}
+
+	if !duplicate {
+		st.remember(event)
+	}
+
+	s.reserveLocked(key, st)
+	return duplicate
+}
+
+// HighWaterMark retorna la última secuencia asignada a un stream
+func (s *Sequencer) HighWaterMark(streamKey string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.streams[streamKey]; ok {
+		return st.last
+	}
+	return 0
+}
+
+// Recent retorna los eventos en memoria con secuencia en (afterSeq, upToSeq].
+// complete es true si la memoria cubre todo el rango (no hace falta ir al histórico).
+func (s *Sequencer) Recent(streamKey string, afterSeq, upToSeq uint64) (events []*connectors.CanonicalEvent, complete bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.streams[streamKey]
+	if !ok || afterSeq >= upToSeq {
+		return nil, afterSeq >= upToSeq
+	}
+
+	for _, event := range st.recent {
+		seq := event.Envelope.Sequence
+		if seq > afterSeq && seq <= upToSeq {
+			events = append(events, event)
+		}
+	}
+
+	complete = len(st.recent) > 0 && st.recent[0].Envelope.Sequence <= afterSeq+1
+	return events, complete
+}
+
+func (s *Sequencer) streamLocked(key string) *streamSequence {
+	st, ok := s.streams[key]
+	if !ok {
+		st = &streamSequence{}
+		s.streams[key] = st
+	}
+	return st
+}
+
+// reserveLocked reserva el bloque siguiente en segundo plano cuando el reservado se
+// acerca a agotarse. La escritura se hace fuera del lock; reserved solo avanza si
+// tiene éxito y, si falla, el siguiente evento lo reintenta.
+func (s *Sequencer) reserveLocked(key string, st *streamSequence) {
+	if s.store == nil || st.reserving || st.last+sequenceRefill <= st.reserved {
+		return
+	}
+
+	if st.reserved > 0 && st.last > st.reserved {
+		// Se agotó el bloque antes de reservar el siguiente: tras un reinicio podrían repetirse
+		fmt.Printf("⚠️  Stream %s is %d sequences past its reservation\n", key, st.last-st.reserved)
+	}
+
+	st.reserving = true
+	upTo := st.last + SequenceBlock
+	store := s.store
+
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		err := store.ReserveSequence(key, upTo)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		st.reserving = false
+		if err != nil {
+			fmt.Printf("⚠️  Error reserving sequences for stream %s: %v\n", key, err)
+			return
+		}
+		if upTo > st.reserved {
+			st.reserved = upTo
+		}
+	}()
+}
+
+// Sync espera a que terminen las reservas en curso (ej: al detener el router)
+func (s *Sequencer) Sync() {
+	s.pending.Wait()
+}
+
+// seen indica si la secuencia corresponde a un evento reciente
+func (st *streamSequence) seen(seq uint64) bool {
+	for _, event := range st.recent {
+		if event.Envelope.Sequence == seq {
+			return true
+		}
+	}
+	return false
+}
+
+// remember guarda el evento en orden de secuencia descartando los más antiguos
+func (st *streamSequence) remember(event *connectors.CanonicalEvent) {
+	i := len(st.recent)
+	for i > 0 && st.recent[i-1].Envelope.Sequence > event.Envelope.Sequence {
+		i--
+	}
+	st.recent = append(st.recent, nil)
+	copy(st.recent[i+1:], st.recent[i:])
+	st.recent[i] = event
+
+	if len(st.recent) > recentEventsPerStream {
+		st.recent = st.recent[len(st.recent)-recentEventsPerStream:]
+	}
+}
@@ -0,0 +1,213 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"omniapi/internal/connectors"
+	"omniapi/internal/domain"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memorySequenceStore SequenceStore en memoria
+type memorySequenceStore struct {
+	reserved map[string]uint64
+	writes   int
+	fail     bool
+	mu       sync.Mutex
+}
+
+func (m *memorySequenceStore) LoadSequences() (map[string]uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]uint64, len(m.reserved))
+	for key, seq := range m.reserved {
+		out[key] = seq
+	}
+	return out, nil
+}
+
+func (m *memorySequenceStore) ReserveSequence(streamKey string, upTo uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writes++
+	if m.fail {
+		return errors.New("store unavailable")
+	}
+	if upTo > m.reserved[streamKey] {
+		m.reserved[streamKey] = upTo
+	}
+	return nil
+}
+
+func TestSequencer_AssignAndFlags(t *testing.T) {
+	seq := NewSequencer()
+	tenantID := primitive.NewObjectID()
+	now := time.Now()
+
+	a1 := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now)
+	a2 := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now.Add(time.Second))
+	b1 := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-B", "feeding.appetite", now)
+	seq.Assign(a1)
+	seq.Assign(a2)
+	seq.Assign(b1)
+
+	if a1.Envelope.Sequence != 1 || a2.Envelope.Sequence != 2 || b1.Envelope.Sequence != 1 {
+		t.Fatalf("expected per-stream sequences 1,2 and 1, got %d,%d and %d",
+			a1.Envelope.Sequence, a2.Envelope.Sequence, b1.Envelope.Sequence)
+	}
+
+	// Timestamp anterior al último visto: nueva secuencia pero tardío
+	late := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now.Add(-time.Minute))
+	if seq.Assign(late) || late.Envelope.Sequence != 3 || late.Envelope.Flags&connectors.EventFlagLate == 0 {
+		t.Fatalf("expected late event with sequence 3, got seq=%d flags=%d", late.Envelope.Sequence, late.Envelope.Flags)
+	}
+
+	// Secuencia de productor ya entregada: duplicado
+	dup := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now.Add(time.Second))
+	dup.Envelope.Sequence = 2
+	if !seq.Assign(dup) || dup.Envelope.Flags&connectors.EventFlagDuplicate == 0 {
+		t.Fatal("expected duplicate for an already delivered sequence")
+	}
+
+	// Secuencia de productor por delante: se respeta
+	ahead := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now.Add(2*time.Second))
+	ahead.Envelope.Sequence = 10
+	seq.Assign(ahead)
+	if ahead.Envelope.Sequence != 10 || seq.HighWaterMark(ahead.Envelope.Stream.String()) != 10 {
+		t.Fatalf("expected producer sequence 10 to be kept, got %d", ahead.Envelope.Sequence)
+	}
+
+	// Hueco rellenado más tarde: tardío, no duplicado
+	gap := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", now.Add(2*time.Second))
+	gap.Envelope.Sequence = 7
+	if seq.Assign(gap) || gap.Envelope.Flags&connectors.EventFlagLate == 0 {
+		t.Fatal("expected late flag for a sequence inside a gap")
+	}
+}
+
+func TestSequencer_PersistsAcrossRestarts(t *testing.T) {
+	store := &memorySequenceStore{reserved: make(map[string]uint64)}
+	tenantID := primitive.NewObjectID()
+
+	first := NewSequencer()
+	if err := first.SetStore(store); err != nil {
+		t.Fatalf("SetStore failed: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		first.Assign(newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", time.Now()))
+	}
+	first.Sync()
+	if store.writes != 1 {
+		t.Fatalf("expected one block reservation, got %d writes", store.writes)
+	}
+
+	// Tras un reinicio la numeración continúa después del bloque reservado
+	restarted := NewSequencer()
+	restarted.SetStore(store)
+	event := newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", time.Now())
+	restarted.Assign(event)
+
+	if event.Envelope.Sequence != SequenceBlock+2 {
+		t.Fatalf("expected sequence %d after restart, got %d", SequenceBlock+2, event.Envelope.Sequence)
+	}
+	if event.Envelope.Flags&(connectors.EventFlagDuplicate|connectors.EventFlagLate) != 0 {
+		t.Fatal("first event after restart must not be flagged")
+	}
+}
+
+func TestSequencer_RetriesFailedReservation(t *testing.T) {
+	store := &memorySequenceStore{reserved: make(map[string]uint64), fail: true}
+	tenantID := primitive.NewObjectID()
+	key := newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", time.Now()).Envelope.Stream.String()
+
+	seq := NewSequencer()
+	seq.SetStore(store)
+	seq.Assign(newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", time.Now()))
+	seq.Sync()
+
+	// La reserva fallida no cuenta como reservada
+	if store.reserved[key] != 0 {
+		t.Fatalf("expected nothing reserved, got %d", store.reserved[key])
+	}
+
+	store.mu.Lock()
+	store.fail = false
+	store.mu.Unlock()
+	seq.Assign(newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", time.Now()))
+	seq.Sync()
+
+	if store.writes != 2 || store.reserved[key] != 2+SequenceBlock {
+		t.Fatalf("expected retry reserving up to %d, got %d after %d writes", 2+SequenceBlock, store.reserved[key], store.writes)
+	}
+
+	// Con el bloque reservado no se vuelve a escribir hasta acercarse a su fin
+	for i := 0; i < sequenceRefill-10; i++ {
+		seq.Assign(newCachedEvent(tenantID, domain.StreamKindClimate, "site-A", "climate.temperature", time.Now()))
+	}
+	seq.Sync()
+	if store.writes != 2 {
+		t.Fatalf("expected no new reservation inside the block, got %d writes", store.writes)
+	}
+}
+
+func TestSequencer_Recent(t *testing.T) {
+	seq := NewSequencer()
+	tenantID := primitive.NewObjectID()
+
+	var key string
+	for i := 0; i < recentEventsPerStream+10; i++ {
+		event := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", time.Now())
+		seq.Assign(event)
+		key = event.Envelope.Stream.String()
+	}
+	last := uint64(recentEventsPerStream + 10)
+
+	events, complete := seq.Recent(key, last-5, last)
+	if !complete || len(events) != 5 || events[0].Envelope.Sequence != last-4 {
+		t.Fatalf("expected the last 5 events from memory, got %d (complete=%v)", len(events), complete)
+	}
+
+	// Las primeras secuencias ya salieron de memoria
+	if _, complete := seq.Recent(key, 0, last); complete {
+		t.Fatal("expected incomplete range when the oldest events were evicted")
+	}
+}
+
+func TestRouter_Resume(t *testing.T) {
+	router, tenantID, sent, _ := newReplayRouter(t, &ThrottleConfig{})
+
+	// 4 eventos ya numerados y en el histórico; solo 3 y 4 siguen en memoria
+	var stored []*connectors.CanonicalEvent
+	for i := 0; i < 4; i++ {
+		event := newCachedEvent(tenantID, domain.StreamKindFeeding, "site-A", "feeding.appetite", time.Now().Add(time.Duration(i-10)*time.Second))
+		router.sequencer.Assign(event)
+		copied := *event
+		stored = append(stored, &copied)
+	}
+	stream := stored[0].Envelope.Stream
+	router.sequencer.streams[stream.String()].recent = router.sequencer.streams[stream.String()].recent[2:]
+	router.SetReplaySource(historySource(stored))
+
+	result, err := router.Resume(context.Background(), "client-1", stream, 1)
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if result.Delivered != 3 || len(*sent) != 3 {
+		t.Fatalf("expected sequences 2..4, got %+v", result)
+	}
+	for i, event := range *sent {
+		if event.Envelope.Sequence != uint64(i+2) || event.Envelope.Flags&connectors.EventFlagReplay == 0 {
+			t.Fatalf("unexpected event %d: seq=%d flags=%d", i, event.Envelope.Sequence, event.Envelope.Flags)
+		}
+	}
+
+	// Al día: nada que enviar
+	if result, _ := router.Resume(context.Background(), "client-1", stream, 4); result.Delivered != 0 {
+		t.Fatalf("expected nothing to resume, got %+v", result)
+	}
+}
@@ -2,6 +2,7 @@ package router
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +21,7 @@ type SubscriptionIndex struct {
 	bySite   map[string][]*Subscription             // SiteID -> Subscriptions
 	byCage   map[string][]*Subscription             // CageID -> Subscriptions
 	byFarm   map[string][]*Subscription             // FarmID -> Subscriptions
+	byMetric map[string][]*Subscription             // Métrica exacta -> Subscriptions
 	all      map[string]*Subscription               // SubscriptionID -> Subscription
 
 	mu sync.RWMutex
@@ -34,6 +36,7 @@ func NewSubscriptionIndex() *SubscriptionIndex {
 		bySite:   make(map[string][]*Subscription),
 		byCage:   make(map[string][]*Subscription),
 		byFarm:   make(map[string][]*Subscription),
+		byMetric: make(map[string][]*Subscription),
 		all:      make(map[string]*Subscription),
 	}
 }
@@ -76,6 +79,11 @@ func (si *SubscriptionIndex) Add(sub *Subscription) error {
 		si.byCage[*sub.Filter.CageID] = append(si.byCage[*sub.Filter.CageID], sub)
 	}
 
+	// Indexar por métrica si todas son exactas
+	for _, metric := range indexedMetrics(sub) {
+		si.byMetric[metric] = append(si.byMetric[metric], sub)
+	}
+
 	return nil
 }
 
@@ -113,9 +121,24 @@ func (si *SubscriptionIndex) Remove(subscriptionID string) error {
 		si.byCage[*sub.Filter.CageID] = si.removeFromSlice(si.byCage[*sub.Filter.CageID], subscriptionID)
 	}
 
+	for _, metric := range indexedMetrics(sub) {
+		si.byMetric[metric] = si.removeFromSlice(si.byMetric[metric], subscriptionID)
+	}
+
 	return nil
 }
 
+// indexedMetrics retorna las métricas por las que se indexa una suscripción. Los filtros
+// de prefijo ("feeding.*") no se indexan y se evalúan como wildcard.
+func indexedMetrics(sub *Subscription) []string {
+	for _, metric := range sub.Filter.Metrics {
+		if strings.HasSuffix(metric, ".*") {
+			return nil
+		}
+	}
+	return sub.Filter.Metrics
+}
+
 // removeFromSlice elimina una suscripción de un slice y retorna el nuevo slice
 func (si *SubscriptionIndex) removeFromSlice(subs []*Subscription, subID string) []*Subscription {
 	for i, sub := range subs {
@@ -163,6 +186,49 @@ func (si *SubscriptionIndex) GetByClient(clientID string) []*Subscription {
 	return result
 }
 
+// ListByClient retorna copias de las suscripciones de un cliente, tomadas bajo el lock
+// para leer EventCount/LastEvent sin carreras con UpdateEventStats
+func (si *SubscriptionIndex) ListByClient(clientID string) []Subscription {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+
+	subs := si.byClient[clientID]
+	result := make([]Subscription, 0, len(subs))
+	for _, sub := range subs {
+		copied := *sub
+		if sub.LastEvent != nil {
+			lastEvent := *sub.LastEvent
+			copied.LastEvent = &lastEvent
+		}
+		if sub.Throttle != nil {
+			throttle := *sub.Throttle
+			copied.Throttle = &throttle
+		}
+		result = append(result, copied)
+	}
+	return result
+}
+
+// SetThrottle actualiza el throttle propio de una suscripción (nil usa el del cliente)
+func (si *SubscriptionIndex) SetThrottle(subscriptionID string, config *ThrottleConfig) (*Subscription, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	sub, exists := si.all[subscriptionID]
+	if !exists {
+		return nil, fmt.Errorf("subscription %s not found", subscriptionID)
+	}
+
+	if config != nil {
+		throttle := *config
+		sub.Throttle = &throttle
+	} else {
+		sub.Throttle = nil
+	}
+
+	return sub, nil
+}
+
 // GetByID retorna una suscripción por su ID
 func (si *SubscriptionIndex) GetByID(subscriptionID string) (*Subscription, error) {
 	si.mu.RLock()
@@ -226,7 +292,14 @@ func (si *SubscriptionIndex) FindMatching(event *connectors.CanonicalEvent) []*S
 		}
 	}
 
-	// 6. Verificar suscripciones sin filtros específicos (wildcard)
+	// 6. Por métrica
+	for _, sub := range si.byMetric[eventMetric(event)] {
+		if sub.Filter.Matches(event) {
+			matched[sub.ID] = sub
+		}
+	}
+
+	// 7. Verificar suscripciones sin filtros específicos (wildcard)
 	for _, sub := range si.all {
 		if _, alreadyMatched := matched[sub.ID]; !alreadyMatched {
 			// Verificar si es una suscripción wildcard que aplica
@@ -250,7 +323,7 @@ func (si *SubscriptionIndex) isWildcardMatch(sub *Subscription, event *connector
 	// Si tiene filtros específicos, ya fue verificada en los índices
 	if sub.Filter.TenantID != nil || sub.Filter.Kind != nil ||
 		sub.Filter.FarmID != nil || sub.Filter.SiteID != nil ||
-		sub.Filter.CageID != nil {
+		sub.Filter.CageID != nil || len(indexedMetrics(sub)) > 0 {
 		return false
 	}
 
@@ -305,7 +378,14 @@ func (si *SubscriptionIndex) FindMatchingStatus(event *connectors.CanonicalEvent
 		}
 	}
 
-	// 6. Verificar suscripciones wildcard con IncludeStatus
+	// 6. Por métrica
+	for _, sub := range si.byMetric[eventMetric(event)] {
+		if sub.IncludeStatus && sub.Filter.Matches(event) {
+			matched[sub.ID] = sub
+		}
+	}
+
+	// 7. Verificar suscripciones wildcard con IncludeStatus
 	for _, sub := range si.all {
 		if !sub.IncludeStatus {
 			continue
@@ -357,6 +437,7 @@ func (si *SubscriptionIndex) GetStats() map[string]interface{} {
 		"sites":               len(si.bySite),
 		"cages":               len(si.byCage),
 		"farms":               len(si.byFarm),
+		"metrics":             len(si.byMetric),
 	}
 }
 
@@ -378,5 +459,6 @@ func (si *SubscriptionIndex) Clear() {
 	si.bySite = make(map[string][]*Subscription)
 	si.byCage = make(map[string][]*Subscription)
 	si.byFarm = make(map[string][]*Subscription)
+	si.byMetric = make(map[string][]*Subscription)
 	si.all = make(map[string]*Subscription)
 }
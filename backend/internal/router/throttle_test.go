@@ -313,8 +313,8 @@ func TestThrottler_ProcessEvent(t *testing.T) {
 	}
 
 	// Verificar que se incrementó el contador de throttled
-	if client.Stats.Throttled != 1 {
-		t.Errorf("Expected throttled count 1, got %d", client.Stats.Throttled)
+	if stats, _ := client.StatsSnapshot(); stats.Throttled != 1 {
+		t.Errorf("Expected throttled count 1, got %d", stats.Throttled)
 	}
 }
 
@@ -432,3 +432,159 @@ func TestDefaultThrottleConfig(t *testing.T) {
 		t.Errorf("Expected default BufferSize 100, got %d", config.BufferSize)
 	}
 }
+
+func TestThrottler_ProcessSubscriptionEvent_PerSubscriptionAndStream(t *testing.T) {
+	throttler := NewThrottler()
+	clientID := "client-1"
+	tenantID := primitive.NewObjectID()
+
+	throttler.RegisterClient(clientID, DefaultThrottleConfig())
+	client := NewClientState(clientID, tenantID)
+
+	// sub-slow: 1 evento por segundo sin buffer; sub-fast: tiempo real
+	throttler.SetSubscriptionConfig(clientID, "sub-slow", &ThrottleConfig{ThrottleMs: 1000})
+	throttler.SetSubscriptionConfig(clientID, "sub-fast", &ThrottleConfig{})
+
+	cageA, cageB := "cage-A", "cage-B"
+	eventA := createTestEvent(tenantID, domain.StreamKindClimate, "farm-1", "site-1", &cageA)
+	eventB := createTestEvent(tenantID, domain.StreamKindClimate, "farm-1", "site-1", &cageB)
+
+	// El throttle es por stream: el primer evento de cada stream pasa
+	if sent, _ := throttler.ProcessSubscriptionEvent(clientID, []string{"sub-slow"}, eventA, client); !sent {
+		t.Error("first event of stream A should be sent")
+	}
+	if sent, _ := throttler.ProcessSubscriptionEvent(clientID, []string{"sub-slow"}, eventB, client); !sent {
+		t.Error("first event of stream B should be sent")
+	}
+
+	// Sin buffer el segundo evento del stream se descarta
+	if sent, reason := throttler.ProcessSubscriptionEvent(clientID, []string{"sub-slow"}, eventA, client); sent || reason != "dropped" {
+		t.Errorf("expected dropped, got sent=%v reason=%s", sent, reason)
+	}
+
+	// Si otra suscripción que coincide lo permite, el evento se envía
+	for i := 0; i < 5; i++ {
+		if sent, _ := throttler.ProcessSubscriptionEvent(clientID, []string{"sub-slow", "sub-fast"}, eventA, client); !sent {
+			t.Fatalf("event %d should be sent through the real-time subscription", i)
+		}
+	}
+
+	if config, ok := throttler.SubscriptionConfig("sub-slow"); !ok || config.ThrottleMs != 1000 {
+		t.Errorf("unexpected sub-slow config: %+v (exists=%v)", config, ok)
+	}
+
+	throttler.RemoveSubscription("sub-slow")
+	if _, ok := throttler.SubscriptionConfig("sub-slow"); ok {
+		t.Error("sub-slow should be removed")
+	}
+}
+
+func TestThrottler_PendingSubscriptionEvents(t *testing.T) {
+	throttler := NewThrottler()
+	clientID := "client-1"
+	tenantID := primitive.NewObjectID()
+	client := NewClientState(clientID, tenantID)
+
+	throttler.SetSubscriptionConfig(clientID, "sub-coalesce", &ThrottleConfig{ThrottleMs: 50, CoalescingEnabled: true, KeepLatest: true, BufferSize: 2})
+	throttler.SetSubscriptionConfig(clientID, "sub-ordered", &ThrottleConfig{ThrottleMs: 50, BufferSize: 10})
+
+	newEvent := func(site string, seq uint64) *connectors.CanonicalEvent {
+		event := createTestEvent(tenantID, domain.StreamKindFeeding, "farm-1", site, nil)
+		event.Envelope.Sequence = seq
+		return event
+	}
+
+	for seq := uint64(1); seq <= 4; seq++ {
+		throttler.ProcessSubscriptionEvent(clientID, []string{"sub-coalesce"}, newEvent("site-1", seq), client)
+		throttler.ProcessSubscriptionEvent(clientID, []string{"sub-ordered"}, newEvent("site-2", seq), client)
+	}
+
+	// Nada pendiente mientras dura el throttle
+	if pending := throttler.PendingSubscriptionEvents(clientID); len(pending) != 0 {
+		t.Fatalf("expected no pending events yet, got %d", len(pending))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	pending := throttler.PendingSubscriptionEvents(clientID)
+	if len(pending) != 2 {
+		t.Fatalf("expected one event per subscription, got %d", len(pending))
+	}
+
+	bySite := make(map[string]uint64)
+	for _, event := range pending {
+		bySite[event.Envelope.Stream.SiteID] = event.Envelope.Sequence
+	}
+	// Coalescing entrega el último (keep-latest con buffer de 2)
+	if bySite["site-1"] != 4 {
+		t.Errorf("expected coalesced event seq 4, got %d", bySite["site-1"])
+	}
+	// Sin coalescing se entrega en orden
+	if bySite["site-2"] != 2 {
+		t.Errorf("expected oldest buffered event seq 2, got %d", bySite["site-2"])
+	}
+}
+
+func TestRouter_SubscriptionThrottle(t *testing.T) {
+	router := NewRouter()
+	tenantID := primitive.NewObjectID()
+	capabilities := []domain.Capability{domain.CapabilityFeedingRead, domain.CapabilityClimateRead}
+
+	err := router.RegisterClient("client-1", tenantID, capabilities, []domain.Scope{{
+		TenantID:    tenantID,
+		Resource:    "site:A",
+		Permissions: capabilities,
+		SiteIDs:     []string{"site-A"},
+	}}, nil)
+	if err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+
+	var sent []*connectors.CanonicalEvent
+	router.SetEventCallback(func(clientID string, event *connectors.CanonicalEvent) error {
+		sent = append(sent, event)
+		return nil
+	})
+
+	climate, feeding := domain.StreamKindClimate, domain.StreamKindFeeding
+	climateSub, _ := router.Subscribe("client-1", SubscriptionFilter{TenantID: &tenantID, Kind: &climate})
+	feedingSub, _ := router.Subscribe("client-1", SubscriptionFilter{TenantID: &tenantID, Kind: &feeding})
+
+	effective, err := router.SetSubscriptionThrottle(climateSub.ID, &ThrottleConfig{ThrottleMs: 50, CoalescingEnabled: true, KeepLatest: true, BufferSize: 1})
+	if err != nil || effective.ThrottleMs != 50 {
+		t.Fatalf("SetSubscriptionThrottle = %+v, %v", effective, err)
+	}
+	router.SetSubscriptionThrottle(feedingSub.ID, &ThrottleConfig{})
+
+	if _, err := router.SetSubscriptionThrottle(feedingSub.ID, &ThrottleConfig{ThrottleMs: -1}); err == nil {
+		t.Error("expected invalid throttle to be rejected")
+	}
+
+	// La suscripción sin throttle propio reporta el del cliente
+	if config, err := router.SubscriptionThrottle("client-1", "unknown"); err != nil || config != DefaultThrottleConfig() {
+		t.Errorf("expected client throttle, got %+v, %v", config, err)
+	}
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		for _, kind := range []domain.StreamKind{climate, feeding} {
+			event := createTestEvent(tenantID, kind, "", "site-A", nil)
+			event.Envelope.Sequence = seq
+			router.processEvent(event)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, event := range sent {
+		counts[event.Kind]++
+	}
+	if counts["feeding"] != 3 || counts["climate"] != 1 {
+		t.Fatalf("expected 3 feeding and 1 climate events, got %v", counts)
+	}
+
+	// Tras el throttle se entrega el último climate buffereado
+	time.Sleep(60 * time.Millisecond)
+	router.processBufferedEvents()
+	last := sent[len(sent)-1]
+	if len(sent) != 5 || last.Kind != "climate" || last.Envelope.Sequence != 3 {
+		t.Errorf("expected coalesced climate seq 3, got %d events (last %s seq %d)", len(sent), last.Kind, last.Envelope.Sequence)
+	}
+}
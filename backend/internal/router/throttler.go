@@ -7,10 +7,13 @@ import (
 	"omniapi/internal/connectors"
 )
 
-// Throttler gestiona el rate limiting y coalescing de eventos
+// Throttler gestiona el rate limiting y coalescing de eventos.
+// El router lo aplica por (cliente, suscripción, stream); el estado por cliente se mantiene
+// como configuración base de las suscripciones sin throttle propio.
 type Throttler struct {
-	clients map[string]*ClientThrottleState
-	mu      sync.RWMutex
+	clients       map[string]*ClientThrottleState
+	subscriptions map[string]*SubscriptionThrottleState // key: subscription ID
+	mu            sync.RWMutex
 }
 
 // ClientThrottleState mantiene el estado de throttle de un cliente
@@ -24,10 +27,22 @@ type ClientThrottleState struct {
 	SecondStart      time.Time
 }
 
+// SubscriptionThrottleState mantiene el throttle de una suscripción: su configuración
+// efectiva y el estado y buffer de cada stream que coincide con ella
+type SubscriptionThrottleState struct {
+	SubscriptionID string
+	ClientID       string
+	Config         ThrottleConfig
+	Override       bool // Config propia; si es false sigue la del cliente
+	Streams        map[string]*ClientThrottleState
+	Buffers        map[string]*StreamBuffer
+}
+
 // NewThrottler crea un nuevo throttler
 func NewThrottler() *Throttler {
 	return &Throttler{
-		clients: make(map[string]*ClientThrottleState),
+		clients:       make(map[string]*ClientThrottleState),
+		subscriptions: make(map[string]*SubscriptionThrottleState),
 	}
 }
 
@@ -54,6 +69,11 @@ func (t *Throttler) UnregisterClient(clientID string) {
 	defer t.mu.Unlock()
 
 	delete(t.clients, clientID)
+	for id, sub := range t.subscriptions {
+		if sub.ClientID == clientID {
+			delete(t.subscriptions, id)
+		}
+	}
 }
 
 // UpdateConfig actualiza la configuración de throttle de un cliente
@@ -78,9 +98,203 @@ func (t *Throttler) UpdateConfig(clientID string, config ThrottleConfig) error {
 	}
 
 	state.Config = config
+
+	// Las suscripciones sin throttle propio heredan la nueva configuración
+	for _, sub := range t.subscriptions {
+		if sub.ClientID == clientID && !sub.Override {
+			sub.applyConfig(config)
+		}
+	}
 	return nil
 }
 
+// SetSubscriptionConfig configura el throttle de una suscripción. Con config nil la
+// suscripción usa la configuración del cliente. Retorna la configuración efectiva.
+func (t *Throttler) SetSubscriptionConfig(clientID, subscriptionID string, config *ThrottleConfig) ThrottleConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sub := t.subscriptionState(clientID, subscriptionID)
+	if config != nil {
+		sub.Override = true
+		sub.applyConfig(*config)
+	} else {
+		sub.Override = false
+		sub.applyConfig(t.clientConfig(clientID))
+	}
+	return sub.Config
+}
+
+// SubscriptionConfig retorna la configuración efectiva de una suscripción
+func (t *Throttler) SubscriptionConfig(subscriptionID string) (ThrottleConfig, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	sub, exists := t.subscriptions[subscriptionID]
+	if !exists {
+		return ThrottleConfig{}, false
+	}
+	return sub.Config, true
+}
+
+// RemoveSubscription elimina el estado y los eventos pendientes de una suscripción
+func (t *Throttler) RemoveSubscription(subscriptionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.subscriptions, subscriptionID)
+}
+
+// clientConfig retorna la configuración del cliente (o la de defecto si no está registrado).
+// Requiere t.mu tomado.
+func (t *Throttler) clientConfig(clientID string) ThrottleConfig {
+	if state, exists := t.clients[clientID]; exists {
+		return state.Config
+	}
+	return DefaultThrottleConfig()
+}
+
+// subscriptionState obtiene o crea el estado de una suscripción. Requiere t.mu tomado.
+func (t *Throttler) subscriptionState(clientID, subscriptionID string) *SubscriptionThrottleState {
+	sub, exists := t.subscriptions[subscriptionID]
+	if !exists {
+		sub = &SubscriptionThrottleState{
+			SubscriptionID: subscriptionID,
+			ClientID:       clientID,
+			Config:         t.clientConfig(clientID),
+			Streams:        make(map[string]*ClientThrottleState),
+			Buffers:        make(map[string]*StreamBuffer),
+		}
+		t.subscriptions[subscriptionID] = sub
+	}
+	return sub
+}
+
+// applyConfig actualiza la configuración de la suscripción y la de sus streams y buffers
+func (s *SubscriptionThrottleState) applyConfig(config ThrottleConfig) {
+	s.Config = config
+	for _, state := range s.Streams {
+		state.Config = config
+		if config.BurstSize > 0 && state.TokenBucket > config.BurstSize {
+			state.TokenBucket = config.BurstSize
+		}
+	}
+	for streamKey, buffer := range s.Buffers {
+		if config.BufferSize <= 0 {
+			delete(s.Buffers, streamKey)
+			continue
+		}
+		buffer.MaxSize = config.BufferSize
+		buffer.KeepLatest = config.KeepLatest
+		if len(buffer.Events) > config.BufferSize {
+			// Conservar los más recientes
+			buffer.Events = buffer.Events[len(buffer.Events)-config.BufferSize:]
+		}
+	}
+}
+
+// streamState obtiene o crea el estado de throttle de un stream de la suscripción
+func (s *SubscriptionThrottleState) streamState(streamKey string, now time.Time) *ClientThrottleState {
+	state, exists := s.Streams[streamKey]
+	if !exists {
+		state = &ClientThrottleState{
+			ClientID:      s.ClientID,
+			Config:        s.Config,
+			LastSent:      time.Time{}, // Zero time para permitir primer evento inmediatamente
+			TokenBucket:   s.Config.BurstSize,
+			LastTokenFill: now,
+			SecondStart:   now,
+		}
+		s.Streams[streamKey] = state
+	}
+	return state
+}
+
+// ProcessSubscriptionEvent aplica el throttle de las suscripciones de un cliente que
+// coinciden con el evento. El evento se envía una sola vez si alguna de ellas lo permite;
+// si no, se buffea en la primera con buffer (BufferSize > 0) o se descarta.
+// Sin suscripciones se aplica el throttle del cliente (ProcessEvent).
+func (t *Throttler) ProcessSubscriptionEvent(clientID string, subscriptionIDs []string, event *connectors.CanonicalEvent, client *ClientState) (bool, string) {
+	if len(subscriptionIDs) == 0 {
+		return t.ProcessEvent(clientID, event, client)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	streamKey := event.Envelope.Stream.String()
+
+	subs := make([]*SubscriptionThrottleState, 0, len(subscriptionIDs))
+	for _, subscriptionID := range subscriptionIDs {
+		sub := t.subscriptionState(clientID, subscriptionID)
+		state := sub.streamState(streamKey, now)
+		t.refillTokenBucket(state, now)
+
+		if t.canSendNow(state, now) {
+			t.updateSendMetrics(state, now)
+			return true, "sent"
+		}
+		subs = append(subs, sub)
+	}
+
+	for _, sub := range subs {
+		if sub.Config.BufferSize <= 0 {
+			continue
+		}
+
+		buffer, exists := sub.Buffers[streamKey]
+		if !exists {
+			buffer = NewStreamBuffer(streamKey, sub.Config.BufferSize, sub.Config.KeepLatest)
+			sub.Buffers[streamKey] = buffer
+		}
+		buffer.Push(event)
+		client.recordThrottled()
+		return false, "buffered"
+	}
+
+	client.recordDropped()
+	return false, "dropped"
+}
+
+// PendingSubscriptionEvents retorna los eventos buffereados de las suscripciones de un
+// cliente que ya pueden enviarse. Con coalescing se envía solo el último de cada stream;
+// sin él, los eventos salen en orden mientras el throttle lo permita.
+func (t *Throttler) PendingSubscriptionEvents(clientID string) []*connectors.CanonicalEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	events := make([]*connectors.CanonicalEvent, 0)
+
+	for _, sub := range t.subscriptions {
+		if sub.ClientID != clientID {
+			continue
+		}
+
+		for streamKey, buffer := range sub.Buffers {
+			state := sub.streamState(streamKey, now)
+			t.refillTokenBucket(state, now)
+
+			if sub.Config.CoalescingEnabled {
+				if buffer.Len() > 0 && t.canSendNow(state, now) {
+					events = append(events, buffer.Events[buffer.Len()-1])
+					buffer.Events = buffer.Events[:0]
+					t.updateSendMetrics(state, now)
+				}
+				continue
+			}
+
+			for buffer.Len() > 0 && t.canSendNow(state, now) {
+				events = append(events, buffer.Pop())
+				t.updateSendMetrics(state, now)
+			}
+		}
+	}
+
+	return events
+}
+
 // ShouldSend determina si un evento debe ser enviado basándose en throttling
 func (t *Throttler) ShouldSend(clientID string, event *connectors.CanonicalEvent) bool {
 	t.mu.Lock()
@@ -249,12 +463,12 @@ func (t *Throttler) ProcessEvent(clientID string, event *connectors.CanonicalEve
 	// Si no se puede enviar, buffear
 	if state.Config.CoalescingEnabled {
 		t.BufferEvent(clientID, event, client)
-		client.Stats.Throttled++
+		client.recordThrottled()
 		return false, "buffered"
 	}
 
 	// Si buffering no está habilitado, descartar
-	client.Stats.EventsDropped++
+	client.recordDropped()
 	return false, "dropped"
 }
 
@@ -304,7 +518,8 @@ func (t *Throttler) GetStats() map[string]interface{} {
 	defer t.mu.RUnlock()
 
 	stats := map[string]interface{}{
-		"active_clients": len(t.clients),
+		"active_clients":       len(t.clients),
+		"active_subscriptions": len(t.subscriptions),
 	}
 
 	totalTokens := 0
@@ -331,11 +546,29 @@ func (t *Throttler) GetClientStats(clientID string) map[string]interface{} {
 		}
 	}
 
+	subscriptions := make(map[string]interface{})
+	for id, sub := range t.subscriptions {
+		if sub.ClientID != clientID {
+			continue
+		}
+		buffered := 0
+		for _, buffer := range sub.Buffers {
+			buffered += buffer.Len()
+		}
+		subscriptions[id] = map[string]interface{}{
+			"config":   sub.Config,
+			"override": sub.Override,
+			"streams":  len(sub.Streams),
+			"buffered": buffered,
+		}
+	}
+
 	return map[string]interface{}{
 		"exists":             true,
 		"token_bucket":       state.TokenBucket,
 		"events_this_second": state.EventsThisSecond,
 		"last_sent":          state.LastSent,
 		"config":             state.Config,
+		"subscriptions":      subscriptions,
 	}
 }
@@ -1,6 +1,12 @@
 package router
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"omniapi/internal/connectors"
@@ -27,9 +33,37 @@ type SubscriptionFilter struct {
 	CageID   *string             `json:"cage_id,omitempty"`
 
 	// Filtros adicionales
-	Capabilities []domain.Capability `json:"capabilities,omitempty"`
+	Capabilities []domain.Capability `json:"capabilities,omitempty"` // Capability requerida por el evento
 	Sources      []string            `json:"sources,omitempty"`
-	Tags         map[string]string   `json:"tags,omitempty"`
+	Tags         map[string]string   `json:"tags,omitempty"`    // payload.tags[k] o payload[k] == v
+	Metrics      []string            `json:"metrics,omitempty"` // Métrica exacta ("feeding.appetite") o prefijo ("feeding.*")
+	Where        string              `json:"where,omitempty"`   // Predicado sobre el payload de eventos DATA (ver Predicate)
+
+	// Aggregate entrega agregados por ventana en lugar de los eventos DATA (ver Aggregator)
+	Aggregate *AggregateSpec `json:"aggregate,omitempty"`
+
+	predicate *Predicate // Where compilado (ver Compile)
+}
+
+// Compile valida la agregación y compila el predicado Where. Matches lo compila en cada
+// llamada si no se compiló antes, por lo que conviene llamarlo al crear la suscripción.
+func (sf *SubscriptionFilter) Compile() error {
+	sf.predicate = nil
+	if sf.Aggregate != nil {
+		if err := sf.Aggregate.Validate(); err != nil {
+			return fmt.Errorf("invalid aggregate: %w", err)
+		}
+	}
+	if strings.TrimSpace(sf.Where) == "" {
+		return nil
+	}
+
+	predicate, err := ParsePredicate(sf.Where)
+	if err != nil {
+		return fmt.Errorf("invalid where: %w", err)
+	}
+	sf.predicate = predicate
+	return nil
 }
 
 // Matches verifica si un CanonicalEvent coincide con este filtro
@@ -80,21 +114,185 @@ func (sf *SubscriptionFilter) Matches(event *connectors.CanonicalEvent) bool {
 		}
 	}
 
+	// Verificar métrica (los STATUS usan la métrica sin el prefijo "status.")
+	if len(sf.Metrics) > 0 && !matchesMetric(sf.Metrics, eventMetric(event)) {
+		return false
+	}
+
+	// Verificar capability requerida por el evento
+	if len(sf.Capabilities) > 0 {
+		required := requiredCapability(event)
+		found := false
+		for _, capability := range sf.Capabilities {
+			if capability == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	// Tags y predicado requieren decodificar el payload
+	isStatus := streamKey.Kind == "status"
+	needsPredicate := strings.TrimSpace(sf.Where) != "" && !isStatus
+	if len(sf.Tags) == 0 && !needsPredicate {
+		return true
+	}
+
+	var payload interface{}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return false
+	}
+
+	for key, want := range sf.Tags {
+		if got, ok := payloadTag(payload, key); !ok || got != want {
+			return false
+		}
+	}
+
+	// El predicado aplica solo a DATA: los STATUS del stream se siguen entregando
+	if needsPredicate {
+		predicate := sf.predicate
+		if predicate == nil {
+			compiled, err := ParsePredicate(sf.Where)
+			if err != nil {
+				return false
+			}
+			predicate = compiled
+		}
+		if !predicate.EvalValue(payload) {
+			return false
+		}
+	}
+
 	return true
 }
 
+// eventMetric retorna la métrica del evento (sin el prefijo "status." de los STATUS)
+func eventMetric(event *connectors.CanonicalEvent) string {
+	if event.Envelope.Stream.Kind == "status" {
+		return strings.TrimPrefix(event.Kind, "status.")
+	}
+	return event.Kind
+}
+
+// matchesMetric verifica una métrica contra filtros exactos o de prefijo ("feeding.*")
+func matchesMetric(filters []string, metric string) bool {
+	for _, filter := range filters {
+		if prefix, ok := strings.CutSuffix(filter, ".*"); ok {
+			if strings.HasPrefix(metric, prefix+".") {
+				return true
+			}
+		} else if filter == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// payloadTag busca un tag en payload.tags y luego en los campos escalares de la raíz
+func payloadTag(payload interface{}, key string) (string, bool) {
+	root, ok := payload.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	if tags, ok := root["tags"].(map[string]interface{}); ok {
+		if value, ok := tags[key]; ok {
+			return scalarString(value)
+		}
+	}
+	if value, ok := root[key]; ok {
+		return scalarString(value)
+	}
+	return "", false
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// Key retorna una representación canónica del filtro: dos filtros con la misma key
+// seleccionan exactamente los mismos eventos y los entregan igual, crudos o con la misma
+// agregación (el orden de listas y tags no importa)
+func (sf *SubscriptionFilter) Key() string {
+	optional := func(value *string) string {
+		if value == nil {
+			return "*"
+		}
+		return "=" + *value
+	}
+
+	tenant := "*"
+	if sf.TenantID != nil {
+		tenant = "=" + sf.TenantID.Hex()
+	}
+	kind := "*"
+	if sf.Kind != nil {
+		kind = "=" + string(*sf.Kind)
+	}
+
+	capabilities := make([]string, 0, len(sf.Capabilities))
+	for _, capability := range sf.Capabilities {
+		capabilities = append(capabilities, string(capability))
+	}
+	sort.Strings(capabilities)
+
+	sources := append([]string(nil), sf.Sources...)
+	sort.Strings(sources)
+
+	tags := make([]string, 0, len(sf.Tags))
+	for key, value := range sf.Tags {
+		tags = append(tags, key+"="+value)
+	}
+	sort.Strings(tags)
+
+	metrics := append([]string(nil), sf.Metrics...)
+	sort.Strings(metrics)
+
+	aggregate := ""
+	if sf.Aggregate != nil {
+		aggregate = sf.Aggregate.Key()
+	}
+
+	return strings.Join([]string{
+		"tenant" + tenant,
+		"kind" + kind,
+		"farm" + optional(sf.FarmID),
+		"site" + optional(sf.SiteID),
+		"cage" + optional(sf.CageID),
+		"caps=" + strings.Join(capabilities, ","),
+		"sources=" + strings.Join(sources, ","),
+		"tags=" + strings.Join(tags, ","),
+		"metrics=" + strings.Join(metrics, ","),
+		"where=" + strings.TrimSpace(sf.Where),
+		"aggregate=" + aggregate,
+	}, "|")
+}
+
 // Subscription representa una suscripción activa de un cliente WebSocket
 type Subscription struct {
 	ID            string             `json:"id"`
 	ClientID      string             `json:"client_id"`
 	Filter        SubscriptionFilter `json:"filter"`
-	IncludeStatus bool               `json:"include_status"` // Si true, recibe heartbeats de estado
+	IncludeStatus bool               `json:"include_status"`     // Si true, recibe heartbeats de estado
+	Throttle      *ThrottleConfig    `json:"throttle,omitempty"` // Throttle propio; nil usa el del cliente
 	CreatedAt     time.Time          `json:"created_at"`
 	LastEvent     *time.Time         `json:"last_event,omitempty"`
 	EventCount    int64              `json:"event_count"`
 }
 
-// ThrottleConfig configura el comportamiento de throttle para un cliente
+// ThrottleConfig configura el comportamiento de throttle para un cliente o una suscripción
 type ThrottleConfig struct {
 	// ThrottleMs es el tiempo mínimo en ms entre eventos
 	ThrottleMs int `json:"throttle_ms"`
@@ -115,6 +313,31 @@ type ThrottleConfig struct {
 	BufferSize int `json:"buffer_size"`
 }
 
+// Validate verifica que los valores del throttle estén dentro de los límites permitidos
+func (tc ThrottleConfig) Validate() error {
+	if tc.ThrottleMs < 0 || tc.ThrottleMs > MaxThrottleMs {
+		return fmt.Errorf("throttle_ms must be between 0 and %d", MaxThrottleMs)
+	}
+	if tc.MaxRate < 0 {
+		return fmt.Errorf("max_rate must not be negative")
+	}
+	if tc.BurstSize < 0 {
+		return fmt.Errorf("burst_size must not be negative")
+	}
+	if tc.BufferSize < 0 || tc.BufferSize > MaxThrottleBufferSize {
+		return fmt.Errorf("buffer_size must be between 0 and %d", MaxThrottleBufferSize)
+	}
+	return nil
+}
+
+const (
+	// MaxThrottleMs intervalo máximo entre eventos configurable por suscripción
+	MaxThrottleMs = 60000
+
+	// MaxThrottleBufferSize tamaño máximo del buffer por stream
+	MaxThrottleBufferSize = 1000
+)
+
 // DefaultThrottleConfig retorna la configuración por defecto
 func DefaultThrottleConfig() ThrottleConfig {
 	return ThrottleConfig{
@@ -197,6 +420,10 @@ type ClientState struct {
 	LastEvent      time.Time                `json:"last_event"`
 	Stats          ClientStats              `json:"stats"`
 	StreamBuffers  map[string]*StreamBuffer `json:"-"` // Buffer por stream key
+
+	// statsMu protege Stats y LastEvent: se envía al cliente desde el event loop, el ticker,
+	// los snapshots del SUB y las goroutines de REPLAY
+	statsMu sync.Mutex
 }
 
 // ClientStats mantiene estadísticas por cliente
@@ -254,6 +481,7 @@ type EventEnvelope struct {
 type RoutingDecision struct {
 	Event       *connectors.CanonicalEvent `json:"event"`
 	Clients     []string                   `json:"clients"`
+	Matched     map[string][]string        `json:"matched,omitempty"` // client ID → suscripciones que coinciden
 	Reason      string                     `json:"reason,omitempty"`
 	Timestamp   time.Time                  `json:"timestamp"`
 	ProcessedIn time.Duration              `json:"processed_in"`
@@ -263,8 +491,11 @@ type RoutingDecision struct {
 type RouterStats struct {
 	EventsRouted        int64            `json:"events_routed"`
 	EventsDropped       int64            `json:"events_dropped"`
+	EventsDuplicate     int64            `json:"events_duplicate"`  // Secuencia ya entregada en el stream
+	EventsLate          int64            `json:"events_late"`       // Fuera de orden respecto al stream
 	EventsDataOut       int64            `json:"events_data_out"`   // Eventos DATA enviados
 	EventsStatusOut     int64            `json:"events_status_out"` // Eventos STATUS enviados
+	EventsRollupOut     int64            `json:"events_rollup_out"` // Ventanas agregadas enviadas a clientes
 	ActiveClients       int              `json:"active_clients"`
 	ActiveSubscriptions int              `json:"active_subscriptions"`
 	TotalBytesRouted    int64            `json:"total_bytes_routed"`
@@ -339,6 +570,37 @@ func NewStreamBuffer(streamKey string, maxSize int, keepLatest bool) *StreamBuff
 	}
 }
 
+// recordSent registra un evento entregado al cliente
+func (c *ClientState) recordSent() {
+	c.statsMu.Lock()
+	c.Stats.EventsSent++
+	c.Stats.EventsReceived++
+	c.LastEvent = time.Now()
+	c.statsMu.Unlock()
+}
+
+// recordDropped registra un evento descartado para el cliente
+func (c *ClientState) recordDropped() {
+	c.statsMu.Lock()
+	c.Stats.EventsDropped++
+	c.statsMu.Unlock()
+}
+
+// recordThrottled registra un evento retenido por el throttle
+func (c *ClientState) recordThrottled() {
+	c.statsMu.Lock()
+	c.Stats.Throttled++
+	c.Stats.LastThrottle = time.Now()
+	c.statsMu.Unlock()
+}
+
+// StatsSnapshot retorna una copia de las estadísticas y del último evento enviado
+func (c *ClientState) StatsSnapshot() (ClientStats, time.Time) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.Stats, c.LastEvent
+}
+
 // NewClientState crea un nuevo estado de cliente
 func NewClientState(clientID string, tenantID primitive.ObjectID) *ClientState {
 	return &ClientState{
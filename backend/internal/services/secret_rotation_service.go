@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"omniapi/internal/crypto"
+	"omniapi/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// secretTarget colección y campos (notación con puntos) que guardan secretos cifrados
+type secretTarget struct {
+	collection string
+	fields     []string
+}
+
+// secretTargets secretos almacenados en MongoDB
+var secretTargets = []secretTarget{
+	{collection: "external_services", fields: []string{"credentials.password", "credentials.client_secret", "credentials.api_key"}},
+	{collection: "broker_configs", fields: []string{"password"}},
+}
+
+// SecretRotationFailure secreto que no se pudo migrar (nunca incluye el valor)
+type SecretRotationFailure struct {
+	DocumentID string `json:"document_id"`
+	Field      string `json:"field"`
+	Error      string `json:"error"`
+}
+
+// CollectionRotationReport resultado de la migración de una colección
+type CollectionRotationReport struct {
+	Collection       string                  `json:"collection"`
+	DocumentsScanned int                     `json:"documents_scanned"`
+	Secrets          int                     `json:"secrets"`
+	ByKey            map[string]int          `json:"by_key"` // key ID -> secretos ("legacy", "plaintext")
+	Pending          int                     `json:"pending"`
+	Migrated         int                     `json:"migrated"`
+	DocumentsUpdated int                     `json:"documents_updated"`
+	Failures         []SecretRotationFailure `json:"failures,omitempty"`
+}
+
+// SecretRotationReport resultado de una ejecución de re-encriptación
+type SecretRotationReport struct {
+	DryRun      bool                        `json:"dry_run"`
+	ActiveKeyID string                      `json:"active_key_id"`
+	Collections []*CollectionRotationReport `json:"collections"`
+	StartedAt   time.Time                   `json:"started_at"`
+	Duration    string                      `json:"duration"`
+}
+
+// Failed retorna el total de secretos que no se pudieron migrar
+func (r *SecretRotationReport) Failed() int {
+	total := 0
+	for _, c := range r.Collections {
+		total += len(c.Failures)
+	}
+	return total
+}
+
+// SecretRotationService re-encripta los secretos almacenados con la clave activa del keyring
+type SecretRotationService struct {
+	rotator crypto.KeyRotator
+	targets []secretTarget
+}
+
+// NewSecretRotationService crea el servicio de re-encriptación
+func NewSecretRotationService(rotator crypto.KeyRotator) *SecretRotationService {
+	return &SecretRotationService{
+		rotator: rotator,
+		targets: secretTargets,
+	}
+}
+
+// Run recorre las colecciones con secretos y los migra a la clave activa.
+// Con dryRun solo reporta (incluye los que fallarían al descifrar) sin escribir.
+// Los secretos en texto plano también se cifran.
+func (rs *SecretRotationService) Run(dryRun bool) (*SecretRotationReport, error) {
+	if database.Database == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	report := &SecretRotationReport{
+		DryRun:      dryRun,
+		ActiveKeyID: keyLabel(rs.rotator.ActiveKeyID()),
+		StartedAt:   time.Now(),
+	}
+
+	for _, target := range rs.targets {
+		collectionReport, err := rs.rotateCollection(target, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("error en colección %s: %w", target.collection, err)
+		}
+		report.Collections = append(report.Collections, collectionReport)
+	}
+
+	report.Duration = time.Since(report.StartedAt).String()
+	return report, nil
+}
+
+func (rs *SecretRotationService) rotateCollection(target secretTarget, dryRun bool) (*CollectionRotationReport, error) {
+	report := &CollectionRotationReport{
+		Collection: target.collection,
+		ByKey:      make(map[string]int),
+	}
+
+	collection := database.GetCollection(target.collection)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	projection := bson.M{}
+	for _, field := range target.fields {
+		projection[field] = 1
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetProjection(projection))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		report.DocumentsScanned++
+
+		updates := bson.M{}
+		for _, field := range target.fields {
+			value, ok := lookupString(doc, field)
+			if !ok || value == "" {
+				continue
+			}
+			report.Secrets++
+
+			if keyID, encrypted := rs.rotator.KeyID(value); encrypted {
+				report.ByKey[keyLabel(keyID)]++
+			} else {
+				report.ByKey["plaintext"]++
+			}
+
+			if !rs.rotator.NeedsRotation(value) {
+				continue
+			}
+			report.Pending++
+
+			rotated, err := rs.rotator.Rotate(value)
+			if err != nil {
+				report.Failures = append(report.Failures, SecretRotationFailure{
+					DocumentID: fmt.Sprintf("%v", doc["_id"]),
+					Field:      field,
+					Error:      err.Error(),
+				})
+				continue
+			}
+			updates[field] = rotated
+		}
+
+		if len(updates) == 0 || dryRun {
+			continue
+		}
+
+		updates["updated_at"] = time.Now()
+		updateCtx, updateCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := collection.UpdateOne(updateCtx, bson.M{"_id": doc["_id"]}, bson.M{"$set": updates})
+		updateCancel()
+		if err != nil {
+			for field := range updates {
+				if field != "updated_at" {
+					report.Failures = append(report.Failures, SecretRotationFailure{
+						DocumentID: fmt.Sprintf("%v", doc["_id"]),
+						Field:      field,
+						Error:      err.Error(),
+					})
+				}
+			}
+			continue
+		}
+
+		report.Migrated += len(updates) - 1
+		report.DocumentsUpdated++
+	}
+
+	return report, cursor.Err()
+}
+
+// lookupString obtiene un string de un documento con notación de puntos ("credentials.password")
+func lookupString(doc bson.M, path string) (string, bool) {
+	var current interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case bson.M:
+			current = node[part]
+		case bson.D:
+			current = nil
+			for _, elem := range node {
+				if elem.Key == part {
+					current = elem.Value
+					break
+				}
+			}
+		default:
+			return "", false
+		}
+	}
+	value, ok := current.(string)
+	return value, ok
+}
+
+// keyLabel nombre legible de un key ID para los reportes
+func keyLabel(keyID string) string {
+	if keyID == crypto.LegacyKeyID {
+		return "legacy"
+	}
+	return keyID
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"omniapi/internal/database"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamSequenceDoc documento de la colección "stream_sequences"
+type streamSequenceDoc struct {
+	StreamKey string    `bson:"_id"`
+	Reserved  int64     `bson:"reserved"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// SequenceService persiste el high-water mark de secuencia por stream (implementa router.SequenceStore)
+type SequenceService struct {
+	collection string
+}
+
+// NewSequenceService crea una nueva instancia del servicio de secuencias
+func NewSequenceService() *SequenceService {
+	return &SequenceService{
+		collection: "stream_sequences",
+	}
+}
+
+// LoadSequences retorna la última secuencia reservada de cada stream
+func (ss *SequenceService) LoadSequences() (map[string]uint64, error) {
+	if database.Database == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	collection := database.GetCollection(ss.collection)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []streamSequenceDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	sequences := make(map[string]uint64, len(docs))
+	for _, doc := range docs {
+		if doc.Reserved > 0 {
+			sequences[doc.StreamKey] = uint64(doc.Reserved)
+		}
+	}
+	return sequences, nil
+}
+
+// ReserveSequence registra la reserva del stream. Nunca retrocede ($max).
+func (ss *SequenceService) ReserveSequence(streamKey string, upTo uint64) error {
+	collection := database.GetCollection(ss.collection)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := collection.UpdateOne(ctx,
+		bson.M{"_id": streamKey},
+		bson.M{
+			"$max": bson.M{"reserved": int64(upTo)},
+			"$set": bson.M{"updated_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -21,16 +22,56 @@ type TokenCache struct {
 	RefreshToken string // Para OAuth2 que soporte refresh
 }
 
-// IsExpired verifica si el token ya expiró
+const (
+	// tokenRefreshWindow antes del vencimiento se renueva en segundo plano (se sigue entregando el token vigente)
+	tokenRefreshWindow = 5 * time.Minute
+
+	// tokenExpirySkew margen para considerar vencido un token (latencia de red y relojes)
+	tokenExpirySkew = 30 * time.Second
+
+	// tokenRetryBase y tokenRetryMax espera tras un fallo de autenticación (se duplica por fallo consecutivo)
+	tokenRetryBase = 5 * time.Second
+	tokenRetryMax  = 5 * time.Minute
+
+	// tokenRetryJitter variación aleatoria de la espera (±20%) para no sincronizar reintentos
+	tokenRetryJitter = 0.2
+)
+
+// IsExpired verifica si el token ya expiró (o está por expirar en segundos)
 func (tc *TokenCache) IsExpired() bool {
-	// Considera expirado si faltan menos de 5 minutos
-	return time.Now().Add(5 * time.Minute).After(tc.ExpiresAt)
+	return time.Now().Add(tokenExpirySkew).After(tc.ExpiresAt)
+}
+
+// NeedsRefresh verifica si el token entró en la ventana de renovación proactiva
+func (tc *TokenCache) NeedsRefresh() bool {
+	return time.Now().Add(tokenRefreshWindow).After(tc.ExpiresAt)
+}
+
+// tokenCall autenticación en curso para un servicio (single-flight)
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
 }
 
-// TokenManager gestor de tokens en memoria (NO SE PERSISTEN EN DB)
+// tokenFailure último fallo de autenticación de un servicio
+type tokenFailure struct {
+	attempts int       // Fallos consecutivos
+	retryAt  time.Time // No se vuelve a contactar al proveedor antes de este momento
+	err      error
+}
+
+// TokenManager gestor de tokens en memoria (NO SE PERSISTEN EN DB).
+// Las autenticaciones concurrentes de un mismo servicio se agrupan en una sola (single-flight)
+// y tras un fallo se espera con backoff exponencial antes de reintentar.
 type TokenManager struct {
-	cache map[string]*TokenCache // Key: serviceID.Hex()
-	mu    sync.RWMutex
+	cache    map[string]*TokenCache   // Key: serviceID.Hex()
+	inflight map[string]*tokenCall    // Key: serviceID.Hex()
+	failures map[string]*tokenFailure // Key: serviceID.Hex()
+	mu       sync.RWMutex
+
+	getAdapter func(serviceType string) (adapters.AuthAdapter, error)
+	random     func() float64 // Fuente del jitter
 }
 
 var (
@@ -41,71 +82,164 @@ var (
 // GetTokenManager obtiene la instancia singleton del Token Manager
 func GetTokenManager() *TokenManager {
 	tokenManagerOnce.Do(func() {
-		tokenManagerInstance = &TokenManager{
-			cache: make(map[string]*TokenCache),
-		}
+		tokenManagerInstance = newTokenManager(adapters.GetAuthAdapter)
 		// Iniciar goroutine de limpieza
 		go tokenManagerInstance.cleanupExpiredTokens()
 	})
 	return tokenManagerInstance
 }
 
-// GetToken obtiene un token válido del cache o autentica nuevamente
+func newTokenManager(getAdapter func(serviceType string) (adapters.AuthAdapter, error)) *TokenManager {
+	return &TokenManager{
+		cache:      make(map[string]*TokenCache),
+		inflight:   make(map[string]*tokenCall),
+		failures:   make(map[string]*tokenFailure),
+		getAdapter: getAdapter,
+		random:     rand.Float64,
+	}
+}
+
+// retryDelay espera antes del siguiente intento tras attempts fallos consecutivos
+func retryDelay(attempts int, random float64) time.Duration {
+	delay := tokenRetryBase
+	for i := 1; i < attempts && delay < tokenRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > tokenRetryMax {
+		delay = tokenRetryMax
+	}
+	return time.Duration(float64(delay) * (1 + tokenRetryJitter*(2*random-1)))
+}
+
+// GetToken obtiene un token válido del cache o autentica nuevamente.
+// Dentro de la ventana de renovación retorna el token vigente y lo renueva en segundo plano.
+// Tras un fallo no se contacta al proveedor hasta que pase el backoff: sin token vigente se
+// retorna el último error.
 func (tm *TokenManager) GetToken(service *models.ExternalService) (string, error) {
 	serviceKey := service.ID.Hex()
 
 	// Verificar cache
 	tm.mu.RLock()
 	cachedToken, exists := tm.cache[serviceKey]
+	_, refreshing := tm.inflight[serviceKey]
+	failure := tm.failures[serviceKey]
 	tm.mu.RUnlock()
 
-	// Si existe y no está expirado, retornar
+	backingOff := failure != nil && time.Now().Before(failure.retryAt)
+
 	if exists && !cachedToken.IsExpired() {
+		if cachedToken.NeedsRefresh() && !refreshing && !backingOff {
+			go tm.authenticateAndCache(service)
+		}
 		return cachedToken.Token, nil
 	}
 
+	if backingOff {
+		return "", fmt.Errorf("autenticación en espera hasta %s tras %d intentos fallidos: %w",
+			failure.retryAt.Format(time.RFC3339), failure.attempts, failure.err)
+	}
+
 	// Token expirado o no existe, autenticar nuevamente
 	return tm.authenticateAndCache(service)
 }
 
-// authenticateAndCache autentica y guarda en cache
+// authenticateAndCache autentica y guarda en cache. Si ya hay una autenticación
+// en curso para el servicio espera su resultado en lugar de iniciar otra.
 func (tm *TokenManager) authenticateAndCache(service *models.ExternalService) (string, error) {
-	// Obtener adaptador de autenticación
-	authAdapter, err := adapters.GetAuthAdapter(service.ServiceType)
-	if err != nil {
-		return "", fmt.Errorf("error obteniendo adaptador: %w", err)
+	serviceKey := service.ID.Hex()
+
+	tm.mu.Lock()
+	if call, ok := tm.inflight[serviceKey]; ok {
+		tm.mu.Unlock()
+		<-call.done
+		return call.token, call.err
 	}
+	call := &tokenCall{done: make(chan struct{})}
+	tm.inflight[serviceKey] = call
+	previous := tm.cache[serviceKey]
+	tm.mu.Unlock()
 
-	// Autenticar
-	tokenResp, err := authAdapter.Authenticate(service)
-	if err != nil {
-		return "", fmt.Errorf("error en autenticación: %w", err)
+	tokenResp, err := tm.obtainToken(service, previous)
+	if err == nil {
+		call.token = tokenResp.AccessToken
+
+		refreshToken := tokenResp.RefreshToken
+		if refreshToken == "" && previous != nil {
+			// Algunos proveedores no rotan el refresh token
+			refreshToken = previous.RefreshToken
+		}
+
+		// Guardar en cache (SOLO EN MEMORIA)
+		tm.mu.Lock()
+		tm.cache[serviceKey] = &TokenCache{
+			Token:        tokenResp.AccessToken,
+			TokenType:    tokenResp.TokenType,
+			ExpiresAt:    tokenResp.ExpiresAt,
+			ServiceID:    service.ID,
+			ServiceType:  service.ServiceType,
+			RefreshToken: refreshToken,
+		}
+		delete(tm.failures, serviceKey)
+		tm.mu.Unlock()
+	} else {
+		call.err = err
+
+		tm.mu.Lock()
+		attempts := 1
+		if failure, ok := tm.failures[serviceKey]; ok {
+			attempts = failure.attempts + 1
+		}
+		delay := retryDelay(attempts, tm.random())
+		tm.failures[serviceKey] = &tokenFailure{attempts: attempts, retryAt: time.Now().Add(delay), err: err}
+		tm.mu.Unlock()
+		fmt.Printf("⚠️  Autenticación fallida para %s (intento %d), próximo intento en %s: %v\n", service.Name, attempts, delay.Round(time.Second), err)
 	}
 
-	// Guardar en cache (SOLO EN MEMORIA)
 	tm.mu.Lock()
-	tm.cache[service.ID.Hex()] = &TokenCache{
-		Token:        tokenResp.AccessToken,
-		TokenType:    tokenResp.TokenType,
-		ExpiresAt:    tokenResp.ExpiresAt,
-		ServiceID:    service.ID,
-		ServiceType:  service.ServiceType,
-		RefreshToken: tokenResp.RefreshToken,
-	}
+	delete(tm.inflight, serviceKey)
 	tm.mu.Unlock()
+	close(call.done)
 
-	return tokenResp.AccessToken, nil
+	return call.token, call.err
+}
+
+// obtainToken intercambia el refresh token si el adaptador lo soporta; si no, o si falla, autentica con credenciales
+func (tm *TokenManager) obtainToken(service *models.ExternalService, previous *TokenCache) (*adapters.TokenResponse, error) {
+	authAdapter, err := tm.getAdapter(service.ServiceType)
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo adaptador: %w", err)
+	}
+
+	if refresher, ok := authAdapter.(adapters.RefreshableAuthAdapter); ok && previous != nil && previous.RefreshToken != "" {
+		tokenResp, err := refresher.Refresh(service, previous.RefreshToken)
+		if err == nil {
+			return tokenResp, nil
+		}
+		fmt.Printf("⚠️  Refresh token rechazado para %s, re-autenticando: %v\n", service.Name, err)
+	}
+
+	// Autenticar
+	tokenResp, err := authAdapter.Authenticate(service)
+	if err != nil {
+		return nil, fmt.Errorf("error en autenticación: %w", err)
+	}
+	return tokenResp, nil
 }
 
 // TestConnection prueba la conexión sin guardar en cache (solo para testing)
 func (tm *TokenManager) TestConnection(service *models.ExternalService) (*adapters.TokenResponse, error) {
-	authAdapter, err := adapters.GetAuthAdapter(service.ServiceType)
+	authAdapter, err := tm.getAdapter(service.ServiceType)
 	if err != nil {
 		return nil, fmt.Errorf("error obteniendo adaptador: %w", err)
 	}
 
 	// Autenticar pero NO guardar en cache
-	tokenResp, err := authAdapter.Authenticate(service)
+	var tokenResp *adapters.TokenResponse
+	if tester, ok := authAdapter.(adapters.ConnectionTester); ok {
+		tokenResp, err = tester.TestConnection(service)
+	} else {
+		tokenResp, err = authAdapter.Authenticate(service)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error en autenticación: %w", err)
 	}
@@ -113,10 +247,25 @@ func (tm *TokenManager) TestConnection(service *models.ExternalService) (*adapte
 	return tokenResp, nil
 }
 
-// InvalidateToken invalida un token en cache (fuerza re-autenticación)
+// InvalidateToken invalida un token en cache y descarta el backoff (fuerza re-autenticación,
+// ej: al cambiar las credenciales del servicio)
 func (tm *TokenManager) InvalidateToken(serviceID primitive.ObjectID) {
 	tm.mu.Lock()
 	delete(tm.cache, serviceID.Hex())
+	delete(tm.failures, serviceID.Hex())
+	tm.mu.Unlock()
+}
+
+// RejectToken marca el token como vencido solo si sigue siendo el cacheado. Lo usan los clientes
+// que recibieron 401/403: si otro ya lo renovó, el token nuevo se conserva y no se re-autentica de nuevo.
+// A diferencia de InvalidateToken conserva el refresh token para la siguiente renovación.
+func (tm *TokenManager) RejectToken(serviceID primitive.ObjectID, token string) {
+	tm.mu.Lock()
+	if cached, ok := tm.cache[serviceID.Hex()]; ok && cached.Token == token {
+		rejected := *cached
+		rejected.ExpiresAt = time.Time{}
+		tm.cache[serviceID.Hex()] = &rejected
+	}
 	tm.mu.Unlock()
 }
 
@@ -173,5 +322,6 @@ func (tm *TokenManager) GetCacheStats() map[string]interface{} {
 func (tm *TokenManager) ClearCache() {
 	tm.mu.Lock()
 	tm.cache = make(map[string]*TokenCache)
+	tm.failures = make(map[string]*tokenFailure)
 	tm.mu.Unlock()
 }
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"omniapi/internal/adapters"
+	"omniapi/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeAuthAdapter adaptador de prueba que cuenta logins y refresh
+type fakeAuthAdapter struct {
+	logins      atomic.Int32
+	refreshes   atomic.Int32
+	expiresIn   time.Duration
+	failRefresh bool
+	failLogin   atomic.Bool
+}
+
+func (f *fakeAuthAdapter) GetServiceType() string { return "fake" }
+
+func (f *fakeAuthAdapter) Authenticate(service *models.ExternalService) (*adapters.TokenResponse, error) {
+	n := f.logins.Add(1)
+	time.Sleep(20 * time.Millisecond) // Login lento: las llamadas concurrentes se solapan
+	if f.failLogin.Load() {
+		return nil, fmt.Errorf("provider unavailable")
+	}
+	return &adapters.TokenResponse{
+		AccessToken:  fmt.Sprintf("login-%d", n),
+		RefreshToken: fmt.Sprintf("refresh-%d", n),
+		ExpiresAt:    time.Now().Add(f.expiresIn),
+	}, nil
+}
+
+func (f *fakeAuthAdapter) Refresh(service *models.ExternalService, refreshToken string) (*adapters.TokenResponse, error) {
+	n := f.refreshes.Add(1)
+	if f.failRefresh {
+		return nil, fmt.Errorf("invalid_grant")
+	}
+	return &adapters.TokenResponse{
+		AccessToken: fmt.Sprintf("refreshed-%d-from-%s", n, refreshToken),
+		ExpiresAt:   time.Now().Add(f.expiresIn),
+	}, nil
+}
+
+func newFakeTokenManager(adapter *fakeAuthAdapter) *TokenManager {
+	return newTokenManager(func(string) (adapters.AuthAdapter, error) { return adapter, nil })
+}
+
+func TestTokenManager_SingleFlight(t *testing.T) {
+	adapter := &fakeAuthAdapter{expiresIn: time.Hour}
+	tm := newFakeTokenManager(adapter)
+	service := &models.ExternalService{ID: primitive.NewObjectID(), ServiceType: "fake"}
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 50)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token, err := tm.GetToken(service)
+			if err != nil {
+				t.Errorf("GetToken failed: %v", err)
+			}
+			tokens[i] = token
+		}(i)
+	}
+	wg.Wait()
+
+	if logins := adapter.logins.Load(); logins != 1 {
+		t.Fatalf("expected a single login for 50 concurrent workers, got %d", logins)
+	}
+	for _, token := range tokens {
+		if token != "login-1" {
+			t.Fatalf("expected every worker to share login-1, got %q", token)
+		}
+	}
+}
+
+func TestTokenManager_RejectTokenUsesRefreshToken(t *testing.T) {
+	adapter := &fakeAuthAdapter{expiresIn: time.Hour}
+	tm := newFakeTokenManager(adapter)
+	service := &models.ExternalService{ID: primitive.NewObjectID(), ServiceType: "fake"}
+
+	first, _ := tm.GetToken(service)
+
+	// 401 con el token vigente: se renueva con el refresh token, sin login
+	tm.RejectToken(service.ID, first)
+	second, err := tm.GetToken(service)
+	if err != nil || second != "refreshed-1-from-refresh-1" {
+		t.Fatalf("expected refreshed token, got %q: %v", second, err)
+	}
+	if adapter.logins.Load() != 1 {
+		t.Fatalf("expected no new login, got %d logins", adapter.logins.Load())
+	}
+
+	// Un worker rezagado rechaza el token viejo: el nuevo se conserva
+	tm.RejectToken(service.ID, first)
+	if token, _ := tm.GetToken(service); token != second || adapter.refreshes.Load() != 1 {
+		t.Fatalf("stale rejection must not discard the renewed token, got %q", token)
+	}
+
+	// El refresh token se conserva aunque el proveedor no lo rote
+	if cached, _ := tm.GetCachedToken(service.ID); cached.RefreshToken != "refresh-1" {
+		t.Fatalf("expected refresh token to be kept, got %q", cached.RefreshToken)
+	}
+}
+
+func TestTokenManager_RefreshFallbackAndProactiveRenewal(t *testing.T) {
+	adapter := &fakeAuthAdapter{expiresIn: time.Hour, failRefresh: true}
+	tm := newFakeTokenManager(adapter)
+	service := &models.ExternalService{ID: primitive.NewObjectID(), ServiceType: "fake"}
+
+	first, _ := tm.GetToken(service)
+	tm.RejectToken(service.ID, first)
+
+	// Refresh rechazado: login completo con credenciales
+	if token, err := tm.GetToken(service); err != nil || token != "login-2" {
+		t.Fatalf("expected fallback login, got %q: %v", token, err)
+	}
+
+	// Dentro de la ventana de renovación se entrega el token vigente y se renueva en segundo plano
+	adapter.failRefresh = false
+	tm.mu.Lock()
+	tm.cache[service.ID.Hex()].ExpiresAt = time.Now().Add(2 * time.Minute)
+	tm.mu.Unlock()
+
+	if token, _ := tm.GetToken(service); token != "login-2" {
+		t.Fatalf("expected current token while renewing, got %q", token)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cached, _ := tm.GetCachedToken(service.ID); cached.Token != "login-2" {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("expected the token to be renewed in background")
+}
+
+func TestTokenManager_BacksOffAfterFailedAuthentication(t *testing.T) {
+	adapter := &fakeAuthAdapter{expiresIn: time.Hour}
+	adapter.failLogin.Store(true)
+	tm := newFakeTokenManager(adapter)
+	tm.random = func() float64 { return 0.5 } // Sin jitter
+	service := &models.ExternalService{ID: primitive.NewObjectID(), ServiceType: "fake"}
+
+	// Los polls siguientes al fallo no vuelven a contactar al proveedor
+	for i := 0; i < 5; i++ {
+		if _, err := tm.GetToken(service); err == nil {
+			t.Fatal("expected authentication error")
+		}
+	}
+	if logins := adapter.logins.Load(); logins != 1 {
+		t.Fatalf("expected a single login attempt during backoff, got %d", logins)
+	}
+
+	// Vencido el backoff se reintenta y la espera siguiente se duplica
+	tm.mu.Lock()
+	tm.failures[service.ID.Hex()].retryAt = time.Now()
+	tm.mu.Unlock()
+	before := time.Now()
+	tm.GetToken(service)
+	tm.mu.RLock()
+	failure := *tm.failures[service.ID.Hex()]
+	tm.mu.RUnlock()
+	if adapter.logins.Load() != 2 || failure.attempts != 2 || failure.retryAt.Sub(before) < 2*tokenRetryBase {
+		t.Fatalf("expected second attempt with doubled backoff, got %+v after %d logins", failure, adapter.logins.Load())
+	}
+
+	// Un token vigente dentro de la ventana de renovación no dispara renovaciones durante el backoff
+	tm.mu.Lock()
+	tm.cache[service.ID.Hex()] = &TokenCache{Token: "current", ExpiresAt: time.Now().Add(2 * time.Minute)}
+	tm.mu.Unlock()
+	for i := 0; i < 5; i++ {
+		if token, _ := tm.GetToken(service); token != "current" {
+			t.Fatalf("expected current token, got %q", token)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if logins := adapter.logins.Load(); logins != 2 {
+		t.Fatalf("expected no background renewal during backoff, got %d logins", logins)
+	}
+
+	// Al cambiar las credenciales se descarta el backoff; un login exitoso lo limpia
+	adapter.failLogin.Store(false)
+	tm.InvalidateToken(service.ID)
+	if token, err := tm.GetToken(service); err != nil || token != "login-3" {
+		t.Fatalf("expected new login after invalidation, got %q: %v", token, err)
+	}
+	if _, failing := tm.failures[service.ID.Hex()]; failing {
+		t.Fatal("expected failure to be cleared after a successful login")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if d := retryDelay(1, 0.5); d != tokenRetryBase {
+		t.Errorf("expected base delay, got %s", d)
+	}
+	if d := retryDelay(3, 0.5); d != 4*tokenRetryBase {
+		t.Errorf("expected 4x base delay, got %s", d)
+	}
+	if d := retryDelay(50, 1); d != time.Duration(float64(tokenRetryMax)*(1+tokenRetryJitter)) {
+		t.Errorf("expected capped delay with jitter, got %s", d)
+	}
+}
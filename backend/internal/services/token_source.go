@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+
+	"omniapi/internal/models"
+)
+
+// ServiceTokenSource expone el token de un servicio externo a través del TokenManager.
+// Implementa requester.TokenSource.
+type ServiceTokenSource struct {
+	manager *TokenManager
+	service *models.ExternalService
+}
+
+// NewServiceTokenSource crea un token source para el servicio indicado
+func NewServiceTokenSource(service *models.ExternalService) *ServiceTokenSource {
+	return &ServiceTokenSource{
+		manager: GetTokenManager(),
+		service: service,
+	}
+}
+
+// Token retorna un token válido desde cache o re-autenticando
+func (s *ServiceTokenSource) Token(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return s.manager.GetToken(s.service)
+}
+
+// Invalidate descarta el token rechazado por el proveedor (si no fue renovado ya)
+func (s *ServiceTokenSource) Invalidate(token string) {
+	s.manager.RejectToken(s.service.ID, token)
+}
@@ -41,7 +41,7 @@ func (us *UserService) Create(user *models.User) error {
 		user.Status = "active"
 	}
 	if user.Role == "" {
-		user.Role = "user"
+		user.Role = "viewer"
 	}
 
 	// Verificar si el usuario ya existe
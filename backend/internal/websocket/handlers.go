@@ -2,56 +2,62 @@
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"omniapi/internal/auth"
+	"omniapi/internal/quota"
 )
 
 // WSHandler maneja las conexiones WebSocket
 func WSHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	// Upgrade HTTP connection a WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Autenticar y resolver el tenant/scopes del usuario antes del upgrade
+	access, err := hub.authorize(r)
 	if err != nil {
-		log.Printf("Error upgrading to WebSocket: %v", err)
+		status, code := http.StatusUnauthorized, "UNAUTHORIZED"
+		if errors.Is(err, auth.ErrTenantForbidden) || errors.Is(err, auth.ErrTenantInactive) || errors.Is(err, auth.ErrTenantUnknown) {
+			status, code = http.StatusForbidden, "FORBIDDEN"
+		} else if errors.Is(err, auth.ErrTenantRequired) {
+			status, code = http.StatusBadRequest, "MISSING_TENANT"
+		}
+		writeHTTPError(w, status, code, err.Error())
 		return
 	}
+	tenantID := access.TenantID
+	tenantIDStr := tenantID.Hex()
 
-	// Obtener parÃ¡metros de query
-	tenantIDStr := r.URL.Query().Get("tenantId")
-	if tenantIDStr == "" {
-		conn.WriteJSON(ErrorMessage{
-			Type:    MessageTypeERROR,
-			Code:    "MISSING_TENANT",
-			Message: "tenantId query parameter is required",
-		})
-		conn.Close()
+	// Quota de conexiones concurrentes del tenant (se libera al desregistrar el cliente)
+	if err := hub.acquireQuota(tenantID, quota.ResourceConcurrentConnections); err != nil {
+		writeHTTPError(w, http.StatusTooManyRequests, quota.ErrorCode, err.Error())
 		return
 	}
 
-	// Parsear TenantID
-	tenantID, err := primitive.ObjectIDFromHex(tenantIDStr)
-	if err != nil {
-		conn.WriteJSON(ErrorMessage{
-			Type:    MessageTypeERROR,
-			Code:    "INVALID_TENANT",
-			Message: "Invalid tenantId format",
-		})
-		conn.Close()
-		return
+	// Generar client ID; el clientId pedido se acota al usuario autenticado para que nadie
+	// pueda tomar la sesión de otro
+	clientID := "ws_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if requested := r.URL.Query().Get("clientId"); requested != "" {
+		clientID = "ws_" + access.UserID + "_" + requested
 	}
 
-	// Generar client ID
-	clientID := r.URL.Query().Get("clientId")
-	if clientID == "" {
-		clientID = "ws_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	// Registrar cliente en el router con las capabilities y scopes del usuario
+	if err := hub.router.RegisterClient(clientID, tenantID, access.Capabilities, access.Scopes, nil); err != nil {
+		hub.releaseQuota(tenantID, quota.ResourceConcurrentConnections, 1)
+		writeHTTPError(w, http.StatusConflict, "CLIENT_ID_IN_USE", err.Error())
+		return
 	}
 
-	// Registrar cliente en el router (con capabilities vacÃ­as por defecto)
-	hub.router.RegisterClient(clientID, tenantID, nil, nil, nil)
+	// Upgrade HTTP connection a WebSocket
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading to WebSocket: %v", err)
+		hub.router.UnregisterClient(clientID)
+		hub.releaseQuota(tenantID, quota.ResourceConcurrentConnections, 1)
+		return
+	}
 
 	// Crear nuevo cliente
 	client := &Client{
@@ -60,6 +66,9 @@ func WSHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		Conn:               conn,
 		Send:               make(chan interface{}, 256),
 		Hub:                hub,
+		UserID:             access.UserID,
+		Permissions:        access.Capabilities,
+		Scopes:             access.Scopes,
 		subscriptions:      make(map[string]*ClientSubscription),
 		includeStatus:      false,
 		lastStatusByKey:    make(map[string]*StatusEventMessage),
@@ -85,6 +94,17 @@ func WSHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	go client.readPump()
 }
 
+// writeHTTPError responde un rechazo previo al upgrade con el mismo formato que ERROR
+func writeHTTPError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorMessage{
+		Type:    MessageTypeERROR,
+		Code:    code,
+		Message: message,
+	})
+}
+
 // WSStatsHandler proporciona estadÃ­sticas del WebSocket via HTTP
 func WSStatsHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	stats := hub.GetStats()
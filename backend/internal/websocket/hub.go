@@ -1,15 +1,21 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"omniapi/internal/auth"
 	"omniapi/internal/connectors"
 	"omniapi/internal/domain"
 	"omniapi/internal/metrics"
+	"omniapi/internal/quota"
 	"omniapi/internal/router"
 
 	"github.com/gorilla/websocket"
@@ -30,9 +36,11 @@ var upgrader = websocket.Upgrader{
 // Tipos de mensajes WebSocket
 const (
 	// Cliente → Servidor
-	MessageTypeSUB   = "SUB"   // Suscripción a streams
-	MessageTypeUNSUB = "UNSUB" // Cancelar suscripción
-	MessageTypePING  = "PING"  // Ping/keep-alive
+	MessageTypeSUB    = "SUB"    // Suscripción a streams
+	MessageTypeUNSUB  = "UNSUB"  // Cancelar suscripción
+	MessageTypePING   = "PING"   // Ping/keep-alive
+	MessageTypeREPLAY = "REPLAY" // Re-envío de un rango histórico
+	MessageTypeLIST   = "LIST"   // Listar suscripciones activas
 
 	// Servidor → Cliente
 	MessageTypeACK    = "ACK"    // Confirmación
@@ -50,10 +58,23 @@ const (
 
 // StreamFilter representa un filtro de stream en SUB
 type StreamFilter struct {
-	Kind   string  `json:"kind"`
-	SiteID string  `json:"siteId"`
-	CageID *string `json:"cageId,omitempty"`
-	Metric *string `json:"metric,omitempty"`
+	Kind   string            `json:"kind"`
+	SiteID string            `json:"siteId"`
+	CageID *string           `json:"cageId,omitempty"`
+	Metric *string           `json:"metric,omitempty"` // Métrica exacta o prefijo ("feeding.*")
+	Tags   map[string]string `json:"tags,omitempty"`   // Campos del payload que deben coincidir
+	Where  string            `json:"where,omitempty"`  // Predicado sobre el payload (ej: "oxygen_mg_l < 6")
+
+	Aggregate *AggregateRequest `json:"aggregate,omitempty"` // Recibir ventanas agregadas en lugar de eventos
+}
+
+// AggregateRequest ventana de agregación (rollup) pedida en un StreamFilter
+type AggregateRequest struct {
+	Window    string   `json:"window"`              // "1m", "5m" o "1h"
+	Slide     string   `json:"slide,omitempty"`     // Paso de la ventana deslizante (default: Window)
+	Fields    []string `json:"fields"`              // Campos numéricos del payload
+	Functions []string `json:"functions,omitempty"` // min, max, avg, sum, count (default: todas)
+	GroupBy   string   `json:"groupBy,omitempty"`   // stream (default), site, farm o tenant
 }
 
 // SubMessage mensaje de suscripción del cliente
@@ -61,13 +82,52 @@ type SubMessage struct {
 	Type          string         `json:"type"` // "SUB"
 	Streams       []StreamFilter `json:"streams"`
 	IncludeStatus *bool          `json:"includeStatus,omitempty"`
-	ThrottleMs    *int           `json:"throttleMs,omitempty"`
+	ThrottleMs    *int           `json:"throttleMs,omitempty"` // Throttle de las suscripciones de este SUB
+	MaxRate       *float64       `json:"maxRate,omitempty"`    // Eventos por segundo por stream (0: sin límite)
+	Coalesce      *bool          `json:"coalesce,omitempty"`   // Enviar solo el último evento buffereado por stream
+	KeepLatest    *bool          `json:"keepLatest,omitempty"` // Con el buffer lleno reemplazar el último evento
+	BufferSize    *int           `json:"bufferSize,omitempty"` // Eventos buffereados por stream (0: descartar)
 	NeedSnapshot  *bool          `json:"needSnapshot,omitempty"`
+	Resume        []StreamCursor `json:"resume,omitempty"` // Última secuencia recibida por stream (reconexión)
+}
+
+// StreamCursor última secuencia recibida de un stream exacto
+type StreamCursor struct {
+	Kind   string  `json:"kind"`
+	SiteID string  `json:"siteId"`
+	CageID *string `json:"cageId,omitempty"`
+	Seq    uint64  `json:"seq"`
+}
+
+// ReplayMessage solicita re-enviar los eventos históricos de un rango
+type ReplayMessage struct {
+	Type    string         `json:"type"`         // "REPLAY"
+	Streams []StreamFilter `json:"streams"`      // Mismos filtros que SUB
+	From    int64          `json:"from"`         // Inicio del rango (Unix ms)
+	To      *int64         `json:"to,omitempty"` // Fin del rango (Unix ms, default: ahora)
 }
 
-// UnsubMessage mensaje para cancelar suscripción
+// MaxReplayRange rango máximo de un REPLAY
+const MaxReplayRange = 7 * 24 * time.Hour
+
+// UnsubMessage mensaje para cancelar suscripciones. Sin subscriptions ni streams
+// se cancelan todas las del cliente.
 type UnsubMessage struct {
-	Type string `json:"type"` // "UNSUB"
+	Type          string         `json:"type"`                    // "UNSUB"
+	Subscriptions []string       `json:"subscriptions,omitempty"` // IDs retornados en el ACK del SUB
+	Streams       []StreamFilter `json:"streams,omitempty"`       // Mismos filtros usados en el SUB
+}
+
+// SubscriptionInfo suscripción del cliente reportada en los ACK de SUB y LIST
+type SubscriptionInfo struct {
+	ID            string                 `json:"id"`
+	Stream        StreamFilter           `json:"stream"`
+	IncludeStatus bool                   `json:"include_status"`
+	Throttle      *router.ThrottleConfig `json:"throttle,omitempty"`   // Throttle efectivo de la suscripción
+	Existing      bool                   `json:"existing,omitempty"`   // Re-SUB de un filtro ya suscrito
+	CreatedAt     int64                  `json:"created_at,omitempty"` // Unix ms
+	EventCount    int64                  `json:"event_count"`
+	LastEvent     *int64                 `json:"last_event,omitempty"` // Unix ms del último evento entregado
 }
 
 // PingMessage keep-alive
@@ -112,14 +172,21 @@ type StreamInfo struct {
 
 // DataEventMessage evento de datos
 type DataEventMessage struct {
-	Type    string                 `json:"type"`    // "DATA"
-	Version string                 `json:"v"`       // Versión del protocolo
-	TS      int64                  `json:"ts"`      // Timestamp Unix (ms)
-	Stream  StreamInfo             `json:"stream"`  // Información del stream
-	Payload map[string]interface{} `json:"payload"` // Datos del evento
-	Flags   *struct {
-		Partial *bool `json:"partial,omitempty"`
-	} `json:"flags,omitempty"`
+	Type    string                 `json:"type"`          // "DATA"
+	Version string                 `json:"v"`             // Versión del protocolo
+	TS      int64                  `json:"ts"`            // Timestamp Unix (ms)
+	Stream  StreamInfo             `json:"stream"`        // Información del stream
+	Payload map[string]interface{} `json:"payload"`       // Datos del evento
+	Seq     uint64                 `json:"seq,omitempty"` // Secuencia del evento en su stream
+	Flags   *EventFlags            `json:"flags,omitempty"`
+}
+
+// EventFlags flags opcionales de eventos DATA/STATUS
+type EventFlags struct {
+	Partial  *bool `json:"partial,omitempty"`  // Dato sintético o incompleto
+	Snapshot *bool `json:"snapshot,omitempty"` // Último valor conocido enviado al suscribirse (no es en vivo)
+	Replay   *bool `json:"replay,omitempty"`   // Re-enviado desde el histórico por un REPLAY (no es en vivo)
+	Rollup   *bool `json:"rollup,omitempty"`   // Ventana agregada de una suscripción con aggregate
 }
 
 // StatusInfo información de estado del stream
@@ -137,11 +204,12 @@ type StatusInfo struct {
 
 // StatusEventMessage evento de estado
 type StatusEventMessage struct {
-	Type    string     `json:"type"`   // "STATUS"
-	Version string     `json:"v"`      // Versión del protocolo
-	TS      int64      `json:"ts"`     // Timestamp Unix (ms)
-	Stream  StreamInfo `json:"stream"` // Información del stream
-	Status  StatusInfo `json:"status"` // Estado del stream
+	Type    string      `json:"type"`            // "STATUS"
+	Version string      `json:"v"`               // Versión del protocolo
+	TS      int64       `json:"ts"`              // Timestamp Unix (ms)
+	Stream  StreamInfo  `json:"stream"`          // Información del stream
+	Status  StatusInfo  `json:"status"`          // Estado del stream
+	Flags   *EventFlags `json:"flags,omitempty"` // Flags del evento
 }
 
 // Message estructura genérica para mensajes legacy
@@ -163,19 +231,27 @@ type Client struct {
 	Send     chan interface{} // Canal para mensajes salientes (puede ser DataEventMessage, StatusEventMessage, etc.)
 	Hub      *Hub
 
+	// Acceso del usuario autenticado
+	UserID      string
+	Permissions []domain.Capability
+	Scopes      []domain.Scope
+
 	// Estado de suscripción
 	mu                 sync.RWMutex
 	subscriptions      map[string]*ClientSubscription // key: subscription ID del router
 	includeStatus      bool                           // Si incluye eventos STATUS
-	throttleMs         int                            // Throttle en ms
 	lastStatusByKey    map[string]*StatusEventMessage // Para keep-latest policy en STATUS
 	deliveryTimes      []float64                      // Tiempos de delivery para P95
 	maxDeliverySamples int
+	cancelReplay       context.CancelFunc // Replay en curso (uno por cliente)
+	closed             bool               // Send cerrado por unregister
 }
 
 // ClientSubscription información de suscripción de un cliente
 type ClientSubscription struct {
 	RouterSubID   string
+	Stream        StreamFilter // Filtro tal como lo envió el cliente
+	FilterKey     string       // router.SubscriptionFilter.Key() del filtro
 	IncludeStatus bool
 	CreatedAt     time.Time
 }
@@ -196,6 +272,12 @@ type Hub struct {
 	// Router para suscripciones
 	router *router.Router
 
+	// Resolver de acceso (token → tenant, capabilities, scopes)
+	access *auth.AccessResolver
+
+	// Quotas por tenant (conexiones, streams, eventos por día)
+	quota *quota.Meter
+
 	// Clientes registrados (key: client ID)
 	clients map[string]*Client
 
@@ -225,6 +307,70 @@ func NewHub(r *router.Router) *Hub {
 	}
 }
 
+// SetAccessResolver configura la autenticación de conexiones.
+// Sin resolver todas las conexiones son rechazadas.
+func (h *Hub) SetAccessResolver(resolver *auth.AccessResolver) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.access = resolver
+}
+
+// SetQuotaMeter configura la aplicación de quotas por tenant.
+// Sin meter no se limitan conexiones, streams ni eventos.
+func (h *Hub) SetQuotaMeter(meter *quota.Meter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.quota = meter
+}
+
+// acquireQuota reserva una unidad de un recurso concurrente del tenant
+func (h *Hub) acquireQuota(tenantID primitive.ObjectID, resource string) error {
+	h.mu.RLock()
+	meter := h.quota
+	h.mu.RUnlock()
+
+	if meter == nil || tenantID.IsZero() {
+		return nil
+	}
+	return meter.Acquire(tenantID.Hex(), resource)
+}
+
+// releaseQuota libera una unidad reservada con acquireQuota
+func (h *Hub) releaseQuota(tenantID primitive.ObjectID, resource string, n int) {
+	h.mu.RLock()
+	meter := h.quota
+	h.mu.RUnlock()
+
+	if meter == nil || tenantID.IsZero() {
+		return
+	}
+	for i := 0; i < n; i++ {
+		meter.Release(tenantID.Hex(), resource)
+	}
+}
+
+// authorize autentica el request de upgrade. El token se lee del header
+// Authorization o del query param "token" (los navegadores no permiten headers en WS).
+func (h *Hub) authorize(r *http.Request) (*auth.Access, error) {
+	h.mu.RLock()
+	resolver := h.access
+	h.mu.RUnlock()
+
+	if resolver == nil {
+		return nil, auth.ErrNotInitialized
+	}
+
+	token, err := auth.TokenFromRequest(r)
+	if err != nil {
+		token = r.URL.Query().Get("token")
+		if token == "" {
+			return nil, auth.ErrMissingToken
+		}
+	}
+
+	return resolver.Resolve(token, r.URL.Query().Get("tenantId"))
+}
+
 // Run ejecuta el hub en un goroutine
 func (h *Hub) Run() {
 	// Configurar callback del router para recibir eventos
@@ -262,7 +408,7 @@ func (h *Hub) onRouterEvent(clientID string, event *connectors.CanonicalEvent) e
 	isStatus := false
 
 	// Verificar si es un evento STATUS (por Stream.Kind o flags)
-	if event.Envelope.Stream.Kind == "status" || event.Kind[:7] == "status." {
+	if isStatusEvent(event) {
 		isStatus = true
 
 		// Verificar si el cliente quiere eventos STATUS
@@ -291,6 +437,14 @@ func (h *Hub) onRouterEvent(clientID string, event *connectors.CanonicalEvent) e
 		h.stats.WSEventsStatusOutTotal++
 		h.mu.Unlock()
 	} else {
+		// Tenant sobre su quota diaria de eventos: se degrada a solo STATUS
+		h.mu.RLock()
+		meter := h.quota
+		h.mu.RUnlock()
+		if meter != nil && meter.Exceeded(event.Envelope.Stream.TenantID.Hex(), quota.ResourceEventsPerDay) {
+			return nil
+		}
+
 		// Evento DATA
 		dataMsg := h.canonicalToData(event)
 		message = dataMsg
@@ -300,9 +454,23 @@ func (h *Hub) onRouterEvent(clientID string, event *connectors.CanonicalEvent) e
 		h.mu.Unlock()
 	}
 
-	// Enviar mensaje al cliente (con backpressure)
+	// Enviar mensaje al cliente (con backpressure). Se envía bajo client.mu porque
+	// unregisterClient cierra Send y un replay cancelado puede seguir entregando eventos;
+	// las métricas se registran después de soltarlo (recordDeliveryTime toma h.mu).
+	client.mu.RLock()
+	if client.closed {
+		client.mu.RUnlock()
+		return nil
+	}
+	sent := false
 	select {
 	case client.Send <- message:
+		sent = true
+	default:
+	}
+	client.mu.RUnlock()
+
+	if sent {
 		// Registrar tiempo de delivery
 		deliveryMs := float64(time.Since(startTime).Microseconds()) / 1000.0
 		h.recordDeliveryTime(deliveryMs)
@@ -314,7 +482,7 @@ func (h *Hub) onRouterEvent(clientID string, event *connectors.CanonicalEvent) e
 		} else {
 			metrics.WSMessagesOutTotal.WithLabelValues(MessageTypeDATA).Inc()
 		}
-	default:
+	} else {
 		// Canal lleno - backpressure
 		if isStatus {
 			// Para STATUS, aplicar keep-latest: descartar el viejo que estaba en el canal
@@ -353,14 +521,30 @@ func (h *Hub) canonicalToData(event *connectors.CanonicalEvent) *DataEventMessag
 		TS:      event.Envelope.Timestamp.UnixMilli(),
 		Stream:  stream,
 		Payload: payload,
+		Seq:     event.Envelope.Sequence,
 	}
 
 	// Agregar flags si hay
-	if event.Envelope.Flags&connectors.EventFlagSynthetic != 0 {
+	if router.IsRollup(event) {
+		rollup := true
+		msg.Flags = &EventFlags{Rollup: &rollup}
+	} else if event.Envelope.Flags&(connectors.EventFlagSynthetic|connectors.EventFlagPartial) != 0 {
 		partial := true
-		msg.Flags = &struct {
-			Partial *bool `json:"partial,omitempty"`
-		}{Partial: &partial}
+		msg.Flags = &EventFlags{Partial: &partial}
+	}
+	if event.Envelope.Flags&connectors.EventFlagSnapshot != 0 {
+		if msg.Flags == nil {
+			msg.Flags = &EventFlags{}
+		}
+		snapshot := true
+		msg.Flags.Snapshot = &snapshot
+	}
+	if event.Envelope.Flags&connectors.EventFlagReplay != 0 {
+		if msg.Flags == nil {
+			msg.Flags = &EventFlags{}
+		}
+		replay := true
+		msg.Flags.Replay = &replay
 	}
 
 	return msg
@@ -412,13 +596,47 @@ func (h *Hub) canonicalToStatus(event *connectors.CanonicalEvent) *StatusEventMe
 		status.Notes = &notes
 	}
 
-	return &StatusEventMessage{
+	msg := &StatusEventMessage{
 		Type:    MessageTypeSTATUS,
 		Version: "1.0",
 		TS:      event.Envelope.Timestamp.UnixMilli(),
 		Stream:  stream,
 		Status:  status,
 	}
+
+	if event.Envelope.Flags&connectors.EventFlagSnapshot != 0 {
+		snapshot := true
+		msg.Flags = &EventFlags{Snapshot: &snapshot}
+	}
+
+	return msg
+}
+
+// isStatusEvent indica si un evento canónico es de tipo STATUS
+func isStatusEvent(event *connectors.CanonicalEvent) bool {
+	return event.Envelope.Stream.Kind == "status" || strings.HasPrefix(event.Kind, "status.")
+}
+
+// sendSnapshot envía al cliente los últimos valores conocidos (DATA/STATUS marcados como snapshot)
+func (h *Hub) sendSnapshot(client *Client, events []*connectors.CanonicalEvent) {
+	for _, event := range events {
+		var message interface{}
+		msgType := MessageTypeDATA
+		if isStatusEvent(event) {
+			message = h.canonicalToStatus(event)
+			msgType = MessageTypeSTATUS
+		} else {
+			message = h.canonicalToData(event)
+		}
+
+		select {
+		case client.Send <- message:
+			metrics.WSMessagesOutTotal.WithLabelValues(msgType).Inc()
+		default:
+			metrics.WSEventBackpressureTotal.WithLabelValues(msgType).Inc()
+			log.Printf("WebSocket congestion for client %s, snapshot %s dropped", client.ID, msgType)
+		}
+	}
 }
 
 // makeStreamKey crea una clave para identificar un stream
@@ -452,14 +670,30 @@ func (h *Hub) unregisterClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if _, ok := h.clients[client.ID]; ok {
-		// Desuscribir del router
+	// Solo si sigue siendo el cliente registrado con ese ID
+	if current, ok := h.clients[client.ID]; ok && current == client {
+		// Desuscribir del router y cancelar el replay en curso
 		client.mu.Lock()
 		for subID := range client.subscriptions {
 			h.router.Unsubscribe(subID)
 		}
+		streams := len(client.subscriptions)
+		if client.cancelReplay != nil {
+			client.cancelReplay()
+		}
+		client.closed = true
 		client.mu.Unlock()
 
+		h.router.UnregisterClient(client.ID)
+
+		// Liberar quotas (h.mu ya está tomado: se usa el meter directamente)
+		if h.quota != nil && !client.TenantID.IsZero() {
+			for i := 0; i < streams; i++ {
+				h.quota.Release(client.TenantID.Hex(), quota.ResourceStreams)
+			}
+			h.quota.Release(client.TenantID.Hex(), quota.ResourceConcurrentConnections)
+		}
+
 		delete(h.clients, client.ID)
 		close(client.Send)
 		h.stats.ConnectionsActive--
@@ -594,6 +828,10 @@ func (c *Client) readPump() {
 			c.handleSubscribe(rawMsg)
 		case MessageTypeUNSUB:
 			c.handleUnsubscribe(rawMsg)
+		case MessageTypeLIST:
+			c.handleList()
+		case MessageTypeREPLAY:
+			c.handleReplay(rawMsg)
 		case MessageTypePING:
 			c.Send <- PongMessage{Type: MessageTypePONG}
 		case MessageTypeChat, MessageTypeNotification:
@@ -618,42 +856,59 @@ func (c *Client) handleSubscribe(rawMsg map[string]interface{}) {
 		return
 	}
 
+	// Validar que todos los streams estén dentro de los scopes del usuario
+	for _, streamFilter := range subMsg.Streams {
+		if !c.canSubscribe(streamFilter) {
+			c.sendError("FORBIDDEN", "Stream outside of allowed scope: kind="+streamFilter.Kind+" siteId="+streamFilter.SiteID)
+			return
+		}
+		if err := validateStreamFilter(streamFilter); err != nil {
+			c.sendError("INVALID_SUB", err.Error())
+			return
+		}
+	}
+
+	// Throttle propio de las suscripciones de este SUB (nil: el del cliente)
+	throttle, err := c.subscriptionThrottle(subMsg)
+	if err != nil {
+		c.sendError("INVALID_SUB", "Invalid throttle: "+err.Error())
+		return
+	}
+
 	// Guardar configuración de suscripción
 	c.mu.Lock()
 	if subMsg.IncludeStatus != nil {
 		c.includeStatus = *subMsg.IncludeStatus
 	}
-	if subMsg.ThrottleMs != nil {
-		c.throttleMs = *subMsg.ThrottleMs
-	}
 	c.mu.Unlock()
 
+	needSnapshot := subMsg.NeedSnapshot != nil && *subMsg.NeedSnapshot
+	var snapshot []*connectors.CanonicalEvent
+	seen := make(map[string]bool)
+	subscribed := make([]SubscriptionInfo, 0, len(subMsg.Streams))
+
 	// Crear suscripciones en el router por cada stream
 	for _, streamFilter := range subMsg.Streams {
-		// Convertir StreamFilter a SubscriptionFilter del router
-		filter := router.SubscriptionFilter{
-			TenantID: &c.TenantID,
-		}
+		filter := c.routerFilter(streamFilter)
+		filterKey := filter.Key()
 
-		// Mapear Kind
-		if streamFilter.Kind != "" {
-			kind := domain.StreamKind(streamFilter.Kind)
-			filter.Kind = &kind
-		}
+		// Re-SUB de un filtro ya suscrito: se reutiliza la suscripción (sin consumir quota)
+		existing := c.findSubscription(filterKey) != nil
 
-		// Mapear SiteID
-		if streamFilter.SiteID != "" {
-			filter.SiteID = &streamFilter.SiteID
-		}
-
-		// Mapear CageID
-		if streamFilter.CageID != nil {
-			filter.CageID = streamFilter.CageID
+		// Cada suscripción nueva consume una unidad de la quota de streams del tenant
+		if !existing {
+			if err := c.Hub.acquireQuota(c.TenantID, quota.ResourceStreams); err != nil {
+				c.sendError(quota.ErrorCode, err.Error())
+				break
+			}
 		}
 
-		// Suscribir en el router
+		// Suscribir en el router (idempotente por cliente y filtro)
 		sub, err := c.Hub.router.Subscribe(c.ID, filter)
 		if err != nil {
+			if !existing {
+				c.Hub.releaseQuota(c.TenantID, quota.ResourceStreams, 1)
+			}
 			c.sendError("SUB_FAILED", "Failed to subscribe: "+err.Error())
 			continue
 		}
@@ -663,17 +918,62 @@ func (c *Client) handleSubscribe(rawMsg map[string]interface{}) {
 			sub.IncludeStatus = true
 		}
 
+		// Aplicar el throttle; un re-SUB sin parámetros de throttle conserva el actual
+		var effective router.ThrottleConfig
+		if throttle != nil || !existing {
+			effective, err = c.Hub.router.SetSubscriptionThrottle(sub.ID, throttle)
+		} else {
+			effective, err = c.Hub.router.SubscriptionThrottle(c.ID, sub.ID)
+		}
+		if err != nil {
+			log.Printf("Throttle de suscripción %s no aplicado: %v", sub.ID, err)
+		}
+
 		// Guardar suscripción
 		c.mu.Lock()
 		if c.subscriptions == nil {
 			c.subscriptions = make(map[string]*ClientSubscription)
 		}
-		c.subscriptions[sub.ID] = &ClientSubscription{
-			RouterSubID:   sub.ID,
-			IncludeStatus: c.includeStatus,
-			CreatedAt:     time.Now(),
+		clientSub, ok := c.subscriptions[sub.ID]
+		if !ok {
+			clientSub = &ClientSubscription{
+				RouterSubID: sub.ID,
+				Stream:      streamFilter,
+				FilterKey:   filterKey,
+				CreatedAt:   time.Now(),
+			}
+			c.subscriptions[sub.ID] = clientSub
 		}
+		clientSub.IncludeStatus = c.includeStatus
+		includeStatus := c.includeStatus
+		subscribed = append(subscribed, SubscriptionInfo{
+			ID:            sub.ID,
+			Stream:        clientSub.Stream,
+			IncludeStatus: includeStatus,
+			Throttle:      &effective,
+			Existing:      ok,
+			CreatedAt:     clientSub.CreatedAt.UnixMilli(),
+		})
 		c.mu.Unlock()
+
+		// Últimos valores del stream (sin duplicar entre filtros superpuestos)
+		if needSnapshot {
+			for _, event := range c.Hub.router.Snapshot(c.ID, filter, includeStatus) {
+				key := event.Envelope.Stream.String() + "|" + event.Kind
+				if !seen[key] {
+					seen[key] = true
+					snapshot = append(snapshot, event)
+				}
+			}
+		}
+	}
+
+	// Cursores de reanudación dentro del scope del usuario
+	var resume []StreamCursor
+	for _, cursor := range subMsg.Resume {
+		if c.canSubscribe(StreamFilter{Kind: cursor.Kind, SiteID: cursor.SiteID, CageID: cursor.CageID}) {
+			resume = append(resume, cursor)
+		}
 	}
 
 	// Enviar ACK
@@ -682,26 +982,368 @@ func (c *Client) handleSubscribe(rawMsg map[string]interface{}) {
 		Message: "Subscribed successfully",
 		Data: map[string]interface{}{
 			"streams":        len(subMsg.Streams),
+			"subscriptions":  subscribed,
 			"include_status": c.includeStatus,
+			"snapshot":       len(snapshot),
+			"resume":         len(resume),
+		},
+	}
+
+	// Enviar snapshot después del ACK
+	if needSnapshot {
+		c.Hub.sendSnapshot(c, snapshot)
+	}
+
+	// Re-enviar lo que el cliente no recibió mientras estaba desconectado
+	if len(resume) > 0 {
+		c.startReplay("Resume completed", func(ctx context.Context) (router.ReplayResult, error) {
+			var total router.ReplayResult
+			for _, cursor := range resume {
+				stream := domain.StreamKey{
+					TenantID: c.TenantID,
+					Kind:     domain.StreamKind(cursor.Kind),
+					SiteID:   cursor.SiteID,
+					CageID:   cursor.CageID,
+				}
+				result, err := c.Hub.router.Resume(ctx, c.ID, stream, cursor.Seq)
+				total.Read += result.Read
+				total.Delivered += result.Delivered
+				total.Skipped += result.Skipped
+				total.Failed += result.Failed
+				if err != nil {
+					return total, err
+				}
+			}
+			return total, nil
+		})
+	}
+}
+
+// subscriptionThrottle construye el throttle de las suscripciones de un SUB a partir del
+// throttle del cliente y los parámetros enviados. Retorna nil si el SUB no trae ninguno.
+func (c *Client) subscriptionThrottle(subMsg SubMessage) (*router.ThrottleConfig, error) {
+	if subMsg.ThrottleMs == nil && subMsg.MaxRate == nil && subMsg.Coalesce == nil &&
+		subMsg.KeepLatest == nil && subMsg.BufferSize == nil {
+		return nil, nil
+	}
+
+	config := router.DefaultThrottleConfig()
+	if client, err := c.Hub.router.GetClient(c.ID); err == nil {
+		config = client.ThrottleConfig
+	}
+
+	if subMsg.ThrottleMs != nil {
+		config.ThrottleMs = *subMsg.ThrottleMs
+	}
+	if subMsg.MaxRate != nil {
+		config.MaxRate = *subMsg.MaxRate
+		if config.MaxRate == 0 {
+			// Sin rate no se rellena el token bucket
+			config.BurstSize = 0
+		}
+	}
+	if subMsg.Coalesce != nil {
+		config.CoalescingEnabled = *subMsg.Coalesce
+	}
+	if subMsg.KeepLatest != nil {
+		config.KeepLatest = *subMsg.KeepLatest
+	}
+	if subMsg.BufferSize != nil {
+		config.BufferSize = *subMsg.BufferSize
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// routerFilter convierte un StreamFilter en un SubscriptionFilter del router
+func (c *Client) routerFilter(streamFilter StreamFilter) router.SubscriptionFilter {
+	filter := router.SubscriptionFilter{
+		TenantID: &c.TenantID,
+	}
+
+	// Mapear Kind
+	if streamFilter.Kind != "" {
+		kind := domain.StreamKind(streamFilter.Kind)
+		filter.Kind = &kind
+	}
+
+	// Mapear SiteID
+	if streamFilter.SiteID != "" {
+		siteID := streamFilter.SiteID
+		filter.SiteID = &siteID
+	}
+
+	// Mapear CageID
+	if streamFilter.CageID != nil {
+		filter.CageID = streamFilter.CageID
+	}
+
+	// Mapear métrica, tags y predicado (validados con validateStreamFilter)
+	if streamFilter.Metric != nil && *streamFilter.Metric != "" {
+		filter.Metrics = []string{*streamFilter.Metric}
+	}
+	if len(streamFilter.Tags) > 0 {
+		filter.Tags = streamFilter.Tags
+	}
+	filter.Where = streamFilter.Where
+	if streamFilter.Aggregate != nil {
+		filter.Aggregate, _ = streamFilter.Aggregate.spec()
+	}
+	filter.Compile()
+
+	return filter
+}
+
+// validateStreamFilter valida el predicado Where y la agregación de un filtro
+func validateStreamFilter(streamFilter StreamFilter) error {
+	if strings.TrimSpace(streamFilter.Where) != "" {
+		if _, err := router.ParsePredicate(streamFilter.Where); err != nil {
+			return fmt.Errorf("invalid where for kind=%s siteId=%s: %w", streamFilter.Kind, streamFilter.SiteID, err)
+		}
+	}
+	if streamFilter.Aggregate != nil {
+		if _, err := streamFilter.Aggregate.spec(); err != nil {
+			return fmt.Errorf("invalid aggregate for kind=%s siteId=%s: %w", streamFilter.Kind, streamFilter.SiteID, err)
+		}
+	}
+	return nil
+}
+
+// spec convierte la agregación pedida en un AggregateSpec del router
+func (a *AggregateRequest) spec() (*router.AggregateSpec, error) {
+	return router.ParseAggregateSpec(a.Window, a.Slide, a.Fields, a.Functions, a.GroupBy)
+}
+
+// handleReplay re-envía los eventos históricos de un rango. Los eventos llegan como DATA
+// con flags.replay y en orden cronológico; al terminar se envía un ACK con el resumen.
+// Un nuevo REPLAY cancela el anterior.
+func (c *Client) handleReplay(rawMsg map[string]interface{}) {
+	var replayMsg ReplayMessage
+	rawBytes, _ := json.Marshal(rawMsg)
+	if err := json.Unmarshal(rawBytes, &replayMsg); err != nil {
+		c.sendError("INVALID_REPLAY", "Invalid REPLAY message format")
+		return
+	}
+
+	from := time.UnixMilli(replayMsg.From)
+	to := time.Now()
+	if replayMsg.To != nil {
+		to = time.UnixMilli(*replayMsg.To)
+	}
+	if replayMsg.From <= 0 || !to.After(from) {
+		c.sendError("INVALID_REPLAY", "from must be before to")
+		return
+	}
+	if to.Sub(from) > MaxReplayRange {
+		c.sendError("INVALID_REPLAY", "Replay range too large (max "+MaxReplayRange.String()+")")
+		return
+	}
+
+	query := router.ReplayQuery{From: from, To: to}
+	for _, streamFilter := range replayMsg.Streams {
+		if !c.canSubscribe(streamFilter) {
+			c.sendError("FORBIDDEN", "Stream outside of allowed scope: kind="+streamFilter.Kind+" siteId="+streamFilter.SiteID)
+			return
+		}
+		if err := validateStreamFilter(streamFilter); err != nil {
+			c.sendError("INVALID_REPLAY", err.Error())
+			return
+		}
+		if streamFilter.Aggregate != nil {
+			c.sendError("INVALID_REPLAY", "aggregate is not supported in REPLAY")
+			return
+		}
+		query.Filters = append(query.Filters, c.routerFilter(streamFilter))
+	}
+	if len(query.Filters) == 0 {
+		c.sendError("INVALID_REPLAY", "At least one stream is required")
+		return
+	}
+
+	c.Send <- AckMessage{
+		Type:    MessageTypeACK,
+		Message: "Replay started",
+		Data: map[string]interface{}{
+			"streams": len(query.Filters),
+			"from":    from.UnixMilli(),
+			"to":      to.UnixMilli(),
 		},
 	}
+
+	c.startReplay("Replay completed", func(ctx context.Context) (router.ReplayResult, error) {
+		return c.Hub.router.Replay(ctx, c.ID, query)
+	})
 }
 
-// handleUnsubscribe maneja cancelación de suscripciones
+// startReplay ejecuta un replay en background (cancelando el anterior) y al terminar
+// envía un ACK con el resumen o un ERROR REPLAY_FAILED
+func (c *Client) startReplay(completed string, run func(ctx context.Context) (router.ReplayResult, error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mu.Lock()
+	if c.cancelReplay != nil {
+		c.cancelReplay()
+	}
+	c.cancelReplay = cancel
+	c.mu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		result, err := run(ctx)
+		if ctx.Err() != nil {
+			return // Cancelado por otro REPLAY o por desconexión
+		}
+
+		var message interface{} = AckMessage{
+			Type:    MessageTypeACK,
+			Message: completed,
+			Data:    result,
+		}
+		if err != nil {
+			message = ErrorMessage{Type: MessageTypeERROR, Code: "REPLAY_FAILED", Message: err.Error()}
+		}
+
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if !c.closed {
+			select {
+			case c.Send <- message:
+			default:
+				log.Printf("WebSocket congestion for client %s, replay result dropped", c.ID)
+			}
+		}
+	}()
+}
+
+// canSubscribe verifica un filtro de stream contra los scopes del cliente
+func (c *Client) canSubscribe(streamFilter StreamFilter) bool {
+	streamKey := domain.StreamKey{Kind: domain.StreamKind(streamFilter.Kind)}
+	cageID := ""
+	if streamFilter.CageID != nil {
+		cageID = *streamFilter.CageID
+	}
+
+	return domain.CanSubscribe(c.Scopes, c.Permissions, streamKey.GetCapabilityRequired(), c.TenantID, streamFilter.SiteID, cageID)
+}
+
+// handleUnsubscribe maneja cancelación de suscripciones: las indicadas por ID o por
+// filtro, o todas si el mensaje no indica ninguna
 func (c *Client) handleUnsubscribe(rawMsg map[string]interface{}) {
+	var unsubMsg UnsubMessage
+	rawBytes, _ := json.Marshal(rawMsg)
+	if err := json.Unmarshal(rawBytes, &unsubMsg); err != nil {
+		c.sendError("INVALID_UNSUB", "Invalid UNSUB message format")
+		return
+	}
+
+	filterKeys := make(map[string]bool, len(unsubMsg.Streams))
+	for _, streamFilter := range unsubMsg.Streams {
+		filter := c.routerFilter(streamFilter)
+		filterKeys[filter.Key()] = true
+	}
+	all := len(unsubMsg.Subscriptions) == 0 && len(unsubMsg.Streams) == 0
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	selected := make(map[string]bool)
+	notFound := make([]string, 0)
+	for _, subID := range unsubMsg.Subscriptions {
+		if _, ok := c.subscriptions[subID]; ok {
+			selected[subID] = true
+		} else {
+			notFound = append(notFound, subID)
+		}
+	}
+	for subID, sub := range c.subscriptions {
+		if all || filterKeys[sub.FilterKey] {
+			selected[subID] = true
+		}
+	}
 
-	// Desuscribir todas las suscripciones
-	for subID := range c.subscriptions {
+	removed := make([]string, 0, len(selected))
+	for subID := range selected {
 		c.Hub.router.Unsubscribe(subID)
 		delete(c.subscriptions, subID)
+		removed = append(removed, subID)
 	}
+	remaining := len(c.subscriptions)
+	c.mu.Unlock()
+
+	// Fuera de c.mu: el hub toma h.mu antes que c.mu al desregistrar
+	c.Hub.releaseQuota(c.TenantID, quota.ResourceStreams, len(removed))
 
+	sort.Strings(removed)
 	c.Send <- AckMessage{
 		Type:    MessageTypeACK,
 		Message: "Unsubscribed successfully",
+		Data: map[string]interface{}{
+			"unsubscribed": removed,
+			"not_found":    notFound,
+			"remaining":    remaining,
+		},
+	}
+}
+
+// handleList responde con las suscripciones activas del cliente y sus estadísticas del router
+func (c *Client) handleList() {
+	stats := make(map[string]router.Subscription)
+	for _, sub := range c.Hub.router.Subscriptions(c.ID) {
+		stats[sub.ID] = sub
+	}
+
+	c.mu.RLock()
+	subscriptions := make([]SubscriptionInfo, 0, len(c.subscriptions))
+	for subID, clientSub := range c.subscriptions {
+		info := SubscriptionInfo{
+			ID:            subID,
+			Stream:        clientSub.Stream,
+			IncludeStatus: clientSub.IncludeStatus,
+			CreatedAt:     clientSub.CreatedAt.UnixMilli(),
+		}
+		if throttle, err := c.Hub.router.SubscriptionThrottle(c.ID, subID); err == nil {
+			info.Throttle = &throttle
+		}
+		if sub, ok := stats[subID]; ok {
+			info.EventCount = sub.EventCount
+			if sub.LastEvent != nil {
+				lastEvent := sub.LastEvent.UnixMilli()
+				info.LastEvent = &lastEvent
+			}
+		}
+		subscriptions = append(subscriptions, info)
 	}
+	c.mu.RUnlock()
+
+	// Orden de creación para que la lista sea estable
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].CreatedAt != subscriptions[j].CreatedAt {
+			return subscriptions[i].CreatedAt < subscriptions[j].CreatedAt
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+
+	c.Send <- AckMessage{
+		Type:    MessageTypeACK,
+		Message: "Active subscriptions",
+		Data: map[string]interface{}{
+			"subscriptions": subscriptions,
+		},
+	}
+}
+
+// findSubscription busca la suscripción del cliente con la misma key de filtro
+func (c *Client) findSubscription(filterKey string) *ClientSubscription {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, sub := range c.subscriptions {
+		if sub.FilterKey == filterKey {
+			return sub
+		}
+	}
+	return nil
 }
 
 // sendError envía un mensaje de error al cliente
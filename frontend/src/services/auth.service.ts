@@ -19,6 +19,8 @@ export interface LoginResponse {
   message: string
   data: {
     token: string
+    refresh_token?: string
+    expires_at?: string
     user: User
   }
 }
@@ -29,15 +31,27 @@ class AuthService {
 
     if (response.data.success && response.data.data.token) {
       localStorage.setItem('token', response.data.data.token)
+      if (response.data.data.refresh_token) {
+        localStorage.setItem('refresh_token', response.data.data.refresh_token)
+      }
       localStorage.setItem('user', JSON.stringify(response.data.data.user))
     }
 
     return response.data
   }
 
-  logout(): void {
-    localStorage.removeItem('token')
-    localStorage.removeItem('user')
+  async logout(): Promise<void> {
+    try {
+      if (this.getToken()) {
+        await api.post('/api/auth/logout')
+      }
+    } catch {
+      // La sesión local se limpia aunque el backend no responda
+    } finally {
+      localStorage.removeItem('token')
+      localStorage.removeItem('refresh_token')
+      localStorage.removeItem('user')
+    }
   }
 
   getCurrentUser(): User | null {